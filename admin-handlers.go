@@ -0,0 +1,543 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	mux "github.com/gorilla/mux"
+)
+
+// ListUsersResponse - format for list users response.
+type ListUsersResponse struct {
+	Users []string `json:"users"`
+}
+
+// UserInfoResponse - format for get user response, secret key is
+// never sent back.
+type UserInfoResponse struct {
+	AccessKey string   `json:"accessKey"`
+	Status    string   `json:"status"`
+	Policies  []string `json:"policies"`
+}
+
+// ListGroupsResponse - format for list groups response.
+type ListGroupsResponse struct {
+	Groups []string `json:"groups"`
+}
+
+// GroupInfoResponse - format for get group response.
+type GroupInfoResponse struct {
+	Name     string   `json:"name"`
+	Members  []string `json:"members"`
+	Policies []string `json:"policies"`
+}
+
+// ListPoliciesResponse - format for list policies response.
+type ListPoliciesResponse struct {
+	Policies []string `json:"policies"`
+}
+
+// isAdminReqAuthenticated - admin API is only available to requests
+// signed with the server credential.
+func isAdminReqAuthenticated(r *http.Request) APIErrorCode {
+	switch getRequestAuthType(r) {
+	case authTypePresigned, authTypeSigned:
+		if s3Error := isReqAuthenticated(r); s3Error != ErrNone {
+			return s3Error
+		}
+		accessKey, s3Error := getRequestAccessKey(r)
+		if s3Error != ErrNone {
+			return s3Error
+		}
+		if accessKey != serverConfig.GetCredential().AccessKeyID {
+			return ErrAccessDenied
+		}
+		return ErrNone
+	}
+	// For all other auth types return error.
+	return ErrAccessDenied
+}
+
+// toAdminAPIErrorCode - converts iam config errors to api error codes.
+func toAdminAPIErrorCode(err error) APIErrorCode {
+	switch err {
+	case errInvalidArgument, errInvalidUserStatus, errReservedAccessKey:
+		return ErrAdminInvalidArgument
+	case errNoSuchUser:
+		return ErrAdminNoSuchUser
+	case errNoSuchGroup:
+		return ErrAdminNoSuchGroup
+	case errNoSuchPolicy:
+		return ErrAdminNoSuchPolicy
+	case errPolicyInUse:
+		return ErrAdminPolicyInUse
+	case errHealInProgress:
+		return ErrAdminHealInProgress
+	case errNoSuchHeal:
+		return ErrAdminNoSuchHeal
+	}
+	errorIf(err, "Admin request failed.", nil)
+	return ErrInternalError
+}
+
+// writeAdminResponse - writes response in JSON format.
+func writeAdminResponse(w http.ResponseWriter, response interface{}) {
+	encodedResponse, err := json.Marshal(response)
+	if err != nil {
+		errorIf(err, "Unable to encode admin response.", nil)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeSuccessResponse(w, encodedResponse)
+}
+
+// readAdminRequestBody - reads request body up to maxAccessPolicySize.
+func readAdminRequestBody(r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r.Body, maxAccessPolicySize))
+}
+
+// ListUsersHandler - GET /minio/admin/v1/users
+// ----------
+// Lists access keys of all the users.
+func (api adminAPIHandlers) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, ListUsersResponse{Users: iamConfig.ListUsers()})
+}
+
+// GetUserHandler - GET /minio/admin/v1/users/{accessKey}
+// ----------
+// Returns status and attached policies of a user.
+func (api adminAPIHandlers) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	accessKey := mux.Vars(r)["accessKey"]
+	user, err := iamConfig.GetUser(accessKey)
+	if err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, UserInfoResponse{
+		AccessKey: accessKey,
+		Status:    user.Status,
+		Policies:  user.Policies,
+	})
+}
+
+// SetUserHandler - PUT /minio/admin/v1/users/{accessKey}
+// ----------
+// Adds a new user or replaces an existing one, request body carries
+// the secret key, status and attached policies in JSON format.
+func (api adminAPIHandlers) SetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	userBuf, err := readAdminRequestBody(r)
+	if err != nil {
+		errorIf(err, "Reading user failed.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	user := iamUser{}
+	if err = json.Unmarshal(userBuf, &user); err != nil {
+		writeErrorResponse(w, r, ErrAdminInvalidArgument, r.URL.Path)
+		return
+	}
+	if err = iamConfig.SetUser(mux.Vars(r)["accessKey"], user); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// DeleteUserHandler - DELETE /minio/admin/v1/users/{accessKey}
+// ----------
+// Removes a user and its group memberships.
+func (api adminAPIHandlers) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if err := iamConfig.DeleteUser(mux.Vars(r)["accessKey"]); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ListGroupsHandler - GET /minio/admin/v1/groups
+// ----------
+// Lists names of all the groups.
+func (api adminAPIHandlers) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, ListGroupsResponse{Groups: iamConfig.ListGroups()})
+}
+
+// GetGroupHandler - GET /minio/admin/v1/groups/{group}
+// ----------
+// Returns members and attached policies of a group.
+func (api adminAPIHandlers) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	groupName := mux.Vars(r)["group"]
+	group, err := iamConfig.GetGroup(groupName)
+	if err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, GroupInfoResponse{
+		Name:     groupName,
+		Members:  group.Members,
+		Policies: group.Policies,
+	})
+}
+
+// SetGroupHandler - PUT /minio/admin/v1/groups/{group}
+// ----------
+// Adds a new group or replaces an existing one, request body carries
+// the members and attached policies in JSON format.
+func (api adminAPIHandlers) SetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	groupBuf, err := readAdminRequestBody(r)
+	if err != nil {
+		errorIf(err, "Reading group failed.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	group := iamGroup{}
+	if err = json.Unmarshal(groupBuf, &group); err != nil {
+		writeErrorResponse(w, r, ErrAdminInvalidArgument, r.URL.Path)
+		return
+	}
+	if err = iamConfig.SetGroup(mux.Vars(r)["group"], group); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// DeleteGroupHandler - DELETE /minio/admin/v1/groups/{group}
+// ----------
+// Removes a group, its members are left untouched.
+func (api adminAPIHandlers) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if err := iamConfig.DeleteGroup(mux.Vars(r)["group"]); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ListPoliciesHandler - GET /minio/admin/v1/policies
+// ----------
+// Lists names of all the policies.
+func (api adminAPIHandlers) ListPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, ListPoliciesResponse{Policies: iamConfig.ListPolicies()})
+}
+
+// GetPolicyHandler - GET /minio/admin/v1/policies/{policy}
+// ----------
+// Returns the policy document.
+func (api adminAPIHandlers) GetPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	policy, err := iamConfig.GetPolicy(mux.Vars(r)["policy"])
+	if err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, policy)
+}
+
+// SetPolicyHandler - PUT /minio/admin/v1/policies/{policy}
+// ----------
+// Adds a new policy or replaces an existing one, request body is the
+// policy document which follows the bucket policy grammar.
+func (api adminAPIHandlers) SetPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	policyBuf, err := readAdminRequestBody(r)
+	if err != nil {
+		errorIf(err, "Reading policy failed.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	policy, err := parseIAMPolicy(policyBuf)
+	if err != nil {
+		errorIf(err, "Unable to parse user policy.", nil)
+		writeErrorResponse(w, r, ErrInvalidPolicyDocument, r.URL.Path)
+		return
+	}
+	if err = iamConfig.SetPolicy(mux.Vars(r)["policy"], policy); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// DeletePolicyHandler - DELETE /minio/admin/v1/policies/{policy}
+// ----------
+// Removes a policy, policies still attached to users or groups
+// cannot be removed.
+func (api adminAPIHandlers) DeletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if err := iamConfig.DeletePolicy(mux.Vars(r)["policy"]); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ServerStatusHandler - GET /minio/admin/v1/status
+// ----------
+// Returns server version, uptime, backend type, quorum settings and
+// status of all the disks.
+func (api adminAPIHandlers) ServerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, getServerStatus(api.ObjectAPI))
+}
+
+// GetRateLimitHandler - GET /minio/admin/v1/config/ratelimit
+// ----------
+// Returns request rate and bandwidth limits.
+func (api adminAPIHandlers) GetRateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, serverConfig.GetRateLimit())
+}
+
+// SetRateLimitHandler - PUT /minio/admin/v1/config/ratelimit
+// ----------
+// Replaces request rate and bandwidth limits in server config, new
+// limits are applied to the incoming requests right away.
+func (api adminAPIHandlers) SetRateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	rateLimitBuf, err := readAdminRequestBody(r)
+	if err != nil {
+		errorIf(err, "Reading rate limits failed.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	rateLimit := rateLimitConfig{}
+	if err = json.Unmarshal(rateLimitBuf, &rateLimit); err != nil || !rateLimit.isValid() {
+		writeErrorResponse(w, r, ErrAdminInvalidArgument, r.URL.Path)
+		return
+	}
+	serverConfig.SetRateLimit(rateLimit)
+	if err = serverConfig.Save(); err != nil {
+		errorIf(err, "Saving rate limits failed.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ListHealsHandler - GET /minio/admin/v1/heal
+// ----------
+// Lists status of all the heal operations.
+func (api adminAPIHandlers) ListHealsHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, ListHealResponse{Heals: api.HealOps.List()})
+}
+
+// GetHealStatusHandler - GET /minio/admin/v1/heal/{bucket}?prefix=
+// ----------
+// Returns status of the heal operation on a bucket or prefix.
+func (api adminAPIHandlers) GetHealStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	bucket := mux.Vars(r)["bucket"]
+	prefix := r.URL.Query().Get("prefix")
+	status, err := api.HealOps.Status(bucket, prefix)
+	if err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, status)
+}
+
+// StartHealHandler - POST /minio/admin/v1/heal/{bucket}?prefix=
+// ----------
+// Starts healing all the objects of a bucket or prefix in background,
+// only supported on XL backend.
+func (api adminAPIHandlers) StartHealHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	sets, ok := getXLSets(api.ObjectAPI)
+	if !ok {
+		writeErrorResponse(w, r, ErrAdminHealNotSupported, r.URL.Path)
+		return
+	}
+	bucket := mux.Vars(r)["bucket"]
+	prefix := r.URL.Query().Get("prefix")
+	if !IsValidObjectPrefix(prefix) {
+		writeErrorResponse(w, r, ErrAdminInvalidArgument, r.URL.Path)
+		return
+	}
+	if _, err := api.ObjectAPI.GetBucketInfo(bucket); err != nil {
+		errorIf(err, "GetBucketInfo failed.", nil)
+		switch err.(type) {
+		case BucketNameInvalid:
+			writeErrorResponse(w, r, ErrInvalidBucketName, r.URL.Path)
+		case BucketNotFound:
+			writeErrorResponse(w, r, ErrNoSuchBucket, r.URL.Path)
+		default:
+			writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		}
+		return
+	}
+	if err := api.HealOps.Start(sets, bucket, prefix); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	status, _ := api.HealOps.Status(bucket, prefix)
+	writeAdminResponse(w, status)
+}
+
+// StopHealHandler - DELETE /minio/admin/v1/heal/{bucket}?prefix=
+// ----------
+// Stops the heal operation running on a bucket or prefix.
+func (api adminAPIHandlers) StopHealHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	bucket := mux.Vars(r)["bucket"]
+	prefix := r.URL.Query().Get("prefix")
+	if err := api.HealOps.Stop(bucket, prefix); err != nil {
+		writeErrorResponse(w, r, toAdminAPIErrorCode(err), r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// GetHealScannerStatusHandler - GET /minio/admin/v1/heal-scanner
+// ----------
+// Returns progress of the background heal scanner, only available on
+// XL backend.
+func (api adminAPIHandlers) GetHealScannerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if globalHealScanner == nil {
+		writeErrorResponse(w, r, ErrAdminHealNotSupported, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, globalHealScanner.Status())
+}
+
+// SuspendHealScannerHandler - PUT /minio/admin/v1/heal-scanner/suspend
+// ----------
+// Suspends all the background tasks including the heal scanner.
+func (api adminAPIHandlers) SuspendHealScannerHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if globalHealScanner == nil {
+		writeErrorResponse(w, r, ErrAdminHealNotSupported, r.URL.Path)
+		return
+	}
+	if !globalTaskCtl.Suspend() {
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ResumeHealScannerHandler - PUT /minio/admin/v1/heal-scanner/resume
+// ----------
+// Resumes all the suspended background tasks.
+func (api adminAPIHandlers) ResumeHealScannerHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if globalHealScanner == nil {
+		writeErrorResponse(w, r, ErrAdminHealNotSupported, r.URL.Path)
+		return
+	}
+	if !globalTaskCtl.Resume() {
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	writeSuccessNoContent(w)
+}
+
+// ListDiskHealsHandler - GET /minio/admin/v1/heal-disks
+// ----------
+// Returns progress of healing replaced disks, only available on XL
+// backend.
+func (api adminAPIHandlers) ListDiskHealsHandler(w http.ResponseWriter, r *http.Request) {
+	if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+	if globalDiskHealer == nil {
+		writeErrorResponse(w, r, ErrAdminHealNotSupported, r.URL.Path)
+		return
+	}
+	writeAdminResponse(w, globalDiskHealer.Status())
+}
@@ -0,0 +1,235 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Heal operation errors.
+var (
+	errHealInProgress = errors.New("Heal operation is already running")
+	errNoSuchHeal     = errors.New("Heal operation does not exist")
+	errHealStopped    = errors.New("Heal operation was stopped")
+)
+
+// Heal operation states.
+const (
+	healRunning  = "running"
+	healStopped  = "stopped"
+	healFinished = "finished"
+	healFailed   = "failed"
+)
+
+// healListLimit - number of files listed at a time while healing.
+const healListLimit = 1000
+
+// HealStatus - status of a heal operation on a bucket or prefix.
+type HealStatus struct {
+	Bucket         string    `json:"bucket"`
+	Prefix         string    `json:"prefix"`
+	State          string    `json:"state"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"endTime"`
+	ObjectsScanned int64     `json:"objectsScanned"`
+	ObjectsFailed  int64     `json:"objectsFailed"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// ListHealResponse - format for list heal operations response.
+type ListHealResponse struct {
+	Heals []HealStatus `json:"heals"`
+}
+
+// healOperation - a heal operation along with its stop channel.
+type healOperation struct {
+	status HealStatus
+	stopCh chan struct{}
+}
+
+// healOperations - keeps track of heal operations started through
+// admin API, only one operation may run on a bucket and prefix.
+type healOperations struct {
+	mutex *sync.Mutex
+	ops   map[string]*healOperation
+}
+
+// newHealOperations - initialize heal operations.
+func newHealOperations() *healOperations {
+	return &healOperations{
+		mutex: &sync.Mutex{},
+		ops:   make(map[string]*healOperation),
+	}
+}
+
+// healOpKey - key of a heal operation.
+func healOpKey(bucket, prefix string) string {
+	return bucket + slashSeparator + prefix
+}
+
+// Start - starts healing all the files under bucket and prefix on
+// every erasure set in background.
+func (h *healOperations) Start(sets []*XL, bucket, prefix string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := healOpKey(bucket, prefix)
+	if op, ok := h.ops[key]; ok && op.status.State == healRunning {
+		return errHealInProgress
+	}
+	op := &healOperation{
+		status: HealStatus{
+			Bucket:    bucket,
+			Prefix:    prefix,
+			State:     healRunning,
+			StartTime: time.Now().UTC(),
+		},
+		stopCh: make(chan struct{}),
+	}
+	h.ops[key] = op
+	go h.run(sets, op)
+	return nil
+}
+
+// Stop - stops a running heal operation, stopping an operation which
+// is no longer running is a no-op.
+func (h *healOperations) Stop(bucket, prefix string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	op, ok := h.ops[healOpKey(bucket, prefix)]
+	if !ok {
+		return errNoSuchHeal
+	}
+	if op.status.State == healRunning {
+		close(op.stopCh)
+		op.status.State = healStopped
+		op.status.EndTime = time.Now().UTC()
+	}
+	return nil
+}
+
+// Status - returns status of a heal operation.
+func (h *healOperations) Status(bucket, prefix string) (HealStatus, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	op, ok := h.ops[healOpKey(bucket, prefix)]
+	if !ok {
+		return HealStatus{}, errNoSuchHeal
+	}
+	return op.status, nil
+}
+
+// List - returns status of all the heal operations.
+func (h *healOperations) List() []HealStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var keys []string
+	for key := range h.ops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	heals := []HealStatus{}
+	for _, key := range keys {
+		heals = append(heals, h.ops[key].status)
+	}
+	return heals
+}
+
+// finish - records the final state of a heal operation, unless it
+// was stopped in the meantime.
+func (h *healOperations) finish(op *healOperation, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if op.status.State != healRunning {
+		return
+	}
+	op.status.State = healFinished
+	if err != nil {
+		op.status.State = healFailed
+		op.status.Error = err.Error()
+	}
+	op.status.EndTime = time.Now().UTC()
+}
+
+// healed - records result of healing a single file.
+func (h *healOperations) healed(op *healOperation, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	op.status.ObjectsScanned++
+	if err != nil {
+		op.status.ObjectsFailed++
+	}
+}
+
+// run - heals the bucket and then every file under the prefix on all
+// the sets, stops early if the operation is stopped.
+func (h *healOperations) run(sets []*XL, op *healOperation) {
+	for _, xl := range sets {
+		if err := h.runSet(xl.background(), op); err != nil {
+			if err != errHealStopped {
+				h.finish(op, err)
+			}
+			return
+		}
+	}
+	h.finish(op, nil)
+}
+
+// runSet - heals the bucket and every file under the prefix on a
+// single erasure set.
+func (h *healOperations) runSet(xl *XL, op *healOperation) error {
+	bucket, prefix := op.status.Bucket, op.status.Prefix
+	if err := xl.healVolume(bucket); err != nil {
+		return err
+	}
+	marker := ""
+	for {
+		fileInfos, eof, err := xl.ListFiles(bucket, prefix, marker, true, healListLimit)
+		if err != nil {
+			return err
+		}
+		for _, fileInfo := range fileInfos {
+			select {
+			case <-op.stopCh:
+				return errHealStopped
+			default:
+			}
+			err = xl.healFile(bucket, fileInfo.Name)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"bucket": bucket,
+					"object": fileInfo.Name,
+				}).Errorf("Healing failed with %s", err)
+			}
+			h.healed(op, err)
+			marker = fileInfo.Name
+		}
+		if eof || len(fileInfos) == 0 {
+			return nil
+		}
+	}
+}
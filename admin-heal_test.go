@@ -0,0 +1,102 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests healing a bucket restores erasure parts of a missing disk.
+func TestHealOperations(t *testing.T) {
+	initNSLock()
+
+	var disks []string
+	for i := 0; i < 4; i++ {
+		disk, err := ioutil.TempDir("", "minio-heal-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+	objAPI, err := newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl, ok := getXLStorage(objAPI)
+	if !ok {
+		t.Fatal("Expected XL storage")
+	}
+	if status := getBackendStatus(objAPI); status.Type != backendXL || len(status.Disks) != 4 {
+		t.Fatalf("Unexpected backend status %#v", status)
+	}
+
+	if err = objAPI.MakeBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello world")
+	if _, err = objAPI.PutObject("bucket", "dir/object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Remove erasure part of the object from the first disk.
+	if err = os.RemoveAll(filepath.Join(disks[0], "bucket", "dir", "object")); err != nil {
+		t.Fatal(err)
+	}
+
+	healOps := newHealOperations()
+	if _, err = healOps.Status("bucket", "dir/"); err != errNoSuchHeal {
+		t.Fatalf("Expected %s, got %s", errNoSuchHeal, err)
+	}
+	if err = healOps.Start([]*XL{xl}, "bucket", "dir/"); err != nil {
+		t.Fatal(err)
+	}
+	var status HealStatus
+	for i := 0; i < 100; i++ {
+		status, err = healOps.Status("bucket", "dir/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State != healRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.State != healFinished {
+		t.Fatalf("Expected heal to finish, got %#v", status)
+	}
+	if status.ObjectsScanned != 1 || status.ObjectsFailed != 0 {
+		t.Fatalf("Unexpected heal status %#v", status)
+	}
+	if _, err = os.Stat(filepath.Join(disks[0], "bucket", "dir", "object", xlMetaV1File)); err != nil {
+		t.Fatalf("Expected object to be healed, got %s", err)
+	}
+	if heals := healOps.List(); len(heals) != 1 {
+		t.Fatalf("Expected 1 heal operation, got %d", len(heals))
+	}
+	// Stopping a finished heal operation is a no-op.
+	if err = healOps.Stop("bucket", "dir/"); err != nil {
+		t.Fatal(err)
+	}
+	if err = healOps.Stop("bucket", "other/"); err != errNoSuchHeal {
+		t.Fatalf("Expected %s, got %s", errNoSuchHeal, err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import router "github.com/gorilla/mux"
+
+// adminAPIHandlers implements and provides http handlers for minio
+// admin API.
+type adminAPIHandlers struct {
+	ObjectAPI ObjectLayer
+	HealOps   *healOperations
+}
+
+// Admin API path prefix.
+const adminAPIPathPrefix = reservedBucket + "/admin/v1"
+
+// registerAdminRouter - registers minio admin APIs.
+func registerAdminRouter(mux *router.Router, api adminAPIHandlers) {
+	// Admin router
+	adminRouter := mux.NewRoute().PathPrefix(adminAPIPathPrefix).Subrouter()
+
+	/// Users operations
+
+	// ListUsers
+	adminRouter.Methods("GET").Path("/users").HandlerFunc(api.ListUsersHandler)
+	// GetUser
+	adminRouter.Methods("GET").Path("/users/{accessKey}").HandlerFunc(api.GetUserHandler)
+	// SetUser
+	adminRouter.Methods("PUT").Path("/users/{accessKey}").HandlerFunc(api.SetUserHandler)
+	// DeleteUser
+	adminRouter.Methods("DELETE").Path("/users/{accessKey}").HandlerFunc(api.DeleteUserHandler)
+
+	/// Groups operations
+
+	// ListGroups
+	adminRouter.Methods("GET").Path("/groups").HandlerFunc(api.ListGroupsHandler)
+	// GetGroup
+	adminRouter.Methods("GET").Path("/groups/{group}").HandlerFunc(api.GetGroupHandler)
+	// SetGroup
+	adminRouter.Methods("PUT").Path("/groups/{group}").HandlerFunc(api.SetGroupHandler)
+	// DeleteGroup
+	adminRouter.Methods("DELETE").Path("/groups/{group}").HandlerFunc(api.DeleteGroupHandler)
+
+	/// Policies operations
+
+	// ListPolicies
+	adminRouter.Methods("GET").Path("/policies").HandlerFunc(api.ListPoliciesHandler)
+	// GetPolicy
+	adminRouter.Methods("GET").Path("/policies/{policy}").HandlerFunc(api.GetPolicyHandler)
+	// SetPolicy
+	adminRouter.Methods("PUT").Path("/policies/{policy}").HandlerFunc(api.SetPolicyHandler)
+	// DeletePolicy
+	adminRouter.Methods("DELETE").Path("/policies/{policy}").HandlerFunc(api.DeletePolicyHandler)
+
+	/// Server operations
+
+	// ServerStatus
+	adminRouter.Methods("GET").Path("/status").HandlerFunc(api.ServerStatusHandler)
+
+	/// Config operations
+
+	// GetRateLimit
+	adminRouter.Methods("GET").Path("/config/ratelimit").HandlerFunc(api.GetRateLimitHandler)
+	// SetRateLimit
+	adminRouter.Methods("PUT").Path("/config/ratelimit").HandlerFunc(api.SetRateLimitHandler)
+
+	/// Heal scanner operations
+
+	// GetHealScannerStatus
+	adminRouter.Methods("GET").Path("/heal-scanner").HandlerFunc(api.GetHealScannerStatusHandler)
+	// SuspendHealScanner
+	adminRouter.Methods("PUT").Path("/heal-scanner/suspend").HandlerFunc(api.SuspendHealScannerHandler)
+	// ResumeHealScanner
+	adminRouter.Methods("PUT").Path("/heal-scanner/resume").HandlerFunc(api.ResumeHealScannerHandler)
+
+	/// Disk heal operations
+
+	// ListDiskHeals
+	adminRouter.Methods("GET").Path("/heal-disks").HandlerFunc(api.ListDiskHealsHandler)
+
+	/// Heal operations
+
+	// ListHeals
+	adminRouter.Methods("GET").Path("/heal").HandlerFunc(api.ListHealsHandler)
+	// GetHealStatus
+	adminRouter.Methods("GET").Path("/heal/{bucket}").HandlerFunc(api.GetHealStatusHandler)
+	// StartHeal
+	adminRouter.Methods("POST").Path("/heal/{bucket}").HandlerFunc(api.StartHealHandler)
+	// StopHeal
+	adminRouter.Methods("DELETE").Path("/heal/{bucket}").HandlerFunc(api.StopHealHandler)
+}
@@ -0,0 +1,189 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"time"
+
+	"github.com/minio/minio/pkg/disk"
+)
+
+// Backend types reported by server status.
+const (
+	backendFS = "fs"
+	backendXL = "xl"
+)
+
+// DiskStatus - online status and usage of a single disk.
+type DiskStatus struct {
+	Path   string `json:"path"`
+	Online bool   `json:"online"`
+	Total  int64  `json:"total"`
+	Free   int64  `json:"free"`
+	FSType string `json:"fsType,omitempty"`
+
+	// Health tracked by XL, not reported for FS.
+	State             string  `json:"state,omitempty"`
+	ConsecutiveErrors int     `json:"consecutiveErrors,omitempty"`
+	AvgLatency        float64 `json:"avgLatency,omitempty"` // In seconds.
+}
+
+// BackendStatus - backend type, erasure and quorum settings of the
+// object layer along with status of all its disks.
+type BackendStatus struct {
+	Type         string       `json:"type"`
+	Sets         int          `json:"sets,omitempty"`
+	DataBlocks   int          `json:"dataBlocks,omitempty"`
+	ParityBlocks int          `json:"parityBlocks,omitempty"`
+	ReadQuorum   int          `json:"readQuorum,omitempty"`
+	WriteQuorum  int          `json:"writeQuorum,omitempty"`
+	Disks        []DiskStatus `json:"disks"`
+}
+
+// ServerStatusResponse - format for server status response.
+type ServerStatusResponse struct {
+	Version    string        `json:"version"`
+	ReleaseTag string        `json:"releaseTag"`
+	Uptime     int64         `json:"uptime"` // In seconds.
+	Backend    BackendStatus `json:"backend"`
+}
+
+// getStorageDiskPath - returns path of a storage disk, network disks
+// are of form <ip>:<port>:<export_dir>.
+func getStorageDiskPath(storage StorageAPI) string {
+	switch s := storage.(type) {
+	case fsStorage:
+		return s.diskPath
+	case *networkFS:
+		return s.netAddr + ":" + s.netPath
+	case *trackedDisk:
+		return getStorageDiskPath(s.disk)
+	case *scheduledDisk:
+		return getStorageDiskPath(s.disk)
+	}
+	return ""
+}
+
+// getDiskStatus - reports status of a storage disk, local disks
+// report their usage as well.
+func getDiskStatus(storage StorageAPI) DiskStatus {
+	diskPath := getStorageDiskPath(storage)
+	switch s := storage.(type) {
+	case fsStorage:
+		di, err := disk.GetInfo(s.diskPath)
+		if err != nil {
+			return DiskStatus{Path: diskPath}
+		}
+		return DiskStatus{
+			Path:   diskPath,
+			Online: true,
+			Total:  di.Total,
+			Free:   di.Free,
+			FSType: di.FSType,
+		}
+	case *trackedDisk:
+		// Disks marked offline are not queried, others report their
+		// status along with health tracked so far.
+		health := s.Health()
+		diskStatus := DiskStatus{Path: diskPath}
+		if health.State == diskOnline {
+			diskStatus = getDiskStatus(s.disk)
+		}
+		diskStatus.State = health.State
+		diskStatus.ConsecutiveErrors = health.ConsecutiveErrors
+		diskStatus.AvgLatency = health.AvgLatency
+		return diskStatus
+	case *scheduledDisk:
+		return getDiskStatus(s.disk)
+	case *networkFS:
+		// Usage of network disks is not exported over rpc, a disk
+		// is online if it is able to list its volumes.
+		_, err := s.ListVols()
+		return DiskStatus{
+			Path:   diskPath,
+			Online: err == nil,
+		}
+	}
+	return DiskStatus{Path: diskPath}
+}
+
+// getXLStorage - returns XL storage of the object layer, if any.
+func getXLStorage(objAPI ObjectLayer) (*XL, bool) {
+	xlObj, ok := objAPI.(xlObjects)
+	if !ok {
+		return nil, false
+	}
+	xl, ok := xlObj.storage.(*XL)
+	return xl, ok
+}
+
+// getXLSets - returns XL storage of every erasure set of the object
+// layer, if any.
+func getXLSets(objAPI ObjectLayer) ([]*XL, bool) {
+	if xl, ok := getXLStorage(objAPI); ok {
+		return []*XL{xl}, true
+	}
+	xlSets, ok := objAPI.(xlSets)
+	if !ok {
+		return nil, false
+	}
+	var sets []*XL
+	for _, set := range xlSets.sets {
+		xl, ok := set.storage.(*XL)
+		if !ok {
+			return nil, false
+		}
+		sets = append(sets, xl)
+	}
+	return sets, true
+}
+
+// getBackendStatus - reports backend status of the object layer.
+func getBackendStatus(objAPI ObjectLayer) BackendStatus {
+	if sets, ok := getXLSets(objAPI); ok {
+		// All the sets share the same erasure settings.
+		backend := BackendStatus{
+			Type:         backendXL,
+			Sets:         len(sets),
+			DataBlocks:   sets[0].DataBlocks,
+			ParityBlocks: sets[0].ParityBlocks,
+			ReadQuorum:   sets[0].readQuorum,
+			WriteQuorum:  sets[0].writeQuorum,
+		}
+		for _, xl := range sets {
+			for _, storage := range xl.disks() {
+				backend.Disks = append(backend.Disks, getDiskStatus(storage))
+			}
+		}
+		return backend
+	}
+	backend := BackendStatus{Type: backendFS}
+	if fs, ok := objAPI.(fsObjects); ok {
+		backend.Disks = []DiskStatus{getDiskStatus(fs.storage)}
+	}
+	return backend
+}
+
+// getServerStatus - reports version, uptime and backend status.
+func getServerStatus(objAPI ObjectLayer) ServerStatusResponse {
+	return ServerStatusResponse{
+		Version:    minioVersion,
+		ReleaseTag: minioReleaseTag,
+		Uptime:     int64(time.Since(globalBootTime).Seconds()),
+		Backend:    getBackendStatus(objAPI),
+	}
+}
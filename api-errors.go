@@ -104,11 +104,29 @@ const (
 	ErrMissingDateHeader
 	ErrInvalidQuerySignatureAlgo
 	ErrInvalidQueryParams
+	ErrSlowDown
 	// Add new error codes here.
 
 	// Extended errors.
 	ErrInsufficientReadResources
 	ErrInsufficientWriteResources
+	ErrServerNotInitialized
+
+	// Admin API errors.
+	ErrAdminInvalidArgument
+	ErrAdminNoSuchUser
+	ErrAdminNoSuchGroup
+	ErrAdminNoSuchPolicy
+	ErrAdminPolicyInUse
+	ErrAdminHealNotSupported
+	ErrAdminHealInProgress
+	ErrAdminNoSuchHeal
+
+	// STS errors.
+	ErrInvalidToken
+	ErrExpiredToken
+	ErrInvalidAction
+	ErrInvalidParameterValue
 )
 
 // error code to APIError structure, these fields carry respective
@@ -199,6 +217,11 @@ var errorCodeResponse = map[APIErrorCode]APIError{
 		Description:    "We cannot satisfy sufficient write resources requested at this moment, please try again.",
 		HTTPStatusCode: http.StatusInternalServerError,
 	},
+	ErrServerNotInitialized: {
+		Code:           "XMinioServerNotInitialized",
+		Description:    "Server is waiting for disks of all the servers to come online, please try again.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
 	ErrInvalidAccessKeyID: {
 		Code:           "InvalidAccessKeyID",
 		Description:    "The access key ID you provided does not exist in our records.",
@@ -409,6 +432,75 @@ var errorCodeResponse = map[APIErrorCode]APIError{
 		Description:    "Query-string authentication version 4 requires the X-Amz-Algorithm, X-Amz-Credential, X-Amz-Signature, X-Amz-Date, X-Amz-SignedHeaders, and X-Amz-Expires parameters.",
 		HTTPStatusCode: http.StatusBadRequest,
 	},
+	ErrSlowDown: {
+		Code:           "SlowDown",
+		Description:    "Please reduce your request rate.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
+
+	/// Admin API errors.
+	ErrAdminInvalidArgument: {
+		Code:           "XMinioAdminInvalidArgument",
+		Description:    "Invalid arguments specified.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrAdminNoSuchUser: {
+		Code:           "XMinioAdminNoSuchUser",
+		Description:    "The specified user does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+	ErrAdminNoSuchGroup: {
+		Code:           "XMinioAdminNoSuchGroup",
+		Description:    "The specified group does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+	ErrAdminNoSuchPolicy: {
+		Code:           "XMinioAdminNoSuchPolicy",
+		Description:    "The specified policy does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+	ErrAdminPolicyInUse: {
+		Code:           "XMinioAdminPolicyInUse",
+		Description:    "The specified policy is attached to a user or a group.",
+		HTTPStatusCode: http.StatusConflict,
+	},
+	ErrAdminHealNotSupported: {
+		Code:           "XMinioAdminHealNotSupported",
+		Description:    "Heal is only supported on XL backend.",
+		HTTPStatusCode: http.StatusNotImplemented,
+	},
+	ErrAdminHealInProgress: {
+		Code:           "XMinioAdminHealInProgress",
+		Description:    "A heal operation is already running on the specified bucket and prefix.",
+		HTTPStatusCode: http.StatusConflict,
+	},
+	ErrAdminNoSuchHeal: {
+		Code:           "XMinioAdminNoSuchHeal",
+		Description:    "The specified heal operation does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	},
+
+	/// STS errors.
+	ErrInvalidToken: {
+		Code:           "InvalidToken",
+		Description:    "The provided token is malformed or otherwise invalid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrExpiredToken: {
+		Code:           "ExpiredToken",
+		Description:    "The provided token has expired.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrInvalidAction: {
+		Code:           "InvalidAction",
+		Description:    "The action or operation requested is invalid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
+	ErrInvalidParameterValue: {
+		Code:           "InvalidParameterValue",
+		Description:    "An invalid or out-of-range value was supplied for the input parameter.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
 	// Add your error structure here.
 }
 
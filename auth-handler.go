@@ -109,8 +109,9 @@ func sumMD5(data []byte) []byte {
 	return hash.Sum(nil)
 }
 
-// Verify if request has valid AWS Signature Version '4'.
-func isReqAuthenticated(r *http.Request) (s3Error APIErrorCode) {
+// Verify if request has valid AWS Signature Version '4', signed for
+// one of services, 's3' only if none are given.
+func isReqAuthenticated(r *http.Request, services ...string) (s3Error APIErrorCode) {
 	if r == nil {
 		errorIf(errInvalidArgument, "HTTP request cannot be empty.", nil)
 		return ErrInternalError
@@ -130,9 +131,9 @@ func isReqAuthenticated(r *http.Request) (s3Error APIErrorCode) {
 	r.Body = ioutil.NopCloser(bytes.NewReader(payload))
 	validateRegion := true // Validate region.
 	if isRequestSignatureV4(r) {
-		return doesSignatureMatch(hex.EncodeToString(sum256(payload)), r, validateRegion)
+		return doesSignatureMatch(hex.EncodeToString(sum256(payload)), r, validateRegion, services...)
 	} else if isRequestPresignedSignatureV4(r) {
-		return doesPresignedSignatureMatch(hex.EncodeToString(sum256(payload)), r, validateRegion)
+		return doesPresignedSignatureMatch(hex.EncodeToString(sum256(payload)), r, validateRegion, services...)
 	}
 	return ErrAccessDenied
 }
@@ -150,6 +151,11 @@ func setAuthHandler(h http.Handler) http.Handler {
 
 // handler for validating incoming authorization headers.
 func (a authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Health checks are served to everyone, skip authorization.
+	if isHealthCheckRequest(r) {
+		a.handler.ServeHTTP(w, r)
+		return
+	}
 	switch getRequestAuthType(r) {
 	case authTypeAnonymous, authTypePresigned, authTypeSigned, authTypePostPolicy:
 		// Let top level caller validate for anonymous and known
@@ -408,10 +408,23 @@ func (api objectAPIHandlers) DeleteMultipleObjectsHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Access key of the user, policies are verified for each object.
+	accessKey, _ := getRequestAccessKey(r)
+	sessionToken := getRequestSessionToken(r)
+	conditions := getRequestConditions(r.URL)
+
 	var deleteErrors []DeleteError
 	var deletedObjects []ObjectIdentifier
 	// Loop through all the objects and delete them sequentially.
 	for _, object := range deleteObjects.Objects {
+		if accessKey != "" && !isRequestActionAllowed(accessKey, sessionToken, "s3:DeleteObject", bucket, object.ObjectName, conditions) {
+			deleteErrors = append(deleteErrors, DeleteError{
+				Code:    errorCodeResponse[ErrAccessDenied].Code,
+				Message: errorCodeResponse[ErrAccessDenied].Description,
+				Key:     object.ObjectName,
+			})
+			continue
+		}
 		err := api.ObjectAPI.DeleteObject(bucket, object.ObjectName)
 		if err == nil {
 			deletedObjects = append(deletedObjects, ObjectIdentifier{
@@ -570,6 +583,16 @@ func (api objectAPIHandlers) PostPolicyBucketHandler(w http.ResponseWriter, r *h
 		writeErrorResponse(w, r, apiErr, r.URL.Path)
 		return
 	}
+	// Verify if the signing user is allowed to upload the object.
+	credHeader, apiErr := parseCredentialHeader("Credential=" + formValues["X-Amz-Credential"])
+	if apiErr != ErrNone {
+		writeErrorResponse(w, r, apiErr, r.URL.Path)
+		return
+	}
+	if !isRequestActionAllowed(credHeader.accessKey, formValues["X-Amz-Security-Token"], "s3:PutObject", bucket, object, nil) {
+		writeErrorResponse(w, r, ErrAccessDenied, r.URL.Path)
+		return
+	}
 	md5Sum, err := api.ObjectAPI.PutObject(bucket, object, -1, fileBody, nil)
 	if err != nil {
 		errorIf(err, "PutObject failed.", nil)
@@ -0,0 +1,67 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Tests anonymous requests are evaluated against an existing read only
+// bucket policy as they always were, resources of the policy match the
+// request resource as patterns.
+func TestBucketPolicyEvalReadOnly(t *testing.T) {
+	policy := BucketPolicy{
+		Version:    "1.0",
+		Statements: setReadOnlyStatement("testbucket", ""),
+	}
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucketPolicy, err := parseBucketPolicy(policyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		action  string
+		path    string
+		allowed bool
+	}{
+		{"s3:GetBucketLocation", "/testbucket", true},
+		{"s3:ListBucket", "/testbucket", true},
+		// Clients list buckets with a trailing slash.
+		{"s3:ListBucket", "/testbucket/", true},
+		{"s3:GetObject", "/testbucket/object", true},
+		{"s3:GetObject", "/testbucket/photos/2016/january.jpg", true},
+		{"s3:PutObject", "/testbucket/object", false},
+		{"s3:DeleteObject", "/testbucket/object", false},
+		{"s3:AbortMultipartUpload", "/testbucket/object", false},
+	}
+	for i, testCase := range testCases {
+		// Resource is constructed as by enforceBucketPolicy.
+		reqURL := &url.URL{Path: testCase.path}
+		resource := AWSResourcePrefix + strings.TrimPrefix(reqURL.Path, "/")
+		allowed := bucketPolicyEvalStatements(testCase.action, resource, map[string]string{}, bucketPolicy.Statements)
+		if allowed != testCase.allowed {
+			t.Errorf("Test %d: expected %s on %s allowed %t, got %t", i+1, testCase.action, testCase.path, testCase.allowed, allowed)
+		}
+	}
+}
@@ -44,6 +44,26 @@ var supportedActionMap = map[string]struct{}{
 	"s3:ListMultipartUploadParts":   {},
 }
 
+// supportedIAMActionMap - lists all the actions which can be granted
+// to users and groups, a superset of bucket policy actions.
+var supportedIAMActionMap = map[string]struct{}{
+	"s3:*":                          {},
+	"s3:GetObject":                  {},
+	"s3:ListBucket":                 {},
+	"s3:PutObject":                  {},
+	"s3:GetBucketLocation":          {},
+	"s3:DeleteObject":               {},
+	"s3:AbortMultipartUpload":       {},
+	"s3:ListBucketMultipartUploads": {},
+	"s3:ListMultipartUploadParts":   {},
+	"s3:CreateBucket":               {},
+	"s3:DeleteBucket":               {},
+	"s3:ListAllMyBuckets":           {},
+	"s3:GetBucketPolicy":            {},
+	"s3:PutBucketPolicy":            {},
+	"s3:DeleteBucketPolicy":         {},
+}
+
 // supported Conditions type.
 var supportedConditionsType = map[string]struct{}{
 	"StringEquals":    {},
@@ -86,13 +106,23 @@ var supportedEffectMap = map[string]struct{}{
 
 // isValidActions - are actions valid.
 func isValidActions(actions []string) (err error) {
+	return isSupportedActions(actions, supportedActionMap)
+}
+
+// isValidIAMActions - are actions valid for user and group policies.
+func isValidIAMActions(actions []string) (err error) {
+	return isSupportedActions(actions, supportedIAMActionMap)
+}
+
+// isSupportedActions - are actions present in the input action map.
+func isSupportedActions(actions []string, actionMap map[string]struct{}) (err error) {
 	// Statement actions cannot be empty.
 	if len(actions) == 0 {
 		err = errors.New("Action list cannot be empty.")
 		return err
 	}
 	for _, action := range actions {
-		if _, ok := supportedActionMap[action]; !ok {
+		if _, ok := actionMap[action]; !ok {
 			err = errors.New("Unsupported action found: ‘" + action + "’, please validate your policy document.")
 			return err
 		}
@@ -299,11 +329,73 @@ func parseBucketPolicy(bucketPolicyBuf []byte) (policy BucketPolicy, err error)
 		}
 	}
 
-	// Separate deny and allow statements, so that we can apply deny
-	// statements in the beginning followed by Allow statements.
+	// Deny statements are enforced first once matched.
+	policy.Statements = denyStatementsFirst(policy.Statements)
+
+	// Return successfully parsed policy structure.
+	return policy, nil
+}
+
+// parseIAMPolicy - parses and validates a policy attached to users
+// and groups. It follows the bucket policy grammar, except that
+// statements carry no Principal since the policy applies to whoever
+// it is attached to.
+func parseIAMPolicy(iamPolicyBuf []byte) (policy BucketPolicy, err error) {
+	if err = json.Unmarshal(iamPolicyBuf, &policy); err != nil {
+		return BucketPolicy{}, err
+	}
+
+	// Policy version cannot be empty.
+	if len(policy.Version) == 0 {
+		err = errors.New("Policy version cannot be empty.")
+		return BucketPolicy{}, err
+	}
+
+	// Policy statements cannot be empty.
+	if len(policy.Statements) == 0 {
+		err = errors.New("Policy statement cannot be empty.")
+		return BucketPolicy{}, err
+	}
+
+	// Loop through all policy statements and validate entries.
+	for _, statement := range policy.Statements {
+		// Statement effect should be valid.
+		if err := isValidEffect(statement.Effect); err != nil {
+			return BucketPolicy{}, err
+		}
+		// Statement principal is implied by the attachment.
+		if len(statement.Principal.AWS) != 0 {
+			err = errors.New("Principal is not allowed in user and group policies.")
+			return BucketPolicy{}, err
+		}
+		// Statement actions should be valid.
+		if err := isValidIAMActions(statement.Actions); err != nil {
+			return BucketPolicy{}, err
+		}
+		// Statement resources should be valid.
+		if err := isValidResources(statement.Resources); err != nil {
+			return BucketPolicy{}, err
+		}
+		// Statement conditions should be valid.
+		if err := isValidConditions(statement.Conditions); err != nil {
+			return BucketPolicy{}, err
+		}
+	}
+
+	// Deny statements are enforced first once matched.
+	policy.Statements = denyStatementsFirst(policy.Statements)
+
+	// Return successfully parsed policy structure.
+	return policy, nil
+}
+
+// denyStatementsFirst - separate deny and allow statements, so that
+// we can apply deny statements in the beginning followed by Allow
+// statements.
+func denyStatementsFirst(statements []policyStatement) []policyStatement {
 	var denyStatements []policyStatement
 	var allowStatements []policyStatement
-	for _, statement := range policy.Statements {
+	for _, statement := range statements {
 		if statement.Effect == "Deny" {
 			denyStatements = append(denyStatements, statement)
 			continue
@@ -311,10 +403,5 @@ func parseBucketPolicy(bucketPolicyBuf []byte) (policy BucketPolicy, err error)
 		// else if statement.Effect == "Allow"
 		allowStatements = append(allowStatements, statement)
 	}
-
-	// Deny statements are enforced first once matched.
-	policy.Statements = append(denyStatements, allowStatements...)
-
-	// Return successfully parsed policy structure.
-	return policy, nil
+	return append(denyStatements, allowStatements...)
 }
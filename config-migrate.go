@@ -32,6 +32,10 @@ func migrateConfig() {
 	migrateV2ToV3()
 	// Migrate version '3' to '4'.
 	migrateV3ToV4()
+	// Migrate version '4' to '5'.
+	migrateV4ToV5()
+	// Migrate version '5' to '6'.
+	migrateV5ToV6()
 }
 
 // Version '1' is not supported anymore and deprecated, safe to delete.
@@ -120,8 +124,8 @@ func migrateV3ToV4() {
 	}
 
 	// Save only the new fields, ignore the rest.
-	srvConfig := &serverConfigV4{}
-	srvConfig.Version = globalMinioConfigVersion
+	srvConfig := &configV4{}
+	srvConfig.Version = "4"
 	srvConfig.Credential = cv3.Credential
 	srvConfig.Region = cv3.Region
 	srvConfig.Logger.Console = cv3.Logger.Console
@@ -138,3 +142,66 @@ func migrateV3ToV4() {
 
 	console.Println("Migration from version ‘" + cv3.Version + "’ to ‘" + srvConfig.Version + "’ completed successfully.")
 }
+
+// Version '4' to '5' migrates config, adds request rate and bandwidth
+// limits which are disabled by default.
+func migrateV4ToV5() {
+	cv4, err := loadConfigV4()
+	if err != nil && os.IsNotExist(err) {
+		return
+	}
+	fatalIf(err, "Unable to load config version ‘4’.", nil)
+	if cv4.Version != "4" {
+		return
+	}
+
+	// Copy over fields from version '4'.
+	srvConfig := &configV5{}
+	srvConfig.Version = "5"
+	srvConfig.Credential = cv4.Credential
+	srvConfig.Region = cv4.Region
+	srvConfig.Logger = cv4.Logger
+
+	qc, err := quick.New(srvConfig)
+	fatalIf(err, "Unable to initialize the quick config.", nil)
+	configFile, err := getConfigFile()
+	fatalIf(err, "Unable to get config file.", nil)
+
+	err = qc.Save(configFile)
+	fatalIf(err, "Migrating from version ‘"+cv4.Version+"’ to ‘"+srvConfig.Version+"’ failed.", nil)
+
+	console.Println("Migration from version ‘" + cv4.Version + "’ to ‘" + srvConfig.Version + "’ completed successfully.")
+}
+
+// Version '5' to '6' migrates config, adds erasure coding configuration.
+// Bitrot checksums default to sha256, parity to half the disks and
+// files up to 8KiB are saved inline.
+func migrateV5ToV6() {
+	cv5, err := loadConfigV5()
+	if err != nil && os.IsNotExist(err) {
+		return
+	}
+	fatalIf(err, "Unable to load config version ‘5’.", nil)
+	if cv5.Version != "5" {
+		return
+	}
+
+	// Copy over fields from version '5'.
+	srvConfig := &serverConfigV6{}
+	srvConfig.Version = globalMinioConfigVersion
+	srvConfig.Credential = cv5.Credential
+	srvConfig.Region = cv5.Region
+	srvConfig.Logger = cv5.Logger
+	srvConfig.RateLimit = cv5.RateLimit
+	srvConfig.Erasure.BitrotAlgorithm = defaultBitrotAlgorithm
+
+	qc, err := quick.New(srvConfig)
+	fatalIf(err, "Unable to initialize the quick config.", nil)
+	configFile, err := getConfigFile()
+	fatalIf(err, "Unable to get config file.", nil)
+
+	err = qc.Save(configFile)
+	fatalIf(err, "Migrating from version ‘"+cv5.Version+"’ to ‘"+srvConfig.Version+"’ failed.", nil)
+
+	console.Println("Migration from version ‘" + cv5.Version + "’ to ‘" + srvConfig.Version + "’ completed successfully.")
+}
@@ -23,8 +23,22 @@ import (
 	"github.com/minio/minio/pkg/quick"
 )
 
-// serverConfigV4 server configuration version '4'.
-type serverConfigV4 struct {
+// erasureConfig - erasure coding configuration of XL.
+type erasureConfig struct {
+	// Hash algorithm used to detect bitrot, one of sha256, sha512
+	// and crc32c.
+	BitrotAlgorithm string `json:"bitrotAlgorithm"`
+	// Number of parity blocks, defaults to half the disks when
+	// zero. Applies to newly written files only.
+	ParityBlocks int `json:"parityBlocks"`
+	// Files up to this size in bytes are saved inline in their
+	// metadata, defaults to 8KiB when zero and disabled when
+	// negative. Applies to newly written files only.
+	InlineThreshold int64 `json:"inlineThreshold"`
+}
+
+// serverConfigV6 server configuration version '6'.
+type serverConfigV6 struct {
 	Version string `json:"version"`
 
 	// S3 API configuration.
@@ -34,6 +48,12 @@ type serverConfigV4 struct {
 	// Additional error logging configuration.
 	Logger logger `json:"logger"`
 
+	// Request rate and bandwidth limits.
+	RateLimit rateLimitConfig `json:"rateLimit"`
+
+	// Erasure coding configuration.
+	Erasure erasureConfig `json:"erasure"`
+
 	// Read Write mutex.
 	rwMutex *sync.RWMutex
 }
@@ -41,9 +61,10 @@ type serverConfigV4 struct {
 // initConfig - initialize server config. config version (called only once).
 func initConfig() error {
 	if !isConfigFileExists() {
-		srvCfg := &serverConfigV4{}
+		srvCfg := &serverConfigV6{}
 		srvCfg.Version = globalMinioConfigVersion
 		srvCfg.Region = "us-east-1"
+		srvCfg.Erasure.BitrotAlgorithm = defaultBitrotAlgorithm
 		srvCfg.Credential = mustGenAccessKeys()
 		// Enable console logger by default on a fresh run.
 		srvCfg.Logger.Console = consoleLogger{
@@ -76,7 +97,7 @@ func initConfig() error {
 	if _, err = os.Stat(configFile); err != nil {
 		return err
 	}
-	srvCfg := &serverConfigV4{}
+	srvCfg := &serverConfigV6{}
 	srvCfg.Version = globalMinioConfigVersion
 	srvCfg.rwMutex = &sync.RWMutex{}
 	qc, err := quick.New(srvCfg)
@@ -87,17 +108,17 @@ func initConfig() error {
 		return err
 	}
 	// Save the loaded config globally.
-	serverConfig = qc.Data().(*serverConfigV4)
+	serverConfig = qc.Data().(*serverConfigV6)
 	// Set the version properly after the unmarshalled json is loaded.
 	serverConfig.Version = globalMinioConfigVersion
 	return nil
 }
 
 // serverConfig server config.
-var serverConfig *serverConfigV4
+var serverConfig *serverConfigV6
 
 // GetVersion get current config version.
-func (s serverConfigV4) GetVersion() string {
+func (s serverConfigV6) GetVersion() string {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Version
@@ -106,77 +127,105 @@ func (s serverConfigV4) GetVersion() string {
 /// Logger related.
 
 // SetFileLogger set new file logger.
-func (s *serverConfigV4) SetFileLogger(flogger fileLogger) {
+func (s *serverConfigV6) SetFileLogger(flogger fileLogger) {
 	s.rwMutex.Lock()
 	defer s.rwMutex.Unlock()
 	s.Logger.File = flogger
 }
 
 // GetFileLogger get current file logger.
-func (s serverConfigV4) GetFileLogger() fileLogger {
+func (s serverConfigV6) GetFileLogger() fileLogger {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Logger.File
 }
 
 // SetConsoleLogger set new console logger.
-func (s *serverConfigV4) SetConsoleLogger(clogger consoleLogger) {
+func (s *serverConfigV6) SetConsoleLogger(clogger consoleLogger) {
 	s.rwMutex.Lock()
 	defer s.rwMutex.Unlock()
 	s.Logger.Console = clogger
 }
 
 // GetConsoleLogger get current console logger.
-func (s serverConfigV4) GetConsoleLogger() consoleLogger {
+func (s serverConfigV6) GetConsoleLogger() consoleLogger {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Logger.Console
 }
 
 // SetSyslogLogger set new syslog logger.
-func (s *serverConfigV4) SetSyslogLogger(slogger syslogLogger) {
+func (s *serverConfigV6) SetSyslogLogger(slogger syslogLogger) {
 	s.rwMutex.Lock()
 	defer s.rwMutex.Unlock()
 	s.Logger.Syslog = slogger
 }
 
 // GetSyslogLogger get current syslog logger.
-func (s *serverConfigV4) GetSyslogLogger() syslogLogger {
+func (s *serverConfigV6) GetSyslogLogger() syslogLogger {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Logger.Syslog
 }
 
 // SetRegion set new region.
-func (s *serverConfigV4) SetRegion(region string) {
+func (s *serverConfigV6) SetRegion(region string) {
 	s.rwMutex.Lock()
 	defer s.rwMutex.Unlock()
 	s.Region = region
 }
 
 // GetRegion get current region.
-func (s serverConfigV4) GetRegion() string {
+func (s serverConfigV6) GetRegion() string {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Region
 }
 
 // SetCredentials set new credentials.
-func (s *serverConfigV4) SetCredential(creds credential) {
+func (s *serverConfigV6) SetCredential(creds credential) {
 	s.rwMutex.Lock()
 	defer s.rwMutex.Unlock()
 	s.Credential = creds
 }
 
 // GetCredentials get current credentials.
-func (s serverConfigV4) GetCredential() credential {
+func (s serverConfigV6) GetCredential() credential {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 	return s.Credential
 }
 
+// SetRateLimit set new rate limits.
+func (s *serverConfigV6) SetRateLimit(rateLimit rateLimitConfig) {
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	s.RateLimit = rateLimit
+}
+
+// GetRateLimit get current rate limits.
+func (s serverConfigV6) GetRateLimit() rateLimitConfig {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	return s.RateLimit
+}
+
+// SetErasure set new erasure config.
+func (s *serverConfigV6) SetErasure(erasure erasureConfig) {
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	s.Erasure = erasure
+}
+
+// GetErasure get current erasure config.
+func (s serverConfigV6) GetErasure() erasureConfig {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	return s.Erasure
+}
+
 // Save config.
-func (s serverConfigV4) Save() error {
+func (s serverConfigV6) Save() error {
 	s.rwMutex.RLock()
 	defer s.rwMutex.RUnlock()
 
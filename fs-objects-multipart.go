@@ -347,45 +347,30 @@ func (fs fsObjects) CompleteMultipartUpload(bucket string, object string, upload
 		return "", (InvalidUploadID{UploadID: uploadID})
 	}
 
-	fileWriter, err := fs.storage.CreateFile(bucket, object)
-	if err != nil {
-		return "", toObjectErr(err, bucket, object)
-	}
-
+	var partPaths []string
 	var md5Sums []string
 	for _, part := range parts {
 		// Construct part suffix.
 		partSuffix := fmt.Sprintf("%s.%d.%s", uploadID, part.PartNumber, part.ETag)
-		var fileReader io.ReadCloser
-		fileReader, err = fs.storage.ReadFile(minioMetaBucket, path.Join(bucket, object, partSuffix), 0)
-		if err != nil {
-			if err == errFileNotFound {
-				return "", (InvalidPart{})
-			}
-			return "", err
-		}
-		_, err = io.Copy(fileWriter, fileReader)
-		if err != nil {
-			return "", err
-		}
-		err = fileReader.Close()
-		if err != nil {
-			return "", err
-		}
+		partPaths = append(partPaths, path.Join(bucket, object, partSuffix))
 		md5Sums = append(md5Sums, part.ETag)
 	}
 
-	err = fileWriter.Close()
-	if err != nil {
-		return "", err
-	}
-
 	// Save the s3 md5.
 	s3MD5, err := makeS3MD5(md5Sums...)
 	if err != nil {
 		return "", err
 	}
 
+	// Objects are plain files in fs mode, parts are copied into the
+	// object. Parts are committed without copying in XL mode only.
+	if err = fs.copyParts(bucket, object, partPaths); err != nil {
+		if err == errFileNotFound {
+			return "", (InvalidPart{})
+		}
+		return "", toObjectErr(err, bucket, object)
+	}
+
 	// Cleanup all the parts.
 	fs.cleanupUploadedParts(bucket, object, uploadID)
 
@@ -393,6 +378,30 @@ func (fs fsObjects) CompleteMultipartUpload(bucket string, object string, upload
 	return s3MD5, nil
 }
 
+// copyParts - copies the parts at partPaths of minio meta volume into
+// the object.
+func (fs fsObjects) copyParts(bucket, object string, partPaths []string) error {
+	fileWriter, err := fs.storage.CreateFile(bucket, object)
+	if err != nil {
+		return err
+	}
+	for _, partPath := range partPaths {
+		var fileReader io.ReadCloser
+		fileReader, err = fs.storage.ReadFile(minioMetaBucket, partPath, 0)
+		if err != nil {
+			safeCloseAndRemove(fileWriter)
+			return err
+		}
+		_, err = io.Copy(fileWriter, fileReader)
+		fileReader.Close()
+		if err != nil {
+			safeCloseAndRemove(fileWriter)
+			return err
+		}
+	}
+	return fileWriter.Close()
+}
+
 // Wrapper to which removes all the uploaded parts after a successful
 // complete multipart upload.
 func (fs fsObjects) cleanupUploadedParts(bucket, object, uploadID string) error {
@@ -46,7 +46,7 @@ func newFSObjects(exportPath string) (ObjectLayer, error) {
 			return nil, err
 		}
 	}
-	return fsObjects{storage}, nil
+	return fsObjects{newScheduledDisk(storage, defaultDiskMaxIO)}, nil
 }
 
 /// Bucket operations
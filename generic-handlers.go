@@ -119,6 +119,32 @@ func (h minioPrivateBucketHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	h.handler.ServeHTTP(w, r)
 }
 
+// Refuses requests other than rpc until XL disks are initialized.
+type xlReadyHandler struct {
+	handler http.Handler
+	readyCh <-chan struct{}
+}
+
+// setXLReadyHandler - returns handler refusing requests other than rpc
+// until readyCh is closed.
+func setXLReadyHandler(readyCh <-chan struct{}) HandlerFunc {
+	return func(h http.Handler) http.Handler {
+		return xlReadyHandler{handler: h, readyCh: readyCh}
+	}
+}
+
+func (h xlReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isRPCRequest(r) {
+		select {
+		case <-h.readyCh:
+		default:
+			writeErrorResponse(w, r, ErrServerNotInitialized, r.URL.Path)
+			return
+		}
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
 // Supported Amz date formats.
 var amzDateFormats = []string{
 	time.RFC1123,
@@ -168,6 +194,11 @@ func setTimeValidityHandler(h http.Handler) http.Handler {
 }
 
 func (h timeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Health checks are not signed, skip date verification.
+	if isHealthCheckRequest(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
 	// Verify if date headers are set, if not reject the request
 	if _, ok := r.Header["Authorization"]; ok {
 		amzDate, apiErr := parseAmzDateHeader(r)
@@ -17,9 +17,12 @@
 package main
 
 import (
+	"time"
+
 	"github.com/fatih/color"
 	"github.com/minio/cli"
 	"github.com/minio/mc/pkg/console"
+	"github.com/minio/minio/pkg/tasker"
 )
 
 // Global constants for Minio.
@@ -29,17 +32,29 @@ const (
 
 // minio configuration related constants.
 const (
-	globalMinioConfigVersion = "4"
+	globalMinioConfigVersion = "6"
 	globalMinioConfigDir     = ".minio"
 	globalMinioCertsDir      = ".minio/certs"
 	globalMinioCertFile      = "public.crt"
 	globalMinioKeyFile       = "private.key"
 	globalMinioConfigFile    = "config.json"
+
+	globalMinioIAMConfigVersion = "1"
+	globalMinioIAMConfigFile    = "iam.json"
 )
 
 var (
 	globalQuiet = false // Quiet flag set via command line
 	globalDebug = false // Debug flag set via command line
+	// Server boot time, used to report uptime.
+	globalBootTime = time.Now().UTC()
+	// Controls all the background tasks.
+	globalTaskCtl = tasker.New("Minio Background Tasks")
+	// Address the server listens on, used to find local disks.
+	globalMinioAddr = ":9000"
+	// Serve prometheus metrics without authentication, set by
+	// MINIO_PROMETHEUS_AUTH_TYPE=public.
+	globalMetricsPublic = false
 	// Add new global flags here.
 )
 
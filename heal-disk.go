@@ -0,0 +1,363 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/minio/minio/pkg/tasker"
+)
+
+const (
+	// Interval for checking for replaced disks.
+	diskCheckInterval = time.Minute
+	// Marker of a disk being healed along with its progress, saved
+	// in minio meta volume of the disk.
+	diskHealingFile         = "healing.json"
+	diskHealProgressVersion = "1"
+	// Progress is saved after healing these many files.
+	diskHealSaveInterval = 100
+)
+
+// isDiskMetaFile - verifies if a file of minio meta volume belongs to
+// the disk itself or to a write in progress, such files are not
+// healed.
+func isDiskMetaFile(volume, path string) bool {
+	if isTmpPath(volume, path) {
+		return true
+	}
+	return volume == minioMetaBucket && (path == formatConfigFile || path == diskHealingFile)
+}
+
+// DiskHealProgress - progress of healing a replaced disk, saved on the
+// disk so that a restart resumes healing.
+type DiskHealProgress struct {
+	Version        string    `json:"version"`
+	Set            int       `json:"set"`
+	Disk           int       `json:"disk"`
+	Path           string    `json:"path"`
+	Volume         string    `json:"volume"`
+	Marker         string    `json:"marker"`
+	ObjectsScanned int64     `json:"objectsScanned"`
+	ObjectsFailed  int64     `json:"objectsFailed"`
+	StartTime      time.Time `json:"startTime"`
+}
+
+// ListDiskHealResponse - format for list disk heals response.
+type ListDiskHealResponse struct {
+	Disks []DiskHealProgress `json:"disks"`
+}
+
+// newDiskHealProgress - initialize progress of healing the disk at
+// position of set.
+func newDiskHealProgress(set, disk int, storage StorageAPI) *DiskHealProgress {
+	return &DiskHealProgress{
+		Version:   diskHealProgressVersion,
+		Set:       set,
+		Disk:      disk,
+		Path:      getStorageDiskPath(storage),
+		StartTime: time.Now().UTC(),
+	}
+}
+
+// loadDiskHealProgress - reads heal progress of a disk, returns
+// errFileNotFound if the disk is not being healed.
+func loadDiskHealProgress(disk StorageAPI) (*DiskHealProgress, error) {
+	reader, err := disk.ReadFile(minioMetaBucket, diskHealingFile, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	progress := &DiskHealProgress{}
+	if err = json.NewDecoder(reader).Decode(progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// saveDiskHealProgress - writes heal progress to the disk being healed.
+func saveDiskHealProgress(disk StorageAPI, progress DiskHealProgress) error {
+	progressBytes, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	writer, err := disk.CreateFile(minioMetaBucket, diskHealingFile)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(progressBytes); err != nil {
+		safeCloseAndRemove(writer)
+		return err
+	}
+	return writer.Close()
+}
+
+// getSetFormat - returns format of any formatted disk of the set.
+func getSetFormat(xl *XL) *formatXLV1 {
+	for _, disk := range xl.disks() {
+		if disk == nil {
+			continue
+		}
+		if format, err := loadFormatXL(disk); err == nil {
+			return format
+		}
+	}
+	return nil
+}
+
+// diskPosition - position of a disk in the erasure sets.
+type diskPosition struct {
+	set, disk int
+}
+
+// diskHealer - detects empty disks which replaced lost ones, formats
+// them and heals every volume and file of their erasure set onto
+// them. Reads heal files lazily, but redundancy should not depend on
+// files being read.
+type diskHealer struct {
+	*healTask
+	sets          []*XL
+	checkInterval time.Duration
+	healing       map[diskPosition]*DiskHealProgress
+}
+
+// Global disk healer, only initialized on XL backend.
+var globalDiskHealer *diskHealer
+
+// newDiskHealer - initialize disk healer.
+func newDiskHealer(sets []*XL, handle tasker.Handle) *diskHealer {
+	return &diskHealer{
+		healTask:      newHealTask(handle),
+		sets:          sets,
+		checkInterval: diskCheckInterval,
+		healing:       make(map[diskPosition]*DiskHealProgress),
+	}
+}
+
+// startDiskHealer - starts disk healer as a task of the global task
+// controller.
+func startDiskHealer(sets []*XL) {
+	handle := globalTaskCtl.NewTask("Disk Healer")
+	globalDiskHealer = newDiskHealer(sets, handle)
+	go globalDiskHealer.run()
+}
+
+// Status - returns progress of all the disks being healed.
+func (h *diskHealer) Status() ListDiskHealResponse {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	disks := []DiskHealProgress{}
+	for set := range h.sets {
+		for disk := range h.sets[set].storageDisks {
+			if progress, ok := h.healing[diskPosition{set, disk}]; ok {
+				disks = append(disks, *progress)
+			}
+		}
+	}
+	return ListDiskHealResponse{Disks: disks}
+}
+
+// check - places disks identified since boot by their format, looks
+// for unformatted disks at known positions and formats them, disks
+// being healed before a restart are picked up again. Disks formatted
+// for another position are taken out of their position.
+func (h *diskHealer) check() {
+	for _, xl := range h.sets {
+		if reference := getSetFormat(xl); reference != nil {
+			placeDisks(h.sets, reference)
+			break
+		}
+	}
+	for set, xl := range h.sets {
+		reference := getSetFormat(xl)
+		for index, disk := range xl.disks() {
+			pos := diskPosition{set, index}
+			h.mutex.Lock()
+			_, healing := h.healing[pos]
+			h.mutex.Unlock()
+			if healing || disk == nil || reference == nil {
+				continue
+			}
+			format, err := loadFormatXL(disk)
+			if err == nil {
+				if format.XL.DeploymentID != reference.XL.DeploymentID || format.XL.Disk != reference.XL.Sets[set][index] {
+					log.WithFields(logrus.Fields{
+						"set":  set,
+						"disk": index,
+						"path": getStorageDiskPath(disk),
+					}).Errorf("Disk is not formatted for its position, %s", errInconsistentFormat)
+					xl.unplaceDisk(index)
+					continue
+				}
+				// Resume healing of disks replaced earlier.
+				if progress, err := loadDiskHealProgress(disk); err == nil {
+					h.mutex.Lock()
+					h.healing[pos] = progress
+					h.mutex.Unlock()
+				}
+				continue
+			}
+			if err != errUnformattedDisk {
+				// Disk is offline.
+				continue
+			}
+			if err = saveFormatXL(disk, *reference, reference.XL.Sets[set][index]); err != nil {
+				log.WithFields(logrus.Fields{
+					"set":  set,
+					"disk": index,
+				}).Errorf("Formatting replaced disk failed with %s", err)
+				continue
+			}
+			progress := newDiskHealProgress(set, index, disk)
+			if err = saveDiskHealProgress(disk, *progress); err != nil {
+				log.WithFields(logrus.Fields{
+					"set":  set,
+					"disk": index,
+				}).Errorf("Saving disk heal progress failed with %s", err)
+				continue
+			}
+			log.WithFields(logrus.Fields{
+				"set":  set,
+				"disk": index,
+				"path": progress.Path,
+			}).Info("Formatted replaced disk, healing all files onto it")
+			h.mutex.Lock()
+			h.healing[pos] = progress
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// healDisks - heals all the disks being healed one after another.
+func (h *diskHealer) healDisks() error {
+	for set := range h.sets {
+		for disk := range h.sets[set].storageDisks {
+			pos := diskPosition{set, disk}
+			h.mutex.Lock()
+			_, healing := h.healing[pos]
+			h.mutex.Unlock()
+			if !healing {
+				continue
+			}
+			if err := h.healDisk(pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// healDisk - heals every volume and file of the set onto the disk,
+// resuming from the saved progress. Files are healed on all the disks
+// of the set missing them.
+func (h *diskHealer) healDisk(pos diskPosition) error {
+	xl := h.sets[pos.set].background()
+	disk := xl.storageDisks[pos.disk]
+	h.mutex.Lock()
+	progress := h.healing[pos]
+	h.mutex.Unlock()
+
+	for _, volume := range listAllVols(xl) {
+		h.mutex.Lock()
+		if volume < progress.Volume {
+			// Already healed.
+			h.mutex.Unlock()
+			continue
+		}
+		marker := ""
+		if volume == progress.Volume {
+			marker = progress.Marker
+		} else {
+			progress.Volume = volume
+			progress.Marker = ""
+		}
+		h.mutex.Unlock()
+
+		if err := xl.healVolume(volume); err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+				"path":   progress.Path,
+			}).Errorf("Healing volume onto replaced disk failed with %s", err)
+			continue
+		}
+		for {
+			names, eof := listAllFiles(xl, volume, marker)
+			for _, name := range names {
+				h.mutex.Lock()
+				throttle := h.throttle
+				h.mutex.Unlock()
+				if err := h.wait(throttle); err != nil {
+					return err
+				}
+				err := xl.healFile(volume, name)
+				h.mutex.Lock()
+				progress.Marker = name
+				progress.ObjectsScanned++
+				if err != nil {
+					progress.ObjectsFailed++
+				}
+				save := progress.ObjectsScanned%diskHealSaveInterval == 0
+				saved := *progress
+				h.mutex.Unlock()
+				if save {
+					errorIf(saveDiskHealProgress(disk, saved), "Unable to save disk heal progress.", nil)
+				}
+				marker = name
+			}
+			if eof || len(names) == 0 {
+				break
+			}
+		}
+	}
+
+	// Disk is fully healed, remove the marker.
+	if err := disk.DeleteFile(minioMetaBucket, diskHealingFile); err != nil && err != errFileNotFound {
+		errorIf(err, "Unable to remove disk heal progress.", nil)
+	}
+	h.mutex.Lock()
+	delete(h.healing, pos)
+	h.mutex.Unlock()
+	log.WithFields(logrus.Fields{
+		"set":            pos.set,
+		"disk":           pos.disk,
+		"path":           progress.Path,
+		"objectsScanned": progress.ObjectsScanned,
+		"objectsFailed":  progress.ObjectsFailed,
+	}).Info("Healing replaced disk finished")
+	return nil
+}
+
+// run - periodically checks for replaced disks and heals them until
+// the task is ended.
+func (h *diskHealer) run() {
+	for {
+		h.check()
+		err := h.healDisks()
+		if err == nil {
+			err = h.wait(h.checkInterval)
+		}
+		if err == errHealScannerClosed {
+			return
+		}
+		if err == errHealScannerEnded {
+			h.handle.Close()
+			return
+		}
+	}
+}
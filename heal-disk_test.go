@@ -0,0 +1,142 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio/pkg/tasker"
+)
+
+// Tests replaced disks are detected, formatted and healed with all
+// the files of their set.
+func TestDiskHealer(t *testing.T) {
+	initNSLock()
+
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objAPI := xlObjects{xl}
+	data := []byte("hello world")
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		if err = objAPI.MakeBucket(bucket); err != nil {
+			t.Fatal(err)
+		}
+		for _, object := range []string{"object1", "object2"} {
+			if _, err = objAPI.PutObject(bucket, object, int64(len(data)), bytes.NewReader(data), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	diskIDs := getDiskIDs(t, xl)
+
+	// Disk is swapped for an empty one.
+	if err = os.RemoveAll(disks[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(disks[2], 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	taskCtl := tasker.New("Test Tasks")
+	healer := newDiskHealer([]*XL{xl}, taskCtl.NewTask("Test Disk Healer"))
+	healer.throttle = 0
+	healer.check()
+	status := healer.Status()
+	if len(status.Disks) != 1 || status.Disks[0].Disk != 2 {
+		t.Fatalf("Expected replaced disk to be detected, got %#v", status.Disks)
+	}
+	if diskID := getDiskIDs(t, xl)[2]; diskID != diskIDs[2] {
+		t.Fatalf("Expected replaced disk to be formatted as %s, got %s", diskIDs[2], diskID)
+	}
+	if err = healer.healDisks(); err != nil {
+		t.Fatal(err)
+	}
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		for _, object := range []string{"object1", "object2"} {
+			// Small objects are saved inline in their metadata.
+			metadataPath := filepath.Join(disks[2], bucket, object, xlMetaV1File)
+			if _, err = os.Stat(metadataPath); err != nil {
+				t.Fatalf("Expected %s to be healed, got %s", metadataPath, err)
+			}
+		}
+	}
+	if status = healer.Status(); len(status.Disks) != 0 {
+		t.Fatalf("Expected healing to be finished, got %#v", status.Disks)
+	}
+	if _, err = loadDiskHealProgress(xl.storageDisks[2]); err != errFileNotFound {
+		t.Fatalf("Expected heal progress to be removed, got %v", err)
+	}
+
+	// Disks formatted at startup are healed after a restart.
+	if err = os.RemoveAll(disks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(disks[1], 0700); err != nil {
+		t.Fatal(err)
+	}
+	if xl, err = newTestFormattedXL(t, disks...); err != nil {
+		t.Fatal(err)
+	}
+	healer = newDiskHealer([]*XL{xl}, taskCtl.NewTask("Restarted Disk Healer"))
+	healer.throttle = 0
+	healer.check()
+	if status = healer.Status(); len(status.Disks) != 1 || status.Disks[0].Disk != 1 {
+		t.Fatalf("Expected disk formatted at startup to be healed, got %#v", status.Disks)
+	}
+	if err = healer.healDisks(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(disks[1], "bucket2", "object2", xlMetaV1File)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests disks formatted for another position are taken out of their
+// position and placed again by their format.
+func TestDiskHealerMisplacedDisks(t *testing.T) {
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskIDs := getDiskIDs(t, xl)
+	xl.storageDisks[1], xl.storageDisks[2] = xl.storageDisks[2], xl.storageDisks[1]
+
+	taskCtl := tasker.New("Test Tasks")
+	healer := newDiskHealer([]*XL{xl}, taskCtl.NewTask("Test Disk Healer"))
+	healer.check()
+	if xl.storageDisks[1] != nil || xl.storageDisks[2] != nil {
+		t.Fatalf("Expected misplaced disks to be taken out, got %v", xl.storageDisks)
+	}
+	if status := healer.Status(); len(status.Disks) != 0 {
+		t.Fatalf("Expected misplaced disks not to be healed, got %#v", status.Disks)
+	}
+	healer.check()
+	for index, diskID := range getDiskIDs(t, xl) {
+		if diskID != diskIDs[index] {
+			t.Fatalf("Disk %d: expected %s, got %s", index, diskIDs[index], diskID)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/minio/minio/pkg/quick"
+	"github.com/minio/minio/pkg/tasker"
+)
+
+// Heal scanner errors, used to unwind the scanner.
+var (
+	errHealScannerEnded  = errors.New("Heal scanner ended")
+	errHealScannerClosed = errors.New("Heal scanner task closed")
+)
+
+const (
+	// Heal scanner progress file, saved in config directory.
+	healScannerProgressFile    = "heal-scanner.json"
+	healScannerProgressVersion = "1"
+	// Progress is saved after scanning these many files.
+	healScannerSaveInterval = 100
+	// Delay between two full passes over all the volumes.
+	healScannerPassInterval = time.Hour
+)
+
+// getHealScannerThrottle - delay between healing two files, keeps
+// the scanner from starving foreground I/O.
+func getHealScannerThrottle(priority tasker.Command) time.Duration {
+	switch priority {
+	case tasker.CmdPriorityLow:
+		return 100 * time.Millisecond
+	case tasker.CmdPriorityHigh, tasker.CmdPrioritySuper:
+		return 0
+	}
+	return 10 * time.Millisecond
+}
+
+// HealScannerProgress - position and counters of the heal scanner,
+// saved periodically so that a restart resumes the current pass.
+type HealScannerProgress struct {
+	Version       string    `json:"version"`
+	Set           int       `json:"set"`
+	Volume        string    `json:"volume"`
+	Marker        string    `json:"marker"`
+	FilesScanned  int64     `json:"filesScanned"`
+	FilesHealed   int64     `json:"filesHealed"`
+	LastCompleted time.Time `json:"lastCompleted"`
+}
+
+// HealScannerStatus - format for heal scanner status response.
+type HealScannerStatus struct {
+	Suspended bool                `json:"suspended"`
+	Progress  HealScannerProgress `json:"progress"`
+}
+
+// healTask - background heal task of the task controller, complies
+// with suspend, resume, end and priority commands. Mutex also guards
+// state of the healer embedding the task.
+type healTask struct {
+	handle tasker.Handle
+
+	mutex     *sync.Mutex
+	suspended bool
+	throttle  time.Duration
+}
+
+// newHealTask - initialize heal task with medium priority.
+func newHealTask(handle tasker.Handle) *healTask {
+	return &healTask{
+		handle:   handle,
+		mutex:    &sync.Mutex{},
+		throttle: getHealScannerThrottle(tasker.CmdPriorityMedium),
+	}
+}
+
+// healScanner - walks every volume and file of all the erasure sets
+// in background and heals the ones which are degraded.
+type healScanner struct {
+	*healTask
+	sets         []*XL
+	progressFile string
+	passInterval time.Duration
+	progress     HealScannerProgress
+}
+
+// Global heal scanner, only initialized on XL backend.
+var globalHealScanner *healScanner
+
+// newHealScanner - initialize heal scanner, loads previously saved
+// progress if any.
+func newHealScanner(sets []*XL, handle tasker.Handle, progressFile string) *healScanner {
+	s := &healScanner{
+		healTask:     newHealTask(handle),
+		sets:         sets,
+		progressFile: progressFile,
+		passInterval: healScannerPassInterval,
+		progress:     HealScannerProgress{Version: healScannerProgressVersion},
+	}
+	progress := &HealScannerProgress{Version: healScannerProgressVersion}
+	qc, err := quick.New(progress)
+	if err == nil {
+		if err = qc.Load(progressFile); err == nil {
+			s.progress = *qc.Data().(*HealScannerProgress)
+		} else if !os.IsNotExist(err) {
+			errorIf(err, "Unable to load heal scanner progress.", nil)
+		}
+	}
+	return s
+}
+
+// startHealScanner - starts heal scanner as a task of the global task
+// controller.
+func startHealScanner(sets []*XL) error {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	handle := globalTaskCtl.NewTask("Background Heal Scanner")
+	globalHealScanner = newHealScanner(sets, handle, filepath.Join(configPath, healScannerProgressFile))
+	go globalHealScanner.run()
+	return nil
+}
+
+// Status - returns heal scanner status.
+func (s *healScanner) Status() HealScannerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return HealScannerStatus{
+		Suspended: s.suspended,
+		Progress:  s.progress,
+	}
+}
+
+// saveProgress - saves progress to the progress file.
+func (s *healScanner) saveProgress() {
+	s.mutex.Lock()
+	progress := s.progress
+	s.mutex.Unlock()
+
+	qc, err := quick.New(&progress)
+	if err == nil {
+		err = qc.Save(s.progressFile)
+	}
+	errorIf(err, "Unable to save heal scanner progress.", nil)
+}
+
+// handleCommand - complies with a command from the task controller,
+// suspending blocks until the task is resumed or ended.
+func (t *healTask) handleCommand(cmd tasker.Command, ok bool) error {
+	if !ok {
+		return errHealScannerClosed
+	}
+	switch cmd {
+	case tasker.CmdSignalEnd, tasker.CmdSignalAbort:
+		t.handle.StatusDone()
+		return errHealScannerEnded
+	case tasker.CmdSignalSuspend:
+		t.mutex.Lock()
+		t.suspended = true
+		t.mutex.Unlock()
+		t.handle.StatusDone()
+		for {
+			cmd, ok = <-t.handle.Listen()
+			if !ok {
+				return errHealScannerClosed
+			}
+			if cmd == tasker.CmdSignalResume {
+				t.mutex.Lock()
+				t.suspended = false
+				t.mutex.Unlock()
+				t.handle.StatusDone()
+				return nil
+			}
+			if cmd == tasker.CmdSignalSuspend {
+				t.handle.StatusDone()
+				continue
+			}
+			if err := t.handleCommand(cmd, ok); err != nil {
+				return err
+			}
+		}
+	case tasker.CmdPriorityLow, tasker.CmdPriorityMedium, tasker.CmdPriorityHigh, tasker.CmdPrioritySuper:
+		t.mutex.Lock()
+		t.throttle = getHealScannerThrottle(cmd)
+		t.mutex.Unlock()
+	}
+	t.handle.StatusDone()
+	return nil
+}
+
+// wait - waits for the duration while complying with commands.
+func (t *healTask) wait(duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case cmd, ok := <-t.handle.Listen():
+			if err := t.handleCommand(cmd, ok); err != nil {
+				return err
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// listAllVols - lists volumes present on any of the disks, a volume
+// missing on some disks is still healed.
+func listAllVols(xl *XL) []string {
+	volumes := make(map[string]struct{})
+	for _, disk := range xl.storageDisks {
+		if disk == nil {
+			continue
+		}
+		volsInfo, err := disk.ListVols()
+		if err != nil {
+			continue
+		}
+		for _, volInfo := range volsInfo {
+			volumes[volInfo.Name] = struct{}{}
+		}
+	}
+	return sortedKeys(volumes)
+}
+
+// listAllFiles - merges file listings of all the disks, a file missing
+// on some disks is still healed. Returns at most healListLimit names.
+func listAllFiles(xl *XL, volume, marker string) (names []string, eof bool) {
+	files := make(map[string]struct{})
+	eof = true
+	for _, disk := range xl.storageDisks {
+		if disk == nil {
+			continue
+		}
+		filesInfo, diskEOF, err := listFiles(disk, volume, "", marker, true, healListLimit)
+		if err != nil {
+			continue
+		}
+		for _, fileInfo := range filesInfo {
+			// Every disk has its own format and heal progress.
+			if isDiskMetaFile(volume, fileInfo.Name) {
+				continue
+			}
+			files[fileInfo.Name] = struct{}{}
+		}
+		if !diskEOF {
+			eof = false
+		}
+	}
+	names = sortedKeys(files)
+	if len(names) > healListLimit {
+		names = names[:healListLimit]
+		eof = false
+	}
+	return names, eof
+}
+
+// needsHeal - compares file metadata across all the disks, a file
+// missing on some disks or with differing metadata needs healing.
+func (s *healScanner) needsHeal(xl *XL, volume, path string) bool {
+	dLock := nsMutex.RLock(volume, path)
+	partsMetadata, errs := xl.getPartsMetadata(volume, path)
+	nsMutex.RUnlock(volume, path, dLock)
+
+	var first *xlMetaV1
+	for index := range partsMetadata {
+		if errs[index] != nil {
+			return true
+		}
+		if first == nil {
+			first = &partsMetadata[index]
+			continue
+		}
+		if partsMetadata[index].Stat.Version != first.Stat.Version ||
+			partsMetadata[index].Stat.Size != first.Stat.Size ||
+			!partsMetadata[index].Stat.ModTime.Equal(first.Stat.ModTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// healFile - heals a file if needed and records progress.
+func (s *healScanner) healFile(xl *XL, volume, path string) {
+	healed := false
+	if s.needsHeal(xl, volume, path) {
+		if err := xl.healFile(volume, path); err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+				"path":   path,
+			}).Errorf("Background healing failed with %s", err)
+		} else {
+			healed = true
+		}
+	}
+
+	s.mutex.Lock()
+	s.progress.Marker = path
+	s.progress.FilesScanned++
+	if healed {
+		s.progress.FilesHealed++
+	}
+	save := s.progress.FilesScanned%healScannerSaveInterval == 0
+	s.mutex.Unlock()
+
+	if save {
+		s.saveProgress()
+	}
+}
+
+// scanVolume - heals a volume and all its files starting after
+// marker.
+func (s *healScanner) scanVolume(xl *XL, volume, marker string) error {
+	if err := xl.healVolume(volume); err != nil {
+		return err
+	}
+	for {
+		names, eof := listAllFiles(xl, volume, marker)
+		for _, name := range names {
+			s.mutex.Lock()
+			throttle := s.throttle
+			s.mutex.Unlock()
+			if err := s.wait(throttle); err != nil {
+				return err
+			}
+			s.healFile(xl, volume, name)
+			marker = name
+		}
+		if eof || len(names) == 0 {
+			return nil
+		}
+	}
+}
+
+// scan - makes one full pass over all the sets, resuming from the
+// saved progress.
+func (s *healScanner) scan() error {
+	for index, xl := range s.sets {
+		s.mutex.Lock()
+		if index < s.progress.Set {
+			// Already scanned in this pass.
+			s.mutex.Unlock()
+			continue
+		}
+		if index > s.progress.Set {
+			s.progress.Set = index
+			s.progress.Volume = ""
+			s.progress.Marker = ""
+		}
+		s.mutex.Unlock()
+
+		if err := s.scanSet(xl.background()); err != nil {
+			return err
+		}
+	}
+
+	// Pass completed, start next pass from the beginning.
+	s.mutex.Lock()
+	s.progress.Set = 0
+	s.progress.Volume = ""
+	s.progress.Marker = ""
+	s.progress.LastCompleted = time.Now().UTC()
+	s.mutex.Unlock()
+	return nil
+}
+
+// scanSet - makes one pass over all the volumes of a set, resuming
+// from the saved progress.
+func (s *healScanner) scanSet(xl *XL) error {
+	for _, volume := range listAllVols(xl) {
+		s.mutex.Lock()
+		if volume < s.progress.Volume {
+			// Already scanned in this pass.
+			s.mutex.Unlock()
+			continue
+		}
+		marker := ""
+		if volume == s.progress.Volume {
+			marker = s.progress.Marker
+		} else {
+			s.progress.Volume = volume
+			s.progress.Marker = ""
+		}
+		s.mutex.Unlock()
+
+		if err := s.scanVolume(xl, volume, marker); err != nil {
+			if err == errHealScannerEnded || err == errHealScannerClosed {
+				return err
+			}
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+			}).Errorf("Background healing of volume failed with %s", err)
+		}
+	}
+	return nil
+}
+
+// run - keeps scanning until the task is ended.
+func (s *healScanner) run() {
+	for {
+		err := s.scan()
+		s.saveProgress()
+		if err == errHealScannerClosed {
+			// Task controller has already released this task.
+			return
+		}
+		if err == errHealScannerEnded {
+			s.handle.Close()
+			return
+		}
+		if err = s.wait(s.passInterval); err != nil {
+			if err == errHealScannerEnded {
+				s.handle.Close()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minio/minio/pkg/tasker"
+)
+
+// Tests heal scanner heals degraded files and resumes from saved
+// progress.
+func TestHealScanner(t *testing.T) {
+	initNSLock()
+
+	var disks []string
+	for i := 0; i < 4; i++ {
+		disk, err := ioutil.TempDir("", "minio-heal-scanner-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+	objAPI, err := newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl, _ := getXLStorage(objAPI)
+	data := []byte("hello world")
+	for _, bucket := range []string{"bucket1", "bucket2"} {
+		if err = objAPI.MakeBucket(bucket); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = objAPI.PutObject(bucket, "object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Degrade both objects, second one loses its bucket on a disk.
+	if err = os.RemoveAll(filepath.Join(disks[0], "bucket1", "object")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(filepath.Join(disks[1], "bucket2")); err != nil {
+		t.Fatal(err)
+	}
+
+	progressDir, err := ioutil.TempDir("", "minio-heal-scanner-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(progressDir)
+	progressFile := filepath.Join(progressDir, healScannerProgressFile)
+
+	taskCtl := tasker.New("Test Tasks")
+	scanner := newHealScanner([]*XL{xl}, taskCtl.NewTask("Test Heal Scanner"), progressFile)
+	scanner.throttle = 0
+	if err = scanner.scan(); err != nil {
+		t.Fatal(err)
+	}
+	scanner.saveProgress()
+	status := scanner.Status()
+	if status.Progress.FilesScanned != 2 || status.Progress.FilesHealed != 2 {
+		t.Fatalf("Unexpected heal scanner progress %#v", status.Progress)
+	}
+	if status.Progress.LastCompleted.IsZero() || status.Progress.Volume != "" {
+		t.Fatalf("Expected pass to be completed, got %#v", status.Progress)
+	}
+	for _, metadataPath := range []string{
+		filepath.Join(disks[0], "bucket1", "object", xlMetaV1File),
+		filepath.Join(disks[1], "bucket2", "object", xlMetaV1File),
+	} {
+		if _, err = os.Stat(metadataPath); err != nil {
+			t.Fatalf("Expected %s to be healed, got %s", metadataPath, err)
+		}
+	}
+
+	// Restarted scanner resumes after the saved marker.
+	scanner.progress.Volume = "bucket1"
+	scanner.progress.Marker = "object"
+	scanner.saveProgress()
+	resumed := newHealScanner([]*XL{xl}, taskCtl.NewTask("Resumed Heal Scanner"), progressFile)
+	resumed.throttle = 0
+	if resumed.Status().Progress.Marker != "object" {
+		t.Fatalf("Expected progress to be loaded, got %#v", resumed.Status().Progress)
+	}
+	if err = resumed.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if scanned := resumed.Status().Progress.FilesScanned; scanned != 3 {
+		t.Fatalf("Expected only one more file to be scanned, got %d", scanned)
+	}
+}
+
+// Tests heal scanner complies with suspend and resume commands.
+func TestHealScannerSuspendResume(t *testing.T) {
+	progressDir, err := ioutil.TempDir("", "minio-heal-scanner-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(progressDir)
+
+	taskCtl := tasker.New("Test Tasks")
+	scanner := newHealScanner([]*XL{{placement: &diskPlacement{}}}, taskCtl.NewTask("Test Heal Scanner"), filepath.Join(progressDir, healScannerProgressFile))
+	scanner.passInterval = time.Hour
+	go scanner.run()
+
+	if !taskCtl.Suspend() {
+		t.Fatal("Expected heal scanner to be suspended")
+	}
+	if !scanner.Status().Suspended {
+		t.Fatal("Expected heal scanner status to be suspended")
+	}
+	if !taskCtl.Resume() {
+		t.Fatal("Expected heal scanner to be resumed")
+	}
+	if scanner.Status().Suspended {
+		t.Fatal("Expected heal scanner status to be resumed")
+	}
+	taskCtl.Shutdown()
+}
@@ -0,0 +1,110 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	router "github.com/gorilla/mux"
+)
+
+// Health check paths.
+const (
+	healthCheckPathPrefix = reservedBucket + "/health"
+	healthCheckLivePath   = healthCheckPathPrefix + "/live"
+	healthCheckReadyPath  = healthCheckPathPrefix + "/ready"
+)
+
+// healthCheckHandlers - serves liveness and readiness probes.
+type healthCheckHandlers struct {
+	ObjectAPI ObjectLayer
+}
+
+// registerHealthCheckRouter - registers health check endpoints.
+func registerHealthCheckRouter(mux *router.Router, api healthCheckHandlers) {
+	healthRouter := mux.NewRoute().PathPrefix(healthCheckPathPrefix).Subrouter()
+
+	// Liveness probe.
+	healthRouter.Methods("GET", "HEAD").Path("/live").HandlerFunc(api.LivenessCheckHandler)
+	// Readiness probe.
+	healthRouter.Methods("GET", "HEAD").Path("/ready").HandlerFunc(api.ReadinessCheckHandler)
+}
+
+// isHealthCheckRequest - health checks are served without verifying
+// authorization and date headers.
+func isHealthCheckRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, healthCheckPathPrefix+slashSeparator)
+}
+
+// countOnlineDisks - probes every disk by listing its volumes,
+// returns number of online disks and total number of disks.
+func countOnlineDisks(storageDisks []StorageAPI) (onlineDisks int, totalDisks int) {
+	for _, disk := range storageDisks {
+		if disk == nil {
+			continue
+		}
+		if _, err := disk.ListVols(); err == nil {
+			onlineDisks++
+		}
+	}
+	return onlineDisks, len(storageDisks)
+}
+
+// isObjectLayerReady - object layer is ready only if enough disks are
+// online to meet both read and write quorum, and XL disks are ordered
+// by their format.
+func isObjectLayerReady(objAPI ObjectLayer) bool {
+	if sets, ok := getXLSets(objAPI); ok {
+		// Every erasure set should have its quorum.
+		for _, xl := range sets {
+			if !xl.formatted {
+				return false
+			}
+			onlineDisks, _ := countOnlineDisks(xl.disks())
+			if onlineDisks < xl.readQuorum || onlineDisks < xl.writeQuorum {
+				return false
+			}
+		}
+		return true
+	}
+	if fs, ok := objAPI.(fsObjects); ok {
+		onlineDisks, totalDisks := countOnlineDisks([]StorageAPI{fs.storage})
+		return onlineDisks == totalDisks
+	}
+	return false
+}
+
+// LivenessCheckHandler - GET /minio/health/live
+// ----------
+// Reports the server process is up and serving requests.
+func (api healthCheckHandlers) LivenessCheckHandler(w http.ResponseWriter, r *http.Request) {
+	writeSuccessResponse(w, nil)
+}
+
+// ReadinessCheckHandler - GET /minio/health/ready
+// ----------
+// Reports the server is ready to serve requests, which requires the
+// server config to be loaded and the object layer to meet read and
+// write quorum.
+func (api healthCheckHandlers) ReadinessCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if serverConfig == nil || iamConfig == nil || !isObjectLayerReady(api.ObjectAPI) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	writeSuccessResponse(w, nil)
+}
@@ -0,0 +1,64 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests readiness of XL object layer depends on disk format and
+// quorum.
+func TestIsObjectLayerReady(t *testing.T) {
+	var disks []string
+	for i := 0; i < 4; i++ {
+		disk, err := ioutil.TempDir("", "minio-health-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+	objAPI, err := newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isObjectLayerReady(objAPI) {
+		t.Fatal("Expected object layer to be not ready before disks are formatted")
+	}
+	sets, _ := getXLSets(objAPI)
+	if err = initFormatXL(sets, true); err != nil {
+		t.Fatal(err)
+	}
+	if !isObjectLayerReady(objAPI) {
+		t.Fatal("Expected object layer to be ready")
+	}
+	// Write quorum for 2 data and 2 parity needs 3 disks online.
+	if err = os.RemoveAll(disks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !isObjectLayerReady(objAPI) {
+		t.Fatal("Expected object layer to be ready with quorum")
+	}
+	if err = os.RemoveAll(disks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if isObjectLayerReady(objAPI) {
+		t.Fatal("Expected object layer to be not ready without quorum")
+	}
+}
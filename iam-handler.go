@@ -0,0 +1,189 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// getRequestAccessKey - get access key of a signed or presigned
+// request. Signature itself is not verified here, handlers verify it
+// later through isReqAuthenticated.
+func getRequestAccessKey(r *http.Request) (string, APIErrorCode) {
+	switch getRequestAuthType(r) {
+	case authTypeSigned:
+		signV4Values, s3Error := parseSignV4(r.Header.Get("Authorization"))
+		if s3Error != ErrNone {
+			return "", s3Error
+		}
+		return signV4Values.Credential.accessKey, ErrNone
+	case authTypePresigned:
+		preSignValues, s3Error := parsePreSignV4(r.URL.Query())
+		if s3Error != ErrNone {
+			return "", s3Error
+		}
+		return preSignValues.Credential.accessKey, ErrNone
+	}
+	return "", ErrAccessDenied
+}
+
+// splitBucketObject - split url path into bucket and object names.
+func splitBucketObject(urlPath string) (bucket, object string) {
+	// Skip the first element which is usually '/' and split the rest.
+	splits := strings.SplitN(strings.TrimPrefix(urlPath, slashSeparator), slashSeparator, 2)
+	bucket = splits[0]
+	if len(splits) == 2 {
+		object = splits[1]
+	}
+	return bucket, object
+}
+
+// getRequestIAMAction - maps incoming S3 request to its policy
+// action, follows the same routes as registerAPIRouter. Returns an
+// empty action for requests whose resources are only known once the
+// request body is read, those are verified by their handlers.
+func getRequestIAMAction(r *http.Request) (action, bucket, object string) {
+	bucket, object = splitBucketObject(r.URL.Path)
+	query := r.URL.Query()
+	_, uploadID := query["uploadId"]
+	if bucket == "" {
+		if r.Method == "GET" {
+			return "s3:ListAllMyBuckets", "", ""
+		}
+		return "", "", ""
+	}
+	if object != "" {
+		switch r.Method {
+		case "GET":
+			if uploadID {
+				return "s3:ListMultipartUploadParts", bucket, object
+			}
+			return "s3:GetObject", bucket, object
+		case "HEAD":
+			return "s3:GetObject", bucket, object
+		case "PUT", "POST":
+			return "s3:PutObject", bucket, object
+		case "DELETE":
+			if uploadID {
+				return "s3:AbortMultipartUpload", bucket, object
+			}
+			return "s3:DeleteObject", bucket, object
+		}
+		return "", "", ""
+	}
+	_, policy := query["policy"]
+	switch r.Method {
+	case "GET":
+		if _, ok := query["location"]; ok {
+			return "s3:GetBucketLocation", bucket, ""
+		}
+		if policy {
+			return "s3:GetBucketPolicy", bucket, ""
+		}
+		if _, ok := query["uploads"]; ok {
+			return "s3:ListBucketMultipartUploads", bucket, ""
+		}
+		return "s3:ListBucket", bucket, ""
+	case "HEAD":
+		return "s3:ListBucket", bucket, ""
+	case "PUT":
+		if policy {
+			return "s3:PutBucketPolicy", bucket, ""
+		}
+		return "s3:CreateBucket", bucket, ""
+	case "DELETE":
+		if policy {
+			return "s3:DeleteBucketPolicy", bucket, ""
+		}
+		return "s3:DeleteBucket", bucket, ""
+	}
+	// POST on bucket is either post policy or multiple delete, object
+	// names are part of the body.
+	return "", "", ""
+}
+
+// getCopySource - get bucket and object names from copy source header.
+func getCopySource(r *http.Request) (bucket, object string) {
+	copySource, err := url.QueryUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return "", ""
+	}
+	return splitBucketObject(copySource)
+}
+
+// getRequestConditions - get conditions for policy verification.
+func getRequestConditions(reqURL *url.URL) map[string]string {
+	conditions := make(map[string]string)
+	for queryParam := range reqURL.Query() {
+		conditions[queryParam] = reqURL.Query().Get(queryParam)
+	}
+	return conditions
+}
+
+// iamPolicyHandler - enforces user and group policies on signed
+// requests before they reach the API handlers.
+type iamPolicyHandler struct {
+	handler http.Handler
+}
+
+// setIAMPolicyHandler to enforce policies attached to the users.
+func setIAMPolicyHandler(h http.Handler) http.Handler {
+	return iamPolicyHandler{h}
+}
+
+func (h iamPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Reserved bucket is not an S3 namespace, admin and web handlers
+	// authorize their requests separately.
+	if strings.HasPrefix(r.URL.Path, reservedBucket+slashSeparator) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	switch getRequestAuthType(r) {
+	case authTypePresigned, authTypeSigned:
+		accessKey, s3Error := getRequestAccessKey(r)
+		if s3Error != ErrNone {
+			// Malformed signatures are rejected by the handlers.
+			break
+		}
+		sessionToken := getRequestSessionToken(r)
+		if _, s3Error = getRequestCredential(accessKey, sessionToken); s3Error != ErrNone {
+			// Unknown access keys and invalid session tokens are
+			// rejected by the handlers.
+			break
+		}
+		action, bucket, object := getRequestIAMAction(r)
+		if action == "" {
+			break
+		}
+		conditions := getRequestConditions(r.URL)
+		if !isRequestActionAllowed(accessKey, sessionToken, action, bucket, object, conditions) {
+			writeErrorResponse(w, r, ErrAccessDenied, r.URL.Path)
+			return
+		}
+		// Copying an object also reads the source object.
+		if r.Method == "PUT" && object != "" && r.Header.Get("X-Amz-Copy-Source") != "" {
+			srcBucket, srcObject := getCopySource(r)
+			if !isRequestActionAllowed(accessKey, sessionToken, "s3:GetObject", srcBucket, srcObject, conditions) {
+				writeErrorResponse(w, r, ErrAccessDenied, r.URL.Path)
+				return
+			}
+		}
+	}
+	h.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,460 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/minio/minio/pkg/quick"
+)
+
+// IAM users, groups and policies errors.
+var (
+	errNoSuchUser        = errors.New("Specified user does not exist")
+	errNoSuchGroup       = errors.New("Specified group does not exist")
+	errNoSuchPolicy      = errors.New("Specified policy does not exist")
+	errPolicyInUse       = errors.New("Specified policy is attached to a user or a group")
+	errInvalidUserStatus = errors.New("User status should be either 'enabled' or 'disabled'")
+	errReservedAccessKey = errors.New("Access key is reserved for the server credential")
+)
+
+// Supported user status values.
+const (
+	iamUserEnabled  = "enabled"
+	iamUserDisabled = "disabled"
+)
+
+// iamUser - additional user with its own secret key and the list of
+// policies attached to it.
+type iamUser struct {
+	SecretKey string   `json:"secretKey"`
+	Status    string   `json:"status"`
+	Policies  []string `json:"policies"`
+}
+
+// iamGroup - group of users sharing the list of policies attached
+// to it.
+type iamGroup struct {
+	Members  []string `json:"members"`
+	Policies []string `json:"policies"`
+}
+
+// iamConfigV1 users, groups and policies version '1'. Users are keyed
+// by their access key, groups and policies by their names.
+type iamConfigV1 struct {
+	Version  string                  `json:"version"`
+	Users    map[string]iamUser      `json:"users"`
+	Groups   map[string]iamGroup     `json:"groups"`
+	Policies map[string]BucketPolicy `json:"policies"`
+
+	// Read Write mutex.
+	rwMutex *sync.RWMutex
+}
+
+// iamConfig users, groups and policies.
+var iamConfig *iamConfigV1
+
+// newIAMConfig - initialize an empty iam config.
+func newIAMConfig() *iamConfigV1 {
+	return &iamConfigV1{
+		Version:  globalMinioIAMConfigVersion,
+		Users:    make(map[string]iamUser),
+		Groups:   make(map[string]iamGroup),
+		Policies: make(map[string]BucketPolicy),
+		rwMutex:  &sync.RWMutex{},
+	}
+}
+
+// getIAMConfigFile get iam config file.
+func getIAMConfigFile() (string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configPath, globalMinioIAMConfigFile), nil
+}
+
+// initIAMConfig - load saved users, groups and policies. The iam
+// config file is only created once the first entry is added.
+func initIAMConfig() error {
+	iamFile, err := getIAMConfigFile()
+	if err != nil {
+		return err
+	}
+	iamCfg := newIAMConfig()
+	if _, err = os.Stat(iamFile); err != nil {
+		if os.IsNotExist(err) {
+			iamConfig = iamCfg
+			return nil
+		}
+		return err
+	}
+	qc, err := quick.New(iamCfg)
+	if err != nil {
+		return err
+	}
+	if err = qc.Load(iamFile); err != nil {
+		return err
+	}
+	iamCfg = qc.Data().(*iamConfigV1)
+	// Empty sections are saved as 'null', initialize them back.
+	if iamCfg.Users == nil {
+		iamCfg.Users = make(map[string]iamUser)
+	}
+	if iamCfg.Groups == nil {
+		iamCfg.Groups = make(map[string]iamGroup)
+	}
+	if iamCfg.Policies == nil {
+		iamCfg.Policies = make(map[string]BucketPolicy)
+	}
+	// Save the loaded config globally.
+	iamConfig = iamCfg
+	return nil
+}
+
+// save - saves iam config, caller should hold the write lock.
+func (s *iamConfigV1) save() error {
+	iamFile, err := getIAMConfigFile()
+	if err != nil {
+		return err
+	}
+	qc, err := quick.New(s)
+	if err != nil {
+		return err
+	}
+	return qc.Save(iamFile)
+}
+
+// verifyPolicies - all the policy names should be present, caller
+// should hold the lock.
+func (s *iamConfigV1) verifyPolicies(policies []string) error {
+	for _, policyName := range policies {
+		if _, ok := s.Policies[policyName]; !ok {
+			return errNoSuchPolicy
+		}
+	}
+	return nil
+}
+
+/// Users related.
+
+// SetUser add a new user or replace an existing one.
+func (s *iamConfigV1) SetUser(accessKey string, user iamUser) error {
+	if !isValidAccessKey.MatchString(accessKey) {
+		return errInvalidArgument
+	}
+	if !isValidSecretKey.MatchString(user.SecretKey) {
+		return errInvalidArgument
+	}
+	if user.Status == "" {
+		user.Status = iamUserEnabled
+	}
+	if user.Status != iamUserEnabled && user.Status != iamUserDisabled {
+		return errInvalidUserStatus
+	}
+	// Server credential cannot be shadowed by a user.
+	if accessKey == serverConfig.GetCredential().AccessKeyID {
+		return errReservedAccessKey
+	}
+
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	if err := s.verifyPolicies(user.Policies); err != nil {
+		return err
+	}
+	s.Users[accessKey] = user
+	return s.save()
+}
+
+// GetUser get user for the access key.
+func (s iamConfigV1) GetUser(accessKey string) (iamUser, error) {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	user, ok := s.Users[accessKey]
+	if !ok {
+		return iamUser{}, errNoSuchUser
+	}
+	return user, nil
+}
+
+// ListUsers list access keys of all users in sorted order.
+func (s iamConfigV1) ListUsers() []string {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	var accessKeys []string
+	for accessKey := range s.Users {
+		accessKeys = append(accessKeys, accessKey)
+	}
+	sort.Strings(accessKeys)
+	return accessKeys
+}
+
+// DeleteUser remove user and its group memberships.
+func (s *iamConfigV1) DeleteUser(accessKey string) error {
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	if _, ok := s.Users[accessKey]; !ok {
+		return errNoSuchUser
+	}
+	delete(s.Users, accessKey)
+	for groupName, group := range s.Groups {
+		var members []string
+		for _, member := range group.Members {
+			if member != accessKey {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+		s.Groups[groupName] = group
+	}
+	return s.save()
+}
+
+/// Groups related.
+
+// SetGroup add a new group or replace an existing one.
+func (s *iamConfigV1) SetGroup(groupName string, group iamGroup) error {
+	if groupName == "" {
+		return errInvalidArgument
+	}
+
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	for _, member := range group.Members {
+		if _, ok := s.Users[member]; !ok {
+			return errNoSuchUser
+		}
+	}
+	if err := s.verifyPolicies(group.Policies); err != nil {
+		return err
+	}
+	s.Groups[groupName] = group
+	return s.save()
+}
+
+// GetGroup get group by its name.
+func (s iamConfigV1) GetGroup(groupName string) (iamGroup, error) {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	group, ok := s.Groups[groupName]
+	if !ok {
+		return iamGroup{}, errNoSuchGroup
+	}
+	return group, nil
+}
+
+// ListGroups list names of all groups in sorted order.
+func (s iamConfigV1) ListGroups() []string {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	var groupNames []string
+	for groupName := range s.Groups {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+	return groupNames
+}
+
+// DeleteGroup remove group, its members are left untouched.
+func (s *iamConfigV1) DeleteGroup(groupName string) error {
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	if _, ok := s.Groups[groupName]; !ok {
+		return errNoSuchGroup
+	}
+	delete(s.Groups, groupName)
+	return s.save()
+}
+
+/// Policies related.
+
+// SetPolicy add a new policy or replace an existing one, input
+// policy is expected to be validated by parseIAMPolicy.
+func (s *iamConfigV1) SetPolicy(policyName string, policy BucketPolicy) error {
+	if policyName == "" {
+		return errInvalidArgument
+	}
+
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	s.Policies[policyName] = policy
+	return s.save()
+}
+
+// GetPolicy get policy by its name.
+func (s iamConfigV1) GetPolicy(policyName string) (BucketPolicy, error) {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	policy, ok := s.Policies[policyName]
+	if !ok {
+		return BucketPolicy{}, errNoSuchPolicy
+	}
+	return policy, nil
+}
+
+// ListPolicies list names of all policies in sorted order.
+func (s iamConfigV1) ListPolicies() []string {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	var policyNames []string
+	for policyName := range s.Policies {
+		policyNames = append(policyNames, policyName)
+	}
+	sort.Strings(policyNames)
+	return policyNames
+}
+
+// DeletePolicy remove policy, policies still attached to users or
+// groups cannot be removed.
+func (s *iamConfigV1) DeletePolicy(policyName string) error {
+	s.rwMutex.Lock()
+	defer s.rwMutex.Unlock()
+	if _, ok := s.Policies[policyName]; !ok {
+		return errNoSuchPolicy
+	}
+	for _, user := range s.Users {
+		if contains(user.Policies, policyName) {
+			return errPolicyInUse
+		}
+	}
+	for _, group := range s.Groups {
+		if contains(group.Policies, policyName) {
+			return errPolicyInUse
+		}
+	}
+	delete(s.Policies, policyName)
+	return s.save()
+}
+
+/// Authentication and authorization.
+
+// GetCredential get credential of an enabled user.
+func (s iamConfigV1) GetCredential(accessKey string) (credential, bool) {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	user, ok := s.Users[accessKey]
+	if !ok || user.Status != iamUserEnabled {
+		return credential{}, false
+	}
+	return credential{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: user.SecretKey,
+	}, true
+}
+
+// IsAllowed verifies if the action on the resource is allowed by the
+// policies attached to the user and to the groups it belongs to. As
+// with bucket policies, an explicit deny wins over any allow and no
+// match at all is a deny.
+func (s iamConfigV1) IsAllowed(accessKey, action, resource string, conditions map[string]string) bool {
+	s.rwMutex.RLock()
+	defer s.rwMutex.RUnlock()
+	user, ok := s.Users[accessKey]
+	if !ok || user.Status != iamUserEnabled {
+		return false
+	}
+	policyNames := append([]string{}, user.Policies...)
+	for _, group := range s.Groups {
+		if contains(group.Members, accessKey) {
+			policyNames = append(policyNames, group.Policies...)
+		}
+	}
+	var statements []policyStatement
+	for _, policyName := range policyNames {
+		statements = append(statements, s.Policies[policyName].Statements...)
+	}
+	return iamPolicyEvalStatements(action, resource, conditions, denyStatementsFirst(statements))
+}
+
+// iamPolicyEvalStatements - verifies if the action on the resource is
+// allowed by user, group or session policy statements, deny statements
+// are expected first. Unlike bucket policies, resources are matched as
+// ARN wildcards.
+func iamPolicyEvalStatements(action, resource string, conditions map[string]string, statements []policyStatement) bool {
+	for _, statement := range statements {
+		if !bucketPolicyActionMatch(action, statement) || !bucketPolicyConditionMatch(conditions, statement) {
+			continue
+		}
+		for _, presource := range statement.Resources {
+			if resourceMatch(presource, resource) {
+				return statement.Effect == "Allow"
+			}
+		}
+	}
+	// None match so deny.
+	return false
+}
+
+// resourceMatch - verifies if resource matches the policy resource as
+// a whole, '*' in the policy resource matches any sequence of
+// characters and '?' any single character, others match themselves.
+func resourceMatch(presource, resource string) bool {
+	var pattern bytes.Buffer
+	pattern.WriteString("^")
+	for _, r := range presource {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	matched, err := regexp.MatchString(pattern.String(), resource)
+	fatalIf(err, "Invalid pattern, please verify the pattern string.", nil)
+	return matched
+}
+
+// getCredential - get credential for the access key, server
+// credential takes precedence over the users.
+func getCredential(accessKey string) (credential, bool) {
+	cred := serverConfig.GetCredential()
+	if accessKey == cred.AccessKeyID {
+		return cred, true
+	}
+	return iamConfig.GetCredential(accessKey)
+}
+
+// isIAMActionAllowed - verifies if the access key is allowed to
+// perform the action on bucket and object. Server credential is
+// allowed to perform all the actions.
+func isIAMActionAllowed(accessKey, action, bucket, object string, conditions map[string]string) bool {
+	if accessKey == serverConfig.GetCredential().AccessKeyID {
+		return true
+	}
+	return iamConfig.IsAllowed(accessKey, action, getIAMResource(bucket, object), conditions)
+}
+
+// getIAMResource - construct resource in 'arn:aws:s3:::examplebucket/object'
+// format, resource for requests without a bucket is 'arn:aws:s3:::*'.
+func getIAMResource(bucket, object string) string {
+	if bucket == "" {
+		return AWSResourcePrefix + "*"
+	}
+	if object == "" {
+		return AWSResourcePrefix + bucket
+	}
+	return AWSResourcePrefix + bucket + slashSeparator + object
+}
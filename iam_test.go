@@ -0,0 +1,262 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// Initialize server and iam config in a temporary config directory.
+func initTestIAMConfig(t *testing.T) (rootPath string) {
+	rootPath, err := ioutil.TempDir(os.TempDir(), "minio-iam-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobalConfigPath(rootPath)
+	if err = initConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err = initIAMConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return rootPath
+}
+
+// Tests validate user and group policy parser.
+func TestParseIAMPolicy(t *testing.T) {
+	testCases := []struct {
+		policy     string
+		shouldPass bool
+	}{
+		// Test case - 1.
+		// Valid policy with bucket and object statements.
+		{`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:ListBucket"], "Resource": ["arn:aws:s3:::photos"]}, {"Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": ["arn:aws:s3:::photos/*"]}]}`, true},
+		// Test case - 2.
+		// Valid policy with all actions allowed.
+		{`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:*"], "Resource": ["arn:aws:s3:::*"]}]}`, true},
+		// Test case - 3.
+		// Principal is implied by the attachment.
+		{`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": {"AWS": ["*"]}, "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::photos/*"]}]}`, false},
+		// Test case - 4.
+		// Unsupported action.
+		{`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:RemoveEverything"], "Resource": ["arn:aws:s3:::photos/*"]}]}`, false},
+		// Test case - 5.
+		// Resource which is not an s3 resource.
+		{`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["photos/*"]}]}`, false},
+		// Test case - 6.
+		// Empty statements.
+		{`{"Version": "2012-10-17", "Statement": []}`, false},
+		// Test case - 7.
+		// Malformed JSON.
+		{`{"Version": "2012-10-17", "Statement": [`, false},
+	}
+	for i, testCase := range testCases {
+		_, err := parseIAMPolicy([]byte(testCase.policy))
+		if err != nil && testCase.shouldPass {
+			t.Errorf("Test %d: Expected to pass, but failed with: <ERROR> %s", i+1, err)
+		}
+		if err == nil && !testCase.shouldPass {
+			t.Errorf("Test %d: Expected to fail, but passed instead", i+1)
+		}
+	}
+}
+
+// Tests policy resources match resources as a whole, with '*' and '?'
+// as the only wildcards.
+func TestResourceMatch(t *testing.T) {
+	testCases := []struct {
+		presource string
+		resource  string
+		matched   bool
+	}{
+		{"arn:aws:s3:::dev", "arn:aws:s3:::dev", true},
+		{"arn:aws:s3:::dev", "arn:aws:s3:::dev2", false},
+		{"arn:aws:s3:::dev", "arn:aws:s3:::devx/object", false},
+		{"arn:aws:s3:::dev", "arn:aws:s3:::prefix-dev", false},
+		{"arn:aws:s3:::dev.bucket", "arn:aws:s3:::dev-bucket", false},
+		{"arn:aws:s3:::dev/*", "arn:aws:s3:::dev/a/b.jpg", true},
+		{"arn:aws:s3:::dev/*", "arn:aws:s3:::devx/a.jpg", false},
+		{"arn:aws:s3:::dev/*", "arn:aws:s3:::dev", false},
+		{"arn:aws:s3:::dev?/*", "arn:aws:s3:::dev2/a.jpg", true},
+		{"arn:aws:s3:::dev/(*", "arn:aws:s3:::dev/(a", true},
+		{"arn:aws:s3:::*", "arn:aws:s3:::dev/a.jpg", true},
+	}
+	for i, testCase := range testCases {
+		if matched := resourceMatch(testCase.presource, testCase.resource); matched != testCase.matched {
+			t.Errorf("Test %d: Expected %s matching %s to be %t", i+1, testCase.presource, testCase.resource, testCase.matched)
+		}
+	}
+}
+
+// Tests evaluation of policies attached to users and groups.
+func TestIAMActionAllowed(t *testing.T) {
+	savedConfigPath := customConfigPath
+	rootPath := initTestIAMConfig(t)
+	defer setGlobalConfigPath(savedConfigPath)
+	defer os.RemoveAll(rootPath)
+
+	readPhotos, err := parseIAMPolicy([]byte(`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:ListBucket"], "Resource": ["arn:aws:s3:::photos"]}, {"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::photos/*"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePhotos, err := parseIAMPolicy([]byte(`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:PutObject", "s3:DeleteObject"], "Resource": ["arn:aws:s3:::photos/*"]}, {"Effect": "Deny", "Action": ["s3:DeleteObject"], "Resource": ["arn:aws:s3:::photos/archive/*"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetPolicy("read-photos", readPhotos); err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetPolicy("write-photos", writePhotos); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown policies cannot be attached.
+	if err = iamConfig.SetUser("reader", iamUser{SecretKey: "reader-secret", Policies: []string{"unknown"}}); err != errNoSuchPolicy {
+		t.Fatalf("Expected %s, got %s", errNoSuchPolicy, err)
+	}
+	if err = iamConfig.SetUser("reader", iamUser{SecretKey: "reader-secret", Policies: []string{"read-photos"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetUser("writer", iamUser{SecretKey: "writer-secret", Policies: []string{"read-photos"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetUser("retired", iamUser{SecretKey: "retired-secret", Status: iamUserDisabled, Policies: []string{"read-photos"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetGroup("editors", iamGroup{Members: []string{"writer"}, Policies: []string{"write-photos"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Policies attached to groups cannot be removed.
+	if err = iamConfig.DeletePolicy("write-photos"); err != errPolicyInUse {
+		t.Fatalf("Expected %s, got %s", errPolicyInUse, err)
+	}
+
+	rootAccessKey := serverConfig.GetCredential().AccessKeyID
+	testCases := []struct {
+		accessKey string
+		action    string
+		bucket    string
+		object    string
+		allowed   bool
+	}{
+		// Test case - 1 - 3.
+		// Server credential is allowed everything.
+		{rootAccessKey, "s3:ListAllMyBuckets", "", "", true},
+		{rootAccessKey, "s3:DeleteBucket", "photos", "", true},
+		{rootAccessKey, "s3:PutObject", "photos", "a.jpg", true},
+		// Test case - 4 - 7.
+		// Policies attached to the user.
+		{"reader", "s3:ListBucket", "photos", "", true},
+		{"reader", "s3:GetObject", "photos", "a.jpg", true},
+		{"reader", "s3:PutObject", "photos", "a.jpg", false},
+		{"reader", "s3:ListAllMyBuckets", "", "", false},
+		// Test case - 8 - 11.
+		// Policies attached to the group, explicit deny wins.
+		{"writer", "s3:GetObject", "photos", "a.jpg", true},
+		{"writer", "s3:PutObject", "photos", "a.jpg", true},
+		{"writer", "s3:DeleteObject", "photos", "a.jpg", true},
+		{"writer", "s3:DeleteObject", "photos", "archive/a.jpg", false},
+		// Test case - 12.
+		// Disabled users are not allowed anything.
+		{"retired", "s3:GetObject", "photos", "a.jpg", false},
+		// Test case - 13.
+		// Unknown users are not allowed anything.
+		{"unknown", "s3:GetObject", "photos", "a.jpg", false},
+		// Test case - 14 - 16.
+		// Resources of neighbouring buckets do not match.
+		{"reader", "s3:ListBucket", "photos2", "", false},
+		{"reader", "s3:GetObject", "photosx", "a.jpg", false},
+		{"reader", "s3:GetObject", "photos-archive", "a.jpg", false},
+	}
+	for i, testCase := range testCases {
+		allowed := isIAMActionAllowed(testCase.accessKey, testCase.action, testCase.bucket, testCase.object, nil)
+		if allowed != testCase.allowed {
+			t.Errorf("Test %d: Expected %t, got %t", i+1, testCase.allowed, allowed)
+		}
+	}
+
+	// Removing a user removes its group membership.
+	if err = iamConfig.DeleteUser("writer"); err != nil {
+		t.Fatal(err)
+	}
+	group, err := iamConfig.GetGroup("editors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Members) != 0 {
+		t.Fatalf("Expected no members, got %v", group.Members)
+	}
+
+	// Saved users, groups and policies are loaded back.
+	if err = initIAMConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if cred, ok := getCredential("reader"); !ok || cred.SecretAccessKey != "reader-secret" {
+		t.Fatalf("Expected saved user 'reader', got %v", cred)
+	}
+	if _, ok := getCredential("retired"); ok {
+		t.Fatal("Expected disabled user to have no credential")
+	}
+	if !isIAMActionAllowed("reader", "s3:GetObject", "photos", "a.jpg", nil) {
+		t.Fatal("Expected saved policies to be loaded back")
+	}
+}
+
+// Tests mapping of S3 requests to policy actions.
+func TestGetRequestIAMAction(t *testing.T) {
+	testCases := []struct {
+		method string
+		url    string
+		action string
+		bucket string
+		object string
+	}{
+		{"GET", "http://localhost:9000/", "s3:ListAllMyBuckets", "", ""},
+		{"GET", "http://localhost:9000/photos", "s3:ListBucket", "photos", ""},
+		{"HEAD", "http://localhost:9000/photos", "s3:ListBucket", "photos", ""},
+		{"GET", "http://localhost:9000/photos?location", "s3:GetBucketLocation", "photos", ""},
+		{"GET", "http://localhost:9000/photos?policy", "s3:GetBucketPolicy", "photos", ""},
+		{"GET", "http://localhost:9000/photos?uploads", "s3:ListBucketMultipartUploads", "photos", ""},
+		{"PUT", "http://localhost:9000/photos", "s3:CreateBucket", "photos", ""},
+		{"PUT", "http://localhost:9000/photos?policy", "s3:PutBucketPolicy", "photos", ""},
+		{"DELETE", "http://localhost:9000/photos", "s3:DeleteBucket", "photos", ""},
+		{"DELETE", "http://localhost:9000/photos?policy", "s3:DeleteBucketPolicy", "photos", ""},
+		{"POST", "http://localhost:9000/photos?delete", "", "", ""},
+		{"GET", "http://localhost:9000/photos/2016/a.jpg", "s3:GetObject", "photos", "2016/a.jpg"},
+		{"HEAD", "http://localhost:9000/photos/a.jpg", "s3:GetObject", "photos", "a.jpg"},
+		{"GET", "http://localhost:9000/photos/a.jpg?uploadId=1", "s3:ListMultipartUploadParts", "photos", "a.jpg"},
+		{"PUT", "http://localhost:9000/photos/a.jpg", "s3:PutObject", "photos", "a.jpg"},
+		{"PUT", "http://localhost:9000/photos/a.jpg?partNumber=1&uploadId=1", "s3:PutObject", "photos", "a.jpg"},
+		{"POST", "http://localhost:9000/photos/a.jpg?uploads", "s3:PutObject", "photos", "a.jpg"},
+		{"DELETE", "http://localhost:9000/photos/a.jpg", "s3:DeleteObject", "photos", "a.jpg"},
+		{"DELETE", "http://localhost:9000/photos/a.jpg?uploadId=1", "s3:AbortMultipartUpload", "photos", "a.jpg"},
+	}
+	for i, testCase := range testCases {
+		req, err := http.NewRequest(testCase.method, testCase.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		action, bucket, object := getRequestIAMAction(req)
+		if action != testCase.action || bucket != testCase.bucket || object != testCase.object {
+			t.Errorf("Test %d: Expected (%s, %s, %s), got (%s, %s, %s)", i+1,
+				testCase.action, testCase.bucket, testCase.object, action, bucket, object)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	router "github.com/gorilla/mux"
+)
+
+const (
+	// Lock rpc server path.
+	lockRPCPath = reservedBucket + "/lock"
+	// Locks not refreshed within lease duration are expired.
+	lockLeaseDuration = 30 * time.Second
+	// Interval for expiring stale locks.
+	lockExpiryInterval = 10 * time.Second
+)
+
+// LockArgs - lock rpc arguments, a lock is identified by its uid and
+// the node which acquired it.
+type LockArgs struct {
+	AuthRPCArgs
+	Name string
+	UID  string
+	Node string
+}
+
+// lockRequester - holder of a granted lock.
+type lockRequester struct {
+	writer    bool
+	uid       string
+	node      string
+	refreshed time.Time
+}
+
+// lockServer - grants read and write locks of namespace resources to
+// all the nodes, locks expire unless refreshed by their holders.
+type lockServer struct {
+	mutex   *sync.Mutex
+	lockMap map[string][]lockRequester
+}
+
+// newLockServer - initialize lock server.
+func newLockServer() *lockServer {
+	return &lockServer{
+		mutex:   &sync.Mutex{},
+		lockMap: make(map[string][]lockRequester),
+	}
+}
+
+// LockHandler - grants a write lock if the resource is not locked.
+func (l *lockServer) LockHandler(args *LockArgs, reply *bool) error {
+	if err := args.verify("Lock.LockHandler"); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.lockMap[args.Name]; ok {
+		*reply = false
+		return nil
+	}
+	l.lockMap[args.Name] = []lockRequester{{
+		writer:    true,
+		uid:       args.UID,
+		node:      args.Node,
+		refreshed: time.Now().UTC(),
+	}}
+	*reply = true
+	return nil
+}
+
+// RLockHandler - grants a read lock if the resource is not write
+// locked.
+func (l *lockServer) RLockHandler(args *LockArgs, reply *bool) error {
+	if err := args.verify("Lock.RLockHandler"); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	requesters := l.lockMap[args.Name]
+	if len(requesters) > 0 && requesters[0].writer {
+		*reply = false
+		return nil
+	}
+	l.lockMap[args.Name] = append(requesters, lockRequester{
+		uid:       args.UID,
+		node:      args.Node,
+		refreshed: time.Now().UTC(),
+	})
+	*reply = true
+	return nil
+}
+
+// removeRequester - removes a lock holder, resource is released once
+// it has no more holders.
+func (l *lockServer) removeRequester(name, uid string) {
+	requesters := l.lockMap[name]
+	for index, requester := range requesters {
+		if requester.uid != uid {
+			continue
+		}
+		requesters = append(requesters[:index], requesters[index+1:]...)
+		break
+	}
+	if len(requesters) == 0 {
+		delete(l.lockMap, name)
+		return
+	}
+	l.lockMap[name] = requesters
+}
+
+// UnlockHandler - releases a write lock.
+func (l *lockServer) UnlockHandler(args *LockArgs, reply *bool) error {
+	if err := args.verify("Lock.UnlockHandler"); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.removeRequester(args.Name, args.UID)
+	*reply = true
+	return nil
+}
+
+// RUnlockHandler - releases a read lock.
+func (l *lockServer) RUnlockHandler(args *LockArgs, reply *bool) error {
+	if err := args.verify("Lock.RUnlockHandler"); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.removeRequester(args.Name, args.UID)
+	*reply = true
+	return nil
+}
+
+// RefreshHandler - extends the lease of a lock, replies false if the
+// lock is no longer held.
+func (l *lockServer) RefreshHandler(args *LockArgs, reply *bool) error {
+	if err := args.verify("Lock.RefreshHandler"); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	requesters := l.lockMap[args.Name]
+	for index := range requesters {
+		if requesters[index].uid == args.UID {
+			requesters[index].refreshed = time.Now().UTC()
+			*reply = true
+			return nil
+		}
+	}
+	*reply = false
+	return nil
+}
+
+// expireStaleLocks - removes locks whose holders have not refreshed
+// them within lease duration, holders may have crashed.
+func (l *lockServer) expireStaleLocks(leaseDuration time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now().UTC()
+	for name, requesters := range l.lockMap {
+		var alive []lockRequester
+		for _, requester := range requesters {
+			if now.Sub(requester.refreshed) > leaseDuration {
+				log.WithFields(logrus.Fields{
+					"name": name,
+					"uid":  requester.uid,
+					"node": requester.node,
+				}).Error("Expiring stale lock")
+				continue
+			}
+			alive = append(alive, requester)
+		}
+		if len(alive) == 0 {
+			delete(l.lockMap, name)
+			continue
+		}
+		l.lockMap[name] = alive
+	}
+}
+
+// startLockExpiry - periodically expires stale locks.
+func (l *lockServer) startLockExpiry() {
+	go func() {
+		ticker := time.NewTicker(lockExpiryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			l.expireStaleLocks(lockLeaseDuration)
+		}
+	}()
+}
+
+// isRPCRequest - verifies if request is for storage or lock rpc, rpc
+// servers hijack the underlying connection.
+func isRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, storageRPCPath) || r.URL.Path == lockRPCPath
+}
+
+// registerLockRPCRouter - register lock rpc router.
+func registerLockRPCRouter(mux *router.Router, lkServer *lockServer) {
+	lockRPCServer := rpc.NewServer()
+	lockRPCServer.RegisterName("Lock", lkServer)
+	mux.Path(lockRPCPath).Handler(lockRPCServer)
+}
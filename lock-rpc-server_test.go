@@ -0,0 +1,217 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	router "github.com/gorilla/mux"
+)
+
+// Tests lock server grants, releases and expires locks.
+func TestLockServer(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	l := newLockServer()
+	call := func(method, name, uid string) bool {
+		var reply bool
+		if err := (localLocker{l}).Call("Lock."+method, &LockArgs{Name: name, UID: uid, Node: "node"}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	if !call("RLockHandler", "bucket/object", "r1") || !call("RLockHandler", "bucket/object", "r2") {
+		t.Fatal("Expected read locks to be shared")
+	}
+	if call("LockHandler", "bucket/object", "w1") {
+		t.Fatal("Expected write lock to wait for readers")
+	}
+	call("RUnlockHandler", "bucket/object", "r1")
+	call("RUnlockHandler", "bucket/object", "r2")
+	if !call("LockHandler", "bucket/object", "w1") {
+		t.Fatal("Expected write lock to be granted")
+	}
+	if call("RLockHandler", "bucket/object", "r3") || call("LockHandler", "bucket/object", "w2") {
+		t.Fatal("Expected write lock to be exclusive")
+	}
+	if !call("RefreshHandler", "bucket/object", "w1") {
+		t.Fatal("Expected held lock to be refreshed")
+	}
+	if call("RefreshHandler", "bucket/object", "w2") {
+		t.Fatal("Expected refresh of unknown lock to fail")
+	}
+
+	// Locks of crashed holders expire.
+	l.expireStaleLocks(time.Hour)
+	if !call("RefreshHandler", "bucket/object", "w1") {
+		t.Fatal("Expected refreshed lock to not expire")
+	}
+	time.Sleep(10 * time.Millisecond)
+	l.expireStaleLocks(time.Millisecond)
+	if !call("LockHandler", "bucket/object", "w2") {
+		t.Fatal("Expected stale lock to be expired")
+	}
+}
+
+// Tests read and write lock quorums overlap.
+func TestGetLockQuorum(t *testing.T) {
+	for lockers := 1; lockers <= 16; lockers++ {
+		readQuorum := getLockQuorum(lockers, true)
+		writeQuorum := getLockQuorum(lockers, false)
+		if readQuorum < 1 || readQuorum+writeQuorum <= lockers || 2*writeQuorum <= lockers {
+			t.Errorf("Lockers %d: quorums %d/%d do not overlap", lockers, readQuorum, writeQuorum)
+		}
+	}
+}
+
+// Tests namespace locks of two nodes exclude each other.
+func TestDistributedNSLock(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	// Third lock server is served over rpc.
+	remote := newLockServer()
+	mux := router.NewRouter()
+	registerLockRPCRouter(mux, remote)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	lockers := []locker{
+		localLocker{newLockServer()},
+		localLocker{newLockServer()},
+		newLazyRPCClient(strings.TrimPrefix(server.URL, "http://"), lockRPCPath),
+	}
+	newNode := func(node string) *nsLockMap {
+		return &nsLockMap{
+			lockMap: make(map[nsParam]*nsLock),
+			mutex:   &sync.Mutex{},
+			lockers: lockers,
+			node:    node,
+		}
+	}
+	node1, node2 := newNode("node1"), newNode("node2")
+
+	dLock1 := node1.Lock("bucket", "object")
+	locked := make(chan struct{})
+	var dLock2 *distLock
+	go func() {
+		dLock2 = node2.Lock("bucket", "object")
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Expected write lock to be held by another node")
+	case <-time.After(500 * time.Millisecond):
+	}
+	node1.Unlock("bucket", "object", dLock1)
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected write lock to be granted after release")
+	}
+	node2.Unlock("bucket", "object", dLock2)
+
+	// Read locks are shared across the nodes.
+	dLock1 = node1.RLock("bucket", "object")
+	dLock2 = node2.RLock("bucket", "object")
+	node1.RUnlock("bucket", "object", dLock1)
+	node2.RUnlock("bucket", "object", dLock2)
+
+	// Read locks of a node are released by their own holder, in any
+	// order.
+	dLock1 = node1.RLock("bucket", "object")
+	dLock2 = node1.RLock("bucket", "object")
+	node1.RUnlock("bucket", "object", dLock1)
+	remote.mutex.Lock()
+	requesters := remote.lockMap["bucket/object"]
+	if len(requesters) != 1 || requesters[0].uid != dLock2.args.UID {
+		t.Errorf("Expected lock %s to be held, got %v", dLock2.args.UID, requesters)
+	}
+	remote.mutex.Unlock()
+	node1.RUnlock("bucket", "object", dLock2)
+
+	remote.mutex.Lock()
+	defer remote.mutex.Unlock()
+	if len(remote.lockMap) != 0 {
+		t.Fatalf("Expected all locks to be released, got %v", remote.lockMap)
+	}
+}
+
+// Tests acquiring a lock held by another node is given up once the
+// timeout elapses, the lock is then returned lost.
+func TestDistLockTimeout(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	var lockers []locker
+	for i := 0; i < 3; i++ {
+		lockers = append(lockers, localLocker{newLockServer()})
+	}
+	dLock := acquireDistLock(lockers, "node1", "bucket", "object", false, time.Minute)
+	defer dLock.release()
+
+	start := time.Now()
+	timedOut := acquireDistLock(lockers, "node2", "bucket", "object", false, 500*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected acquiring to be given up, waited %s", elapsed)
+	}
+	if !isLockLost(timedOut) {
+		t.Fatal("Expected lock acquired after timeout to be lost")
+	}
+	timedOut.release()
+	if isLockLost(dLock) {
+		t.Fatal("Expected lock of the other node to be held")
+	}
+}
+
+// Tests holders are notified of locks which lost quorum of lock
+// servers.
+func TestDistLockLost(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	servers := []*lockServer{newLockServer(), newLockServer(), newLockServer()}
+	var lockers []locker
+	for _, server := range servers {
+		lockers = append(lockers, localLocker{server})
+	}
+	dLock := acquireDistLock(lockers, "node", "bucket", "object", false, lockAcquireTimeout)
+	defer dLock.release()
+	if !dLock.refreshLease() {
+		t.Fatal("Expected lock to be refreshed")
+	}
+	select {
+	case <-dLock.lostCh:
+		t.Fatal("Expected lock to be held")
+	default:
+	}
+
+	// Lock expires on two of the three lock servers.
+	for _, server := range servers[:2] {
+		server.expireStaleLocks(-time.Hour)
+	}
+	if dLock.refreshLease() {
+		t.Fatal("Expected refresh to lose quorum")
+	}
+	select {
+	case <-dLock.lostCh:
+	default:
+		t.Fatal("Expected holder to be notified of the lost lock")
+	}
+}
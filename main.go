@@ -199,6 +199,10 @@ func main() {
 		err := initConfig()
 		fatalIf(err, "Unable to initialize minio config.", nil)
 
+		// Initialize users, groups and policies.
+		err = initIAMConfig()
+		fatalIf(err, "Unable to initialize minio users.", nil)
+
 		// Enable all loggers by now.
 		enableLoggers()
 
@@ -0,0 +1,214 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	router "github.com/gorilla/mux"
+)
+
+// Prometheus metrics path.
+const metricsPath = reservedBucket + "/prometheus/metrics"
+
+// metricsHandlers - serves server metrics.
+type metricsHandlers struct {
+	ObjectAPI ObjectLayer
+}
+
+// registerMetricsRouter - registers prometheus metrics endpoint.
+func registerMetricsRouter(mux *router.Router, api metricsHandlers) {
+	mux.Methods("GET").Path(metricsPath).HandlerFunc(api.MetricsHandler)
+}
+
+// MetricsHandler - GET /minio/prometheus/metrics
+// ----------
+// Writes all the server metrics in prometheus text exposition format.
+// Requests are signed with the server credential like admin API
+// requests, unless metrics are configured to be public.
+func (api metricsHandlers) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !globalMetricsPublic {
+		if s3Error := isAdminReqAuthenticated(r); s3Error != ErrNone {
+			writeErrorResponse(w, r, s3Error, r.URL.Path)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	globalMetrics.Write(w, api.ObjectAPI)
+}
+
+// getRequestAPIName - returns name of the API serving the request,
+// used to partition request metrics.
+func getRequestAPIName(r *http.Request) string {
+	switch {
+	case r.URL.Path == metricsPath:
+		return "Metrics"
+	case strings.HasPrefix(r.URL.Path, adminAPIPathPrefix+slashSeparator):
+		return "Admin"
+	case strings.HasPrefix(r.URL.Path, reservedBucket+slashSeparator):
+		return "Web"
+	case r.Method == "POST" && r.URL.Path == slashSeparator:
+		return "STS"
+	}
+	bucket, object := splitBucketObject(r.URL.Path)
+	query := r.URL.Query()
+	_, uploadID := query["uploadId"]
+	if bucket == "" {
+		return "ListBuckets"
+	}
+	if object != "" {
+		switch r.Method {
+		case "GET":
+			if uploadID {
+				return "ListObjectParts"
+			}
+			return "GetObject"
+		case "HEAD":
+			return "HeadObject"
+		case "PUT":
+			if uploadID {
+				return "PutObjectPart"
+			}
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				return "CopyObject"
+			}
+			return "PutObject"
+		case "POST":
+			if uploadID {
+				return "CompleteMultipartUpload"
+			}
+			return "NewMultipartUpload"
+		case "DELETE":
+			if uploadID {
+				return "AbortMultipartUpload"
+			}
+			return "DeleteObject"
+		}
+		return "Unknown"
+	}
+	_, policy := query["policy"]
+	switch r.Method {
+	case "GET":
+		if _, ok := query["location"]; ok {
+			return "GetBucketLocation"
+		}
+		if policy {
+			return "GetBucketPolicy"
+		}
+		if _, ok := query["uploads"]; ok {
+			return "ListMultipartUploads"
+		}
+		return "ListObjects"
+	case "HEAD":
+		return "HeadBucket"
+	case "PUT":
+		if policy {
+			return "PutBucketPolicy"
+		}
+		return "MakeBucket"
+	case "POST":
+		if _, ok := query["delete"]; ok {
+			return "DeleteMultipleObjects"
+		}
+		return "PostPolicy"
+	case "DELETE":
+		if policy {
+			return "DeleteBucketPolicy"
+		}
+		return "DeleteBucket"
+	}
+	return "Unknown"
+}
+
+// metricsResponseWriter - records status code and number of bytes
+// written by the handlers.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int64
+}
+
+func (w *metricsResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *metricsResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush - handlers streaming their responses rely on http.Flusher.
+func (w *metricsResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// metricsReadCloser - records number of bytes read from the request
+// body. Handlers may still read the body from another goroutine after
+// they return, bytesRead is accessed atomically.
+type metricsReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (r *metricsReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.bytesRead, int64(n))
+	return n, err
+}
+
+// metricsHandler - records request counts, latencies and bytes
+// transferred for all incoming requests.
+type metricsHandler struct {
+	handler http.Handler
+}
+
+// setMetricsHandler to instrument all incoming requests.
+func setMetricsHandler(h http.Handler) http.Handler {
+	return metricsHandler{h}
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Storage and lock rpc hijack the underlying connection, skip it.
+	if isRPCRequest(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	api := getRequestAPIName(r)
+	mw := &metricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	body := &metricsReadCloser{ReadCloser: r.Body}
+	if r.Body != nil {
+		r.Body = body
+	}
+	h.handler.ServeHTTP(mw, r)
+
+	code := strconv.Itoa(mw.statusCode)
+	globalMetrics.httpRequests.Inc(api, code)
+	globalMetrics.httpDuration.ObserveDuration(start, api, code)
+	globalMetrics.httpReceivedBytes.Add(float64(atomic.LoadInt64(&body.bytesRead)), api)
+	globalMetrics.httpSentBytes.Add(float64(mw.bytesWritten), api)
+}
@@ -0,0 +1,374 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default histogram buckets for request latencies in seconds.
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram buckets for namespace lock wait times in seconds.
+var lockWaitBuckets = []float64{0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+// Histogram buckets for disk operation queue times in seconds.
+var diskIOWaitBuckets = []float64{0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+// escapeLabelValue - escapes label value as per prometheus text
+// exposition format.
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+// formatLabels - formats label names and values as name="value"
+// pairs separated by comma.
+func formatLabels(labelNames, labelValues []string) string {
+	var pairs []string
+	for index, labelName := range labelNames {
+		var labelValue string
+		if index < len(labelValues) {
+			labelValue = labelValues[index]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labelName, escapeLabelValue(labelValue)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// writeSample - writes a single sample line.
+func writeSample(w io.Writer, name, labels string, value float64) {
+	if labels == "" {
+		fmt.Fprintf(w, "%s %v\n", name, value)
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %v\n", name, labels, value)
+}
+
+// writeMetricHeader - writes help and type lines of a metric.
+func writeMetricHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// sortedKeys - returns sorted keys of a label map.
+func sortedKeys(m map[string]struct{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// counterVec - counter partitioned by label values.
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      *sync.Mutex
+	values     map[string]float64
+}
+
+// newCounterVec - initialize a new counter.
+func newCounterVec(name, help string, labelNames ...string) *counterVec {
+	return &counterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string]float64),
+	}
+}
+
+// Add - adds value to the counter for label values.
+func (c *counterVec) Add(value float64, labelValues ...string) {
+	labels := formatLabels(c.labelNames, labelValues)
+	c.mutex.Lock()
+	c.values[labels] += value
+	c.mutex.Unlock()
+}
+
+// Inc - increments the counter for label values.
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Write - writes the counter in text exposition format.
+func (c *counterVec) Write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	writeMetricHeader(w, c.name, c.help, "counter")
+	keys := make(map[string]struct{})
+	for labels := range c.values {
+		keys[labels] = struct{}{}
+	}
+	for _, labels := range sortedKeys(keys) {
+		writeSample(w, c.name, labels, c.values[labels])
+	}
+}
+
+// histogram - cumulative bucket counts, sum and count of observations.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec - histogram partitioned by label values.
+type histogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mutex      *sync.Mutex
+	values     map[string]*histogram
+}
+
+// newHistogramVec - initialize a new histogram.
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *histogramVec {
+	return &histogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		mutex:      &sync.Mutex{},
+		values:     make(map[string]*histogram),
+	}
+}
+
+// Observe - records an observation for label values.
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	labels := formatLabels(h.labelNames, labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hist, ok := h.values[labels]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[labels] = hist
+	}
+	for index, bucket := range h.buckets {
+		if value <= bucket {
+			hist.counts[index]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// ObserveDuration - records time elapsed since start in seconds.
+func (h *histogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Write - writes the histogram in text exposition format.
+func (h *histogramVec) Write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeMetricHeader(w, h.name, h.help, "histogram")
+	keys := make(map[string]struct{})
+	for labels := range h.values {
+		keys[labels] = struct{}{}
+	}
+	for _, labels := range sortedKeys(keys) {
+		hist := h.values[labels]
+		prefix := labels
+		if prefix != "" {
+			prefix += ","
+		}
+		for index, bucket := range h.buckets {
+			writeSample(w, h.name+"_bucket", fmt.Sprintf(`%sle="%v"`, prefix, bucket), float64(hist.counts[index]))
+		}
+		writeSample(w, h.name+"_bucket", prefix+`le="+Inf"`, float64(hist.count))
+		writeSample(w, h.name+"_sum", labels, hist.sum)
+		writeSample(w, h.name+"_count", labels, float64(hist.count))
+	}
+}
+
+// serverMetrics - all the metrics instrumented by the server.
+type serverMetrics struct {
+	httpRequests      *counterVec
+	httpDuration      *histogramVec
+	httpReceivedBytes *counterVec
+	httpSentBytes     *counterVec
+	erasureErrors     *counterVec
+	bitrotErrors      *counterVec
+	healObjects       *counterVec
+	nsLockWait        *histogramVec
+	diskIOWait        *histogramVec
+}
+
+// newServerMetrics - initialize server metrics.
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		httpRequests: newCounterVec("minio_http_requests_total",
+			"Total number of requests by API and status code.", "api", "code"),
+		httpDuration: newHistogramVec("minio_http_request_duration_seconds",
+			"Request latencies by API and status code.", defaultLatencyBuckets, "api", "code"),
+		httpReceivedBytes: newCounterVec("minio_http_received_bytes_total",
+			"Total number of bytes received by API.", "api"),
+		httpSentBytes: newCounterVec("minio_http_sent_bytes_total",
+			"Total number of bytes sent by API.", "api"),
+		erasureErrors: newCounterVec("minio_erasure_errors_total",
+			"Total number of erasure read and write errors per disk.", "disk", "op"),
+		bitrotErrors: newCounterVec("minio_bitrot_errors_total",
+			"Total number of corrupted blocks detected per disk.", "disk"),
+		healObjects: newCounterVec("minio_heal_objects_total",
+			"Total number of healed objects by result.", "result"),
+		nsLockWait: newHistogramVec("minio_ns_lock_wait_seconds",
+			"Time spent waiting for namespace locks.", lockWaitBuckets, "type"),
+		diskIOWait: newHistogramVec("minio_disk_io_wait_seconds",
+			"Time disk operations spent queued by priority class.", diskIOWaitBuckets, "disk", "class"),
+	}
+}
+
+// Global server metrics.
+var globalMetrics = newServerMetrics()
+
+// erasureReadError - records an erasure read error on disk.
+func (m *serverMetrics) erasureReadError(disk StorageAPI) {
+	m.erasureErrors.Inc(getStorageDiskPath(disk), "read")
+}
+
+// erasureWriteError - records an erasure write error on disk.
+func (m *serverMetrics) erasureWriteError(disk StorageAPI) {
+	m.erasureErrors.Inc(getStorageDiskPath(disk), "write")
+}
+
+// healResult - records result of healing an object.
+func (m *serverMetrics) healResult(err error) {
+	if err != nil {
+		m.healObjects.Inc("failure")
+		return
+	}
+	m.healObjects.Inc("success")
+}
+
+// getLocalDisk - returns the local disk underneath storage, false for
+// disks of other servers.
+func getLocalDisk(storage StorageAPI) (fsStorage, bool) {
+	switch s := storage.(type) {
+	case fsStorage:
+		return s, true
+	case *scheduledDisk:
+		return getLocalDisk(s.disk)
+	}
+	return fsStorage{}, false
+}
+
+// getCachedDiskStatus - reports status of a storage disk from the
+// health tracked by its operations, disks are not queried. Local
+// disks online report their usage as well.
+func getCachedDiskStatus(storage StorageAPI) DiskStatus {
+	tracked, ok := storage.(*trackedDisk)
+	if !ok {
+		return getDiskStatus(storage)
+	}
+	health := tracked.Health()
+	diskStatus := DiskStatus{Path: getStorageDiskPath(storage)}
+	if health.State == diskOnline {
+		if local, ok := getLocalDisk(tracked.disk); ok {
+			diskStatus = getDiskStatus(local)
+		}
+		diskStatus.Online = true
+	}
+	diskStatus.State = health.State
+	diskStatus.ConsecutiveErrors = health.ConsecutiveErrors
+	diskStatus.AvgLatency = health.AvgLatency
+	return diskStatus
+}
+
+// getCachedDisksStatus - reports status of all the disks of the object
+// layer from their tracked health.
+func getCachedDisksStatus(objAPI ObjectLayer) []DiskStatus {
+	var disks []DiskStatus
+	if sets, ok := getXLSets(objAPI); ok {
+		for _, xl := range sets {
+			for _, storage := range xl.disks() {
+				disks = append(disks, getCachedDiskStatus(storage))
+			}
+		}
+	} else if fs, ok := objAPI.(fsObjects); ok {
+		disks = append(disks, getDiskStatus(fs.storage))
+	}
+	return disks
+}
+
+// writeDiskMetrics - writes capacity, usage, online status and health
+// of all the disks of the object layer. Disk state is taken from the
+// health tracked by disk operations, scrapes do not query the disks.
+func writeDiskMetrics(w io.Writer, objAPI ObjectLayer) {
+	disks := getCachedDisksStatus(objAPI)
+	diskLabels := func(disk DiskStatus) string {
+		return formatLabels([]string{"disk"}, []string{disk.Path})
+	}
+	writeMetricHeader(w, "minio_disk_online", "Disk online status, 1 if online.", "gauge")
+	for _, disk := range disks {
+		var online float64
+		if disk.Online {
+			online = 1
+		}
+		writeSample(w, "minio_disk_online", diskLabels(disk), online)
+	}
+	writeMetricHeader(w, "minio_disk_total_bytes", "Total disk capacity in bytes.", "gauge")
+	for _, disk := range disks {
+		writeSample(w, "minio_disk_total_bytes", diskLabels(disk), float64(disk.Total))
+	}
+	writeMetricHeader(w, "minio_disk_free_bytes", "Free disk space in bytes.", "gauge")
+	for _, disk := range disks {
+		writeSample(w, "minio_disk_free_bytes", diskLabels(disk), float64(disk.Free))
+	}
+	writeMetricHeader(w, "minio_disk_used_bytes", "Used disk space in bytes.", "gauge")
+	for _, disk := range disks {
+		writeSample(w, "minio_disk_used_bytes", diskLabels(disk), float64(disk.Total-disk.Free))
+	}
+	writeMetricHeader(w, "minio_disk_consecutive_errors", "Consecutive faults of disk since last successful operation.", "gauge")
+	for _, disk := range disks {
+		writeSample(w, "minio_disk_consecutive_errors", diskLabels(disk), float64(disk.ConsecutiveErrors))
+	}
+	writeMetricHeader(w, "minio_disk_latency_seconds", "Average latency of disk operations in seconds.", "gauge")
+	for _, disk := range disks {
+		writeSample(w, "minio_disk_latency_seconds", diskLabels(disk), disk.AvgLatency)
+	}
+}
+
+// Write - writes all the server metrics in text exposition format.
+func (m *serverMetrics) Write(w io.Writer, objAPI ObjectLayer) {
+	m.httpRequests.Write(w)
+	m.httpDuration.Write(w)
+	m.httpReceivedBytes.Write(w)
+	m.httpSentBytes.Write(w)
+	m.erasureErrors.Write(w)
+	m.bitrotErrors.Write(w)
+	m.healObjects.Write(w)
+	m.nsLockWait.Write(w)
+	m.diskIOWait.Write(w)
+	writeMetricHeader(w, "minio_uptime_seconds", "Server uptime in seconds.", "gauge")
+	writeSample(w, "minio_uptime_seconds", "", time.Since(globalBootTime).Seconds())
+	if objAPI != nil {
+		writeDiskMetrics(w, objAPI)
+	}
+}
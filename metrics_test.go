@@ -0,0 +1,154 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests exposition format of counters and histograms.
+func TestMetricsWrite(t *testing.T) {
+	counter := newCounterVec("test_requests_total", "Test requests.", "api", "code")
+	counter.Inc("GetObject", "200")
+	counter.Add(2, "GetObject", "200")
+	counter.Inc("Put\"Object", "500")
+
+	buf := &bytes.Buffer{}
+	counter.Write(buf)
+	expected := `# HELP test_requests_total Test requests.
+# TYPE test_requests_total counter
+test_requests_total{api="GetObject",code="200"} 3
+test_requests_total{api="Put\"Object",code="500"} 1
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buf.String())
+	}
+
+	hist := newHistogramVec("test_latency_seconds", "Test latency.", []float64{0.1, 1}, "api")
+	hist.Observe(0.05, "GetObject")
+	hist.Observe(0.5, "GetObject")
+	hist.Observe(5, "GetObject")
+
+	buf.Reset()
+	hist.Write(buf)
+	expected = `# HELP test_latency_seconds Test latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{api="GetObject",le="0.1"} 1
+test_latency_seconds_bucket{api="GetObject",le="1"} 2
+test_latency_seconds_bucket{api="GetObject",le="+Inf"} 3
+test_latency_seconds_sum{api="GetObject"} 5.55
+test_latency_seconds_count{api="GetObject"} 3
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+// Tests mapping requests to API names.
+func TestGetRequestAPIName(t *testing.T) {
+	testCases := []struct {
+		method  string
+		url     string
+		header  http.Header
+		apiName string
+	}{
+		{"GET", "/", nil, "ListBuckets"},
+		{"POST", "/", nil, "STS"},
+		{"PUT", "/bucket", nil, "MakeBucket"},
+		{"GET", "/bucket?policy", nil, "GetBucketPolicy"},
+		{"GET", "/bucket?uploads", nil, "ListMultipartUploads"},
+		{"POST", "/bucket?delete", nil, "DeleteMultipleObjects"},
+		{"POST", "/bucket", nil, "PostPolicy"},
+		{"HEAD", "/bucket", nil, "HeadBucket"},
+		{"GET", "/bucket/object", nil, "GetObject"},
+		{"HEAD", "/bucket/object", nil, "HeadObject"},
+		{"PUT", "/bucket/object", nil, "PutObject"},
+		{"PUT", "/bucket/object", http.Header{"X-Amz-Copy-Source": []string{"/src/object"}}, "CopyObject"},
+		{"PUT", "/bucket/object?uploadId=1&partNumber=1", nil, "PutObjectPart"},
+		{"POST", "/bucket/object?uploads", nil, "NewMultipartUpload"},
+		{"POST", "/bucket/object?uploadId=1", nil, "CompleteMultipartUpload"},
+		{"DELETE", "/bucket/object?uploadId=1", nil, "AbortMultipartUpload"},
+		{"GET", adminAPIPathPrefix + "/status", nil, "Admin"},
+		{"GET", metricsPath, nil, "Metrics"},
+		{"POST", reservedBucket + "/webrpc", nil, "Web"},
+	}
+	for i, testCase := range testCases {
+		req, err := http.NewRequest(testCase.method, "http://localhost:9000"+testCase.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, values := range testCase.header {
+			req.Header[key] = values
+		}
+		if apiName := getRequestAPIName(req); apiName != testCase.apiName {
+			t.Errorf("Test %d: Expected %s, got %s", i+1, testCase.apiName, apiName)
+		}
+	}
+}
+
+// Tests disk metrics are reported for fs backend.
+func TestWriteDiskMetrics(t *testing.T) {
+	directory, err := ioutil.TempDir("", "minio-metrics-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	objAPI, err := newFSObjects(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	writeDiskMetrics(buf, objAPI)
+	if !strings.Contains(buf.String(), `minio_disk_online{disk="`+directory+`"} 1`) {
+		t.Fatalf("Expected disk to be online, got %s", buf.String())
+	}
+}
+
+// Tests disk metrics of XL are reported from the tracked disk health.
+func TestWriteDiskMetricsXL(t *testing.T) {
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	storage, err := newXL(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl := storage.(*XL)
+	offlineDisk := xl.storageDisks[0].(*trackedDisk)
+	for i := 0; i < diskFaultThreshold; i++ {
+		offlineDisk.fault(errDiskNotFound)
+	}
+
+	buf := &bytes.Buffer{}
+	writeDiskMetrics(buf, xlObjects{xl})
+	if !strings.Contains(buf.String(), `minio_disk_online{disk="`+disks[0]+`"} 0`) {
+		t.Fatalf("Expected faulty disk to be offline, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `minio_disk_consecutive_errors{disk="`+disks[0]+`"} 3`) {
+		t.Fatalf("Expected faults of the disk reported, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `minio_disk_online{disk="`+disks[1]+`"} 1`) {
+		t.Fatalf("Expected disk to be online, got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), `minio_disk_total_bytes{disk="`+disks[1]+`"} 0`) {
+		t.Fatalf("Expected usage of local disk reported, got %s", buf.String())
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skyrings/skyring-common/tools/uuid"
+)
+
+const (
+	// Interval for refreshing held locks, should be well within
+	// lock lease duration.
+	lockRefreshInterval = 10 * time.Second
+	// Maximum delay between two attempts to acquire a lock.
+	lockRetryMaxDelay = 250 * time.Millisecond
+	// Failed attempts after which waiting for a lock is logged.
+	lockRetryLogAttempts = 100
+	// Time after which acquiring a lock is given up, the lock is
+	// then held locally only and reported lost.
+	lockAcquireTimeout = 2 * lockLeaseDuration
+)
+
+// locker - lock server of a node, either called directly or over rpc.
+type locker interface {
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+}
+
+// localLocker - lock server of this node, called directly.
+type localLocker struct {
+	*lockServer
+}
+
+// Call - calls the lock server method.
+func (l localLocker) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	lockArgs, granted := args.(*LockArgs), reply.(*bool)
+	lockArgs.SetAuthToken(newRPCAuthToken(serviceMethod))
+	switch serviceMethod {
+	case "Lock.LockHandler":
+		return l.LockHandler(lockArgs, granted)
+	case "Lock.RLockHandler":
+		return l.RLockHandler(lockArgs, granted)
+	case "Lock.UnlockHandler":
+		return l.UnlockHandler(lockArgs, granted)
+	case "Lock.RUnlockHandler":
+		return l.RUnlockHandler(lockArgs, granted)
+	case "Lock.RefreshHandler":
+		return l.RefreshHandler(lockArgs, granted)
+	}
+	return errUnexpected
+}
+
+// distLock - a lock granted by quorum of lock servers, refreshed in
+// background until released.
+type distLock struct {
+	args     LockArgs
+	readLock bool
+	lockers  []locker
+	granted  []bool
+	stopCh   chan struct{}
+	// Closed once the lock loses quorum of lock servers, other nodes
+	// may be granted the lock from then on.
+	lostCh chan struct{}
+}
+
+// getLockQuorum - write locks need majority of the lock servers, read
+// locks need enough servers to overlap with every write lock.
+func getLockQuorum(lockers int, readLock bool) int {
+	writeQuorum := lockers/2 + 1
+	if readLock {
+		return lockers - writeQuorum + 1
+	}
+	return writeQuorum
+}
+
+// callLockers - calls the method on lock servers where call is set,
+// in parallel. Returns lock servers which replied true.
+func callLockers(lockers []locker, call []bool, method string, args LockArgs) []bool {
+	replies := make([]bool, len(lockers))
+	var wg = &sync.WaitGroup{}
+	for index, lk := range lockers {
+		if !call[index] {
+			continue
+		}
+		wg.Add(1)
+		go func(index int, lk locker) {
+			defer wg.Done()
+			// Every call carries its own token.
+			lockArgs := args
+			var reply bool
+			if err := lk.Call(method, &lockArgs, &reply); err == nil {
+				replies[index] = reply
+			}
+		}(index, lk)
+	}
+	wg.Wait()
+	return replies
+}
+
+// acquireDistLock - blocks until the lock is granted by quorum of
+// lock servers, partially granted locks are released and retried
+// after a random delay. Once timeout elapses the lock is returned
+// lost without being granted, writes holding it do not commit.
+func acquireDistLock(lockers []locker, node, volume, path string, readLock bool, timeout time.Duration) *distLock {
+	lockMethod, unlockMethod := "Lock.LockHandler", "Lock.UnlockHandler"
+	if readLock {
+		lockMethod, unlockMethod = "Lock.RLockHandler", "Lock.RUnlockHandler"
+	}
+	all := make([]bool, len(lockers))
+	for index := range all {
+		all[index] = true
+	}
+	quorum := getLockQuorum(len(lockers), readLock)
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		args := LockArgs{
+			Name: pathJoin(volume, path),
+			UID:  newLockUID(),
+			Node: node,
+		}
+		granted := callLockers(lockers, all, lockMethod, args)
+		grantedCount := 0
+		for _, ok := range granted {
+			if ok {
+				grantedCount++
+			}
+		}
+		if grantedCount >= quorum {
+			dLock := &distLock{
+				args:     args,
+				readLock: readLock,
+				lockers:  lockers,
+				granted:  granted,
+				stopCh:   make(chan struct{}),
+				lostCh:   make(chan struct{}),
+			}
+			go dLock.refresh()
+			return dLock
+		}
+		callLockers(lockers, granted, unlockMethod, args)
+		if time.Now().After(deadline) {
+			log.WithFields(logrus.Fields{
+				"volume":   volume,
+				"path":     path,
+				"attempts": attempt,
+			}).Error("Quorum of lock servers did not grant the lock in time")
+			dLock := &distLock{
+				args:     args,
+				readLock: readLock,
+				lockers:  lockers,
+				granted:  make([]bool, len(lockers)),
+				stopCh:   make(chan struct{}),
+				lostCh:   make(chan struct{}),
+			}
+			close(dLock.lostCh)
+			return dLock
+		}
+		if attempt%lockRetryLogAttempts == 0 {
+			log.WithFields(logrus.Fields{
+				"volume":   volume,
+				"path":     path,
+				"attempts": attempt,
+			}).Error("Waiting for quorum of lock servers to grant the lock")
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(lockRetryMaxDelay))))
+	}
+}
+
+// newLockUID - returns unique id of a lock.
+func newLockUID() string {
+	uid, err := uuid.New()
+	if err != nil {
+		// Fall back to time based id, only needs to be unique
+		// among the locks of a node.
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	return uid.String()
+}
+
+// refresh - extends lease of the lock on all the lock servers which
+// granted it, until the lock is released or lost.
+func (d *distLock) refresh() {
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			if !d.refreshLease() {
+				return
+			}
+		}
+	}
+}
+
+// refreshLease - extends lease of the lock once. Returns false if the
+// lock lost quorum of lock servers, holder of the lock is notified by
+// closing lostCh.
+func (d *distLock) refreshLease() bool {
+	refreshed := callLockers(d.lockers, d.granted, "Lock.RefreshHandler", d.args)
+	refreshedCount := 0
+	for _, ok := range refreshed {
+		if ok {
+			refreshedCount++
+		}
+	}
+	if refreshedCount >= getLockQuorum(len(d.lockers), d.readLock) {
+		return true
+	}
+	log.WithFields(logrus.Fields{
+		"name": d.args.Name,
+		"uid":  d.args.UID,
+	}).Error("Lock lost quorum of lock servers")
+	close(d.lostCh)
+	return false
+}
+
+// release - releases the lock on all the lock servers which granted
+// it, lock servers which are not reachable expire it later.
+func (d *distLock) release() {
+	close(d.stopCh)
+	unlockMethod := "Lock.UnlockHandler"
+	if d.readLock {
+		unlockMethod = "Lock.RUnlockHandler"
+	}
+	callLockers(d.lockers, d.granted, unlockMethod, d.args)
+}
+
+// initDistributedNSLock - namespace is locked across the lock servers
+// of all the nodes when disks of other nodes are exported, otherwise
+// only locally.
+func initDistributedNSLock(lkServer *lockServer, exportPaths []string) {
+	var lockers []locker
+	netAddrs := make(map[string]struct{})
+	for _, exportPath := range exportPaths {
+		if _, ok := getLocalExportPath(exportPath); ok {
+			continue
+		}
+		netAddr, _ := splitRemoteExportPath(exportPath)
+		if _, ok := netAddrs[netAddr]; ok {
+			continue
+		}
+		netAddrs[netAddr] = struct{}{}
+		lockers = append(lockers, newLazyRPCClient(netAddr, lockRPCPath))
+	}
+	if len(lockers) == 0 {
+		// Single node.
+		return
+	}
+	lockers = append([]locker{localLocker{lkServer}}, lockers...)
+	lkServer.startLockExpiry()
+
+	node := globalMinioAddr
+	if hostname, err := os.Hostname(); err == nil {
+		node = hostname + globalMinioAddr
+	}
+
+	nsMutex.mutex.Lock()
+	defer nsMutex.mutex.Unlock()
+	nsMutex.lockers = lockers
+	nsMutex.node = node
+}
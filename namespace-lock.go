@@ -18,6 +18,7 @@ package main
 
 import (
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -32,13 +33,19 @@ type nsParam struct {
 type nsLock struct {
 	*sync.RWMutex
 	ref uint
+	// Distributed locks held along with the local lock, by their
+	// holders.
+	distLocks []*distLock
 }
 
 // nsLockMap - namespace lock map, provides primitives to Lock,
-// Unlock, RLock and RUnlock.
+// Unlock, RLock and RUnlock. Resources are additionally locked on
+// lock servers of all the nodes in distributed setup.
 type nsLockMap struct {
 	lockMap map[nsParam]*nsLock
 	mutex   *sync.Mutex
+	lockers []locker
+	node    string
 }
 
 // Global name space lock.
@@ -52,8 +59,9 @@ func initNSLock() {
 	}
 }
 
-// Lock the namespace resource.
-func (n *nsLockMap) lock(volume, path string, readLock bool) {
+// Lock the namespace resource. Returns the lock held on other nodes,
+// nil if the lock is held locally only.
+func (n *nsLockMap) lock(volume, path string, readLock bool) *distLock {
 	n.mutex.Lock()
 
 	param := nsParam{volume, path}
@@ -70,20 +78,51 @@ func (n *nsLockMap) lock(volume, path string, readLock bool) {
 	n.mutex.Unlock()
 
 	// Locking here can block.
+	start := time.Now()
+	lockType := "write"
 	if readLock {
 		nsLk.RLock()
+		lockType = "read"
 	} else {
 		nsLk.Lock()
 	}
+
+	// Lock on other nodes once no one else holds the lock locally.
+	var dLock *distLock
+	if len(n.lockers) > 0 {
+		dLock = acquireDistLock(n.lockers, n.node, volume, path, readLock, lockAcquireTimeout)
+		n.mutex.Lock()
+		nsLk.distLocks = append(nsLk.distLocks, dLock)
+		n.mutex.Unlock()
+	}
+	globalMetrics.nsLockWait.ObserveDuration(start, lockType)
+	return dLock
 }
 
-// Unlock the namespace resource.
-func (n *nsLockMap) unlock(volume, path string, readLock bool) {
+// Unlock the namespace resource, dLock is the lock held on other nodes
+// returned by lock.
+func (n *nsLockMap) unlock(volume, path string, readLock bool, dLock *distLock) {
+	param := nsParam{volume, path}
+
+	// Release the lock on other nodes before the local lock.
+	if dLock != nil {
+		n.mutex.Lock()
+		if nsLk, found := n.lockMap[param]; found {
+			for index, held := range nsLk.distLocks {
+				if held == dLock {
+					nsLk.distLocks = append(nsLk.distLocks[:index], nsLk.distLocks[index+1:]...)
+					break
+				}
+			}
+		}
+		n.mutex.Unlock()
+		dLock.release()
+	}
+
 	// nsLk.Unlock() will not block, hence locking the map for the entire function is fine.
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 
-	param := nsParam{volume, path}
 	if nsLk, found := n.lockMap[param]; found {
 		if readLock {
 			nsLk.RUnlock()
@@ -107,26 +146,29 @@ func (n *nsLockMap) unlock(volume, path string, readLock bool) {
 }
 
 // Lock - locks the given resource for writes, using a previously
-// allocated name space lock or initializing a new one.
-func (n *nsLockMap) Lock(volume, path string) {
+// allocated name space lock or initializing a new one. Returns the lock
+// held on other nodes to be passed to Unlock, writes check it is not
+// lost before they commit.
+func (n *nsLockMap) Lock(volume, path string) *distLock {
 	readLock := false
-	n.lock(volume, path, readLock)
+	return n.lock(volume, path, readLock)
 }
 
-// Unlock - unlocks any previously acquired write locks.
-func (n *nsLockMap) Unlock(volume, path string) {
+// Unlock - unlocks the write lock returned by Lock.
+func (n *nsLockMap) Unlock(volume, path string, dLock *distLock) {
 	readLock := false
-	n.unlock(volume, path, readLock)
+	n.unlock(volume, path, readLock, dLock)
 }
 
-// RLock - locks any previously acquired read locks.
-func (n *nsLockMap) RLock(volume, path string) {
+// RLock - locks any previously acquired read locks. Returns the lock
+// held on other nodes to be passed to RUnlock.
+func (n *nsLockMap) RLock(volume, path string) *distLock {
 	readLock := true
-	n.lock(volume, path, readLock)
+	return n.lock(volume, path, readLock)
 }
 
-// RUnlock - unlocks any previously acquired read locks.
-func (n *nsLockMap) RUnlock(volume, path string) {
+// RUnlock - unlocks the read lock returned by RLock.
+func (n *nsLockMap) RUnlock(volume, path string, dLock *distLock) {
 	readLock := true
-	n.unlock(volume, path, readLock)
+	n.unlock(volume, path, readLock, dLock)
 }
@@ -127,9 +127,32 @@ func (d byBucketName) Len() int           { return len(d) }
 func (d byBucketName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
 func (d byBucketName) Less(i, j int) bool { return d[i].Name < d[j].Name }
 
+// byObjectName is a collection satisfying sort.Interface.
+type byObjectName []ObjectInfo
+
+func (d byObjectName) Len() int           { return len(d) }
+func (d byObjectName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byObjectName) Less(i, j int) bool { return d[i].Name < d[j].Name }
+
+// byObjectUpload is a collection satisfying sort.Interface.
+type byObjectUpload []uploadMetadata
+
+func (d byObjectUpload) Len() int      { return len(d) }
+func (d byObjectUpload) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byObjectUpload) Less(i, j int) bool {
+	if d[i].Object != d[j].Object {
+		return d[i].Object < d[j].Object
+	}
+	return d[i].UploadID < d[j].UploadID
+}
+
 // safeCloseAndRemove - safely closes and removes underlying temporary
 // file writer if possible.
 func safeCloseAndRemove(writer io.WriteCloser) error {
+	// Writer of a scheduled disk, remove the file written.
+	if scheduledWriter, ok := writer.(*scheduledWriter); ok {
+		return safeCloseAndRemove(scheduledWriter.WriteCloser)
+	}
 	// If writer is a safe file, Attempt to close and remove.
 	safeWriter, ok := writer.(*safe.File)
 	if ok {
@@ -139,5 +162,10 @@ func safeCloseAndRemove(writer io.WriteCloser) error {
 	if ok {
 		return pipeWriter.CloseWithError(errors.New("Close and error out."))
 	}
+	// Network file is discarded by the server if upload fails.
+	networkWriter, ok := writer.(*networkFileWriter)
+	if ok {
+		return networkWriter.CloseWithError(errors.New("Close and error out."))
+	}
 	return nil
 }
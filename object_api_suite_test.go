@@ -21,8 +21,10 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"strconv"
+	"strings"
 
 	"gopkg.in/check.v1"
 )
@@ -79,6 +81,18 @@ func testMultipartObjectCreation(c *check.C, create func() ObjectLayer) {
 	md5Sum, err := obj.CompleteMultipartUpload("bucket", "key", uploadID, completedParts.Parts)
 	c.Assert(err, check.IsNil)
 	c.Assert(md5Sum, check.Equals, "7dd76eded6f7c3580a78463a7cf539bd-10")
+
+	// Completed object is the parts in order. Parts are committed
+	// without copying in XL mode, verified by TestXLCommitParts.
+	expectedData := strings.Repeat("The specified multipart upload does not exist. The upload ID might be invalid, or the multipart upload might have been aborted or completed.", 10)
+	objInfo, err := obj.GetObjectInfo("bucket", "key")
+	c.Assert(err, check.IsNil)
+	c.Assert(objInfo.Size, check.Equals, int64(len(expectedData)))
+	reader, err := obj.GetObject("bucket", "key", 0)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, expectedData)
 }
 
 // Tests validate abortion of Multipart operation.
@@ -70,6 +70,7 @@ func (t task) getHandle() Handle {
 
 	// Make a handle with limited access to channels (only send or receive).
 	return Handle{
+		this:     t.this,
 		cmdCh:    t.cmdCh,
 		statusCh: t.statusCh,
 		closeCh:  t.closeCh,
@@ -82,6 +82,7 @@ func (tc *TaskCtl) Shutdown() {
 	for e := tc.tasks.Front(); e != nil; e = e.Next() {
 		wg.Add(1)
 		thisTask := e.Value.(task) // Make a local copy for go routine.
+		thisTask.this = e
 		// End tasks in background. Flow of events from here is as follows: thisTask.handle.Close() -> tc.NewTask() -> this.task.close().
 		go func() {
 			thisTask.getHandle().Close()
@@ -91,8 +92,9 @@ func (tc *TaskCtl) Shutdown() {
 
 	wg.Wait() // Wait for all tasks to end gracefully.
 
-	// Reset the task pool.
-	tc.tasks = nil
+	// Reset the task pool, tasks still being released are removed
+	// from the old list.
+	tc.tasks = list.New()
 }
 
 // Suspend puts all tasks to sleep.
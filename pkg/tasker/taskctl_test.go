@@ -36,3 +36,21 @@ func (s *MySuite) TestCheckData(c *C) {
 	testTasks.Shutdown()
 	// c.Assert(err, Not(IsNil))
 }
+
+func (s *MySuite) TestSuspendResume(c *C) {
+	testTasks := tasker.New("Test Task")
+	handle := testTasks.NewTask("Test Suspend Resume")
+	go func() {
+		for cmd := range handle.Listen() {
+			switch cmd {
+			case tasker.CmdSignalSuspend, tasker.CmdSignalResume:
+				handle.StatusDone()
+			default:
+				handle.StatusBusy()
+			}
+		}
+	}()
+	c.Assert(testTasks.Suspend(), Equals, true)
+	c.Assert(testTasks.Resume(), Equals, true)
+	testTasks.Shutdown()
+}
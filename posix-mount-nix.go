@@ -0,0 +1,39 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isMountPoint - returns true if dirPath is on another device than its
+// parent directory.
+func isMountPoint(dirPath string) (bool, error) {
+	st, err := os.Stat(dirPath)
+	if err != nil {
+		return false, err
+	}
+	parentSt, err := os.Stat(filepath.Dir(filepath.Clean(dirPath)))
+	if err != nil {
+		return false, err
+	}
+	return st.Sys().(*syscall.Stat_t).Dev != parentSt.Sys().(*syscall.Stat_t).Dev, nil
+}
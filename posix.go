@@ -50,6 +50,9 @@ type fsStorage struct {
 	minFreeDisk        int64
 	listObjectMap      map[listParams][]*treeWalker
 	listObjectMapMutex *sync.Mutex
+	// Disk path was a mount point when the disk was initialized, the
+	// disk is not found once it is unmounted.
+	mountPoint bool
 }
 
 // isDirEmpty - returns whether given directory is empty or not.
@@ -96,11 +99,19 @@ func newPosix(diskPath string) (StorageAPI, error) {
 		}).Debugf("Disk %s.", syscall.ENOTDIR)
 		return nil, syscall.ENOTDIR
 	}
+	mountPoint, err := isMountPoint(diskPath)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"diskPath": diskPath,
+		}).Debugf("isMountPoint failed with %s", err)
+		return nil, err
+	}
 	fs := fsStorage{
 		diskPath:           diskPath,
 		minFreeDisk:        5, // Minimum 5% disk should be free.
 		listObjectMap:      make(map[listParams][]*treeWalker),
 		listObjectMapMutex: &sync.Mutex{},
+		mountPoint:         mountPoint,
 	}
 	log.WithFields(logrus.Fields{
 		"diskPath":    diskPath,
@@ -109,6 +120,22 @@ func newPosix(diskPath string) (StorageAPI, error) {
 	return fs, nil
 }
 
+// checkDiskFound - returns errDiskNotFound if the disk path no longer
+// exists or is no longer mounted, otherwise the original error. A
+// removed disk should not be mistaken for missing volumes and files,
+// nor should the empty directory left by an unmounted disk.
+func (s fsStorage) checkDiskFound(err error) error {
+	if _, statErr := os.Stat(s.diskPath); statErr != nil && os.IsNotExist(statErr) {
+		return errDiskNotFound
+	}
+	if s.mountPoint {
+		if mounted, mountErr := isMountPoint(s.diskPath); mountErr == nil && !mounted {
+			return errDiskNotFound
+		}
+	}
+	return err
+}
+
 // checkDiskFree verifies if disk path has sufficient minium free disk
 // space.
 func checkDiskFree(diskPath string, minFreeDisk int64) (err error) {
@@ -206,7 +233,7 @@ func (s fsStorage) getVolumeDir(volume string) (string, error) {
 		var volsInfo []VolInfo
 		volsInfo, err = getAllUniqueVols(s.diskPath)
 		if err != nil {
-			return volumeDir, errVolumeNotFound
+			return volumeDir, s.checkDiskFound(errVolumeNotFound)
 		}
 		for _, vol := range volsInfo {
 			// Verify if lowercase version of
@@ -218,7 +245,7 @@ func (s fsStorage) getVolumeDir(volume string) (string, error) {
 				return volumeDir, nil
 			}
 		}
-		return volumeDir, errVolumeNotFound
+		return volumeDir, s.checkDiskFound(errVolumeNotFound)
 	} else if os.IsPermission(err) {
 		log.WithFields(logrus.Fields{
 			"diskPath": s.diskPath,
@@ -235,7 +262,7 @@ func (s fsStorage) getVolumeDir(volume string) (string, error) {
 func (s fsStorage) MakeVol(volume string) (err error) {
 	// Validate if disk is free.
 	if err = checkDiskFree(s.diskPath, s.minFreeDisk); err != nil {
-		return err
+		return s.checkDiskFound(err)
 	}
 
 	volumeDir, err := s.getVolumeDir(volume)
@@ -268,14 +295,20 @@ func (s fsStorage) ListVols() (volsInfo []VolInfo, err error) {
 		log.WithFields(logrus.Fields{
 			"diskPath": s.diskPath,
 		}).Debugf("Failed to get disk info, %s", err)
-		return nil, err
+		return nil, s.checkDiskFound(err)
 	}
 	volsInfo, err = getAllUniqueVols(s.diskPath)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"diskPath": s.diskPath,
 		}).Debugf("getAllUniqueVols failed with %s", err)
-		return nil, err
+		return nil, s.checkDiskFound(err)
+	}
+	// Unmounted disk leaves an empty directory.
+	if len(volsInfo) == 0 {
+		if err = s.checkDiskFound(nil); err != nil {
+			return nil, err
+		}
 	}
 	for i, vol := range volsInfo {
 		// Volname on case sensitive fs backends can come in as
@@ -756,5 +789,17 @@ func (s fsStorage) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) err
 		log.Debug("os.MkdirAll failed with %s", err)
 		return err
 	}
-	return os.Rename(path.Join(srcVolumeDir, srcPath), path.Join(dstVolumeDir, dstPath))
+	srcFilePath := path.Join(srcVolumeDir, srcPath)
+	if err = os.Rename(srcFilePath, path.Join(dstVolumeDir, dstPath)); err != nil {
+		return err
+	}
+	// Parent directories left empty are removed, as by DeleteFile.
+	if err = deleteFile(srcVolumeDir, path.Dir(srcFilePath)); err != nil && err != errFileNotFound {
+		log.WithFields(logrus.Fields{
+			"diskPath": s.diskPath,
+			"volume":   srcVolume,
+			"path":     srcPath,
+		}).Debugf("deleteFile failed with %s", err)
+	}
+	return nil
 }
@@ -0,0 +1,389 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"container/list"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit - token bucket limits, a zero value disables the limit.
+type rateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	RequestsBurst     int     `json:"requestsBurst"`
+	BytesPerSecond    int64   `json:"bytesPerSecond"`
+}
+
+// isValid - limits cannot be negative.
+func (l rateLimit) isValid() bool {
+	return l.RequestsPerSecond >= 0 && l.RequestsBurst >= 0 && l.BytesPerSecond >= 0
+}
+
+// rateLimitConfig - limits applied separately to every access key,
+// bucket and source IP.
+type rateLimitConfig struct {
+	AccessKey rateLimit `json:"accessKey"`
+	Bucket    rateLimit `json:"bucket"`
+	SourceIP  rateLimit `json:"sourceIP"`
+}
+
+// isValid - verifies all the limits.
+func (c rateLimitConfig) isValid() bool {
+	return c.AccessKey.isValid() && c.Bucket.isValid() && c.SourceIP.isValid()
+}
+
+// Kinds of rate limit keys.
+const (
+	rateLimitAccessKey = "accessKey"
+	rateLimitBucket    = "bucket"
+	rateLimitSourceIP  = "sourceIP"
+)
+
+// rateLimitKey - a client request is limited on.
+type rateLimitKey struct {
+	kind  string
+	value string
+}
+
+// getLimit - returns limit applied to a kind of key.
+func (c rateLimitConfig) getLimit(kind string) rateLimit {
+	switch kind {
+	case rateLimitAccessKey:
+		return c.AccessKey
+	case rateLimitBucket:
+		return c.Bucket
+	case rateLimitSourceIP:
+		return c.SourceIP
+	}
+	return rateLimit{}
+}
+
+// tokenBucket - tokens are added at a fixed rate up to burst, each
+// request or byte consumes a token.
+type tokenBucket struct {
+	mutex  *sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket - initialize a full token bucket.
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		mutex:  &sync.Mutex{},
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// refill - adds tokens accumulated since last refill, must be called
+// with the mutex held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Allow - consumes n tokens if available.
+func (b *tokenBucket) Allow(n float64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Reserve - consumes n tokens even if they are not available yet,
+// returns how long the caller has to wait for them.
+func (b *tokenBucket) Reserve(n float64) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// allowRequest - consumes a token of every bucket if all of them have
+// one available, none are consumed otherwise. Buckets are listed in
+// order of their kinds, which keeps the locking order consistent.
+func allowRequest(buckets []*tokenBucket) bool {
+	for _, bucket := range buckets {
+		bucket.mutex.Lock()
+		defer bucket.mutex.Unlock()
+	}
+	for _, bucket := range buckets {
+		bucket.refill()
+		if bucket.tokens < 1 {
+			return false
+		}
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true
+}
+
+// maxRateLimitBuckets - least recently used buckets are dropped
+// beyond this count.
+const maxRateLimitBuckets = 10000
+
+// rateLimitEntry - token bucket of a rate limit key.
+type rateLimitEntry struct {
+	key    rateLimitKey
+	bucket *tokenBucket
+}
+
+// rateLimitBuckets - token buckets of rate limit keys, least recently
+// used buckets are dropped once there are too many of them.
+type rateLimitBuckets struct {
+	lru     *list.List
+	entries map[rateLimitKey]*list.Element
+}
+
+// newRateLimitBuckets - initialize rate limit buckets.
+func newRateLimitBuckets() *rateLimitBuckets {
+	return &rateLimitBuckets{
+		lru:     list.New(),
+		entries: make(map[rateLimitKey]*list.Element),
+	}
+}
+
+// get - returns bucket of key, a new bucket is added if none.
+func (b *rateLimitBuckets) get(key rateLimitKey, rate, burst float64) *tokenBucket {
+	if elem, ok := b.entries[key]; ok {
+		b.lru.MoveToFront(elem)
+		return elem.Value.(rateLimitEntry).bucket
+	}
+	if b.lru.Len() >= maxRateLimitBuckets {
+		oldest := b.lru.Back()
+		b.lru.Remove(oldest)
+		delete(b.entries, oldest.Value.(rateLimitEntry).key)
+	}
+	bucket := newTokenBucket(rate, burst)
+	b.entries[key] = b.lru.PushFront(rateLimitEntry{key, bucket})
+	return bucket
+}
+
+// rateLimiter - keeps request and bandwidth token buckets of all
+// the rate limit keys.
+type rateLimiter struct {
+	mutex    *sync.Mutex
+	config   rateLimitConfig
+	requests *rateLimitBuckets
+	bytes    *rateLimitBuckets
+}
+
+// newRateLimiter - initialize a new rate limiter.
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		mutex:    &sync.Mutex{},
+		requests: newRateLimitBuckets(),
+		bytes:    newRateLimitBuckets(),
+	}
+}
+
+// Global rate limiter.
+var globalRateLimiter = newRateLimiter()
+
+// getBuckets - returns request and bandwidth buckets of keys with
+// limits enabled. All the buckets are reset when limits change, which
+// makes limits reloadable through server config.
+func (l *rateLimiter) getBuckets(config rateLimitConfig, keys []rateLimitKey) (requestBuckets, byteBuckets []*tokenBucket) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if config != l.config {
+		l.config = config
+		l.requests = newRateLimitBuckets()
+		l.bytes = newRateLimitBuckets()
+	}
+	for _, key := range keys {
+		limit := config.getLimit(key.kind)
+		if limit.RequestsPerSecond > 0 {
+			burst := float64(limit.RequestsBurst)
+			if burst == 0 {
+				burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+			}
+			requestBuckets = append(requestBuckets, l.requests.get(key, limit.RequestsPerSecond, burst))
+		}
+		if limit.BytesPerSecond > 0 {
+			// Allow up to a second worth of bytes in a burst.
+			rate := float64(limit.BytesPerSecond)
+			byteBuckets = append(byteBuckets, l.bytes.get(key, rate, rate))
+		}
+	}
+	return requestBuckets, byteBuckets
+}
+
+// waitForBytes - paces transfer of n bytes on all the buckets.
+func waitForBytes(buckets []*tokenBucket, n int) {
+	var wait time.Duration
+	for _, bucket := range buckets {
+		if d := bucket.Reserve(float64(n)); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// maxPacedChunkSize - returns the largest chunk which can be
+// transferred at once without exceeding burst of any bucket.
+func maxPacedChunkSize(buckets []*tokenBucket, size int) int {
+	for _, bucket := range buckets {
+		if burst := int(bucket.burst); burst > 0 && burst < size {
+			size = burst
+		}
+	}
+	return size
+}
+
+// rateLimitReadCloser - paces reads of the request body.
+type rateLimitReadCloser struct {
+	io.ReadCloser
+	buckets []*tokenBucket
+}
+
+func (r *rateLimitReadCloser) Read(p []byte) (int, error) {
+	p = p[:maxPacedChunkSize(r.buckets, len(p))]
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		waitForBytes(r.buckets, n)
+	}
+	return n, err
+}
+
+// rateLimitResponseWriter - paces writes of the response body.
+type rateLimitResponseWriter struct {
+	http.ResponseWriter
+	buckets []*tokenBucket
+}
+
+func (w *rateLimitResponseWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:maxPacedChunkSize(w.buckets, len(p))]
+		waitForBytes(w.buckets, len(chunk))
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Flush - handlers streaming their responses rely on http.Flusher.
+func (w *rateLimitResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// isRateLimitKeyAuthenticated - verifies signature of the request
+// headers, the payload is verified by the handlers. Access keys and
+// buckets of requests failing verification are not limited on, so
+// that clients cannot use up limits of others.
+func isRateLimitKeyAuthenticated(r *http.Request) bool {
+	// Region is verified by the handlers.
+	validateRegion := false
+	switch getRequestAuthType(r) {
+	case authTypeSigned:
+		hashedPayload := r.Header.Get("X-Amz-Content-Sha256")
+		if hashedPayload == "" {
+			return false
+		}
+		return doesSignatureMatch(hashedPayload, r, validateRegion, serviceS3, serviceSTS) == ErrNone
+	case authTypePresigned:
+		hashedPayload := r.URL.Query().Get("X-Amz-Content-Sha256")
+		return doesPresignedSignatureMatch(hashedPayload, r, validateRegion, serviceS3, serviceSTS) == ErrNone
+	}
+	return false
+}
+
+// getRateLimitKeys - returns access key, bucket and source IP of the
+// request. Requests without a valid signature are limited by source
+// IP only.
+func getRateLimitKeys(r *http.Request) []rateLimitKey {
+	var keys []rateLimitKey
+	if isRateLimitKeyAuthenticated(r) {
+		if accessKey, s3Error := getRequestAccessKey(r); s3Error == ErrNone {
+			keys = append(keys, rateLimitKey{rateLimitAccessKey, accessKey})
+		}
+		if !strings.HasPrefix(r.URL.Path, reservedBucket+slashSeparator) {
+			if bucket, _ := splitBucketObject(r.URL.Path); bucket != "" {
+				keys = append(keys, rateLimitKey{rateLimitBucket, bucket})
+			}
+		}
+	}
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	keys = append(keys, rateLimitKey{rateLimitSourceIP, sourceIP})
+	return keys
+}
+
+// rateLimitHandler - limits request rate and bandwidth of clients.
+type rateLimitHandler struct {
+	handler http.Handler
+}
+
+// setRateLimitHandler to enforce request rate and bandwidth limits.
+func setRateLimitHandler(h http.Handler) http.Handler {
+	return rateLimitHandler{h}
+}
+
+func (h rateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Health checks and storage rpc are never limited.
+	if serverConfig == nil || isHealthCheckRequest(r) || isRPCRequest(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	requestBuckets, byteBuckets := globalRateLimiter.getBuckets(serverConfig.GetRateLimit(), getRateLimitKeys(r))
+	if !allowRequest(requestBuckets) {
+		writeErrorResponse(w, r, ErrSlowDown, r.URL.Path)
+		return
+	}
+	if len(byteBuckets) > 0 {
+		// Large transfers are paced instead of being rejected.
+		if r.Body != nil {
+			r.Body = &rateLimitReadCloser{ReadCloser: r.Body, buckets: byteBuckets}
+		}
+		w = &rateLimitResponseWriter{ResponseWriter: w, buckets: byteBuckets}
+	}
+	h.handler.ServeHTTP(w, r)
+}
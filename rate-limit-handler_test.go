@@ -0,0 +1,146 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Tests token bucket allows up to burst and paces reservations.
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(10, 2)
+	if !bucket.Allow(1) || !bucket.Allow(1) {
+		t.Fatal("Expected burst of 2 to be allowed")
+	}
+	if bucket.Allow(1) {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if wait := bucket.Reserve(10); wait < 900*time.Millisecond || wait > time.Second+100*time.Millisecond {
+		t.Fatalf("Expected to wait about a second, got %s", wait)
+	}
+}
+
+// Tests limits are applied per key and reset when config changes.
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter()
+	config := rateLimitConfig{
+		AccessKey: rateLimit{RequestsPerSecond: 1},
+		SourceIP:  rateLimit{BytesPerSecond: 1024},
+	}
+	keys := []rateLimitKey{
+		{rateLimitAccessKey, "accesskey"},
+		{rateLimitBucket, "bucket"},
+		{rateLimitSourceIP, "127.0.0.1"},
+	}
+	requestBuckets, byteBuckets := limiter.getBuckets(config, keys)
+	if len(requestBuckets) != 1 || len(byteBuckets) != 1 {
+		t.Fatalf("Expected 1 request and 1 byte bucket, got %d and %d", len(requestBuckets), len(byteBuckets))
+	}
+	if !requestBuckets[0].Allow(1) || requestBuckets[0].Allow(1) {
+		t.Fatal("Expected only one request to be allowed")
+	}
+	// Same key shares its bucket.
+	sameBuckets, _ := limiter.getBuckets(config, keys[:1])
+	if sameBuckets[0] != requestBuckets[0] {
+		t.Fatal("Expected same bucket for the same key")
+	}
+	// Changing config resets buckets.
+	config.AccessKey.RequestsPerSecond = 2
+	newBuckets, _ := limiter.getBuckets(config, keys[:1])
+	if !newBuckets[0].Allow(1) {
+		t.Fatal("Expected buckets to be reset on config change")
+	}
+	if requestBuckets, byteBuckets = limiter.getBuckets(rateLimitConfig{}, keys); len(requestBuckets)+len(byteBuckets) != 0 {
+		t.Fatal("Expected no buckets with limits disabled")
+	}
+	if (rateLimitConfig{Bucket: rateLimit{BytesPerSecond: -1}}).isValid() {
+		t.Fatal("Expected negative limits to be invalid")
+	}
+}
+
+// Tests request bodies are paced instead of being rejected.
+func TestRateLimitReadCloser(t *testing.T) {
+	bucket := newTokenBucket(1024*1024, 1024)
+	data := bytes.Repeat([]byte("a"), 4096)
+	reader := &rateLimitReadCloser{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(data)),
+		buckets:    []*tokenBucket{bucket},
+	}
+	readData, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Expected paced reader to return all the data")
+	}
+}
+
+// Tests unauthenticated requests are limited by source IP only.
+func TestGetRateLimitKeys(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://localhost:9000/bucket/object", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "10.0.0.1:1234"
+	keys := getRateLimitKeys(req)
+	expected := []rateLimitKey{{rateLimitSourceIP, "10.0.0.1"}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+}
+
+// Tests requests take tokens only if all their buckets have them.
+func TestAllowRequest(t *testing.T) {
+	available := newTokenBucket(10, 1)
+	exhausted := newTokenBucket(0.001, 1)
+	exhausted.Allow(1)
+	if allowRequest([]*tokenBucket{available, exhausted}) {
+		t.Fatal("Expected request to be rejected")
+	}
+	if !available.Allow(1) {
+		t.Fatal("Expected no tokens taken from buckets of a rejected request")
+	}
+}
+
+// Tests least recently used buckets are dropped first.
+func TestRateLimitBucketsLRU(t *testing.T) {
+	buckets := newRateLimitBuckets()
+	first := buckets.get(rateLimitKey{rateLimitSourceIP, "first"}, 1, 1)
+	for i := 1; i < maxRateLimitBuckets; i++ {
+		buckets.get(rateLimitKey{rateLimitSourceIP, strconv.Itoa(i)}, 1, 1)
+	}
+	// Using the first bucket makes the second the least recently used.
+	if buckets.get(rateLimitKey{rateLimitSourceIP, "first"}, 1, 1) != first {
+		t.Fatal("Expected same bucket for the same key")
+	}
+	buckets.get(rateLimitKey{rateLimitSourceIP, "new"}, 1, 1)
+	if buckets.lru.Len() != maxRateLimitBuckets {
+		t.Fatalf("Expected %d buckets, got %d", maxRateLimitBuckets, buckets.lru.Len())
+	}
+	if _, ok := buckets.entries[rateLimitKey{rateLimitSourceIP, "1"}]; ok {
+		t.Fatal("Expected least recently used bucket to be dropped")
+	}
+	if _, ok := buckets.entries[rateLimitKey{rateLimitSourceIP, "first"}]; !ok {
+		t.Fatal("Expected recently used bucket to be kept")
+	}
+}
@@ -30,18 +30,59 @@ func newObjectLayer(exportPaths ...string) (ObjectLayer, error) {
 		// Initialize FS object layer.
 		return newFSObjects(exportPath)
 	}
+	// Initialize XL object layer on erasure sets, if there are more
+	// disks than a single XL supports.
+	if len(exportPaths) > maxErasureBlocks {
+		return newXLSets(exportPaths...)
+	}
 	// Initialize XL object layer.
 	return newXLObjects(exportPaths...)
 }
 
 // configureServer handler returns final handler for the http server.
 func configureServerHandler(srvCmdConfig serverCmdConfig) http.Handler {
+	// Initialize lock server, namespace is locked on all the nodes
+	// in distributed setup.
+	lkServer := newLockServer()
+	initDistributedNSLock(lkServer, srvCmdConfig.exportPaths)
+
 	objAPI, err := newObjectLayer(srvCmdConfig.exportPaths...)
 	fatalIf(err, "Initializing object layer failed.", nil)
 
-	// Initialize storage rpc server.
-	storageRPC, err := newRPCServer(srvCmdConfig.exportPaths[0]) // FIXME: should only have one path.
-	fatalIf(err, "Initializing storage rpc server failed.", nil)
+	// Validate format of the disks, recover interrupted writes and start
+	// background healing on XL, once disks of all the servers are reachable.
+	// Disks of other servers are reachable only once they serve storage
+	// rpc, in distributed setup only rpc is served until then.
+	var xlReadyCh chan struct{}
+	if sets, ok := getXLSets(objAPI); ok {
+		// Disks of a new deployment are formatted by the server of
+		// the first disk.
+		_, formatDisks := getLocalExportPath(srvCmdConfig.exportPaths[0])
+		initXL := func() {
+			waitForXLQuorum(sets)
+			fatalIf(waitForFormatXL(sets, formatDisks), "Validating format of disks failed.", nil)
+			recoverXLTmpOps(sets)
+			startDiskHealer(sets)
+			fatalIf(startHealScanner(sets), "Starting background heal scanner failed.", nil)
+		}
+		if isDistributedSetup(srvCmdConfig.exportPaths) {
+			xlReadyCh = make(chan struct{})
+			go func() {
+				initXL()
+				close(xlReadyCh)
+			}()
+		} else {
+			initXL()
+		}
+	}
+
+	// Initialize storage rpc servers for all the local disks.
+	var storageRPCs []*storageServer
+	for _, exportPath := range getLocalExportPaths(srvCmdConfig.exportPaths) {
+		storageRPC, err := newRPCServer(exportPath)
+		fatalIf(err, "Initializing storage rpc server failed.", nil)
+		storageRPCs = append(storageRPCs, storageRPC)
+	}
 
 	// Initialize API.
 	apiHandlers := objectAPIHandlers{
@@ -53,11 +94,34 @@ func configureServerHandler(srvCmdConfig serverCmdConfig) http.Handler {
 		ObjectAPI: objAPI,
 	}
 
+	// Initialize Admin.
+	adminHandlers := adminAPIHandlers{
+		ObjectAPI: objAPI,
+		HealOps:   newHealOperations(),
+	}
+
+	// Initialize Metrics.
+	metricsHandlers := metricsHandlers{
+		ObjectAPI: objAPI,
+	}
+
+	// Initialize health checks.
+	healthCheckHandlers := healthCheckHandlers{
+		ObjectAPI: objAPI,
+	}
+
 	// Initialize router.
 	mux := router.NewRouter()
 
 	// Register all routers.
-	registerStorageRPCRouter(mux, storageRPC)
+	for _, storageRPC := range storageRPCs {
+		registerStorageRPCRouter(mux, storageRPC)
+	}
+	registerLockRPCRouter(mux, lkServer)
+	registerAdminRouter(mux, adminHandlers)
+	registerMetricsRouter(mux, metricsHandlers)
+	registerHealthCheckRouter(mux, healthCheckHandlers)
+	registerSTSRouter(mux, stsAPIHandlers{})
 	registerWebRouter(mux, webHandlers)
 	registerAPIRouter(mux, apiHandlers)
 	// Add new routers here.
@@ -83,8 +147,22 @@ func configureServerHandler(srvCmdConfig serverCmdConfig) http.Handler {
 		// routes them accordingly. Client receives a HTTP error for
 		// invalid/unsupported signatures.
 		setAuthHandler,
+		// Enforces policies attached to users and groups for all
+		// incoming signed requests.
+		setIAMPolicyHandler,
+		// Limits request rate and bandwidth per access key, bucket
+		// and source IP.
+		setRateLimitHandler,
+		// Records request counts, latencies and bytes transferred
+		// for all incoming requests.
+		setMetricsHandler,
 		// Add new handlers here.
 	}
+	// Requests other than rpc are refused until XL disks of all the
+	// servers are initialized.
+	if xlReadyCh != nil {
+		handlerFns = append(handlerFns, setXLReadyHandler(xlReadyCh))
+	}
 
 	// Register rest of the handlers.
 	return registerHandlers(mux, handlerFns...)
@@ -0,0 +1,265 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	fastSha256 "github.com/minio/minio/pkg/crypto/sha256"
+)
+
+// Tokens older or newer than this are rejected, also bounds clock skew
+// between the servers.
+const rpcAuthTokenValidity = 5 * time.Minute
+
+// RPCAuthToken - token carried by every rpc call and stream, signed
+// with the server credentials. Nonce makes every token unique so
+// that it can be used only once.
+type RPCAuthToken struct {
+	AccessKey string
+	Timestamp int64
+	Nonce     string
+	Signature string
+}
+
+// AuthRPCArgs - rpc arguments carrying a token, embedded by arguments
+// of all the rpc methods.
+type AuthRPCArgs struct {
+	Auth RPCAuthToken
+}
+
+// SetAuthToken - sets token of the rpc call.
+func (a *AuthRPCArgs) SetAuthToken(token RPCAuthToken) {
+	a.Auth = token
+}
+
+// verify - verifies token of the rpc call.
+func (a AuthRPCArgs) verify(method string) error {
+	return a.Auth.verify(method)
+}
+
+// rpcAuthSetter - rpc arguments which can carry a token.
+type rpcAuthSetter interface {
+	SetAuthToken(token RPCAuthToken)
+}
+
+// getRPCCredential - credential rpc tokens are signed with, all the
+// servers share the same credential.
+func getRPCCredential() credential {
+	if serverConfig == nil {
+		return credential{}
+	}
+	return serverConfig.GetCredential()
+}
+
+// getRPCAuthSignature - hex encoded HMAC-SHA256 of the token fields
+// and the rpc method or stream the token is valid for.
+func getRPCAuthSignature(secretKey, method string, token RPCAuthToken) string {
+	mac := hmac.New(fastSha256.New, []byte(secretKey))
+	io.WriteString(mac, token.AccessKey+"\n")
+	io.WriteString(mac, method+"\n")
+	io.WriteString(mac, strconv.FormatInt(token.Timestamp, 10)+"\n")
+	io.WriteString(mac, token.Nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newRPCAuthToken - generates a new token for the rpc method.
+func newRPCAuthToken(method string) RPCAuthToken {
+	cred := getRPCCredential()
+	token := RPCAuthToken{
+		AccessKey: cred.AccessKeyID,
+		Timestamp: time.Now().UTC().UnixNano(),
+		Nonce:     newLockUID(),
+	}
+	token.Signature = getRPCAuthSignature(cred.SecretAccessKey, method, token)
+	return token
+}
+
+// rpcNonceCache - remembers nonces of accepted tokens until they
+// expire, to reject replayed tokens. Nonces are kept in buckets by
+// token timestamp, a bucket is dropped whole once its tokens expire.
+// The cache is bounded by token validity only, nonces are added after
+// the token signature is verified so that only servers holding the
+// credentials fill it.
+type rpcNonceCache struct {
+	mutex   *sync.Mutex
+	buckets [rpcNonceBuckets]rpcNonceBucket
+	count   int
+}
+
+// rpcNonceBucket - nonces of tokens with timestamps in the same
+// period of rpcAuthTokenValidity.
+type rpcNonceBucket struct {
+	period int64
+	nonces map[string]struct{}
+}
+
+// Tokens are valid for rpcAuthTokenValidity either side of now,
+// nonces of three periods are needed at any time.
+const rpcNonceBuckets = 4
+
+// Nonces of all the accepted rpc tokens.
+var globalRPCNonces = newRPCNonceCache()
+
+// newRPCNonceCache - initialize nonce cache.
+func newRPCNonceCache() *rpcNonceCache {
+	return &rpcNonceCache{mutex: &sync.Mutex{}}
+}
+
+// add - remembers nonce of a token with timestamp, returns false if
+// it was seen before. Timestamp is verified
+// by the caller to be within rpcAuthTokenValidity of now.
+func (c *rpcNonceCache) add(nonce string, timestamp int64, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	period := timestamp / int64(rpcAuthTokenValidity)
+	if period < 0 {
+		return false
+	}
+	// Drop buckets of periods tokens have expired in.
+	expired := now.UnixNano()/int64(rpcAuthTokenValidity) - 1
+	for index := range c.buckets {
+		if bucket := &c.buckets[index]; bucket.nonces != nil && bucket.period < expired {
+			c.count -= len(bucket.nonces)
+			bucket.nonces = nil
+		}
+	}
+	bucket := &c.buckets[period%rpcNonceBuckets]
+	if bucket.nonces == nil || bucket.period != period {
+		c.count -= len(bucket.nonces)
+		bucket.period = period
+		bucket.nonces = make(map[string]struct{})
+	}
+	if _, ok := bucket.nonces[nonce]; ok {
+		return false
+	}
+	bucket.nonces[nonce] = struct{}{}
+	c.count++
+	return true
+}
+
+// verify - verifies the token is signed for the method, is recent
+// and is not replayed.
+func (token RPCAuthToken) verify(method string) error {
+	cred := getRPCCredential()
+	if cred.SecretAccessKey == "" || token.AccessKey != cred.AccessKeyID || token.Nonce == "" {
+		return errRPCAuthentication
+	}
+	signature := getRPCAuthSignature(cred.SecretAccessKey, method, token)
+	if !hmac.Equal([]byte(signature), []byte(token.Signature)) {
+		return errRPCAuthentication
+	}
+	now := time.Now().UTC()
+	skew := now.Sub(time.Unix(0, token.Timestamp))
+	if skew > rpcAuthTokenValidity || skew < -rpcAuthTokenValidity {
+		return errRPCAuthentication
+	}
+	if !globalRPCNonces.add(token.Nonce, token.Timestamp, now) {
+		return errRPCAuthentication
+	}
+	return nil
+}
+
+// checksumReader - computes sha256 of a stream body, verifying it
+// against the expected checksum at the end of the stream. Expected
+// checksum is only known once the body is read, as it is sent at the
+// end of the stream. Bodies of declared length are verified as soon as the
+// length is read, bodies closed before the end are read to the end
+// and verified on Close.
+type checksumReader struct {
+	reader   io.ReadCloser
+	hasher   hash.Hash
+	expected func() string
+	// Declared length of the body, -1 if unknown.
+	length   int64
+	read     int64
+	verified bool
+	err      error
+}
+
+// newChecksumReader - initialize checksum reader of a body of length,
+// -1 if unknown.
+func newChecksumReader(reader io.ReadCloser, length int64, expected func() string) *checksumReader {
+	return &checksumReader{
+		reader:   reader,
+		hasher:   fastSha256.New(),
+		expected: expected,
+		length:   length,
+	}
+}
+
+// Read - reads and hashes the body, returns errRPCChecksum instead of
+// io.EOF if the checksum does not match.
+func (c *checksumReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.reader.Read(p)
+	c.hasher.Write(p[:n])
+	c.read += int64(n)
+	// Checksum is read right after the declared length, there is
+	// nothing left to read but the end of the body.
+	if err == nil && c.length >= 0 && c.read >= c.length {
+		var extra [1]byte
+		var m int
+		if m, err = io.ReadFull(c.reader, extra[:]); m > 0 {
+			err = errRPCChecksum
+		}
+	}
+	if err == io.EOF {
+		c.verified = true
+		if (c.length >= 0 && c.read != c.length) || c.expected() != c.Sum() {
+			err = errRPCChecksum
+		}
+	}
+	if err != nil {
+		c.err = err
+	}
+	// Data failing verification is not returned.
+	if err == errRPCChecksum {
+		return 0, err
+	}
+	return n, err
+}
+
+// Close - verifies the body if it was not read to the end and closes
+// it. Returns errRPCChecksum if the checksum does not match.
+func (c *checksumReader) Close() error {
+	var err error
+	if !c.verified && c.err == nil {
+		_, err = io.Copy(ioutil.Discard, c)
+	}
+	if c.err == errRPCChecksum {
+		err = errRPCChecksum
+	}
+	if cErr := c.reader.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// Sum - hex encoded sha256 of the body read so far.
+func (c *checksumReader) Sum() string {
+	return hex.EncodeToString(c.hasher.Sum(nil))
+}
@@ -0,0 +1,281 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	router "github.com/gorilla/mux"
+	fastSha256 "github.com/minio/minio/pkg/crypto/sha256"
+)
+
+// initTestRPCConfig - initializes server config with new credentials
+// for rpc tests, returns function restoring the previous config.
+func initTestRPCConfig() func() {
+	savedConfig := serverConfig
+	serverConfig = &serverConfigV6{rwMutex: &sync.RWMutex{}}
+	serverConfig.SetCredential(mustGenAccessKeys())
+	return func() {
+		serverConfig = savedConfig
+	}
+}
+
+// Tests rpc tokens are verified for method, credentials, time and
+// replay.
+func TestRPCAuthToken(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	token := newRPCAuthToken("Storage.MakeVolHandler")
+	if err := token.verify("Storage.MakeVolHandler"); err != nil {
+		t.Fatal(err)
+	}
+	// Replayed token.
+	if err := token.verify("Storage.MakeVolHandler"); err != errRPCAuthentication {
+		t.Fatalf("Expected replayed token to be rejected, got %v", err)
+	}
+
+	// Token used for another method.
+	token = newRPCAuthToken("Storage.MakeVolHandler")
+	if err := token.verify("Storage.DeleteVolHandler"); err != errRPCAuthentication {
+		t.Fatalf("Expected token of another method to be rejected, got %v", err)
+	}
+
+	// Token signed with other credentials.
+	token = newRPCAuthToken("Storage.MakeVolHandler")
+	serverConfig.SetCredential(mustGenAccessKeys())
+	if err := token.verify("Storage.MakeVolHandler"); err != errRPCAuthentication {
+		t.Fatalf("Expected token of other credentials to be rejected, got %v", err)
+	}
+
+	// Expired and future tokens.
+	cred := serverConfig.GetCredential()
+	for _, skew := range []time.Duration{-2 * rpcAuthTokenValidity, 2 * rpcAuthTokenValidity} {
+		token = newRPCAuthToken("Storage.MakeVolHandler")
+		token.Timestamp = time.Now().UTC().Add(skew).UnixNano()
+		token.Signature = getRPCAuthSignature(cred.SecretAccessKey, "Storage.MakeVolHandler", token)
+		if err := token.verify("Storage.MakeVolHandler"); err != errRPCAuthentication {
+			t.Fatalf("Expected token with skew %s to be rejected, got %v", skew, err)
+		}
+	}
+
+	// Tokens are rejected without credentials.
+	token = newRPCAuthToken("Storage.MakeVolHandler")
+	serverConfig = nil
+	if err := token.verify("Storage.MakeVolHandler"); err != errRPCAuthentication {
+		t.Fatalf("Expected token to be rejected without credentials, got %v", err)
+	}
+}
+
+// Tests nonce cache rejects replayed nonces and drops expired nonces.
+func TestRPCNonceCache(t *testing.T) {
+	cache := newRPCNonceCache()
+	now := time.Now().UTC()
+	timestamp := now.UnixNano()
+	if !cache.add("nonce", timestamp, now) {
+		t.Fatal("Expected new nonce to be added")
+	}
+	if cache.add("nonce", timestamp, now) {
+		t.Fatal("Expected replayed nonce to be rejected")
+	}
+
+	// Nonces are dropped once their tokens expire.
+	later := now.Add(3 * rpcAuthTokenValidity)
+	if !cache.add("other", later.UnixNano(), later) {
+		t.Fatal("Expected new nonce to be added")
+	}
+	if cache.count != 1 {
+		t.Fatalf("Expected expired nonces to be dropped, %d nonces left", cache.count)
+	}
+}
+
+// Tests steady traffic is never rejected by the nonce cache, nonces
+// are kept only until their tokens expire.
+func TestRPCNonceCacheSteadyTraffic(t *testing.T) {
+	cache := newRPCNonceCache()
+	start := time.Now().UTC()
+	// More than a million tokens over eight validity periods.
+	const periods, tokensPerPeriod = 8, 150000
+	step := rpcAuthTokenValidity / tokensPerPeriod
+	maxCount := 0
+	for i := 0; i < periods*tokensPerPeriod; i++ {
+		now := start.Add(time.Duration(i) * step)
+		if !cache.add(strconv.Itoa(i), now.UnixNano(), now) {
+			t.Fatalf("Token %d: expected nonce to be added", i)
+		}
+		if cache.count > maxCount {
+			maxCount = cache.count
+		}
+	}
+	// Nonces of the current and the last two periods at most.
+	if maxCount > 3*tokensPerPeriod {
+		t.Fatalf("Expected expired nonces to be dropped, %d nonces kept", maxCount)
+	}
+}
+
+// Tests storage rpc calls and streams are authenticated and stream
+// bodies are checksummed.
+func TestStorageRPCAuth(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	disk, err := ioutil.TempDir("", "minio-rpc-auth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(disk)
+	stServer, err := newRPCServer(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := router.NewRouter()
+	registerStorageRPCRouter(mux, stServer)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	netAddr := strings.TrimPrefix(server.URL, "http://")
+
+	storage, err := newRPCClient(netAddr + ":" + disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("hello world"), 1024)
+	writer, err := storage.CreateFile("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := storage.ReadFile("bucket", "object", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Read data does not match written data")
+	}
+
+	// Calls and streams without token are rejected.
+	conn, err := dialRPCMuxConn(netAddr, getStorageRPCPath(disk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close(errRPCCanceled)
+	testCases := []struct {
+		method string
+		args   rpcMessage
+	}{
+		{"Storage.MakeVolHandler", &GenericVolArgs{Vol: "other"}},
+		{"Storage.ReadFileHandler", &ReadFileArgs{Vol: "bucket", Path: "object"}},
+		{"Storage.CreateFileHandler", &CreateFileArgs{Vol: "bucket", Path: "other"}},
+	}
+	for i, testCase := range testCases {
+		stream, err := conn.open(testCase.method, testCase.args, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = stream.waitReply(&GenericReply{}); toStorageErr(err) != errRPCAuthentication {
+			t.Fatalf("Test %d: expected call without token to be rejected, got %v", i+1, err)
+		}
+		stream.end()
+	}
+
+	// Uploads corrupted on the wire are not committed.
+	args := &CreateFileArgs{Vol: "bucket", Path: "corrupted"}
+	args.SetAuthToken(newRPCAuthToken("Storage.CreateFileHandler"))
+	stream, err := conn.open("Storage.CreateFileHandler", args, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.writeFrame(rpcFrameEOF, stream.id, []byte("bad")); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.waitReply(&GenericReply{}); toStorageErr(err) != errRPCChecksum {
+		t.Fatalf("Expected corrupted upload to be rejected, got %v", err)
+	}
+	if _, err = storage.StatFile("bucket", "corrupted"); err != errFileNotFound {
+		t.Fatalf("Expected corrupted upload to not be committed, got %v", err)
+	}
+}
+
+// Tests checksum reader detects corrupted stream bodies.
+func TestChecksumReader(t *testing.T) {
+	data := []byte("hello world")
+	hasher := fastSha256.New()
+	hasher.Write(data)
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	expected := func() string { return checksum }
+	corrupted := append([]byte("j"), data[1:]...)
+	for _, length := range []int64{-1, int64(len(data))} {
+		reader := newChecksumReader(ioutil.NopCloser(bytes.NewReader(data)), length, expected)
+		if _, err := ioutil.ReadAll(reader); err != nil {
+			t.Fatal(err)
+		}
+		reader = newChecksumReader(ioutil.NopCloser(bytes.NewReader(corrupted)), length, expected)
+		if _, err := io.Copy(ioutil.Discard, reader); err != errRPCChecksum {
+			t.Fatalf("Expected corrupted body to be detected, got %v", err)
+		}
+	}
+
+	// Bodies of declared length are verified once the length is read.
+	reader := newChecksumReader(ioutil.NopCloser(bytes.NewReader(corrupted)), int64(len(data)), expected)
+	if _, err := io.ReadFull(reader, make([]byte, len(data))); err != errRPCChecksum {
+		t.Fatalf("Expected corrupted body to be detected once read, got %v", err)
+	}
+	reader = newChecksumReader(ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)-1), expected)
+	if _, err := ioutil.ReadAll(reader); err != errRPCChecksum {
+		t.Fatalf("Expected body longer than declared to be detected, got %v", err)
+	}
+
+	// Bodies closed before the end are verified on close.
+	reader = newChecksumReader(ioutil.NopCloser(bytes.NewReader(data)), -1, expected)
+	if _, err := io.ReadFull(reader, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader = newChecksumReader(ioutil.NopCloser(bytes.NewReader(corrupted)), -1, expected)
+	if _, err := io.ReadFull(reader, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != errRPCChecksum {
+		t.Fatalf("Expected corrupted body to be detected on close, got %v", err)
+	}
+}
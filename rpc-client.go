@@ -17,32 +17,128 @@
 package main
 
 import (
+	"bufio"
 	"errors"
-	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/rpc"
-	"net/url"
-	urlpath "path"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
 type networkFS struct {
-	netScheme  string
-	netAddr    string
-	netPath    string
-	rpcClient  *rpc.Client
-	httpClient *http.Client
+	netAddr       string
+	netPath       string
+	rpcPath       string
+	rpcClient     *rpcMuxPool
+	streamTimeout time.Duration
 }
 
 const (
 	storageRPCPath = reservedBucket + "/storage"
+	// Timeout for connecting to rpc servers.
+	rpcDialTimeout = 5 * time.Second
+	// Timeout of a rpc call, the client stops waiting for the reply
+	// once past it. Storage operations already running on the server
+	// are not interrupted.
+	rpcCallTimeout = 1 * time.Minute
+	// Timeout of rpc streams, streams fail on both ends once no data
+	// moves over them for this long.
+	rpcStreamTimeout = 1 * time.Minute
+	// Persistent connections of every disk served over rpc, calls
+	// and file streams are multiplexed over them and spread across
+	// them so that a busy connection does not hold up the others.
+	rpcPoolSize = 4
 )
 
+// lazyRPCClient - rpc client which connects on first call and
+// reconnects once the connection is lost, so that servers which are
+// not up yet can still be initialized. Concurrent calls are
+// multiplexed over the connection.
+type lazyRPCClient struct {
+	mutex   *sync.Mutex
+	netAddr string
+	rpcPath string
+	timeout time.Duration
+	client  *rpc.Client
+}
+
+// newLazyRPCClient - initialize rpc client of a rpc server at path.
+func newLazyRPCClient(netAddr, rpcPath string) *lazyRPCClient {
+	return &lazyRPCClient{
+		mutex:   &sync.Mutex{},
+		netAddr: netAddr,
+		rpcPath: rpcPath,
+		timeout: rpcCallTimeout,
+	}
+}
+
+// dialRPCHTTPPath - connects to a rpc server at path, same as
+// rpc.DialHTTPPath but with a timeout.
+func dialRPCHTTPPath(netAddr, rpcPath string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", netAddr, rpcDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(conn, "CONNECT "+rpcPath+" HTTP/1.0\n\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.Status != "200 Connected to Go RPC" {
+		conn.Close()
+		return nil, errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// Call - calls the rpc method, connecting first if needed. Arguments
+// carrying a token are signed for the method.
+func (c *lazyRPCClient) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	if authArgs, ok := args.(rpcAuthSetter); ok {
+		authArgs.SetAuthToken(newRPCAuthToken(serviceMethod))
+	}
+	c.mutex.Lock()
+	client := c.client
+	if client == nil {
+		var err error
+		client, err = dialRPCHTTPPath(c.netAddr, c.rpcPath)
+		if err != nil {
+			c.mutex.Unlock()
+			return err
+		}
+		c.client = client
+	}
+	c.mutex.Unlock()
+
+	// Stop waiting for the reply once past the timeout, the reply is
+	// discarded when it arrives.
+	var err error
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case call := <-client.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1)).Done:
+		err = call.Error
+	case <-timer.C:
+		return errRPCTimeout
+	}
+	if err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Connection is lost, reconnect on next call.
+		c.mutex.Lock()
+		if c.client == client {
+			c.client = nil
+		}
+		c.mutex.Unlock()
+		client.Close()
+	}
+	return err
+}
+
 // splits network path into its components Address and Path.
 func splitNetPath(networkPath string) (netAddr, netPath string) {
 	index := strings.LastIndex(networkPath, ":")
@@ -55,6 +151,14 @@ func splitNetPath(networkPath string) (netAddr, netPath string) {
 // written so that the storageAPI errors are consistent across network
 // disks as well.
 func toStorageErr(err error) error {
+	// Server is unreachable or the connection is lost.
+	if _, ok := err.(net.Error); ok {
+		return errDiskNotFound
+	}
+	switch err {
+	case rpc.ErrShutdown, io.EOF, io.ErrUnexpectedEOF:
+		return errDiskNotFound
+	}
 	switch err.Error() {
 	case errDiskFull.Error():
 		return errDiskFull
@@ -72,6 +176,16 @@ func toStorageErr(err error) error {
 		return errFileAccessDenied
 	case errVolumeAccessDenied.Error():
 		return errVolumeAccessDenied
+	case errDiskNotFound.Error():
+		return errDiskNotFound
+	case errRPCAuthentication.Error():
+		return errRPCAuthentication
+	case errRPCChecksum.Error():
+		return errRPCChecksum
+	case errRPCTimeout.Error():
+		return errRPCTimeout
+	case errRPCCanceled.Error():
+		return errRPCCanceled
 	}
 	return err
 }
@@ -89,32 +203,19 @@ func newRPCClient(networkPath string) (StorageAPI, error) {
 	// TODO validate netAddr and netPath.
 	netAddr, netPath := splitNetPath(networkPath)
 
-	// Dial minio rpc storage http path.
-	rpcClient, err := rpc.DialHTTPPath("tcp", netAddr, storageRPCPath)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"netAddr":        netAddr,
-			"storageRPCPath": storageRPCPath,
-		}).Debugf("RPC HTTP dial failed with %s", err)
-		return nil, err
-	}
-
-	// Initialize http client.
-	httpClient := &http.Client{
-		// Setting a sensible time out of 6minutes to wait for
-		// response headers. Request is pro-actively cancelled
-		// after 6minutes if no response was received from server.
-		Timeout:   6 * time.Minute,
-		Transport: http.DefaultTransport,
-	}
+	// Every disk is served on its own rpc path, rpc server is
+	// connected to on first use.
+	rpcPath := getStorageRPCPath(netPath)
+	rpcClient := newRPCMuxPool(netAddr, rpcPath, rpcPoolSize)
 
-	// Initialize network storage.
+	// Initialize network storage, streams are timed out once no data
+	// moves over them rather than on their total duration.
 	ndisk := &networkFS{
-		netScheme:  "http", // TODO: fix for ssl rpc support.
-		netAddr:    netAddr,
-		netPath:    netPath,
-		rpcClient:  rpcClient,
-		httpClient: httpClient,
+		netAddr:       netAddr,
+		netPath:       netPath,
+		rpcPath:       rpcPath,
+		rpcClient:     rpcClient,
+		streamTimeout: rpcStreamTimeout,
 	}
 
 	// Returns successfully here.
@@ -124,7 +225,7 @@ func newRPCClient(networkPath string) (StorageAPI, error) {
 // MakeVol - make a volume.
 func (n networkFS) MakeVol(volume string) error {
 	reply := GenericReply{}
-	if err := n.rpcClient.Call("Storage.MakeVolHandler", volume, &reply); err != nil {
+	if err := n.rpcClient.Call("Storage.MakeVolHandler", &GenericVolArgs{Vol: volume}, &reply); err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
 		}).Debugf("Storage.MakeVolHandler returned an error %s", err)
@@ -136,17 +237,17 @@ func (n networkFS) MakeVol(volume string) error {
 // ListVols - List all volumes.
 func (n networkFS) ListVols() (vols []VolInfo, err error) {
 	ListVols := ListVolsReply{}
-	err = n.rpcClient.Call("Storage.ListVolsHandler", "", &ListVols)
+	err = n.rpcClient.Call("Storage.ListVolsHandler", &GenericArgs{}, &ListVols)
 	if err != nil {
 		log.Debugf("Storage.ListVolsHandler returned an error %s", err)
-		return nil, err
+		return nil, toStorageErr(err)
 	}
 	return ListVols.Vols, nil
 }
 
 // StatVol - get current Stat volume info.
 func (n networkFS) StatVol(volume string) (volInfo VolInfo, err error) {
-	if err = n.rpcClient.Call("Storage.StatVolHandler", volume, &volInfo); err != nil {
+	if err = n.rpcClient.Call("Storage.StatVolHandler", &GenericVolArgs{Vol: volume}, &volInfo); err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
 		}).Debugf("Storage.StatVolHandler returned an error %s", err)
@@ -158,7 +259,7 @@ func (n networkFS) StatVol(volume string) (volInfo VolInfo, err error) {
 // DeleteVol - Delete a volume.
 func (n networkFS) DeleteVol(volume string) error {
 	reply := GenericReply{}
-	if err := n.rpcClient.Call("Storage.DeleteVolHandler", volume, &reply); err != nil {
+	if err := n.rpcClient.Call("Storage.DeleteVolHandler", &GenericVolArgs{Vol: volume}, &reply); err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
 		}).Debugf("Storage.DeleteVolHandler returned an error %s", err)
@@ -171,42 +272,65 @@ func (n networkFS) DeleteVol(volume string) error {
 
 // CreateFile - create file.
 func (n networkFS) CreateFile(volume, path string) (writeCloser io.WriteCloser, err error) {
-	writeURL := new(url.URL)
-	writeURL.Scheme = n.netScheme
-	writeURL.Host = n.netAddr
-	writeURL.Path = fmt.Sprintf("%s/upload/%s", storageRPCPath, urlpath.Join(volume, path))
-
-	contentType := "application/octet-stream"
-	readCloser, writeCloser := io.Pipe()
-	go func() {
-		resp, err := n.httpClient.Post(writeURL.String(), contentType, readCloser)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Debugf("CreateFile HTTP POST failed to upload data with error %s", err)
-			readCloser.CloseWithError(err)
-			return
-		}
-		if resp != nil {
-			if resp.StatusCode != http.StatusOK {
-				if resp.StatusCode == http.StatusNotFound {
-					readCloser.CloseWithError(errFileNotFound)
-					return
-				}
-				readCloser.CloseWithError(errors.New("Invalid response."))
-				return
-			}
-			// Close the reader.
-			readCloser.Close()
-		}
-	}()
-	return writeCloser, nil
+	stream, err := n.rpcClient.open("Storage.CreateFileHandler", &CreateFileArgs{
+		Vol:  volume,
+		Path: path,
+	}, n.streamTimeout)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Debugf("Storage.CreateFileHandler failed with %s", err)
+		return nil, toStorageErr(err)
+	}
+	return &networkFileWriter{stream}, nil
+}
+
+// networkFileWriter - writer of a file created over the network,
+// closing it waits until the file is committed by the server.
+type networkFileWriter struct {
+	stream *rpcStream
+}
+
+// Write - sends data of the file, fails with the error of the server
+// once it gave up on the file.
+func (w *networkFileWriter) Write(p []byte) (int, error) {
+	n, err := w.stream.Write(p)
+	if err == errRPCCanceled {
+		// Server replied ahead of the data with an error.
+		err = w.stream.waitReply(&GenericReply{})
+	}
+	if err != nil {
+		w.stream.cancel(errRPCCanceled)
+		return n, toStorageErr(err)
+	}
+	return n, nil
+}
+
+// CloseWithError - abandons the file, the server discards it.
+func (w *networkFileWriter) CloseWithError(err error) error {
+	w.stream.cancel(errRPCCanceled)
+	return nil
+}
+
+// Close - ends the data of the file and waits for the server to
+// commit it.
+func (w *networkFileWriter) Close() error {
+	defer w.stream.end()
+	// Server may have replied ahead of the data with an error.
+	err := w.stream.closeWrite()
+	if rErr := w.stream.waitReply(&GenericReply{}); rErr != nil || err == nil {
+		err = rErr
+	}
+	if err != nil {
+		return toStorageErr(err)
+	}
+	return nil
 }
 
 // StatFile - get latest Stat information for a file at path.
 func (n networkFS) StatFile(volume, path string) (fileInfo FileInfo, err error) {
-	if err = n.rpcClient.Call("Storage.StatFileHandler", StatFileArgs{
+	if err = n.rpcClient.Call("Storage.StatFileHandler", &StatFileArgs{
 		Vol:  volume,
 		Path: path,
 	}, &fileInfo); err != nil {
@@ -221,36 +345,32 @@ func (n networkFS) StatFile(volume, path string) (fileInfo FileInfo, err error)
 
 // ReadFile - reads a file.
 func (n networkFS) ReadFile(volume string, path string, offset int64) (reader io.ReadCloser, err error) {
-	readURL := new(url.URL)
-	readURL.Scheme = n.netScheme
-	readURL.Host = n.netAddr
-	readURL.Path = fmt.Sprintf("%s/download/%s", storageRPCPath, urlpath.Join(volume, path))
-	readQuery := make(url.Values)
-	readQuery.Set("offset", strconv.FormatInt(offset, 10))
-	readURL.RawQuery = readQuery.Encode()
-	resp, err := n.httpClient.Get(readURL.String())
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"volume": volume,
-			"path":   path,
-		}).Debugf("ReadFile http Get failed with error %s", err)
-		return nil, err
-	}
-	if resp != nil {
-		if resp.StatusCode != http.StatusOK {
-			if resp.StatusCode == http.StatusNotFound {
-				return nil, errFileNotFound
-			}
-			return nil, errors.New("Invalid response")
+	stream, err := n.rpcClient.open("Storage.ReadFileHandler", &ReadFileArgs{
+		Vol:    volume,
+		Path:   path,
+		Offset: offset,
+	}, n.streamTimeout)
+	if err == nil {
+		reply := &ReadFileReply{}
+		if err = stream.waitReply(reply); err != nil {
+			stream.end()
+		} else {
+			// Data is verified against its checksum once its
+			// declared length is read, or on close.
+			return newChecksumReader(stream, reply.Length, stream.getChecksum), nil
 		}
 	}
-	return resp.Body, nil
+	log.WithFields(logrus.Fields{
+		"volume": volume,
+		"path":   path,
+	}).Debugf("Storage.ReadFileHandler failed with %s", err)
+	return nil, toStorageErr(err)
 }
 
 // ListFiles - List all files in a volume.
 func (n networkFS) ListFiles(volume, prefix, marker string, recursive bool, count int) (files []FileInfo, eof bool, err error) {
 	listFilesReply := ListFilesReply{}
-	if err = n.rpcClient.Call("Storage.ListFilesHandler", ListFilesArgs{
+	if err = n.rpcClient.Call("Storage.ListFilesHandler", &ListFilesArgs{
 		Vol:       volume,
 		Prefix:    prefix,
 		Marker:    marker,
@@ -273,7 +393,7 @@ func (n networkFS) ListFiles(volume, prefix, marker string, recursive bool, coun
 // DeleteFile - Delete a file at path.
 func (n networkFS) DeleteFile(volume, path string) (err error) {
 	reply := GenericReply{}
-	if err = n.rpcClient.Call("Storage.DeleteFileHandler", DeleteFileArgs{
+	if err = n.rpcClient.Call("Storage.DeleteFileHandler", &DeleteFileArgs{
 		Vol:  volume,
 		Path: path,
 	}, &reply); err != nil {
@@ -289,7 +409,7 @@ func (n networkFS) DeleteFile(volume, path string) (err error) {
 // RenameFile - Rename file.
 func (n networkFS) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) (err error) {
 	reply := GenericReply{}
-	if err = n.rpcClient.Call("Storage.RenameFileHandler", RenameFileArgs{
+	if err = n.rpcClient.Call("Storage.RenameFileHandler", &RenameFileArgs{
 		SrcVol:  srcVolume,
 		SrcPath: srcPath,
 		DstVol:  dstVolume,
@@ -0,0 +1,351 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	router "github.com/gorilla/mux"
+	fastSha256 "github.com/minio/minio/pkg/crypto/sha256"
+)
+
+// slowRPCService - rpc service whose calls block until released.
+type slowRPCService struct {
+	releaseCh chan struct{}
+}
+
+// WaitHandler - blocks until released.
+func (s *slowRPCService) WaitHandler(args *GenericArgs, reply *GenericReply) error {
+	<-s.releaseCh
+	return nil
+}
+
+// Tests the client stops waiting for rpc calls past their timeout.
+func TestRPCCallTimeout(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	service := &slowRPCService{releaseCh: make(chan struct{})}
+	defer close(service.releaseCh)
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Slow", service)
+	mux := router.NewRouter()
+	mux.Path("/slow").Handler(rpcServer)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newLazyRPCClient(strings.TrimPrefix(server.URL, "http://"), "/slow")
+	client.timeout = 50 * time.Millisecond
+	if err := client.Call("Slow.WaitHandler", &GenericArgs{}, &GenericReply{}); err != errRPCTimeout {
+		t.Fatalf("Expected call to time out, got %v", err)
+	}
+}
+
+// Tests streams fail on the client once no data moves over them
+// within the timeout, and streams which keep moving data do not.
+func TestRPCStreamClientTimeout(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	storage, cleanup := newTestRPCDisk(t)
+	defer cleanup()
+	storage.streamTimeout = 100 * time.Millisecond
+	if err := storage.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := storage.CreateFile("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err = writer.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(storage.streamTimeout / 2)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err = storage.CreateFile("bucket", "stalled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(4 * storage.streamTimeout)
+	if _, err = writer.Write([]byte("hello")); err == nil {
+		t.Fatal("Expected stalled stream to fail")
+	}
+	if _, err = storage.StatFile("bucket", "stalled"); err != errFileNotFound {
+		t.Fatalf("Expected %s, got %v", errFileNotFound, err)
+	}
+}
+
+// Tests streams fail on the server once no data moves over them within
+// the timeout sent by the client.
+func TestRPCStreamServerTimeout(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	storage, cleanup := newTestRPCDisk(t)
+	defer cleanup()
+	if err := storage.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialRPCMuxConn(storage.netAddr, storage.rpcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close(errRPCCanceled)
+	args := &CreateFileArgs{Vol: "bucket", Path: "object"}
+	args.SetAuthToken(newRPCAuthToken("Storage.CreateFileHandler"))
+	stream, err := conn.open("Storage.CreateFileHandler", args, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Client stalls without timing the stream out on its end.
+	stream.timer.stop()
+	if _, err = stream.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stream.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected stalled stream to be canceled by the server")
+	}
+	if _, err = storage.StatFile("bucket", "object"); err != errFileNotFound {
+		t.Fatalf("Expected %s, got %v", errFileNotFound, err)
+	}
+}
+
+// Tests calls and streams are spread over the connections of the pool.
+func TestRPCMuxPool(t *testing.T) {
+	defer initTestRPCConfig()()
+
+	storage, cleanup := newTestRPCDisk(t)
+	defer cleanup()
+	for i := 0; i < 2*rpcPoolSize; i++ {
+		if _, err := storage.ListVols(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for index, client := range storage.rpcClient.clients {
+		if client.conn == nil {
+			t.Errorf("Expected connection %d of the pool to be used", index)
+		}
+	}
+
+	// Lost connections are reconnected.
+	conn := storage.rpcClient.clients[0].conn
+	conn.close(errRPCCanceled)
+	for i := 0; i < rpcPoolSize; i++ {
+		if _, err := storage.ListVols(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if storage.rpcClient.clients[0].conn == conn {
+		t.Fatal("Expected lost connection to be reconnected")
+	}
+}
+
+// newTestRPCDisk - serves a new disk over storage rpc, returns its
+// client and a function removing it.
+func newTestRPCDisk(t testing.TB) (*networkFS, func()) {
+	disk, err := ioutil.TempDir("", "minio-rpc-client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stServer, err := newRPCServer(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := router.NewRouter()
+	registerStorageRPCRouter(mux, stServer)
+	server := httptest.NewServer(mux)
+	storage, err := newRPCClient(strings.TrimPrefix(server.URL, "http://") + ":" + disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage.(*networkFS), func() {
+		server.Close()
+		os.RemoveAll(disk)
+	}
+}
+
+// baselineStorageRPC - storage rpc transport the multiplexed transport
+// replaced, calls in gob over a net/rpc connection and file streams
+// over a http request each. Kept for benchmarks only, only the
+// operations benchmarked are implemented.
+type baselineStorageRPC struct {
+	StorageAPI
+	rpcClient  *lazyRPCClient
+	httpClient *http.Client
+	streamURL  string
+}
+
+// Trailer carrying sha256 of baseline file streams.
+const baselineChecksumTrailer = "X-Minio-Rpc-Sha256"
+
+// newBaselineStorageRPC - serves stServer over the baseline transport.
+func newBaselineStorageRPC(stServer *storageServer) (*baselineStorageRPC, func()) {
+	rpcServer := rpc.NewServer()
+	rpcServer.RegisterName("Storage", stServer)
+	mux := router.NewRouter()
+	mux.Path("/rpc").Handler(rpcServer)
+	mux.Path("/download/{volume}/{path:.+}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := router.Vars(r)
+		reader, err := stServer.storage.ReadFile(vars["volume"], vars["path"], 0)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// Bodies carry their sha256 in a trailer.
+		w.Header().Set("Trailer", baselineChecksumTrailer)
+		hasher := fastSha256.New()
+		io.Copy(w, io.TeeReader(reader, hasher))
+		reader.Close()
+		w.Header().Set(baselineChecksumTrailer, hex.EncodeToString(hasher.Sum(nil)))
+	})
+	server := httptest.NewServer(mux)
+	return &baselineStorageRPC{
+		rpcClient:  newLazyRPCClient(strings.TrimPrefix(server.URL, "http://"), "/rpc"),
+		httpClient: &http.Client{Transport: http.DefaultTransport},
+		streamURL:  server.URL + "/download/",
+	}, server.Close
+}
+
+// StatFile - stats a file over the baseline transport.
+func (b *baselineStorageRPC) StatFile(volume, path string) (fileInfo FileInfo, err error) {
+	err = b.rpcClient.Call("Storage.StatFileHandler", &StatFileArgs{Vol: volume, Path: path}, &fileInfo)
+	return fileInfo, err
+}
+
+// ReadFile - reads a file over the baseline transport.
+func (b *baselineStorageRPC) ReadFile(volume, path string, offset int64) (io.ReadCloser, error) {
+	resp, err := b.httpClient.Get(b.streamURL + volume + "/" + path)
+	if err != nil {
+		return nil, err
+	}
+	return newChecksumReader(resp.Body, resp.ContentLength, func() string {
+		return resp.Trailer.Get(baselineChecksumTrailer)
+	}), nil
+}
+
+// newBenchmarkRPCDisks - serves a disk with a file of size over the
+// baseline and the multiplexed transports, returns both clients.
+func newBenchmarkRPCDisks(b *testing.B, size int) (baseline, mux StorageAPI, cleanup func()) {
+	disk, err := ioutil.TempDir("", "minio-rpc-client-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	stServer, err := newRPCServer(disk)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = stServer.storage.MakeVol("bucket"); err != nil {
+		b.Fatal(err)
+	}
+	writer, err := stServer.storage.CreateFile("bucket", "object")
+	if err != nil {
+		b.Fatal(err)
+	}
+	writer.Write(bytes.Repeat([]byte("a"), size))
+	if err = writer.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	muxRouter := router.NewRouter()
+	registerStorageRPCRouter(muxRouter, stServer)
+	server := httptest.NewServer(muxRouter)
+	mux, err = newRPCClient(strings.TrimPrefix(server.URL, "http://") + ":" + disk)
+	if err != nil {
+		b.Fatal(err)
+	}
+	baselineStorage, closeBaseline := newBaselineStorageRPC(stServer)
+	return baselineStorage, mux, func() {
+		closeBaseline()
+		server.Close()
+		os.RemoveAll(disk)
+	}
+}
+
+// Benchmarks concurrent metadata calls over the baseline transport and
+// over the multiplexed transport.
+func BenchmarkStorageRPCStatFile(b *testing.B) {
+	defer initTestRPCConfig()()
+
+	baseline, mux, cleanup := newBenchmarkRPCDisks(b, 11)
+	defer cleanup()
+	for _, testCase := range []struct {
+		name    string
+		storage StorageAPI
+	}{
+		{"baseline", baseline},
+		{"mux", mux},
+	} {
+		b.Run(testCase.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := testCase.storage.StatFile("bucket", "object"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// Benchmarks concurrent file reads over the baseline transport and
+// over the multiplexed transport.
+func BenchmarkStorageRPCReadFile(b *testing.B) {
+	defer initTestRPCConfig()()
+
+	const size = 1 << 20
+	baseline, mux, cleanup := newBenchmarkRPCDisks(b, size)
+	defer cleanup()
+	for _, testCase := range []struct {
+		name    string
+		storage StorageAPI
+	}{
+		{"baseline", baseline},
+		{"mux", mux},
+	} {
+		b.Run(testCase.name, func(b *testing.B) {
+			b.SetBytes(size)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					reader, err := testCase.storage.ReadFile("bucket", "object", 0)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err = io.Copy(ioutil.Discard, reader); err != nil {
+						b.Fatal(err)
+					}
+					reader.Close()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,717 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fastSha256 "github.com/minio/minio/pkg/crypto/sha256"
+)
+
+// Storage rpc calls and file streams of a disk are multiplexed over
+// persistent connections. A connection is opened by a CONNECT request
+// to the rpc path of the disk and then carries frames both ways:
+//
+//	type (1 byte) | stream id (4 bytes) | payload length (4 bytes) | payload
+//
+// Every call or file stream is a stream opened by a request frame of
+// the client and ended by a reply frame of the server. File data
+// moves in data frames ended by an EOF frame carrying the sha256 of
+// the data. Receivers grant a window of data per stream, so that a
+// stream not being read does not hold up the others.
+const (
+	// Opens a stream, carries method, timeout and arguments.
+	rpcFrameRequest byte = iota + 1
+	// Result of the call, carries error and reply.
+	rpcFrameReply
+	// File data of the stream.
+	rpcFrameData
+	// End of file data, carries its hex encoded sha256.
+	rpcFrameEOF
+	// Receiver read data, sender may send as much more.
+	rpcFrameWindow
+	// Stream is abandoned, by timeout or close.
+	rpcFrameCancel
+)
+
+const (
+	rpcFrameHeaderSize = 9
+	// Largest payload of a frame, large listings are a few MiB.
+	rpcMaxFrameSize = 16 << 20
+	// Largest payload of a data frame.
+	rpcDataFrameSize = 32 << 10
+	// Data sent on a stream ahead of the receiver reading it.
+	rpcStreamWindow = 256 << 10
+	// Status line of a server accepting a connection.
+	rpcConnectedStatus = "200 Connected to Minio Storage RPC"
+)
+
+// rpcMuxConn - connection carrying storage rpc streams, used by both
+// clients and servers.
+type rpcMuxConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// Frames are written whole, one at a time.
+	writeMutex *sync.Mutex
+	writer     *bufio.Writer
+
+	mutex   *sync.Mutex
+	streams map[uint32]*rpcStream
+	nextID  uint32
+	// Set once the connection is lost.
+	err error
+
+	// Serves streams opened by the other end, nil on clients.
+	serve func(stream *rpcStream, request []byte)
+}
+
+// newRPCMuxConn - initialize connection carrying rpc streams, serve is
+// called for every stream opened by the other end.
+func newRPCMuxConn(conn net.Conn, reader *bufio.Reader, serve func(stream *rpcStream, request []byte)) *rpcMuxConn {
+	c := &rpcMuxConn{
+		conn:       conn,
+		reader:     reader,
+		writeMutex: &sync.Mutex{},
+		writer:     bufio.NewWriterSize(conn, rpcDataFrameSize+rpcFrameHeaderSize),
+		mutex:      &sync.Mutex{},
+		streams:    make(map[uint32]*rpcStream),
+		serve:      serve,
+	}
+	go c.readFrames()
+	return c
+}
+
+// dialRPCMuxConn - connects to the rpc server at path.
+func dialRPCMuxConn(netAddr, rpcPath string) (*rpcMuxConn, error) {
+	conn, err := (&net.Dialer{
+		Timeout:   rpcDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).Dial("tcp", netAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(rpcDialTimeout))
+	io.WriteString(conn, "CONNECT "+rpcPath+" HTTP/1.0\n\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: "CONNECT"})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.Status != rpcConnectedStatus {
+		conn.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errDiskNotFound
+		}
+		return nil, errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return newRPCMuxConn(conn, reader, nil), nil
+}
+
+// acceptRPCMuxConn - takes over the connection of a CONNECT request,
+// streams opened on it are served by serve.
+func acceptRPCMuxConn(w http.ResponseWriter, r *http.Request, serve func(stream *rpcStream, request []byte)) {
+	if r.Method != "CONNECT" {
+		http.Error(w, "405 must CONNECT", http.StatusMethodNotAllowed)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can not be hijacked", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		log.Debugf("Hijacking rpc connection failed with %s", err)
+		return
+	}
+	// Deadlines of the http server do not apply to rpc connections.
+	conn.SetDeadline(time.Time{})
+	io.WriteString(conn, "HTTP/1.0 "+rpcConnectedStatus+"\n\n")
+	newRPCMuxConn(conn, buf.Reader, serve)
+}
+
+// failed - returns why the connection was lost, nil if it was not.
+func (c *rpcMuxConn) failed() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// close - closes the connection, all of its streams fail.
+func (c *rpcMuxConn) close(err error) {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return
+	}
+	c.err = err
+	streams := c.streams
+	c.streams = make(map[uint32]*rpcStream)
+	c.mutex.Unlock()
+	log.Debugf("RPC connection to %s closed with %s", c.conn.RemoteAddr(), err)
+	c.conn.Close()
+	for _, stream := range streams {
+		// Streams only see the connection is lost.
+		stream.fail(io.ErrUnexpectedEOF)
+	}
+}
+
+// writeFrame - writes a frame, closes the connection if the frame can
+// not be written within rpcStreamTimeout.
+func (c *rpcMuxConn) writeFrame(frameType byte, id uint32, payload []byte) error {
+	var header [rpcFrameHeaderSize]byte
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:5], id)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if err := c.failed(); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(rpcStreamTimeout))
+	_, err := c.writer.Write(header[:])
+	if err == nil {
+		_, err = c.writer.Write(payload)
+	}
+	if err == nil {
+		err = c.writer.Flush()
+	}
+	if err != nil {
+		c.close(err)
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// readFrames - reads frames until the connection is lost, passing
+// them on to their streams.
+func (c *rpcMuxConn) readFrames() {
+	var header [rpcFrameHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			c.close(err)
+			return
+		}
+		frameType := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		length := binary.BigEndian.Uint32(header[5:9])
+		if length > rpcMaxFrameSize {
+			c.close(errRPCProtocol)
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			c.close(err)
+			return
+		}
+		if err := c.handleFrame(frameType, id, payload); err != nil {
+			c.close(err)
+			return
+		}
+	}
+}
+
+// handleFrame - passes a frame on to its stream. Frames of streams
+// already ended on this end are dropped.
+func (c *rpcMuxConn) handleFrame(frameType byte, id uint32, payload []byte) error {
+	if frameType == rpcFrameRequest {
+		if c.serve == nil {
+			return errRPCProtocol
+		}
+		stream, err := c.addStream(id)
+		if err != nil {
+			return err
+		}
+		go c.serve(stream, payload)
+		return nil
+	}
+	c.mutex.Lock()
+	stream := c.streams[id]
+	c.mutex.Unlock()
+	if stream == nil {
+		return nil
+	}
+	switch frameType {
+	case rpcFrameReply:
+		stream.receiveReply(payload)
+	case rpcFrameData:
+		return stream.receiveData(payload)
+	case rpcFrameEOF:
+		stream.receiveEOF(string(payload))
+	case rpcFrameWindow:
+		if len(payload) != 4 {
+			return errRPCProtocol
+		}
+		stream.grantWindow(int(binary.BigEndian.Uint32(payload)))
+	case rpcFrameCancel:
+		c.removeStream(id)
+		stream.fail(errRPCCanceled)
+	default:
+		return errRPCProtocol
+	}
+	return nil
+}
+
+// addStream - adds a stream opened by the other end.
+func (c *rpcMuxConn) addStream(id uint32) (*rpcStream, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, ok := c.streams[id]; ok {
+		return nil, errRPCProtocol
+	}
+	stream := newRPCStream(c, id)
+	c.streams[id] = stream
+	return stream, nil
+}
+
+// removeStream - forgets an ended stream.
+func (c *rpcMuxConn) removeStream(id uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.streams, id)
+}
+
+// open - opens a stream calling method with args, the stream is
+// canceled on both ends once no data moves over it within timeout.
+func (c *rpcMuxConn) open(method string, args rpcMessage, timeout time.Duration) (*rpcStream, error) {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return nil, io.ErrUnexpectedEOF
+	}
+	c.nextID++
+	stream := newRPCStream(c, c.nextID)
+	c.streams[stream.id] = stream
+	c.mutex.Unlock()
+
+	e := &rpcEncoder{}
+	e.putString(method)
+	e.putVarint(int64(timeout))
+	args.encodeRPC(e)
+	stream.setTimeout(timeout)
+	if err := c.writeFrame(rpcFrameRequest, stream.id, e.buf); err != nil {
+		stream.end()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// rpcStream - a call or file stream over a rpc connection. Data is
+// read and written by one goroutine at a time.
+type rpcStream struct {
+	conn *rpcMuxConn
+	id   uint32
+
+	mutex *sync.Mutex
+	cond  *sync.Cond
+	// Data received and not read yet, data the other end may still
+	// send and data read since the window was last granted.
+	received   [][]byte
+	recvWindow int
+	consumed   int
+	// End of received data along with its checksum.
+	eof      bool
+	checksum string
+	// Data which may still be sent.
+	sendWindow int
+	hasher     hash.Hash
+	// Reply of the call, once received.
+	replyCh chan []byte
+	replied bool
+	// Set once the stream failed, doneCh is closed along with it.
+	err    error
+	doneCh chan struct{}
+
+	// Cancels the stream once no data moves over it.
+	timer *rpcStreamTimer
+}
+
+// newRPCStream - initialize stream of the connection.
+func newRPCStream(c *rpcMuxConn, id uint32) *rpcStream {
+	s := &rpcStream{
+		conn:       c,
+		id:         id,
+		mutex:      &sync.Mutex{},
+		recvWindow: rpcStreamWindow,
+		sendWindow: rpcStreamWindow,
+		hasher:     fastSha256.New(),
+		replyCh:    make(chan []byte, 1),
+		doneCh:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(s.mutex)
+	return s
+}
+
+// setTimeout - cancels the stream with errRPCTimeout once no data
+// moves over it within timeout, zero disables the timeout.
+func (s *rpcStream) setTimeout(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if timeout <= 0 || s.err != nil {
+		return
+	}
+	s.timer = newRPCStreamTimer(timeout, func() {
+		s.cancel(errRPCTimeout)
+	})
+}
+
+// progress - restarts the timer of the stream as data moved.
+func (s *rpcStream) progress() {
+	if s.timer != nil {
+		s.timer.progress()
+	}
+}
+
+// fail - fails the stream on this end, waking up its readers and
+// writers.
+func (s *rpcStream) fail(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	close(s.doneCh)
+	s.cond.Broadcast()
+	if s.timer != nil {
+		s.timer.stop()
+	}
+}
+
+// cancel - fails the stream on both ends.
+func (s *rpcStream) cancel(err error) {
+	s.conn.removeStream(s.id)
+	s.fail(err)
+	s.conn.writeFrame(rpcFrameCancel, s.id, nil)
+}
+
+// end - ends a stream which completed on both ends.
+func (s *rpcStream) end() {
+	s.conn.removeStream(s.id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.timer != nil {
+		s.timer.stop()
+	}
+}
+
+// receiveReply - reply of the call was received.
+func (s *rpcStream) receiveReply(payload []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.replied {
+		return
+	}
+	s.replied = true
+	s.replyCh <- payload
+	// Writers stop sending once the call completed.
+	s.cond.Broadcast()
+}
+
+// receiveData - data was received, the other end may not send more
+// than the window granted.
+func (s *rpcStream) receiveData(payload []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(payload) > s.recvWindow || s.eof {
+		return errRPCProtocol
+	}
+	s.recvWindow -= len(payload)
+	s.received = append(s.received, payload)
+	s.cond.Broadcast()
+	return nil
+}
+
+// receiveEOF - end of data was received.
+func (s *rpcStream) receiveEOF(checksum string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.eof = true
+	s.checksum = checksum
+	s.cond.Broadcast()
+}
+
+// grantWindow - other end read data, as much more may be sent.
+func (s *rpcStream) grantWindow(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sendWindow += n
+	s.cond.Broadcast()
+}
+
+// Read - reads data of the stream, returns io.EOF once the other end
+// sent all of its data.
+func (s *rpcStream) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	for len(s.received) == 0 && !s.eof && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.err != nil {
+		err := s.err
+		s.mutex.Unlock()
+		return 0, err
+	}
+	if len(s.received) == 0 {
+		s.mutex.Unlock()
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && len(s.received) > 0 {
+		m := copy(p[n:], s.received[0])
+		n += m
+		if m == len(s.received[0]) {
+			s.received = s.received[1:]
+		} else {
+			s.received[0] = s.received[0][m:]
+		}
+	}
+	s.consumed += n
+	grant := 0
+	if s.consumed >= rpcStreamWindow/2 {
+		grant = s.consumed
+		s.consumed = 0
+		s.recvWindow += grant
+	}
+	s.mutex.Unlock()
+
+	s.progress()
+	if grant > 0 {
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], uint32(grant))
+		if err := s.conn.writeFrame(rpcFrameWindow, s.id, payload[:]); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// getChecksum - returns checksum sent along with the end of data.
+func (s *rpcStream) getChecksum() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.checksum
+}
+
+// Write - sends data within the window granted by the other end.
+// Fails once the other end replied, a call does not take data after
+// it completed.
+func (s *rpcStream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		s.mutex.Lock()
+		for s.sendWindow == 0 && s.err == nil && !s.replied {
+			s.cond.Wait()
+		}
+		if s.err != nil || s.replied {
+			err := s.err
+			s.mutex.Unlock()
+			if err == nil {
+				err = errRPCCanceled
+			}
+			return written, err
+		}
+		n := len(p) - written
+		if n > s.sendWindow {
+			n = s.sendWindow
+		}
+		if n > rpcDataFrameSize {
+			n = rpcDataFrameSize
+		}
+		s.sendWindow -= n
+		s.mutex.Unlock()
+
+		chunk := p[written : written+n]
+		s.hasher.Write(chunk)
+		if err := s.conn.writeFrame(rpcFrameData, s.id, chunk); err != nil {
+			return written, err
+		}
+		written += n
+		s.progress()
+	}
+	return written, nil
+}
+
+// closeWrite - ends data of the stream, sending its checksum.
+func (s *rpcStream) closeWrite() error {
+	return s.conn.writeFrame(rpcFrameEOF, s.id, []byte(hex.EncodeToString(s.hasher.Sum(nil))))
+}
+
+// Close - ends a stream read to its end, cancels it otherwise.
+func (s *rpcStream) Close() error {
+	s.mutex.Lock()
+	done := s.eof && len(s.received) == 0
+	s.mutex.Unlock()
+	if done {
+		s.end()
+	} else {
+		s.cancel(errRPCCanceled)
+	}
+	return nil
+}
+
+// sendReply - sends reply of the call, err is sent in its place if
+// set.
+func (s *rpcStream) sendReply(reply rpcMessage, err error) error {
+	e := &rpcEncoder{}
+	if err != nil {
+		e.putString(err.Error())
+	} else {
+		e.putString("")
+		reply.encodeRPC(e)
+	}
+	return s.conn.writeFrame(rpcFrameReply, s.id, e.buf)
+}
+
+// waitReply - waits for reply of the call, returns the error sent in
+// its place if any.
+func (s *rpcStream) waitReply(reply rpcMessage) error {
+	var payload []byte
+	select {
+	case payload = <-s.replyCh:
+	case <-s.doneCh:
+		// Reply may have raced the failure.
+		select {
+		case payload = <-s.replyCh:
+		default:
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return s.err
+		}
+	}
+	d := &rpcDecoder{buf: payload}
+	if errString := d.getString(); errString != "" {
+		return errors.New(errString)
+	}
+	reply.decodeRPC(d)
+	return d.err
+}
+
+// rpcStreamTimer - expires once no data moves over a rpc stream within
+// the timeout.
+type rpcStreamTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// newRPCStreamTimer - initialize timer calling expire once no data
+// moves within timeout.
+func newRPCStreamTimer(timeout time.Duration, expire func()) *rpcStreamTimer {
+	return &rpcStreamTimer{
+		timer:   time.AfterFunc(timeout, expire),
+		timeout: timeout,
+	}
+}
+
+// progress - restarts the timer as data moved over the stream.
+func (t *rpcStreamTimer) progress() {
+	t.timer.Reset(t.timeout)
+}
+
+// stop - stops the timer.
+func (t *rpcStreamTimer) stop() {
+	t.timer.Stop()
+}
+
+// rpcMuxClient - rpc connection which connects on first use and
+// reconnects once the connection is lost, so that servers which are
+// not up yet can still be initialized.
+type rpcMuxClient struct {
+	mutex   *sync.Mutex
+	netAddr string
+	rpcPath string
+	conn    *rpcMuxConn
+}
+
+// getConn - returns the connection, connecting first if needed.
+func (c *rpcMuxClient) getConn() (*rpcMuxConn, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn != nil && c.conn.failed() == nil {
+		return c.conn, nil
+	}
+	conn, err := dialRPCMuxConn(c.netAddr, c.rpcPath)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// rpcMuxPool - persistent connections to a rpc server, streams are
+// spread over the connections in round robin.
+type rpcMuxPool struct {
+	clients []*rpcMuxClient
+	next    uint32
+	// Timeout of calls, the client stops waiting for the reply once
+	// past it and the server drops calls not started by then.
+	callTimeout time.Duration
+}
+
+// newRPCMuxPool - initialize pool of size connections to a rpc server
+// at path, connections are made on first use.
+func newRPCMuxPool(netAddr, rpcPath string, size int) *rpcMuxPool {
+	pool := &rpcMuxPool{callTimeout: rpcCallTimeout}
+	for i := 0; i < size; i++ {
+		pool.clients = append(pool.clients, &rpcMuxClient{
+			mutex:   &sync.Mutex{},
+			netAddr: netAddr,
+			rpcPath: rpcPath,
+		})
+	}
+	return pool
+}
+
+// open - opens a stream over the next connection of the pool. Arguments
+// carrying a token are signed for the method.
+func (p *rpcMuxPool) open(method string, args rpcMessage, timeout time.Duration) (*rpcStream, error) {
+	if authArgs, ok := args.(rpcAuthSetter); ok {
+		authArgs.SetAuthToken(newRPCAuthToken(method))
+	}
+	index := atomic.AddUint32(&p.next, 1) % uint32(len(p.clients))
+	conn, err := p.clients[index].getConn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.open(method, args, timeout)
+}
+
+// Call - calls the rpc method and waits for its reply.
+func (p *rpcMuxPool) Call(method string, args, reply rpcMessage) error {
+	stream, err := p.open(method, args, p.callTimeout)
+	if err != nil {
+		return err
+	}
+	defer stream.end()
+	return stream.waitReply(reply)
+}
@@ -16,19 +16,246 @@
 
 package main
 
+import (
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+// rpcMessage - arguments or reply of a storage rpc call, sent in a
+// compact binary encoding.
+type rpcMessage interface {
+	encodeRPC(e *rpcEncoder)
+	decodeRPC(d *rpcDecoder)
+}
+
+// rpcEncoder - appends values to a message, integers as varints and
+// strings prefixed with their length.
+type rpcEncoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// putUvarint - appends an unsigned integer.
+func (e *rpcEncoder) putUvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+// putVarint - appends an integer.
+func (e *rpcEncoder) putVarint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+// putString - appends a string.
+func (e *rpcEncoder) putString(s string) {
+	e.putUvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// putBool - appends a boolean.
+func (e *rpcEncoder) putBool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// putTime - appends a time, in seconds and nanoseconds.
+func (e *rpcEncoder) putTime(t time.Time) {
+	e.putVarint(t.Unix())
+	e.putUvarint(uint64(t.Nanosecond()))
+}
+
+// rpcDecoder - reads values of a message in the order they were
+// appended, the first error is kept and later reads return zero
+// values.
+type rpcDecoder struct {
+	buf []byte
+	err error
+}
+
+// getUvarint - reads an unsigned integer.
+func (d *rpcDecoder) getUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errRPCProtocol
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// getVarint - reads an integer.
+func (d *rpcDecoder) getVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errRPCProtocol
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// getString - reads a string.
+func (d *rpcDecoder) getString() string {
+	length := d.getUvarint()
+	if d.err != nil {
+		return ""
+	}
+	if length > uint64(len(d.buf)) {
+		d.err = errRPCProtocol
+		return ""
+	}
+	s := string(d.buf[:length])
+	d.buf = d.buf[length:]
+	return s
+}
+
+// getBool - reads a boolean.
+func (d *rpcDecoder) getBool() bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.buf) == 0 {
+		d.err = errRPCProtocol
+		return false
+	}
+	b := d.buf[0] != 0
+	d.buf = d.buf[1:]
+	return b
+}
+
+// getTime - reads a time, zero time is kept as is.
+func (d *rpcDecoder) getTime() time.Time {
+	sec := d.getVarint()
+	nsec := d.getUvarint()
+	if d.err != nil {
+		return time.Time{}
+	}
+	if sec == (time.Time{}).Unix() && nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, int64(nsec))
+}
+
+// getCount - reads number of elements of a list, every element takes
+// at least a byte.
+func (d *rpcDecoder) getCount() int {
+	count := d.getUvarint()
+	if count > uint64(len(d.buf)) {
+		d.err = errRPCProtocol
+		return 0
+	}
+	return int(count)
+}
+
+func (a *AuthRPCArgs) encodeRPC(e *rpcEncoder) {
+	e.putString(a.Auth.AccessKey)
+	e.putVarint(a.Auth.Timestamp)
+	e.putString(a.Auth.Nonce)
+	e.putString(a.Auth.Signature)
+}
+
+func (a *AuthRPCArgs) decodeRPC(d *rpcDecoder) {
+	a.Auth.AccessKey = d.getString()
+	a.Auth.Timestamp = d.getVarint()
+	a.Auth.Nonce = d.getString()
+	a.Auth.Signature = d.getString()
+}
+
+func (v *VolInfo) encodeRPC(e *rpcEncoder) {
+	e.putString(v.Name)
+	e.putTime(v.Created)
+	e.putVarint(v.Total)
+	e.putVarint(v.Free)
+	e.putString(v.FSType)
+}
+
+func (v *VolInfo) decodeRPC(d *rpcDecoder) {
+	v.Name = d.getString()
+	v.Created = d.getTime()
+	v.Total = d.getVarint()
+	v.Free = d.getVarint()
+	v.FSType = d.getString()
+}
+
+func (f *FileInfo) encodeRPC(e *rpcEncoder) {
+	e.putString(f.Volume)
+	e.putString(f.Name)
+	e.putString(f.MD5Sum)
+	e.putTime(f.ModTime)
+	e.putVarint(f.Size)
+	e.putUvarint(uint64(f.Mode))
+}
+
+func (f *FileInfo) decodeRPC(d *rpcDecoder) {
+	f.Volume = d.getString()
+	f.Name = d.getString()
+	f.MD5Sum = d.getString()
+	f.ModTime = d.getTime()
+	f.Size = d.getVarint()
+	f.Mode = os.FileMode(d.getUvarint())
+}
+
 // GenericReply generic rpc reply.
 type GenericReply struct{}
 
+func (r *GenericReply) encodeRPC(e *rpcEncoder) {}
+
+func (r *GenericReply) decodeRPC(d *rpcDecoder) {}
+
 // GenericArgs generic rpc args.
-type GenericArgs struct{}
+type GenericArgs struct {
+	AuthRPCArgs
+}
+
+// GenericVolArgs generic volume args.
+type GenericVolArgs struct {
+	AuthRPCArgs
+	Vol string
+}
+
+func (a *GenericVolArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+}
+
+func (a *GenericVolArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+}
 
 // ListVolsReply list vols rpc reply.
 type ListVolsReply struct {
 	Vols []VolInfo
 }
 
+func (r *ListVolsReply) encodeRPC(e *rpcEncoder) {
+	e.putUvarint(uint64(len(r.Vols)))
+	for index := range r.Vols {
+		r.Vols[index].encodeRPC(e)
+	}
+}
+
+func (r *ListVolsReply) decodeRPC(d *rpcDecoder) {
+	r.Vols = make([]VolInfo, d.getCount())
+	for index := range r.Vols {
+		r.Vols[index].decodeRPC(d)
+	}
+}
+
 // ListFilesArgs list file args.
 type ListFilesArgs struct {
+	AuthRPCArgs
 	Vol       string
 	Prefix    string
 	Marker    string
@@ -36,28 +263,160 @@ type ListFilesArgs struct {
 	Count     int
 }
 
+func (a *ListFilesArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+	e.putString(a.Prefix)
+	e.putString(a.Marker)
+	e.putBool(a.Recursive)
+	e.putVarint(int64(a.Count))
+}
+
+func (a *ListFilesArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+	a.Prefix = d.getString()
+	a.Marker = d.getString()
+	a.Recursive = d.getBool()
+	a.Count = int(d.getVarint())
+}
+
 // ListFilesReply list file reply.
 type ListFilesReply struct {
 	Files []FileInfo
 	EOF   bool
 }
 
+func (r *ListFilesReply) encodeRPC(e *rpcEncoder) {
+	e.putUvarint(uint64(len(r.Files)))
+	for index := range r.Files {
+		r.Files[index].encodeRPC(e)
+	}
+	e.putBool(r.EOF)
+}
+
+func (r *ListFilesReply) decodeRPC(d *rpcDecoder) {
+	r.Files = make([]FileInfo, d.getCount())
+	for index := range r.Files {
+		r.Files[index].decodeRPC(d)
+	}
+	r.EOF = d.getBool()
+}
+
 // StatFileArgs stat file args.
 type StatFileArgs struct {
+	AuthRPCArgs
 	Vol  string
 	Path string
 }
 
+func (a *StatFileArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+	e.putString(a.Path)
+}
+
+func (a *StatFileArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+	a.Path = d.getString()
+}
+
 // DeleteFileArgs delete file args.
 type DeleteFileArgs struct {
+	AuthRPCArgs
 	Vol  string
 	Path string
 }
 
+func (a *DeleteFileArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+	e.putString(a.Path)
+}
+
+func (a *DeleteFileArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+	a.Path = d.getString()
+}
+
 // RenameFileArgs rename file args.
 type RenameFileArgs struct {
+	AuthRPCArgs
 	SrcVol  string
 	SrcPath string
 	DstVol  string
 	DstPath string
 }
+
+func (a *RenameFileArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.SrcVol)
+	e.putString(a.SrcPath)
+	e.putString(a.DstVol)
+	e.putString(a.DstPath)
+}
+
+func (a *RenameFileArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.SrcVol = d.getString()
+	a.SrcPath = d.getString()
+	a.DstVol = d.getString()
+	a.DstPath = d.getString()
+}
+
+// CreateFileArgs create file args, file data is streamed after.
+type CreateFileArgs struct {
+	AuthRPCArgs
+	Vol  string
+	Path string
+}
+
+func (a *CreateFileArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+	e.putString(a.Path)
+}
+
+func (a *CreateFileArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+	a.Path = d.getString()
+}
+
+// ReadFileArgs read file args.
+type ReadFileArgs struct {
+	AuthRPCArgs
+	Vol    string
+	Path   string
+	Offset int64
+}
+
+func (a *ReadFileArgs) encodeRPC(e *rpcEncoder) {
+	a.AuthRPCArgs.encodeRPC(e)
+	e.putString(a.Vol)
+	e.putString(a.Path)
+	e.putVarint(a.Offset)
+}
+
+func (a *ReadFileArgs) decodeRPC(d *rpcDecoder) {
+	a.AuthRPCArgs.decodeRPC(d)
+	a.Vol = d.getString()
+	a.Path = d.getString()
+	a.Offset = d.getVarint()
+}
+
+// ReadFileReply read file reply, file data is streamed after. Length
+// of the data is -1 if unknown.
+type ReadFileReply struct {
+	Length int64
+}
+
+func (r *ReadFileReply) encodeRPC(e *rpcEncoder) {
+	e.putVarint(r.Length)
+}
+
+func (r *ReadFileReply) decodeRPC(d *rpcDecoder) {
+	r.Length = d.getVarint()
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"net/http"
-	"net/rpc"
-	"strconv"
+	"os"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	router "github.com/gorilla/mux"
@@ -14,16 +15,20 @@ import (
 // disk over a network.
 type storageServer struct {
 	storage StorageAPI
+	rpcPath string
 }
 
 /// Volume operations handlers
 
 // MakeVolHandler - make vol handler is rpc wrapper for MakeVol operation.
-func (s *storageServer) MakeVolHandler(arg *string, reply *GenericReply) error {
-	err := s.storage.MakeVol(*arg)
+func (s *storageServer) MakeVolHandler(arg *GenericVolArgs, reply *GenericReply) error {
+	if err := arg.verify("Storage.MakeVolHandler"); err != nil {
+		return err
+	}
+	err := s.storage.MakeVol(arg.Vol)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"volume": *arg,
+			"volume": arg.Vol,
 		}).Debugf("MakeVol failed with error %s", err)
 		return err
 	}
@@ -31,7 +36,10 @@ func (s *storageServer) MakeVolHandler(arg *string, reply *GenericReply) error {
 }
 
 // ListVolsHandler - list vols handler is rpc wrapper for ListVols operation.
-func (s *storageServer) ListVolsHandler(arg *string, reply *ListVolsReply) error {
+func (s *storageServer) ListVolsHandler(arg *GenericArgs, reply *ListVolsReply) error {
+	if err := arg.verify("Storage.ListVolsHandler"); err != nil {
+		return err
+	}
 	vols, err := s.storage.ListVols()
 	if err != nil {
 		log.Debugf("Listsvols failed with error %s", err)
@@ -42,11 +50,14 @@ func (s *storageServer) ListVolsHandler(arg *string, reply *ListVolsReply) error
 }
 
 // StatVolHandler - stat vol handler is a rpc wrapper for StatVol operation.
-func (s *storageServer) StatVolHandler(arg *string, reply *VolInfo) error {
-	volInfo, err := s.storage.StatVol(*arg)
+func (s *storageServer) StatVolHandler(arg *GenericVolArgs, reply *VolInfo) error {
+	if err := arg.verify("Storage.StatVolHandler"); err != nil {
+		return err
+	}
+	volInfo, err := s.storage.StatVol(arg.Vol)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"volume": *arg,
+			"volume": arg.Vol,
 		}).Debugf("StatVol failed with error %s", err)
 		return err
 	}
@@ -56,11 +67,14 @@ func (s *storageServer) StatVolHandler(arg *string, reply *VolInfo) error {
 
 // DeleteVolHandler - delete vol handler is a rpc wrapper for
 // DeleteVol operation.
-func (s *storageServer) DeleteVolHandler(arg *string, reply *GenericReply) error {
-	err := s.storage.DeleteVol(*arg)
+func (s *storageServer) DeleteVolHandler(arg *GenericVolArgs, reply *GenericReply) error {
+	if err := arg.verify("Storage.DeleteVolHandler"); err != nil {
+		return err
+	}
+	err := s.storage.DeleteVol(arg.Vol)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"volume": *arg,
+			"volume": arg.Vol,
 		}).Debugf("DeleteVol failed with error %s", err)
 		return err
 	}
@@ -71,6 +85,9 @@ func (s *storageServer) DeleteVolHandler(arg *string, reply *GenericReply) error
 
 // ListFilesHandler - list files handler.
 func (s *storageServer) ListFilesHandler(arg *ListFilesArgs, reply *ListFilesReply) error {
+	if err := arg.verify("Storage.ListFilesHandler"); err != nil {
+		return err
+	}
 	files, eof, err := s.storage.ListFiles(arg.Vol, arg.Prefix, arg.Marker, arg.Recursive, arg.Count)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -93,6 +110,9 @@ func (s *storageServer) ListFilesHandler(arg *ListFilesArgs, reply *ListFilesRep
 
 // StatFileHandler - stat file handler is rpc wrapper to stat file.
 func (s *storageServer) StatFileHandler(arg *StatFileArgs, reply *FileInfo) error {
+	if err := arg.verify("Storage.StatFileHandler"); err != nil {
+		return err
+	}
 	fileInfo, err := s.storage.StatFile(arg.Vol, arg.Path)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -107,6 +127,9 @@ func (s *storageServer) StatFileHandler(arg *StatFileArgs, reply *FileInfo) erro
 
 // DeleteFileHandler - delete file handler is rpc wrapper to delete file.
 func (s *storageServer) DeleteFileHandler(arg *DeleteFileArgs, reply *GenericReply) error {
+	if err := arg.verify("Storage.DeleteFileHandler"); err != nil {
+		return err
+	}
 	err := s.storage.DeleteFile(arg.Vol, arg.Path)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -120,6 +143,9 @@ func (s *storageServer) DeleteFileHandler(arg *DeleteFileArgs, reply *GenericRep
 
 // RenameFileHandler - rename file handler is rpc wrapper to rename file.
 func (s *storageServer) RenameFileHandler(arg *RenameFileArgs, reply *GenericReply) error {
+	if err := arg.verify("Storage.RenameFileHandler"); err != nil {
+		return err
+	}
 	err := s.storage.RenameFile(arg.SrcVol, arg.SrcPath, arg.DstVol, arg.DstPath)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -133,6 +159,154 @@ func (s *storageServer) RenameFileHandler(arg *RenameFileArgs, reply *GenericRep
 	return nil
 }
 
+// CreateFileHandler - create file handler is rpc wrapper to create a
+// file with the data streamed by the client. File is committed once
+// the whole data is received and its checksum verified.
+func (s *storageServer) CreateFileHandler(arg *CreateFileArgs, stream *rpcStream) error {
+	if err := arg.verify("Storage.CreateFileHandler"); err != nil {
+		return err
+	}
+	writeCloser, err := s.storage.CreateFile(arg.Vol, arg.Path)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": arg.Vol,
+			"path":   arg.Path,
+		}).Debugf("CreateFile failed with error %s", err)
+		return err
+	}
+	if _, err = io.Copy(writeCloser, newChecksumReader(stream, -1, stream.getChecksum)); err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": arg.Vol,
+			"path":   arg.Path,
+		}).Debugf("Copying incoming stream to writer failed %s", err)
+		safeCloseAndRemove(writeCloser)
+		return err
+	}
+	return writeCloser.Close()
+}
+
+// ReadFileHandler - read file handler is rpc wrapper to stream a file
+// to the client. Reply carries the length of the data when known, data
+// follows it.
+func (s *storageServer) ReadFileHandler(arg *ReadFileArgs, stream *rpcStream) error {
+	if err := arg.verify("Storage.ReadFileHandler"); err != nil {
+		return err
+	}
+	readCloser, err := s.storage.ReadFile(arg.Vol, arg.Path, arg.Offset)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": arg.Vol,
+			"path":   arg.Path,
+		}).Debugf("ReadFile failed with error %s", err)
+		return err
+	}
+	defer readCloser.Close()
+	reply := &ReadFileReply{Length: -1}
+	if file, ok := readCloser.(*os.File); ok {
+		if st, sErr := file.Stat(); sErr == nil {
+			reply.Length = st.Size() - arg.Offset
+		}
+	}
+	if err = stream.sendReply(reply, nil); err != nil {
+		return err
+	}
+	if _, err = io.Copy(stream, readCloser); err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": arg.Vol,
+			"path":   arg.Path,
+		}).Debugf("Copying file to outgoing stream failed %s", err)
+		stream.cancel(err)
+		return nil
+	}
+	if err = stream.closeWrite(); err != nil {
+		stream.fail(err)
+	}
+	return nil
+}
+
+// errRPCMethodNotFound - rpc method is not served.
+var errRPCMethodNotFound = errors.New("rpc method not found")
+
+// getRPCCall - returns arguments, reply and handler of a rpc call.
+func (s *storageServer) getRPCCall(method string) (args, reply rpcMessage, call func() error) {
+	switch method {
+	case "Storage.MakeVolHandler":
+		args, reply := &GenericVolArgs{}, &GenericReply{}
+		return args, reply, func() error { return s.MakeVolHandler(args, reply) }
+	case "Storage.ListVolsHandler":
+		args, reply := &GenericArgs{}, &ListVolsReply{}
+		return args, reply, func() error { return s.ListVolsHandler(args, reply) }
+	case "Storage.StatVolHandler":
+		args, reply := &GenericVolArgs{}, &VolInfo{}
+		return args, reply, func() error { return s.StatVolHandler(args, reply) }
+	case "Storage.DeleteVolHandler":
+		args, reply := &GenericVolArgs{}, &GenericReply{}
+		return args, reply, func() error { return s.DeleteVolHandler(args, reply) }
+	case "Storage.ListFilesHandler":
+		args, reply := &ListFilesArgs{}, &ListFilesReply{}
+		return args, reply, func() error { return s.ListFilesHandler(args, reply) }
+	case "Storage.StatFileHandler":
+		args, reply := &StatFileArgs{}, &FileInfo{}
+		return args, reply, func() error { return s.StatFileHandler(args, reply) }
+	case "Storage.DeleteFileHandler":
+		args, reply := &DeleteFileArgs{}, &GenericReply{}
+		return args, reply, func() error { return s.DeleteFileHandler(args, reply) }
+	case "Storage.RenameFileHandler":
+		args, reply := &RenameFileArgs{}, &GenericReply{}
+		return args, reply, func() error { return s.RenameFileHandler(args, reply) }
+	}
+	return nil, nil, nil
+}
+
+// serveStream - serves a rpc call or file stream opened by a client.
+// Stream is canceled once no data moves over it within the timeout
+// sent by the client, calls not started by then are dropped.
+func (s *storageServer) serveStream(stream *rpcStream, request []byte) {
+	d := &rpcDecoder{buf: request}
+	method := d.getString()
+	stream.setTimeout(time.Duration(d.getVarint()))
+	defer stream.end()
+
+	var err error
+	reply := rpcMessage(&GenericReply{})
+	switch method {
+	case "Storage.CreateFileHandler":
+		args := &CreateFileArgs{}
+		if args.decodeRPC(d); d.err == nil {
+			err = s.CreateFileHandler(args, stream)
+		}
+	case "Storage.ReadFileHandler":
+		args := &ReadFileArgs{}
+		if args.decodeRPC(d); d.err == nil {
+			if err = s.ReadFileHandler(args, stream); err == nil {
+				// Reply was sent ahead of the data.
+				return
+			}
+		}
+	default:
+		var args rpcMessage
+		var call func() error
+		if args, reply, call = s.getRPCCall(method); call == nil {
+			err = errRPCMethodNotFound
+			break
+		}
+		if args.decodeRPC(d); d.err != nil {
+			break
+		}
+		select {
+		case <-stream.doneCh:
+			// Client gave up on the call.
+			return
+		default:
+		}
+		err = call()
+	}
+	if d.err != nil {
+		err = d.err
+	}
+	stream.sendReply(reply, err)
+}
+
 // Initialize new storage rpc.
 func newRPCServer(exportPath string) (*storageServer, error) {
 	// Initialize posix storage API.
@@ -142,86 +316,15 @@ func newRPCServer(exportPath string) (*storageServer, error) {
 	}
 	return &storageServer{
 		storage: storage,
+		rpcPath: getStorageRPCPath(exportPath),
 	}, nil
 }
 
-// registerStorageRPCRouter - register storage rpc router.
+// registerStorageRPCRouter - register storage rpc router, every disk
+// is served on its own path. Calls and file streams of a disk are
+// multiplexed over connections opened by CONNECT requests.
 func registerStorageRPCRouter(mux *router.Router, stServer *storageServer) {
-	storageRPCServer := rpc.NewServer()
-	storageRPCServer.RegisterName("Storage", stServer)
-	storageRouter := mux.NewRoute().PathPrefix(reservedBucket).Subrouter()
-	// Add minio storage routes.
-	storageRouter.Path("/storage").Handler(storageRPCServer)
-	// StreamUpload - stream upload handler.
-	storageRouter.Methods("POST").Path("/storage/upload/{volume}/{path:.+}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		vars := router.Vars(r)
-		volume := vars["volume"]
-		path := vars["path"]
-		writeCloser, err := stServer.storage.CreateFile(volume, path)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Debugf("CreateFile failed with error %s", err)
-			httpErr := http.StatusInternalServerError
-			if err == errVolumeNotFound {
-				httpErr = http.StatusNotFound
-			} else if err == errIsNotRegular {
-				httpErr = http.StatusConflict
-			}
-			http.Error(w, err.Error(), httpErr)
-			return
-		}
-		reader := r.Body
-		if _, err = io.Copy(writeCloser, reader); err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Debugf("Copying incoming reader to writer failed %s", err)
-			safeCloseAndRemove(writeCloser)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		writeCloser.Close()
-		reader.Close()
-	})
-	// StreamDownloadHandler - stream download handler.
-	storageRouter.Methods("GET").Path("/storage/download/{volume}/{path:.+}").Queries("offset", "{offset:.*}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		vars := router.Vars(r)
-		volume := vars["volume"]
-		path := vars["path"]
-		offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Debugf("Parse offset failure with error %s", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		readCloser, err := stServer.storage.ReadFile(volume, path, offset)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Debugf("ReadFile failed with error %s", err)
-			httpErr := http.StatusBadRequest
-			if err == errVolumeNotFound {
-				httpErr = http.StatusNotFound
-			} else if err == errFileNotFound {
-				httpErr = http.StatusNotFound
-			}
-			http.Error(w, err.Error(), httpErr)
-			return
-		}
-
-		// Copy reader to writer.
-		io.Copy(w, readCloser)
-
-		// Flush out any remaining buffers to client.
-		w.(http.Flusher).Flush()
-
-		// Close the reader.
-		readCloser.Close()
+	mux.Path(stServer.rpcPath).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptRPCMuxConn(w, r, stServer.serveStream)
 	})
 }
@@ -41,6 +41,10 @@ var serverCmd = cli.Command{
 			Name:  "address",
 			Value: ":9000",
 		},
+		cli.IntFlag{
+			Name:  "parity",
+			Usage: "Number of parity blocks for erasure coded layer, defaults to half the disks.",
+		},
 	},
 	Action: serverMain,
 	CustomHelpTemplate: `NAME:
@@ -55,6 +59,8 @@ OPTIONS:
 ENVIRONMENT VARIABLES:
   MINIO_ACCESS_KEY: Access key string of 5 to 20 characters in length.
   MINIO_SECRET_KEY: Secret key string of 8 to 40 characters in length.
+  MINIO_PROMETHEUS_AUTH_TYPE: Set to "public" to serve prometheus metrics without authentication,
+                              metrics require requests signed with the server credential otherwise.
 
 EXAMPLES:
   1. Start minio server.
@@ -69,6 +75,17 @@ EXAMPLES:
   4. Start minio server 8 disks to enable erasure coded layer with 4 data and 4 parity.
       $ minio {{.Name}} /mnt/export1/backend /mnt/export2/backend /mnt/export3/backend /mnt/export4/backend \
           /mnt/export5/backend /mnt/export6/backend /mnt/export7/backend /mnt/export8/backend
+
+  5. Start minio server 12 disks to enable erasure coded layer with 10 data and 2 parity.
+      $ minio {{.Name}} --parity 2 /mnt/export1/backend /mnt/export2/backend /mnt/export3/backend \
+          /mnt/export4/backend /mnt/export5/backend /mnt/export6/backend /mnt/export7/backend \
+          /mnt/export8/backend /mnt/export9/backend /mnt/export10/backend /mnt/export11/backend \
+          /mnt/export12/backend
+
+  6. Start minio server on 4 servers to enable distributed erasure coded layer, run the same command on
+     every server.
+      $ minio {{.Name}} 192.168.1.11:/mnt/export/backend 192.168.1.12:/mnt/export/backend \
+          192.168.1.13:/mnt/export/backend 192.168.1.14:/mnt/export/backend
 `,
 }
 
@@ -153,6 +170,25 @@ func initServerConfig(c *cli.Context) {
 		})
 	}
 
+	// Prometheus metrics are authenticated unless configured to be
+	// public.
+	switch authType := os.Getenv("MINIO_PROMETHEUS_AUTH_TYPE"); authType {
+	case "":
+		globalMetricsPublic = false
+	case "public":
+		globalMetricsPublic = true
+	default:
+		fatalIf(errInvalidArgument, "Unknown prometheus auth type "+authType+", expected public.", nil)
+	}
+
+	// Parity blocks from command line override the config for
+	// this run.
+	if c.IsSet("parity") {
+		erasure := serverConfig.GetErasure()
+		erasure.ParityBlocks = c.Int("parity")
+		serverConfig.SetErasure(erasure)
+	}
+
 	// Set maxOpenFiles, This is necessary since default operating
 	// system limits of 1024, 2048 are not enough for Minio server.
 	setMaxOpenFiles()
@@ -267,6 +303,9 @@ func serverMain(c *cli.Context) {
 	// Check if requested port is available.
 	checkPortAvailability(getPort(net.JoinHostPort(host, port)))
 
+	// Disks with this address are local disks.
+	globalMinioAddr = net.JoinHostPort(host, port)
+
 	// Save all command line args as export paths.
 	exportPaths := c.Args()
 
@@ -31,9 +31,11 @@ import (
 
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 
 	. "gopkg.in/check.v1"
 )
@@ -96,6 +98,9 @@ func (s *MyAPISuite) SetUpSuite(c *C) {
 	// Do this only once here
 	setGlobalConfigPath(root)
 
+	// Initialize users, groups and policies.
+	c.Assert(initIAMConfig(), IsNil)
+
 	// Save config.
 	c.Assert(serverConfig.Save(), IsNil)
 
@@ -147,6 +152,11 @@ var ignoredHeaders = map[string]bool{
 }
 
 func (s *MyAPISuite) newRequest(method, urlStr string, contentLength int64, body io.ReadSeeker) (*http.Request, error) {
+	return s.newServiceRequest("s3", method, urlStr, contentLength, body)
+}
+
+// newServiceRequest - signs the request for service.
+func (s *MyAPISuite) newServiceRequest(service, method, urlStr string, contentLength int64, body io.ReadSeeker) (*http.Request, error) {
 	if method == "" {
 		method = "POST"
 	}
@@ -244,7 +254,7 @@ func (s *MyAPISuite) newRequest(method, urlStr string, contentLength int64, body
 	scope := strings.Join([]string{
 		t.Format(yyyymmdd),
 		"us-east-1",
-		"s3",
+		service,
 		"aws4_request",
 	}, "/")
 
@@ -254,8 +264,8 @@ func (s *MyAPISuite) newRequest(method, urlStr string, contentLength int64, body
 
 	date := sumHMAC([]byte("AWS4"+s.credential.SecretAccessKey), []byte(t.Format(yyyymmdd)))
 	region := sumHMAC(date, []byte("us-east-1"))
-	service := sumHMAC(region, []byte("s3"))
-	signingKey := sumHMAC(service, []byte("aws4_request"))
+	serviceKey := sumHMAC(region, []byte(service))
+	signingKey := sumHMAC(serviceKey, []byte("aws4_request"))
 
 	signature := hex.EncodeToString(sumHMAC(signingKey, []byte(stringToSign)))
 
@@ -361,6 +371,184 @@ func (s *MyAPISuite) TestBucketPolicy(c *C) {
 	c.Assert(response.StatusCode, Equals, http.StatusNotFound)
 }
 
+func (s *MyAPISuite) TestAssumeRole(c *C) {
+	// Session policy only allows listing buckets.
+	sessionPolicy := `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:ListAllMyBuckets"], "Resource": ["arn:aws:s3:::*"]}]}`
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", stsAPIVersion)
+	form.Set("DurationSeconds", "900")
+	form.Set("Policy", sessionPolicy)
+	formBuf := []byte(form.Encode())
+
+	request, err := s.newServiceRequest("sts", "POST", testAPIFSCacheServer.URL+"/", int64(len(formBuf)), bytes.NewReader(formBuf))
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	assumeRoleResponse := &AssumeRoleResponse{}
+	decoder := xml.NewDecoder(response.Body)
+	c.Assert(decoder.Decode(assumeRoleResponse), IsNil)
+	stsCreds := assumeRoleResponse.Result.Credentials
+	c.Assert(stsCreds.SessionToken, Not(Equals), "")
+
+	// S3 APIs do not accept signatures for 'sts'.
+	request, err = s.newServiceRequest("sts", "GET", testAPIFSCacheServer.URL+"/", 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	verifyError(c, response, "AccessDenied", "Service scope should be of value 's3'.", http.StatusBadRequest)
+
+	// Sign requests with the session credential.
+	newSessionRequest := func(method, urlStr string, sessionToken string) *http.Request {
+		rootCred := s.credential
+		defer func() { s.credential = rootCred }()
+		s.credential = credential{stsCreds.AccessKeyID, stsCreds.SecretAccessKey}
+		request, err := s.newRequest(method, urlStr, 0, nil)
+		c.Assert(err, IsNil)
+		request.Header.Set("X-Amz-Security-Token", sessionToken)
+		return request
+	}
+
+	// Listing buckets is allowed by the session policy.
+	response, err = client.Do(newSessionRequest("GET", testAPIFSCacheServer.URL+"/", stsCreds.SessionToken))
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	// Creating buckets is not allowed by the session policy.
+	response, err = client.Do(newSessionRequest("PUT", testAPIFSCacheServer.URL+"/sessionbucket", stsCreds.SessionToken))
+	c.Assert(err, IsNil)
+	verifyError(c, response, "AccessDenied", "Access Denied.", http.StatusForbidden)
+
+	// Session credential is not valid without its token.
+	response, err = client.Do(newSessionRequest("GET", testAPIFSCacheServer.URL+"/", "invalid-token"))
+	c.Assert(err, IsNil)
+	verifyError(c, response, "InvalidToken", "The provided token is malformed or otherwise invalid.", http.StatusBadRequest)
+}
+
+func (s *MyAPISuite) TestAdminServerStatus(c *C) {
+	request, err := s.newRequest("GET", testAPIFSCacheServer.URL+adminAPIPathPrefix+"/status", 0, nil)
+	c.Assert(err, IsNil)
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	status := ServerStatusResponse{}
+	c.Assert(json.NewDecoder(response.Body).Decode(&status), IsNil)
+	c.Assert(status.Version, Equals, minioVersion)
+	c.Assert(status.Backend.Type, Equals, backendFS)
+	c.Assert(len(status.Backend.Disks), Equals, 1)
+	c.Assert(status.Backend.Disks[0].Online, Equals, true)
+
+	// Heal is not supported on fs backend.
+	request, err = s.newRequest("POST", testAPIFSCacheServer.URL+adminAPIPathPrefix+"/heal/healbucket", 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	verifyError(c, response, "XMinioAdminHealNotSupported", "Heal is only supported on XL backend.", http.StatusNotImplemented)
+}
+
+func (s *MyAPISuite) TestMetrics(c *C) {
+	request, err := s.newRequest("GET", testAPIFSCacheServer.URL+"/", 0, nil)
+	c.Assert(err, IsNil)
+
+	client := http.Client{}
+	response, err := client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	// Metrics require requests signed with the server credential.
+	response, err = client.Get(testAPIFSCacheServer.URL + metricsPath)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusForbidden)
+
+	request, err = s.newRequest("GET", testAPIFSCacheServer.URL+metricsPath, 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+	metrics, err := ioutil.ReadAll(response.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(metrics), `minio_http_requests_total{api="ListBuckets",code="200"}`), Equals, true)
+	c.Assert(strings.Contains(string(metrics), "minio_disk_free_bytes{disk="), Equals, true)
+
+	// Public metrics are served without authentication.
+	globalMetricsPublic = true
+	defer func() {
+		globalMetricsPublic = false
+	}()
+	response, err = client.Get(testAPIFSCacheServer.URL + metricsPath)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+}
+
+func (s *MyAPISuite) TestHealthCheck(c *C) {
+	client := http.Client{}
+	for _, healthPath := range []string{healthCheckLivePath, healthCheckReadyPath} {
+		response, err := client.Get(testAPIFSCacheServer.URL + healthPath)
+		c.Assert(err, IsNil)
+		c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+		// Health checks bypass authorization and date verification.
+		request, err := http.NewRequest("GET", testAPIFSCacheServer.URL+healthPath, nil)
+		c.Assert(err, IsNil)
+		request.Header.Set("Authorization", "invalid")
+		response, err = client.Do(request)
+		c.Assert(err, IsNil)
+		c.Assert(response.StatusCode, Equals, http.StatusOK)
+	}
+}
+
+func (s *MyAPISuite) TestRateLimit(c *C) {
+	setRateLimit := func(rateLimit rateLimitConfig) {
+		rateLimitBuf, err := json.Marshal(rateLimit)
+		c.Assert(err, IsNil)
+		request, err := s.newRequest("PUT", testAPIFSCacheServer.URL+adminAPIPathPrefix+"/config/ratelimit", int64(len(rateLimitBuf)), bytes.NewReader(rateLimitBuf))
+		c.Assert(err, IsNil)
+		response, err := http.DefaultClient.Do(request)
+		c.Assert(err, IsNil)
+		c.Assert(response.StatusCode, Equals, http.StatusNoContent)
+	}
+	// Allow only one request on the bucket.
+	setRateLimit(rateLimitConfig{Bucket: rateLimit{RequestsPerSecond: 0.001, RequestsBurst: 1}})
+	defer setRateLimit(rateLimitConfig{})
+
+	// Requests with forged signatures do not use up the limit.
+	request, err := s.newRequest("HEAD", testAPIFSCacheServer.URL+"/ratelimitbucket", 0, nil)
+	c.Assert(err, IsNil)
+	authorization := request.Header.Get("Authorization")
+	signatureIndex := strings.Index(authorization, "Signature=") + len("Signature=")
+	request.Header.Set("Authorization", authorization[:signatureIndex]+strings.Repeat("0", 64))
+	client := http.Client{}
+	response, err := client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusForbidden)
+
+	request, err = s.newRequest("PUT", testAPIFSCacheServer.URL+"/ratelimitbucket", 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	request, err = s.newRequest("HEAD", testAPIFSCacheServer.URL+"/ratelimitbucket", 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	c.Assert(response.StatusCode, Equals, http.StatusServiceUnavailable)
+
+	request, err = s.newRequest("GET", testAPIFSCacheServer.URL+"/ratelimitbucket", 0, nil)
+	c.Assert(err, IsNil)
+	response, err = client.Do(request)
+	c.Assert(err, IsNil)
+	verifyError(c, response, "SlowDown", "Please reduce your request rate.", http.StatusServiceUnavailable)
+}
+
 func (s *MyAPISuite) TestDeleteBucket(c *C) {
 	request, err := s.newRequest("PUT", testAPIFSCacheServer.URL+"/deletebucket", 0, nil)
 	c.Assert(err, IsNil)
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -57,13 +58,40 @@ func (jwt *JWT) GenerateToken(userName string) (string, error) {
 	return token.SignedString([]byte(jwt.SecretAccessKey))
 }
 
-// Authenticate - authenticates incoming username and password.
+// keyFunc - verifies signing method and returns the key tokens are
+// signed with.
+func (jwt *JWT) keyFunc(token *jwtgo.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwtgo.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return []byte(jwt.SecretAccessKey), nil
+}
+
+// getTokenUser - returns the user a valid token was generated for,
+// tokens of removed or disabled users are not valid anymore.
+func getTokenUser(token *jwtgo.Token) (string, bool) {
+	if !token.Valid {
+		return "", false
+	}
+	userName, ok := token.Claims["sub"].(string)
+	if !ok {
+		return "", false
+	}
+	if _, ok = getCredential(userName); !ok {
+		return "", false
+	}
+	return userName, true
+}
+
+// Authenticate - authenticates incoming username and password, any
+// enabled user can login along with the server credential.
 func (jwt *JWT) Authenticate(userName, password string) bool {
 	userName = strings.TrimSpace(userName)
 	password = strings.TrimSpace(password)
-	if userName != jwt.AccessKeyID {
+	cred, ok := getCredential(userName)
+	if !ok {
 		return false
 	}
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(jwt.SecretAccessKey), bcrypt.DefaultCost)
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(cred.SecretAccessKey), bcrypt.DefaultCost)
 	return bcrypt.CompareHashAndPassword(hashedPassword, []byte(password)) == nil
 }
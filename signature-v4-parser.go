@@ -22,6 +22,34 @@ import (
 	"time"
 )
 
+// Services requests can be signed for, 's3' for all S3 APIs and 'sts'
+// for clients requesting session credentials. Each API verifies the
+// service of the signature is one it accepts.
+const (
+	serviceS3  = "s3"
+	serviceSTS = "sts"
+)
+
+// supportedServices - all the services requests can be signed for.
+var supportedServices = map[string]struct{}{
+	serviceS3:  {},
+	serviceSTS: {},
+}
+
+// isServiceAccepted - verifies if the signature service is one of the
+// services accepted, S3 APIs accept only 's3' when none are given.
+func isServiceAccepted(service string, services []string) bool {
+	if len(services) == 0 {
+		return service == serviceS3
+	}
+	for _, acceptedService := range services {
+		if service == acceptedService {
+			return true
+		}
+	}
+	return false
+}
+
 // credentialHeader data type represents structured form of Credential
 // string from authorization header.
 type credentialHeader struct {
@@ -63,7 +91,7 @@ func parseCredentialHeader(credElement string) (credentialHeader, APIErrorCode)
 		return credentialHeader{}, ErrInvalidRegion
 	}
 	cred.scope.region = credElements[2]
-	if credElements[3] != "s3" {
+	if _, ok := supportedServices[credElements[3]]; !ok {
 		return credentialHeader{}, ErrInvalidService
 	}
 	cred.scope.service = credElements[3]
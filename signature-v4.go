@@ -114,31 +114,31 @@ func getCanonicalRequest(extractedSignedHeaders http.Header, payload, queryStr,
 }
 
 // getScope generate a string of a specific date, an AWS region, and a service.
-func getScope(t time.Time, region string) string {
+func getScope(t time.Time, region, service string) string {
 	scope := strings.Join([]string{
 		t.Format(yyyymmdd),
 		region,
-		"s3",
+		service,
 		"aws4_request",
 	}, "/")
 	return scope
 }
 
 // getStringToSign a string based on selected query values.
-func getStringToSign(canonicalRequest string, t time.Time, region string) string {
+func getStringToSign(canonicalRequest string, t time.Time, region, service string) string {
 	stringToSign := signV4Algorithm + "\n" + t.Format(iso8601Format) + "\n"
-	stringToSign = stringToSign + getScope(t, region) + "\n"
+	stringToSign = stringToSign + getScope(t, region, service) + "\n"
 	canonicalRequestBytes := sha256.Sum256([]byte(canonicalRequest))
 	stringToSign = stringToSign + hex.EncodeToString(canonicalRequestBytes[:])
 	return stringToSign
 }
 
 // getSigningKey hmac seed to calculate final signature.
-func getSigningKey(secretKey string, t time.Time, region string) []byte {
+func getSigningKey(secretKey string, t time.Time, region, service string) []byte {
 	date := sumHMAC([]byte("AWS4"+secretKey), []byte(t.Format(yyyymmdd)))
 	regionBytes := sumHMAC(date, []byte(region))
-	service := sumHMAC(regionBytes, []byte("s3"))
-	signingKey := sumHMAC(service, []byte("aws4_request"))
+	serviceBytes := sumHMAC(regionBytes, []byte(service))
+	signingKey := sumHMAC(serviceBytes, []byte("aws4_request"))
 	return signingKey
 }
 
@@ -151,9 +151,6 @@ func getSignature(signingKey []byte, stringToSign string) string {
 //     - http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
 // returns true if matches, false otherwise. if error is not nil then it is always false
 func doesPolicySignatureMatch(formValues map[string]string) APIErrorCode {
-	// Access credentials.
-	cred := serverConfig.GetCredential()
-
 	// Server region.
 	region := serverConfig.GetRegion()
 
@@ -162,10 +159,14 @@ func doesPolicySignatureMatch(formValues map[string]string) APIErrorCode {
 	if err != ErrNone {
 		return ErrMissingFields
 	}
+	if !isServiceAccepted(credHeader.scope.service, nil) {
+		return ErrInvalidService
+	}
 
-	// Verify if the access key id matches.
-	if credHeader.accessKey != cred.AccessKeyID {
-		return ErrInvalidAccessKeyID
+	// Access credentials for the access key id.
+	cred, s3Error := getRequestCredential(credHeader.accessKey, formValues["X-Amz-Security-Token"])
+	if s3Error != ErrNone {
+		return s3Error
 	}
 
 	// Verify if the region is valid.
@@ -181,7 +182,7 @@ func doesPolicySignatureMatch(formValues map[string]string) APIErrorCode {
 	}
 
 	// Get signing key.
-	signingKey := getSigningKey(cred.SecretAccessKey, t, region)
+	signingKey := getSigningKey(cred.SecretAccessKey, t, region, credHeader.scope.service)
 
 	// Get signature.
 	newSignature := getSignature(signingKey, formValues["Policy"])
@@ -196,10 +197,8 @@ func doesPolicySignatureMatch(formValues map[string]string) APIErrorCode {
 // doesPresignedSignatureMatch - Verify query headers with presigned signature
 //     - http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
 // returns true if matches, false otherwise. if error is not nil then it is always false
-func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validateRegion bool) APIErrorCode {
-	// Access credentials.
-	cred := serverConfig.GetCredential()
-
+// Signatures are accepted for services, 's3' only if none are given.
+func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validateRegion bool, services ...string) APIErrorCode {
 	// Server region.
 	region := serverConfig.GetRegion()
 
@@ -211,10 +210,15 @@ func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validate
 	if err != ErrNone {
 		return err
 	}
+	if !isServiceAccepted(preSignValues.Credential.scope.service, services) {
+		return ErrInvalidService
+	}
 
-	// Verify if the access key id matches.
-	if preSignValues.Credential.accessKey != cred.AccessKeyID {
-		return ErrInvalidAccessKeyID
+	// Access credentials for the access key id.
+	sessionToken := req.URL.Query().Get("X-Amz-Security-Token")
+	cred, err := getRequestCredential(preSignValues.Credential.accessKey, sessionToken)
+	if err != ErrNone {
+		return err
 	}
 
 	// Verify if region is valid.
@@ -253,7 +257,11 @@ func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validate
 	query.Set("X-Amz-Date", t.Format(iso8601Format))
 	query.Set("X-Amz-Expires", strconv.Itoa(expireSeconds))
 	query.Set("X-Amz-SignedHeaders", getSignedHeaders(extractedSignedHeaders))
-	query.Set("X-Amz-Credential", cred.AccessKeyID+"/"+getScope(t, sRegion))
+	sService := preSignValues.Credential.scope.service
+	query.Set("X-Amz-Credential", cred.AccessKeyID+"/"+getScope(t, sRegion, sService))
+	if sessionToken != "" {
+		query.Set("X-Amz-Security-Token", sessionToken)
+	}
 
 	// Save other headers available in the request parameters.
 	for k, v := range req.URL.Query() {
@@ -295,10 +303,10 @@ func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validate
 	presignedCanonicalReq := getCanonicalRequest(extractedSignedHeaders, hashedPayload, encodedQuery, req.URL.Path, req.Method, req.Host)
 
 	// Get string to sign from canonical request.
-	presignedStringToSign := getStringToSign(presignedCanonicalReq, t, region)
+	presignedStringToSign := getStringToSign(presignedCanonicalReq, t, region, sService)
 
 	// Get hmac presigned signing key.
-	presignedSigningKey := getSigningKey(cred.SecretAccessKey, t, region)
+	presignedSigningKey := getSigningKey(cred.SecretAccessKey, t, region, sService)
 
 	// Get new signature.
 	newSignature := getSignature(presignedSigningKey, presignedStringToSign)
@@ -313,10 +321,8 @@ func doesPresignedSignatureMatch(hashedPayload string, r *http.Request, validate
 // doesSignatureMatch - Verify authorization header with calculated header in accordance with
 //     - http://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
 // returns true if matches, false otherwise. if error is not nil then it is always false
-func doesSignatureMatch(hashedPayload string, r *http.Request, validateRegion bool) APIErrorCode {
-	// Access credentials.
-	cred := serverConfig.GetCredential()
-
+// Signatures are accepted for services, 's3' only if none are given.
+func doesSignatureMatch(hashedPayload string, r *http.Request, validateRegion bool, services ...string) APIErrorCode {
 	// Server region.
 	region := serverConfig.GetRegion()
 
@@ -331,13 +337,17 @@ func doesSignatureMatch(hashedPayload string, r *http.Request, validateRegion bo
 	if err != ErrNone {
 		return err
 	}
+	if !isServiceAccepted(signV4Values.Credential.scope.service, services) {
+		return ErrInvalidService
+	}
 
 	// Extract all the signed headers along with its values.
 	extractedSignedHeaders := extractSignedHeaders(signV4Values.SignedHeaders, req.Header)
 
-	// Verify if the access key id matches.
-	if signV4Values.Credential.accessKey != cred.AccessKeyID {
-		return ErrInvalidAccessKeyID
+	// Access credentials for the access key id.
+	cred, err := getRequestCredential(signV4Values.Credential.accessKey, req.Header.Get("X-Amz-Security-Token"))
+	if err != ErrNone {
+		return err
 	}
 
 	// Verify if region is valid.
@@ -372,10 +382,10 @@ func doesSignatureMatch(hashedPayload string, r *http.Request, validateRegion bo
 	canonicalRequest := getCanonicalRequest(extractedSignedHeaders, hashedPayload, queryStr, req.URL.Path, req.Method, req.Host)
 
 	// Get string to sign from canonical request.
-	stringToSign := getStringToSign(canonicalRequest, t, region)
+	stringToSign := getStringToSign(canonicalRequest, t, region, signV4Values.Credential.scope.service)
 
 	// Get hmac signing key.
-	signingKey := getSigningKey(cred.SecretAccessKey, t, region)
+	signingKey := getSigningKey(cred.SecretAccessKey, t, region, signV4Values.Credential.scope.service)
 
 	// Calculate signature.
 	newSignature := getSignature(signingKey, stringToSign)
@@ -34,3 +34,9 @@ type StorageAPI interface {
 	DeleteFile(volume string, path string) (err error)
 	RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error
 }
+
+// partsStorage - storage which commits the parts of multipart uploads,
+// saved in minio meta volume, as a file without copying their data.
+type partsStorage interface {
+	CommitParts(volume, path string, partPaths []string) error
+}
@@ -0,0 +1,175 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Delay between checks for quorum while bootstrapping.
+const quorumRetryInterval = 2 * time.Second
+
+// isWindowsDrivePath - verifies if export path starts with a windows
+// drive letter, i.e. C:\ which is not a remote export path.
+func isWindowsDrivePath(exportPath string) bool {
+	if len(exportPath) < 2 || exportPath[1] != ':' {
+		return false
+	}
+	letter := exportPath[0]
+	return (letter >= 'a' && letter <= 'z') || (letter >= 'A' && letter <= 'Z')
+}
+
+// isRemoteExportPath - verifies if export path is of the form
+// <host>[:<port>]:<export_dir>.
+func isRemoteExportPath(exportPath string) bool {
+	return strings.Contains(exportPath, ":") && !isWindowsDrivePath(exportPath)
+}
+
+// splitRemoteExportPath - splits remote export path into network
+// address and export dir, port defaults to the port of this server.
+func splitRemoteExportPath(exportPath string) (netAddr, netPath string) {
+	netAddr, netPath = splitNetPath(exportPath)
+	if _, _, err := net.SplitHostPort(netAddr); err != nil {
+		_, port, _ := net.SplitHostPort(globalMinioAddr)
+		netAddr = net.JoinHostPort(netAddr, port)
+	}
+	return netAddr, netPath
+}
+
+// isLocalAddr - verifies if network address belongs to this server,
+// i.e. its host resolves to one of the local interfaces and its port
+// is the one this server listens on.
+func isLocalAddr(netAddr string) bool {
+	host, port, err := net.SplitHostPort(netAddr)
+	if err != nil {
+		return false
+	}
+	if _, serverPort, _ := net.SplitHostPort(globalMinioAddr); port != serverPort {
+		return false
+	}
+	hostIPs, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		for _, hostIP := range hostIPs {
+			if ip := net.ParseIP(hostIP); ip != nil && ip.Equal(ipNet.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getLocalExportPath - returns the local directory of an export path,
+// returns false for export paths of other servers.
+func getLocalExportPath(exportPath string) (string, bool) {
+	if !isRemoteExportPath(exportPath) {
+		return exportPath, true
+	}
+	netAddr, netPath := splitRemoteExportPath(exportPath)
+	if !isLocalAddr(netAddr) {
+		return "", false
+	}
+	return netPath, true
+}
+
+// isDistributedSetup - returns true if any of the export paths is
+// served by another server.
+func isDistributedSetup(exportPaths []string) bool {
+	for _, exportPath := range exportPaths {
+		if _, ok := getLocalExportPath(exportPath); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getLocalExportPaths - returns local directories of all the export
+// paths served by this server.
+func getLocalExportPaths(exportPaths []string) []string {
+	var localPaths []string
+	for _, exportPath := range exportPaths {
+		if localPath, ok := getLocalExportPath(exportPath); ok {
+			localPaths = append(localPaths, localPath)
+		}
+	}
+	return localPaths
+}
+
+// getStorageRPCPath - returns storage rpc path of a disk, every local
+// disk is served on its own path.
+func getStorageRPCPath(diskPath string) string {
+	return storageRPCPath + path.Clean(slashSeparator+filepath.ToSlash(diskPath))
+}
+
+// newStorageAPI - initialize storage of an export path, local disks
+// are accessed directly and disks of other servers over rpc. Disk
+// operations are scheduled in either case.
+func newStorageAPI(exportPath string) (StorageAPI, error) {
+	var storage StorageAPI
+	var err error
+	if localPath, ok := getLocalExportPath(exportPath); ok {
+		storage, err = newPosix(localPath)
+	} else {
+		netAddr, netPath := splitRemoteExportPath(exportPath)
+		storage, err = newRPCClient(netAddr + ":" + netPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newScheduledDisk(storage, defaultDiskMaxIO), nil
+}
+
+// waitForXLQuorum - blocks until every erasure set has read and write
+// quorum of disks online, disks of other servers may come up later
+// than this server.
+func waitForXLQuorum(sets []*XL) {
+	for {
+		ready := true
+		for index, xl := range sets {
+			onlineDisks, totalDisks := countOnlineDisks(xl.disks())
+			if onlineDisks < xl.readQuorum || onlineDisks < xl.writeQuorum {
+				log.WithFields(logrus.Fields{
+					"set":         index,
+					"onlineDisks": onlineDisks,
+					"totalDisks":  totalDisks,
+				}).Info("Waiting for quorum of disks to come online")
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return
+		}
+		time.Sleep(quorumRetryInterval)
+	}
+}
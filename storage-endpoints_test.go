@@ -0,0 +1,191 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	router "github.com/gorilla/mux"
+)
+
+// Tests parsing of local and remote export paths.
+func TestExportPaths(t *testing.T) {
+	savedAddr := globalMinioAddr
+	defer func() {
+		globalMinioAddr = savedAddr
+	}()
+	globalMinioAddr = ":9000"
+
+	testCases := []struct {
+		exportPath string
+		remote     bool
+		netAddr    string
+		netPath    string
+	}{
+		{"/mnt/disk1", false, "", ""},
+		{`C:\disk1`, false, "", ""},
+		{"host1:/mnt/disk1", true, "host1:9000", "/mnt/disk1"},
+		{"host1:9001:/mnt/disk1", true, "host1:9001", "/mnt/disk1"},
+		{"10.0.0.1:9000:/mnt/disk1", true, "10.0.0.1:9000", "/mnt/disk1"},
+	}
+	for i, testCase := range testCases {
+		if remote := isRemoteExportPath(testCase.exportPath); remote != testCase.remote {
+			t.Errorf("Test %d: expected remote %t, got %t", i+1, testCase.remote, remote)
+			continue
+		}
+		if !testCase.remote {
+			continue
+		}
+		netAddr, netPath := splitRemoteExportPath(testCase.exportPath)
+		if netAddr != testCase.netAddr || netPath != testCase.netPath {
+			t.Errorf("Test %d: expected %s %s, got %s %s", i+1, testCase.netAddr, testCase.netPath, netAddr, netPath)
+		}
+	}
+
+	if !isLocalAddr("127.0.0.1:9000") {
+		t.Error("Expected loopback address to be local")
+	}
+	if isLocalAddr("127.0.0.1:9001") {
+		t.Error("Expected address with another port to be remote")
+	}
+	localPaths := getLocalExportPaths([]string{"/mnt/disk1", "127.0.0.1:/mnt/disk2", "192.0.2.1:/mnt/disk3"})
+	if strings.Join(localPaths, ",") != "/mnt/disk1,/mnt/disk2" {
+		t.Errorf("Unexpected local export paths %v", localPaths)
+	}
+	if rpcPath := getStorageRPCPath("/mnt/disk1/"); rpcPath != storageRPCPath+"/mnt/disk1" {
+		t.Errorf("Unexpected storage rpc path %s", rpcPath)
+	}
+	if isDistributedSetup([]string{"/mnt/disk1", "127.0.0.1:/mnt/disk2"}) {
+		t.Error("Expected setup of local disks not to be distributed")
+	}
+	if !isDistributedSetup([]string{"/mnt/disk1", "192.0.2.1:/mnt/disk3"}) {
+		t.Error("Expected setup with disks of another server to be distributed")
+	}
+}
+
+// Tests only rpc is served until XL disks are initialized.
+func TestXLReadyHandler(t *testing.T) {
+	readyCh := make(chan struct{})
+	handler := setXLReadyHandler(readyCh)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	testCases := []struct {
+		path       string
+		ready      bool
+		statusCode int
+	}{
+		{"/bucket/object", false, http.StatusServiceUnavailable},
+		{storageRPCPath + "/mnt/disk1", false, http.StatusOK},
+		{lockRPCPath, false, http.StatusOK},
+		{"/bucket/object", true, http.StatusOK},
+	}
+	for i, testCase := range testCases {
+		if testCase.ready {
+			close(readyCh)
+		}
+		req, err := http.NewRequest("GET", "http://localhost:9000"+testCase.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.statusCode {
+			t.Errorf("Test %d: expected status %d, got %d", i+1, testCase.statusCode, rec.Code)
+		}
+	}
+}
+
+// Tests XL on local disks and disks served over storage rpc by
+// another server.
+func TestDistributedXL(t *testing.T) {
+	defer initTestRPCConfig()()
+	initNSLock()
+
+	var disks []string
+	for i := 0; i < 4; i++ {
+		disk, err := ioutil.TempDir("", "minio-distributed-xl-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+
+	// Serve the last two disks from another server.
+	mux := router.NewRouter()
+	for _, disk := range disks[2:] {
+		stServer, err := newRPCServer(disk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registerStorageRPCRouter(mux, stServer)
+	}
+	remote := httptest.NewServer(mux)
+	defer remote.Close()
+	remoteAddr := strings.TrimPrefix(remote.URL, "http://")
+
+	exportPaths := []string{
+		disks[0],
+		disks[1],
+		remoteAddr + ":" + disks[2],
+		remoteAddr + ":" + disks[3],
+	}
+	objAPI, err := newObjectLayer(exportPaths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl, _ := getXLStorage(objAPI)
+	for index, disk := range xl.storageDisks {
+		// Disks are scheduled.
+		scheduled := disk.(*trackedDisk).disk.(*scheduledDisk)
+		_, isRemote := scheduled.disk.(*networkFS)
+		if isRemote != (index >= 2) {
+			t.Fatalf("Disk %d: expected remote %t", index, index >= 2)
+		}
+	}
+	waitForXLQuorum([]*XL{xl})
+
+	data := bytes.Repeat([]byte("hello world"), 1024)
+	if err = objAPI.MakeBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = objAPI.PutObject("bucket", "object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Shards are written to the remote disks.
+	if _, err = os.Stat(disks[3] + "/bucket/object/file.3"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := objAPI.GetObject("bucket", "object", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Unexpected object data")
+	}
+}
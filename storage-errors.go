@@ -49,5 +49,27 @@ var errReadQuorum = errors.New("I/O error.  did not meet read quorum.")
 // errWriteQuorum - did not meet write quorum.
 var errWriteQuorum = errors.New("I/O error.  did not meet write quorum.")
 
+// errDiskNotFound - disk is removed, unmounted or unreachable, unlike
+// missing volumes and files.
+var errDiskNotFound = errors.New("disk not found")
+
+// errRPCAuthentication - rpc token is invalid, expired or replayed.
+var errRPCAuthentication = errors.New("rpc authentication failed")
+
+// errRPCChecksum - rpc stream body was corrupted on the wire.
+var errRPCChecksum = errors.New("rpc stream checksum mismatch")
+
+// errRPCTimeout - rpc call did not complete within its deadline.
+var errRPCTimeout = errors.New("rpc call deadline exceeded")
+
+// errRPCCanceled - rpc stream was abandoned by the other end.
+var errRPCCanceled = errors.New("rpc stream canceled")
+
+// errRPCProtocol - rpc frame or message is malformed.
+var errRPCProtocol = errors.New("rpc protocol error")
+
+// errBitrot - block checksum mismatch.
+var errBitrot = errors.New("bitrot detected, block checksum mismatch")
+
 // errDataCorrupt - err data corrupt.
 var errDataCorrupt = errors.New("data likely corrupted, all blocks are zero in length")
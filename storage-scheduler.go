@@ -0,0 +1,272 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum concurrent operations per disk.
+	defaultDiskMaxIO = 16
+	// Waiting background operations are let through once in this
+	// many operations, so that foreground load does not starve them.
+	ioBackgroundShare = 8
+)
+
+// ioClass - priority class of disk operations.
+type ioClass int
+
+// I/O priority classes, foreground reads and writes go ahead of
+// healing and scanning.
+const (
+	ioForeground ioClass = iota
+	ioBackground
+	ioClasses
+)
+
+// String - returns name of the class.
+func (c ioClass) String() string {
+	if c == ioBackground {
+		return "background"
+	}
+	return "foreground"
+}
+
+// ioScheduler - bounds concurrent operations on a disk, operations
+// over the limit wait in a queue per class.
+type ioScheduler struct {
+	diskPath string
+	maxIO    int
+
+	mutex  *sync.Mutex
+	active int
+	queues [ioClasses][]chan struct{}
+	// Foreground operations let through while background waits.
+	passed int
+}
+
+// newIOScheduler - initialize scheduler of a disk.
+func newIOScheduler(diskPath string, maxIO int) *ioScheduler {
+	return &ioScheduler{
+		diskPath: diskPath,
+		maxIO:    maxIO,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// acquire - waits for a slot for an operation of class, the time
+// spent waiting is recorded.
+func (s *ioScheduler) acquire(class ioClass) {
+	start := time.Now()
+	s.mutex.Lock()
+	if s.active < s.maxIO {
+		s.active++
+		s.mutex.Unlock()
+		globalMetrics.diskIOWait.ObserveDuration(start, s.diskPath, class.String())
+		return
+	}
+	waiter := make(chan struct{})
+	s.queues[class] = append(s.queues[class], waiter)
+	s.mutex.Unlock()
+
+	// Slot is handed over by release.
+	<-waiter
+	globalMetrics.diskIOWait.ObserveDuration(start, s.diskPath, class.String())
+}
+
+// release - hands the slot over to the next waiting operation, if
+// any, frees it otherwise.
+func (s *ioScheduler) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	foreground := len(s.queues[ioForeground]) > 0
+	background := len(s.queues[ioBackground]) > 0
+	var class ioClass
+	switch {
+	case foreground && background && s.passed >= ioBackgroundShare:
+		class, s.passed = ioBackground, 0
+	case foreground:
+		class = ioForeground
+		if background {
+			s.passed++
+		}
+	case background:
+		class, s.passed = ioBackground, 0
+	default:
+		s.active--
+		return
+	}
+	waiter := s.queues[class][0]
+	s.queues[class] = s.queues[class][1:]
+	close(waiter)
+}
+
+// scheduledDisk - storage disk with its operations scheduled, reads
+// and writes of files are scheduled one call at a time.
+type scheduledDisk struct {
+	disk      StorageAPI
+	scheduler *ioScheduler
+	class     ioClass
+}
+
+// newScheduledDisk - schedules foreground operations of a disk.
+func newScheduledDisk(disk StorageAPI, maxIO int) StorageAPI {
+	return &scheduledDisk{
+		disk:      disk,
+		scheduler: newIOScheduler(getStorageDiskPath(disk), maxIO),
+		class:     ioForeground,
+	}
+}
+
+// withIOClass - returns a view of the disk scheduling its operations
+// in class, sharing the scheduler.
+func (d *scheduledDisk) withIOClass(class ioClass) StorageAPI {
+	return &scheduledDisk{
+		disk:      d.disk,
+		scheduler: d.scheduler,
+		class:     class,
+	}
+}
+
+// ioClassifier - disks which can schedule their operations in
+// another class.
+type ioClassifier interface {
+	withIOClass(class ioClass) StorageAPI
+}
+
+// withIOClass - returns a view of disk scheduling its operations in
+// class, disks which are not scheduled are returned as is.
+func withIOClass(disk StorageAPI, class ioClass) StorageAPI {
+	if classifier, ok := disk.(ioClassifier); ok {
+		return classifier.withIOClass(class)
+	}
+	return disk
+}
+
+// MakeVol - make a volume.
+func (d *scheduledDisk) MakeVol(volume string) error {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.MakeVol(volume)
+}
+
+// ListVols - list volumes.
+func (d *scheduledDisk) ListVols() ([]VolInfo, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.ListVols()
+}
+
+// StatVol - stat a volume.
+func (d *scheduledDisk) StatVol(volume string) (VolInfo, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.StatVol(volume)
+}
+
+// DeleteVol - delete a volume.
+func (d *scheduledDisk) DeleteVol(volume string) error {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.DeleteVol(volume)
+}
+
+// ListFiles - list files of a volume.
+func (d *scheduledDisk) ListFiles(volume, prefix, marker string, recursive bool, count int) ([]FileInfo, bool, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.ListFiles(volume, prefix, marker, recursive, count)
+}
+
+// scheduledReader - reader of a file on a scheduled disk.
+type scheduledReader struct {
+	io.ReadCloser
+	disk *scheduledDisk
+}
+
+// Read - schedules and reads.
+func (r scheduledReader) Read(p []byte) (int, error) {
+	r.disk.scheduler.acquire(r.disk.class)
+	defer r.disk.scheduler.release()
+	return r.ReadCloser.Read(p)
+}
+
+// ReadFile - reads a file.
+func (d *scheduledDisk) ReadFile(volume, path string, offset int64) (io.ReadCloser, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	reader, err := d.disk.ReadFile(volume, path, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scheduledReader{reader, d}, nil
+}
+
+// scheduledWriter - writer of a file on a scheduled disk.
+type scheduledWriter struct {
+	io.WriteCloser
+	disk *scheduledDisk
+}
+
+// Write - schedules and writes.
+func (w *scheduledWriter) Write(p []byte) (int, error) {
+	w.disk.scheduler.acquire(w.disk.class)
+	defer w.disk.scheduler.release()
+	return w.WriteCloser.Write(p)
+}
+
+// Close - schedules and closes, committing the file.
+func (w *scheduledWriter) Close() error {
+	w.disk.scheduler.acquire(w.disk.class)
+	defer w.disk.scheduler.release()
+	return w.WriteCloser.Close()
+}
+
+// CreateFile - creates a file.
+func (d *scheduledDisk) CreateFile(volume, path string) (io.WriteCloser, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	writer, err := d.disk.CreateFile(volume, path)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduledWriter{writer, d}, nil
+}
+
+// StatFile - stat a file.
+func (d *scheduledDisk) StatFile(volume, path string) (FileInfo, error) {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.StatFile(volume, path)
+}
+
+// DeleteFile - delete a file.
+func (d *scheduledDisk) DeleteFile(volume, path string) error {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.DeleteFile(volume, path)
+}
+
+// RenameFile - rename a file.
+func (d *scheduledDisk) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
+	d.scheduler.acquire(d.class)
+	defer d.scheduler.release()
+	return d.disk.RenameFile(srcVolume, srcPath, dstVolume, dstPath)
+}
@@ -0,0 +1,173 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// waitQueued - waits until count operations of class are queued.
+func waitQueued(t *testing.T, s *ioScheduler, class ioClass, count int) {
+	for i := 0; i < 1000; i++ {
+		s.mutex.Lock()
+		queued := len(s.queues[class])
+		s.mutex.Unlock()
+		if queued == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d %s operations queued", count, class)
+}
+
+// diskIOWaitCount - returns count of queue times recorded for class
+// on disk.
+func diskIOWaitCount(diskPath string, class ioClass) uint64 {
+	h := globalMetrics.diskIOWait
+	labels := formatLabels(h.labelNames, []string{diskPath, class.String()})
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if hist, ok := h.values[labels]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+// Tests concurrent operations are bounded and waiting operations are
+// let through by priority.
+func TestIOScheduler(t *testing.T) {
+	waitCount := diskIOWaitCount("priority-test-disk", ioBackground)
+	s := newIOScheduler("priority-test-disk", 2)
+	s.acquire(ioForeground)
+	s.acquire(ioBackground)
+
+	// Operations over the limit wait, foreground goes first.
+	order := make(chan ioClass, 2)
+	go func() {
+		s.acquire(ioBackground)
+		order <- ioBackground
+	}()
+	waitQueued(t, s, ioBackground, 1)
+	go func() {
+		s.acquire(ioForeground)
+		order <- ioForeground
+	}()
+	waitQueued(t, s, ioForeground, 1)
+
+	s.release()
+	if class := <-order; class != ioForeground {
+		t.Fatalf("expected foreground operation first, got %s", class)
+	}
+	s.release()
+	if class := <-order; class != ioBackground {
+		t.Fatalf("expected background operation next, got %s", class)
+	}
+	s.release()
+	s.release()
+	if s.active != 0 {
+		t.Fatalf("expected no active operations, got %d", s.active)
+	}
+
+	if count := diskIOWaitCount("priority-test-disk", ioBackground) - waitCount; count != 2 {
+		t.Fatalf("expected queue times of 2 operations recorded, got %d", count)
+	}
+}
+
+// Tests background operations are not starved by foreground load.
+func TestIOSchedulerBackgroundShare(t *testing.T) {
+	s := newIOScheduler("share-test-disk", 1)
+	s.acquire(ioForeground)
+
+	done := make(chan ioClass, ioBackgroundShare+2)
+	go func() {
+		s.acquire(ioBackground)
+		done <- ioBackground
+	}()
+	waitQueued(t, s, ioBackground, 1)
+	for i := 0; i <= ioBackgroundShare; i++ {
+		go func() {
+			s.acquire(ioForeground)
+			done <- ioForeground
+		}()
+	}
+	waitQueued(t, s, ioForeground, ioBackgroundShare+1)
+
+	for i := 0; i <= ioBackgroundShare; i++ {
+		s.release()
+		class := <-done
+		if i < ioBackgroundShare && class != ioForeground {
+			t.Fatalf("Operation %d: expected foreground, got %s", i+1, class)
+		}
+		if i == ioBackgroundShare && class != ioBackground {
+			t.Fatalf("Operation %d: expected background, got %s", i+1, class)
+		}
+	}
+}
+
+// Tests scheduled disks operate on the disk, and views of another
+// class share the scheduler and health of the disk.
+func TestScheduledDisk(t *testing.T) {
+	diskPath, err := ioutil.TempDir("", "minio-scheduler-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diskPath)
+	storage, err := newPosix(diskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := newTrackedDisk(newScheduledDisk(storage, defaultDiskMaxIO))
+	if path := getStorageDiskPath(disk); path != diskPath {
+		t.Fatalf("expected disk path %s, got %s", diskPath, path)
+	}
+
+	background := withIOClass(disk, ioBackground).(*trackedDisk)
+	if background.disk.(*scheduledDisk).class != ioBackground {
+		t.Fatal("expected background view of the disk")
+	}
+	if background.disk.(*scheduledDisk).scheduler != disk.disk.(*scheduledDisk).scheduler {
+		t.Fatal("expected scheduler shared with the disk")
+	}
+	if err = background.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = background.StatVol("missing"); err != errVolumeNotFound {
+		t.Fatalf("expected %s, got %v", errVolumeNotFound, err)
+	}
+	background.fault(errDiskNotFound)
+	if health := disk.Health(); health.TotalErrors != 1 {
+		t.Fatalf("expected health shared with the disk, got %+v", health)
+	}
+
+	// Files written are removed if writes fail.
+	writer, err := background.CreateFile("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = safeCloseAndRemove(writer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(diskPath + "/bucket/object"); !os.IsNotExist(err) {
+		t.Fatalf("expected file removed, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	router "github.com/gorilla/mux"
+)
+
+// STS API version supported.
+const stsAPIVersion = "2011-06-15"
+
+// stsAPIHandlers implements and provides http handlers for STS API.
+type stsAPIHandlers struct{}
+
+// registerSTSRouter - registers STS compatible APIs.
+func registerSTSRouter(mux *router.Router, sts stsAPIHandlers) {
+	// STS Router
+	stsRouter := mux.NewRoute().PathPrefix("/").Subrouter()
+
+	// AssumeRole
+	stsRouter.Methods("POST").Path("/").HeadersRegexp("Content-Type", "application/x-www-form-urlencoded*").HandlerFunc(sts.AssumeRoleHandler)
+}
+
+// STSCredentials - temporary credentials in AssumeRole response.
+type STSCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+// AssumedRoleUser - identifiers of the session in AssumeRole response.
+type AssumedRoleUser struct {
+	Arn           string
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+// AssumeRoleResponse - format for AssumeRole response.
+type AssumeRoleResponse struct {
+	XMLName xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse" json:"-"`
+
+	Result struct {
+		Credentials     STSCredentials
+		AssumedRoleUser AssumedRoleUser
+	} `xml:"AssumeRoleResult"`
+
+	ResponseMetadata struct {
+		RequestID string `xml:"RequestId"`
+	}
+}
+
+// generateAssumeRoleResponse - generates AssumeRole response for the
+// session credential.
+func generateAssumeRoleResponse(sessionCred sessionCredential, roleSessionName string) AssumeRoleResponse {
+	response := AssumeRoleResponse{}
+	response.Result.Credentials = STSCredentials{
+		AccessKeyID:     sessionCred.AccessKeyID,
+		SecretAccessKey: sessionCred.SecretAccessKey,
+		SessionToken:    sessionCred.SessionToken,
+		Expiration:      sessionCred.Expiration.Format(timeFormatAMZ),
+	}
+	response.Result.AssumedRoleUser = AssumedRoleUser{
+		Arn:           "arn:aws:sts:::assumed-role/" + sessionCred.ParentUser + "/" + roleSessionName,
+		AssumedRoleID: sessionCred.AccessKeyID + ":" + roleSessionName,
+	}
+	response.ResponseMetadata.RequestID = string(generateRequestID())
+	return response
+}
+
+// AssumeRoleHandler - POST / with Action=AssumeRole
+// ----------
+// Issues temporary credentials for the signing user, valid for
+// DurationSeconds and optionally restricted further by an inline
+// Policy. Session credentials are allowed at most what the signing
+// user is allowed.
+func (sts stsAPIHandlers) AssumeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	switch getRequestAuthType(r) {
+	default:
+		// For all unknown auth types return error.
+		writeErrorResponse(w, r, ErrAccessDenied, r.URL.Path)
+		return
+	case authTypePresigned, authTypeSigned:
+		// Clients sign for 'sts', some sign for 's3' as well.
+		if s3Error := isReqAuthenticated(r, serviceSTS, serviceS3); s3Error != ErrNone {
+			writeErrorResponse(w, r, s3Error, r.URL.Path)
+			return
+		}
+	}
+
+	// Session credentials cannot be used to issue new ones.
+	if getRequestSessionToken(r) != "" {
+		writeErrorResponse(w, r, ErrAccessDenied, r.URL.Path)
+		return
+	}
+	accessKey, s3Error := getRequestAccessKey(r)
+	if s3Error != ErrNone {
+		writeErrorResponse(w, r, s3Error, r.URL.Path)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		errorIf(err, "Unable to parse form values.", nil)
+		writeErrorResponse(w, r, ErrMalformedPOSTRequest, r.URL.Path)
+		return
+	}
+	if r.Form.Get("Action") != "AssumeRole" {
+		writeErrorResponse(w, r, ErrInvalidAction, r.URL.Path)
+		return
+	}
+	if r.Form.Get("Version") != stsAPIVersion {
+		writeErrorResponse(w, r, ErrInvalidParameterValue, r.URL.Path)
+		return
+	}
+
+	// Validate requested duration.
+	duration := defaultSessionDuration
+	if durationStr := r.Form.Get("DurationSeconds"); durationStr != "" {
+		durationSeconds, err := strconv.Atoi(durationStr)
+		if err != nil {
+			writeErrorResponse(w, r, ErrInvalidParameterValue, r.URL.Path)
+			return
+		}
+		duration = time.Duration(durationSeconds) * time.Second
+		if duration < minSessionDuration || duration > maxSessionDuration {
+			writeErrorResponse(w, r, ErrInvalidParameterValue, r.URL.Path)
+			return
+		}
+	}
+
+	// Validate inline session policy.
+	policy := r.Form.Get("Policy")
+	if policy != "" {
+		if _, err := parseIAMPolicy([]byte(policy)); err != nil {
+			errorIf(err, "Unable to parse session policy.", nil)
+			writeErrorResponse(w, r, ErrInvalidPolicyDocument, r.URL.Path)
+			return
+		}
+	}
+
+	sessionCred, err := newSessionCredential(accessKey, duration, policy)
+	if err != nil {
+		errorIf(err, "Unable to generate session credential.", nil)
+		writeErrorResponse(w, r, ErrInternalError, r.URL.Path)
+		return
+	}
+	response := generateAssumeRoleResponse(sessionCred, r.Form.Get("RoleSessionName"))
+	encodedSuccessResponse := encodeResponse(response)
+	// Write headers
+	setCommonHeaders(w)
+	// Write success response.
+	writeSuccessResponse(w, encodedSuccessResponse)
+}
@@ -0,0 +1,204 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// Session credentials duration limits.
+const (
+	minSessionDuration     = 15 * time.Minute
+	maxSessionDuration     = 12 * time.Hour
+	defaultSessionDuration = time.Hour
+)
+
+// Audience of session tokens, tokens of other audiences are not
+// session tokens.
+const sessionTokenAudience = "sts"
+
+// sessionCredential - temporary credential issued to a user, carries
+// the user it was issued for and an optional policy restricting the
+// rights of that user.
+type sessionCredential struct {
+	credential
+	SessionToken string
+	Expiration   time.Time
+	ParentUser   string
+	Policy       *BucketPolicy
+}
+
+// getSessionSecretKey - secret key of session credentials is derived
+// from the server secret key, so that session tokens do not carry
+// secrets and do not need to be saved.
+func getSessionSecretKey(accessKey string) string {
+	cred := serverConfig.GetCredential()
+	sum := sumHMAC([]byte(cred.SecretAccessKey), []byte("sts/"+accessKey))
+	return base64.StdEncoding.EncodeToString(sum)[:minioSecretID]
+}
+
+// getSessionTokenKey - key session tokens are signed with, derived
+// from the server secret key. Web tokens are signed with the secret
+// key itself, so neither is accepted in place of the other.
+func getSessionTokenKey() []byte {
+	cred := serverConfig.GetCredential()
+	return sumHMAC([]byte(cred.SecretAccessKey), []byte("sts/session-token"))
+}
+
+// sessionTokenKeyFunc - verifies signing method and returns the key
+// session tokens are signed with.
+func sessionTokenKeyFunc(token *jwtgo.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwtgo.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return getSessionTokenKey(), nil
+}
+
+// newSessionCredential - generates session credential for the parent
+// user valid for duration, policy is optional.
+func newSessionCredential(parentUser string, duration time.Duration, policy string) (sessionCredential, error) {
+	accessKeyID, err := genAccessKeyID()
+	if err != nil {
+		return sessionCredential{}, err
+	}
+	accessKey := string(accessKeyID)
+	expiration := time.Now().UTC().Add(duration)
+
+	token := jwtgo.New(jwtgo.SigningMethodHS512)
+	token.Claims["aud"] = sessionTokenAudience
+	token.Claims["accessKey"] = accessKey
+	token.Claims["parent"] = parentUser
+	token.Claims["exp"] = expiration.Unix()
+	token.Claims["iat"] = time.Now().UTC().Unix()
+	if policy != "" {
+		token.Claims["policy"] = policy
+	}
+	sessionToken, err := token.SignedString(getSessionTokenKey())
+	if err != nil {
+		return sessionCredential{}, err
+	}
+	return sessionCredential{
+		credential: credential{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: getSessionSecretKey(accessKey),
+		},
+		SessionToken: sessionToken,
+		Expiration:   time.Unix(expiration.Unix(), 0).UTC(),
+		ParentUser:   parentUser,
+	}, nil
+}
+
+// getSessionCredential - validates session token issued for the
+// access key and returns the session credential.
+func getSessionCredential(accessKey, sessionToken string) (sessionCredential, APIErrorCode) {
+	token, e := jwtgo.Parse(sessionToken, sessionTokenKeyFunc)
+	if e != nil {
+		if ve, ok := e.(*jwtgo.ValidationError); ok && ve.Errors&jwtgo.ValidationErrorExpired != 0 {
+			return sessionCredential{}, ErrExpiredToken
+		}
+		return sessionCredential{}, ErrInvalidToken
+	}
+	if !token.Valid || toString(token.Claims["aud"]) != sessionTokenAudience ||
+		toString(token.Claims["accessKey"]) != accessKey {
+		return sessionCredential{}, ErrInvalidToken
+	}
+	// Tokens without expiry are never issued.
+	expiration, ok := token.Claims["exp"].(float64)
+	if !ok {
+		return sessionCredential{}, ErrInvalidToken
+	}
+	// Session credentials are valid as long as their parent user is.
+	parentUser := toString(token.Claims["parent"])
+	if _, ok = getCredential(parentUser); !ok {
+		return sessionCredential{}, ErrInvalidToken
+	}
+	sessionCred := sessionCredential{
+		credential: credential{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: getSessionSecretKey(accessKey),
+		},
+		SessionToken: sessionToken,
+		Expiration:   time.Unix(int64(expiration), 0).UTC(),
+		ParentUser:   parentUser,
+	}
+	if policy := toString(token.Claims["policy"]); policy != "" {
+		sessionPolicy, err := parseIAMPolicy([]byte(policy))
+		if err != nil {
+			return sessionCredential{}, ErrInvalidToken
+		}
+		sessionCred.Policy = &sessionPolicy
+	}
+	return sessionCred, ErrNone
+}
+
+// IsAllowed - action should be allowed both for the parent user and
+// by the session policy.
+func (s sessionCredential) IsAllowed(action, bucket, object string, conditions map[string]string) bool {
+	if !isIAMActionAllowed(s.ParentUser, action, bucket, object, conditions) {
+		return false
+	}
+	if s.Policy == nil {
+		return true
+	}
+	resource := getIAMResource(bucket, object)
+	return iamPolicyEvalStatements(action, resource, conditions, s.Policy.Statements)
+}
+
+// getRequestSessionToken - session token is either a header for
+// signed requests or a query param for presigned requests.
+func getRequestSessionToken(r *http.Request) string {
+	if sessionToken := r.Header.Get("X-Amz-Security-Token"); sessionToken != "" {
+		return sessionToken
+	}
+	return r.URL.Query().Get("X-Amz-Security-Token")
+}
+
+// getRequestCredential - get credential for the access key, session
+// token if present is validated for the access key.
+func getRequestCredential(accessKey, sessionToken string) (credential, APIErrorCode) {
+	if sessionToken == "" {
+		cred, ok := getCredential(accessKey)
+		if !ok {
+			return credential{}, ErrInvalidAccessKeyID
+		}
+		return cred, ErrNone
+	}
+	sessionCred, s3Error := getSessionCredential(accessKey, sessionToken)
+	if s3Error != ErrNone {
+		return credential{}, s3Error
+	}
+	return sessionCred.credential, ErrNone
+}
+
+// isRequestActionAllowed - verifies if the access key is allowed to
+// perform the action, session credentials are verified against both
+// their parent user and the session policy.
+func isRequestActionAllowed(accessKey, sessionToken, action, bucket, object string, conditions map[string]string) bool {
+	if sessionToken == "" {
+		return isIAMActionAllowed(accessKey, action, bucket, object, conditions)
+	}
+	sessionCred, s3Error := getSessionCredential(accessKey, sessionToken)
+	if s3Error != ErrNone {
+		return false
+	}
+	return sessionCred.IsAllowed(action, bucket, object, conditions)
+}
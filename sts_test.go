@@ -0,0 +1,168 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// Tests validation of session tokens.
+func TestGetSessionCredential(t *testing.T) {
+	savedConfigPath := customConfigPath
+	rootPath := initTestIAMConfig(t)
+	defer setGlobalConfigPath(savedConfigPath)
+	defer os.RemoveAll(rootPath)
+
+	rootAccessKey := serverConfig.GetCredential().AccessKeyID
+	sessionCred, err := newSessionCredential(rootAccessKey, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredCred, err := newSessionCredential(rootAccessKey, -time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetUser("departed", iamUser{SecretKey: "departed-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	orphanCred, err := newSessionCredential("departed", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.DeleteUser("departed"); err != nil {
+		t.Fatal(err)
+	}
+	// Token with session claims signed with the key of web tokens.
+	webToken := jwtgo.New(jwtgo.SigningMethodHS512)
+	webToken.Claims["aud"] = sessionTokenAudience
+	webToken.Claims["accessKey"] = sessionCred.AccessKeyID
+	webToken.Claims["parent"] = rootAccessKey
+	webToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	webSessionToken, err := webToken.SignedString([]byte(initJWT().SecretAccessKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Token signed with the session token key, of another audience.
+	otherToken := jwtgo.New(jwtgo.SigningMethodHS512)
+	otherToken.Claims["accessKey"] = sessionCred.AccessKeyID
+	otherToken.Claims["parent"] = rootAccessKey
+	otherToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	otherSessionToken, err := otherToken.SignedString(getSessionTokenKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		accessKey    string
+		sessionToken string
+		s3Error      APIErrorCode
+	}{
+		// Test case - 1.
+		// Valid session token.
+		{sessionCred.AccessKeyID, sessionCred.SessionToken, ErrNone},
+		// Test case - 2.
+		// Session token issued for another access key.
+		{expiredCred.AccessKeyID, sessionCred.SessionToken, ErrInvalidToken},
+		// Test case - 3.
+		// Expired session token.
+		{expiredCred.AccessKeyID, expiredCred.SessionToken, ErrExpiredToken},
+		// Test case - 4.
+		// Malformed session token.
+		{sessionCred.AccessKeyID, "invalid-token", ErrInvalidToken},
+		// Test case - 5.
+		// Session token of a removed user.
+		{orphanCred.AccessKeyID, orphanCred.SessionToken, ErrInvalidToken},
+		// Test case - 6.
+		// Token signed with the key of web tokens.
+		{sessionCred.AccessKeyID, webSessionToken, ErrInvalidToken},
+		// Test case - 7.
+		// Token without the session token audience.
+		{sessionCred.AccessKeyID, otherSessionToken, ErrInvalidToken},
+	}
+	// Session tokens are not valid web tokens.
+	if _, err = jwtgo.Parse(sessionCred.SessionToken, initJWT().keyFunc); err == nil {
+		t.Fatal("Expected session token to be rejected as a web token")
+	}
+	for i, testCase := range testCases {
+		cred, s3Error := getRequestCredential(testCase.accessKey, testCase.sessionToken)
+		if s3Error != testCase.s3Error {
+			t.Errorf("Test %d: Expected error code %d, got %d", i+1, testCase.s3Error, s3Error)
+			continue
+		}
+		if s3Error == ErrNone && cred != sessionCred.credential {
+			t.Errorf("Test %d: Expected credential %v, got %v", i+1, sessionCred.credential, cred)
+		}
+	}
+}
+
+// Tests session credentials are restricted by both the parent user
+// and the session policy.
+func TestSessionCredentialAllowed(t *testing.T) {
+	savedConfigPath := customConfigPath
+	rootPath := initTestIAMConfig(t)
+	defer setGlobalConfigPath(savedConfigPath)
+	defer os.RemoveAll(rootPath)
+
+	readPhotos, err := parseIAMPolicy([]byte(`{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::photos/*"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetPolicy("read-photos", readPhotos); err != nil {
+		t.Fatal(err)
+	}
+	if err = iamConfig.SetUser("reader", iamUser{SecretKey: "reader-secret", Policies: []string{"read-photos"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rootAccessKey := serverConfig.GetCredential().AccessKeyID
+	sessionPolicy := `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": ["arn:aws:s3:::photos/*"]}]}`
+	rootSession, err := newSessionCredential(rootAccessKey, time.Hour, sessionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := newSessionCredential("reader", time.Hour, sessionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		sessionCred sessionCredential
+		action      string
+		object      string
+		allowed     bool
+	}{
+		// Test case - 1 - 3.
+		// Server credential restricted by the session policy.
+		{rootSession, "s3:GetObject", "a.jpg", true},
+		{rootSession, "s3:PutObject", "a.jpg", true},
+		{rootSession, "s3:DeleteObject", "a.jpg", false},
+		// Test case - 4 - 5.
+		// Session policy cannot grant more than the user is allowed.
+		{readerSession, "s3:GetObject", "a.jpg", true},
+		{readerSession, "s3:PutObject", "a.jpg", false},
+	}
+	for i, testCase := range testCases {
+		allowed := isRequestActionAllowed(testCase.sessionCred.AccessKeyID, testCase.sessionCred.SessionToken, testCase.action, "photos", testCase.object, nil)
+		if allowed != testCase.allowed {
+			t.Errorf("Test %d: Expected %t, got %t", i+1, testCase.allowed, allowed)
+		}
+	}
+}
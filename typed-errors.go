@@ -29,3 +29,6 @@ var errSignatureMismatch = errors.New("Signature does not match")
 
 // used when token used for authentication by the MinioBrowser has expired
 var errInvalidToken = errors.New("Invalid token")
+
+// used when user policies do not allow the requested action.
+var errAccessDenied = errors.New("Access denied")
@@ -37,17 +37,32 @@ import (
 // isJWTReqAuthenticated validates if any incoming request to be a
 // valid JWT authenticated request.
 func isJWTReqAuthenticated(req *http.Request) bool {
+	_, ok := getJWTReqUser(req)
+	return ok
+}
+
+// getJWTReqUser validates incoming JWT authenticated request and
+// returns the user it was authenticated for.
+func getJWTReqUser(req *http.Request) (string, bool) {
 	jwt := initJWT()
-	token, e := jwtgo.ParseFromRequest(req, func(token *jwtgo.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwtgo.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwt.SecretAccessKey), nil
-	})
+	token, e := jwtgo.ParseFromRequest(req, jwt.keyFunc)
 	if e != nil {
-		return false
+		return "", false
 	}
-	return token.Valid
+	return getTokenUser(token)
+}
+
+// isWebActionAllowed validates incoming JWT authenticated request and
+// verifies if its user is allowed to perform the action.
+func isWebActionAllowed(req *http.Request, action, bucket, object string, conditions map[string]string) *json2.Error {
+	userName, ok := getJWTReqUser(req)
+	if !ok {
+		return &json2.Error{Message: "Unauthorized request"}
+	}
+	if !isIAMActionAllowed(userName, action, bucket, object, conditions) {
+		return &json2.Error{Message: "Access denied"}
+	}
+	return nil
 }
 
 // WebGenericArgs - empty struct for calls that don't accept arguments
@@ -105,8 +120,8 @@ type MakeBucketArgs struct {
 
 // MakeBucket - make a bucket.
 func (web *webAPIHandlers) MakeBucket(r *http.Request, args *MakeBucketArgs, reply *WebGenericRep) error {
-	if !isJWTReqAuthenticated(r) {
-		return &json2.Error{Message: "Unauthorized request"}
+	if err := isWebActionAllowed(r, "s3:CreateBucket", args.BucketName, "", nil); err != nil {
+		return err
 	}
 	reply.UIVersion = miniobrowser.UIVersion
 	if err := web.ObjectAPI.MakeBucket(args.BucketName); err != nil {
@@ -135,8 +150,8 @@ type WebBucketInfo struct {
 
 // ListBuckets - list buckets api.
 func (web *webAPIHandlers) ListBuckets(r *http.Request, args *WebGenericArgs, reply *ListBucketsRep) error {
-	if !isJWTReqAuthenticated(r) {
-		return &json2.Error{Message: "Unauthorized request"}
+	if err := isWebActionAllowed(r, "s3:ListAllMyBuckets", "", "", nil); err != nil {
+		return err
 	}
 	buckets, err := web.ObjectAPI.ListBuckets()
 	if err != nil {
@@ -184,8 +199,9 @@ type WebObjectInfo struct {
 // ListObjects - list objects api.
 func (web *webAPIHandlers) ListObjects(r *http.Request, args *ListObjectsArgs, reply *ListObjectsRep) error {
 	marker := ""
-	if !isJWTReqAuthenticated(r) {
-		return &json2.Error{Message: "Unauthorized request"}
+	conditions := map[string]string{"prefix": args.Prefix}
+	if err := isWebActionAllowed(r, "s3:ListBucket", args.BucketName, "", conditions); err != nil {
+		return err
 	}
 	for {
 		lo, err := web.ObjectAPI.ListObjects(args.BucketName, args.Prefix, marker, "/", 1000)
@@ -222,8 +238,8 @@ type RemoveObjectArgs struct {
 
 // RemoveObject - removes an object.
 func (web *webAPIHandlers) RemoveObject(r *http.Request, args *RemoveObjectArgs, reply *WebGenericRep) error {
-	if !isJWTReqAuthenticated(r) {
-		return &json2.Error{Message: "Unauthorized request"}
+	if err := isWebActionAllowed(r, "s3:DeleteObject", args.BucketName, args.ObjectName, nil); err != nil {
+		return err
 	}
 	reply.UIVersion = miniobrowser.UIVersion
 	if err := web.ObjectAPI.DeleteObject(args.BucketName, args.ObjectName); err != nil {
@@ -291,9 +307,15 @@ type SetAuthReply struct {
 
 // SetAuth - Set accessKey and secretKey credentials.
 func (web *webAPIHandlers) SetAuth(r *http.Request, args *SetAuthArgs, reply *SetAuthReply) error {
-	if !isJWTReqAuthenticated(r) {
+	userName, ok := getJWTReqUser(r)
+	if !ok {
 		return &json2.Error{Message: "Unauthorized request"}
 	}
+	// Only the server credential can be changed here, users are
+	// managed through the admin API.
+	if userName != serverConfig.GetCredential().AccessKeyID {
+		return &json2.Error{Message: "Access denied"}
+	}
 	if !isValidAccessKey.MatchString(args.AccessKey) {
 		return &json2.Error{Message: "Invalid Access Key"}
 	}
@@ -328,10 +350,15 @@ type GetAuthReply struct {
 
 // GetAuth - return accessKey and secretKey credentials.
 func (web *webAPIHandlers) GetAuth(r *http.Request, args *WebGenericArgs, reply *GetAuthReply) error {
-	if !isJWTReqAuthenticated(r) {
+	userName, ok := getJWTReqUser(r)
+	if !ok {
+		return &json2.Error{Message: "Unauthorized request"}
+	}
+	// Reply with credentials of the logged in user.
+	creds, ok := getCredential(userName)
+	if !ok {
 		return &json2.Error{Message: "Unauthorized request"}
 	}
-	creds := serverConfig.GetCredential()
 	reply.AccessKey = creds.AccessKeyID
 	reply.SecretKey = creds.SecretAccessKey
 	reply.UIVersion = miniobrowser.UIVersion
@@ -340,13 +367,18 @@ func (web *webAPIHandlers) GetAuth(r *http.Request, args *WebGenericArgs, reply
 
 // Upload - file upload handler.
 func (web *webAPIHandlers) Upload(w http.ResponseWriter, r *http.Request) {
-	if !isJWTReqAuthenticated(r) {
+	userName, ok := getJWTReqUser(r)
+	if !ok {
 		writeWebErrorResponse(w, errInvalidToken)
 		return
 	}
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
 	object := vars["object"]
+	if !isIAMActionAllowed(userName, "s3:PutObject", bucket, object, nil) {
+		writeWebErrorResponse(w, errAccessDenied)
+		return
+	}
 	if _, err := web.ObjectAPI.PutObject(bucket, object, -1, r.Body, nil); err != nil {
 		writeWebErrorResponse(w, err)
 	}
@@ -360,16 +392,20 @@ func (web *webAPIHandlers) Download(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 
 	jwt := initJWT()
-	jwttoken, e := jwtgo.Parse(token, func(token *jwtgo.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwtgo.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwt.SecretAccessKey), nil
-	})
-	if e != nil || !jwttoken.Valid {
+	jwttoken, e := jwtgo.Parse(token, jwt.keyFunc)
+	if e != nil {
+		writeWebErrorResponse(w, errInvalidToken)
+		return
+	}
+	userName, ok := getTokenUser(jwttoken)
+	if !ok {
 		writeWebErrorResponse(w, errInvalidToken)
 		return
 	}
+	if !isIAMActionAllowed(userName, "s3:GetObject", bucket, object, nil) {
+		writeWebErrorResponse(w, errAccessDenied)
+		return
+	}
 	// Add content disposition.
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(object)))
 
@@ -392,6 +428,13 @@ func writeWebErrorResponse(w http.ResponseWriter, err error) {
 		w.Write([]byte(err.Error()))
 		return
 	}
+	// Handle access denied by user policies as a special case.
+	if err == errAccessDenied {
+		apiErr := getAPIError(ErrAccessDenied)
+		w.WriteHeader(apiErr.HTTPStatusCode)
+		w.Write([]byte(apiErr.Description))
+		return
+	}
 	// Convert error type to api error code.
 	var apiErrCode APIErrorCode
 	switch err.(type) {
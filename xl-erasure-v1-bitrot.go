@@ -0,0 +1,142 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	slashpath "path"
+
+	"github.com/Sirupsen/logrus"
+	fastSha256 "github.com/minio/minio/pkg/crypto/sha256"
+	fastSha512 "github.com/minio/minio/pkg/crypto/sha512"
+)
+
+// Supported bitrot hash algorithms.
+const (
+	bitrotSHA256 = "sha256"
+	bitrotSHA512 = "sha512"
+	bitrotCRC32C = "crc32c"
+
+	// Default bitrot hash algorithm.
+	defaultBitrotAlgorithm = bitrotSHA256
+)
+
+// errBitrotAlgorithm - unsupported bitrot hash algorithm.
+var errBitrotAlgorithm = errors.New("Unsupported bitrot hash algorithm")
+
+// isValidBitrotAlgorithm - verifies if algorithm is supported.
+func isValidBitrotAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case bitrotSHA256, bitrotSHA512, bitrotCRC32C:
+		return true
+	}
+	return false
+}
+
+// newBitrotHash - initialize a new hash for algorithm.
+func newBitrotHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case bitrotSHA512:
+		return fastSha512.New()
+	case bitrotCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	return fastSha256.New()
+}
+
+// bitrotSum - returns hex encoded checksum of a block.
+func bitrotSum(algorithm string, block []byte) string {
+	h := newBitrotHash(algorithm)
+	h.Write(block)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getBitrotAlgorithm - returns bitrot algorithm from server config.
+func getBitrotAlgorithm() string {
+	if serverConfig == nil {
+		return defaultBitrotAlgorithm
+	}
+	if algorithm := serverConfig.GetErasure().BitrotAlgorithm; algorithm != "" {
+		return algorithm
+	}
+	return defaultBitrotAlgorithm
+}
+
+// verifyBlock - verifies checksum of a block of a shard, files written
+// without checksums are always verified.
+func (m xlMetaV1) verifyBlock(shard, block int, data []byte) bool {
+	checksum := m.Erasure.Checksum
+	if checksum.Algorithm == "" || shard >= len(checksum.shards) {
+		return true
+	}
+	if block >= len(checksum.shards[shard]) {
+		return false
+	}
+	return bitrotSum(checksum.Algorithm, data) == checksum.shards[shard][block]
+}
+
+// reportBitrot - logs and records a corrupted block.
+func reportBitrot(disk StorageAPI, volume, path string, shard, block int) {
+	log.WithFields(logrus.Fields{
+		"volume":     volume,
+		"path":       path,
+		"diskIndex":  shard,
+		"blockIndex": block,
+	}).Errorf("%s", errBitrot)
+	globalMetrics.bitrotErrors.Inc(getStorageDiskPath(disk))
+}
+
+// verifyShards - reads every shard on online disks and verifies all
+// their block checksums. Returns shards which are corrupted or could
+// not be read.
+func (xl XL) verifyShards(volume, path string, onlineDisks []StorageAPI, metadata xlMetaV1) []bool {
+	corrupted := make([]bool, len(onlineDisks))
+	if metadata.Erasure.Checksum.Algorithm == "" {
+		return corrupted
+	}
+	for index, disk := range onlineDisks {
+		if disk == nil {
+			continue
+		}
+		erasurePart := slashpath.Join(path, metadata.shardFile(index))
+		reader, err := disk.ReadFile(volume, erasurePart, 0)
+		if err != nil {
+			corrupted[index] = true
+			continue
+		}
+		totalLeft := metadata.Stat.Size
+		for block := 0; totalLeft > 0; block++ {
+			curBlockSize := metadata.Erasure.BlockSize
+			if totalLeft < curBlockSize {
+				curBlockSize = totalLeft
+			}
+			data := make([]byte, getEncodedBlockLen(curBlockSize, metadata.Erasure.DataBlocks))
+			if _, err = io.ReadFull(reader, data); err != nil || !metadata.verifyBlock(index, block, data) {
+				reportBitrot(disk, volume, path, index, block)
+				corrupted[index] = true
+				break
+			}
+			totalLeft -= curBlockSize
+		}
+		reader.Close()
+	}
+	return corrupted
+}
@@ -0,0 +1,174 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests bitrot checksums of supported algorithms.
+func TestBitrotSum(t *testing.T) {
+	testCases := []struct {
+		algorithm string
+		valid     bool
+		sumLen    int
+	}{
+		{bitrotSHA256, true, 64},
+		{bitrotSHA512, true, 128},
+		{bitrotCRC32C, true, 8},
+		{"md5", false, 0},
+		{"", false, 0},
+	}
+	data := []byte("hello world")
+	for i, testCase := range testCases {
+		if valid := isValidBitrotAlgorithm(testCase.algorithm); valid != testCase.valid {
+			t.Errorf("Test %d: expected valid %t, got %t", i+1, testCase.valid, valid)
+		}
+		if !testCase.valid {
+			continue
+		}
+		sum := bitrotSum(testCase.algorithm, data)
+		if len(sum) != testCase.sumLen {
+			t.Errorf("Test %d: expected checksum of length %d, got %s", i+1, testCase.sumLen, sum)
+		}
+		if sum == bitrotSum(testCase.algorithm, []byte("hello World")) {
+			t.Errorf("Test %d: expected checksums of different blocks to differ", i+1)
+		}
+
+		var metadata xlMetaV1
+		metadata.Erasure.Checksum.Algorithm = testCase.algorithm
+		metadata.Erasure.Checksum.shards = [][]string{{sum}}
+		if !metadata.verifyBlock(0, 0, data) {
+			t.Errorf("Test %d: expected block to verify", i+1)
+		}
+		if metadata.verifyBlock(0, 0, []byte("hello World")) {
+			t.Errorf("Test %d: expected corrupted block to fail verification", i+1)
+		}
+		if metadata.verifyBlock(0, 1, data) {
+			t.Errorf("Test %d: expected unknown block to fail verification", i+1)
+		}
+	}
+
+	// Files written without checksums are always verified.
+	var metadata xlMetaV1
+	if !metadata.verifyBlock(0, 0, data) {
+		t.Error("Expected block without checksum to verify")
+	}
+}
+
+// Tests corrupted shards are reconstructed on reads and healed.
+func TestBitrotReadFile(t *testing.T) {
+	initNSLock()
+
+	var disks []string
+	for i := 0; i < 4; i++ {
+		disk, err := ioutil.TempDir("", "minio-bitrot-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+	objAPI, err := newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl, _ := getXLStorage(objAPI)
+
+	// Object spanning more than one erasure block.
+	data := make([]byte, erasureBlockSize+1024*1024)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	if err = objAPI.MakeBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = objAPI.PutObject("bucket", "object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every disk saves checksums of its own shard only.
+	partsMetadata, _ := xl.getPartsMetadata("bucket", "object")
+	for index, diskMetadata := range partsMetadata {
+		if blocks := diskMetadata.Erasure.Checksum.Blocks; len(blocks) != 2 {
+			t.Fatalf("Disk %d: expected checksums of 2 blocks, got %v", index, blocks)
+		}
+		if index > 0 && diskMetadata.Erasure.Checksum.Blocks[0] == partsMetadata[0].Erasure.Checksum.Blocks[0] {
+			t.Fatalf("Disk %d: expected checksums of its own shard", index)
+		}
+	}
+
+	// Flip a byte of the second block of a data shard.
+	shardPath := filepath.Join(disks[0], "bucket", "object", "file.0")
+	shard, err := ioutil.ReadFile(shardPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard[len(shard)-1] ^= 0xff
+	if err = ioutil.WriteFile(shardPath, shard, 0644); err != nil {
+		t.Fatal(err)
+	}
+	onlineDisks, metadata, _, err := xl.listOnlineDisks("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupted := xl.verifyShards("bucket", "object", onlineDisks, metadata); !corrupted[0] {
+		t.Fatal("Expected corrupted shard to be detected")
+	}
+
+	reader, err := objAPI.GetObject("bucket", "object", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Expected corrupted shard to be reconstructed")
+	}
+
+	// Corrupted shard is healed in background after the read.
+	for i := 0; ; i++ {
+		corrupted := xl.verifyShards("bucket", "object", onlineDisks, metadata)
+		if !corrupted[0] {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Expected corrupted shard to be healed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Checksums of a lost shard are recreated by healing.
+	if err = os.Remove(filepath.Join(disks[1], "bucket", "object", xlMetaV1File)); err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.healFile("bucket", "object"); err != nil {
+		t.Fatal(err)
+	}
+	healedMetadata, errs := xl.getPartsMetadata("bucket", "object")
+	if errs[1] != nil || !reflect.DeepEqual(healedMetadata[1].Erasure.Checksum.Blocks, partsMetadata[1].Erasure.Checksum.Blocks) {
+		t.Fatalf("expected healed checksums %v, got %v, err %v", partsMetadata[1].Erasure.Checksum.Blocks, healedMetadata[1].Erasure.Checksum.Blocks, errs[1])
+	}
+}
@@ -0,0 +1,446 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	slashpath "path"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skyrings/skyring-common/tools/uuid"
+)
+
+const (
+	// Temporary area of the writes in progress, inside minio meta
+	// volume of every disk. Not a valid bucket name, hence never
+	// clashes with multipart uploads saved in minio meta volume.
+	tmpMetaPrefix = ".tmp"
+	// Target of a write, saved in its temporary area once the write
+	// starts being committed on the disk.
+	tmpOpFile = "op.json"
+	// Marker of a write committed on quorum disks.
+	tmpCommitFile = "commit"
+	// Files replaced by a write are kept here until it is committed.
+	tmpBackupDir = "old"
+)
+
+// tmpOp - target of a write, used to roll back writes which were
+// interrupted while committing.
+type tmpOp struct {
+	Volume string   `json:"volume"`
+	Path   string   `json:"path"`
+	Files  []string `json:"files"`
+	// Sources of the files in minio meta volume, parallel to files.
+	// Files without a source are in the temporary area.
+	Sources []string `json:"sources,omitempty"`
+	// Files of the old version not replaced by the write, removed
+	// once it is committed. Deletes set the files they remove, the
+	// stale shard files are added on commit.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// source - returns path of the file at index in minio meta volume.
+func (op tmpOp) source(tmpPath string, index int) string {
+	if index < len(op.Sources) && op.Sources[index] != "" {
+		return op.Sources[index]
+	}
+	return slashpath.Join(tmpPath, op.Files[index])
+}
+
+// newTmpPath - returns a new temporary area for a write.
+func newTmpPath() (string, error) {
+	id, err := uuid.New()
+	if err != nil {
+		return "", err
+	}
+	return slashpath.Join(tmpMetaPrefix, id.String()), nil
+}
+
+// isTmpPath - verifies if a file of minio meta volume belongs to the
+// temporary area of a write.
+func isTmpPath(volume, path string) bool {
+	return volume == minioMetaBucket && strings.HasPrefix(path, tmpMetaPrefix+"/")
+}
+
+// saveTmpOp - saves target of the write in its temporary area.
+func saveTmpOp(disk StorageAPI, tmpPath string, op tmpOp) error {
+	opBytes, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	writer, err := disk.CreateFile(minioMetaBucket, slashpath.Join(tmpPath, tmpOpFile))
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(opBytes); err != nil {
+		safeCloseAndRemove(writer)
+		return err
+	}
+	return writer.Close()
+}
+
+// loadTmpOp - reads target of the write from its temporary area.
+func loadTmpOp(disk StorageAPI, tmpPath string) (tmpOp, error) {
+	reader, err := disk.ReadFile(minioMetaBucket, slashpath.Join(tmpPath, tmpOpFile), 0)
+	if err != nil {
+		return tmpOp{}, err
+	}
+	defer reader.Close()
+	var op tmpOp
+	if err = json.NewDecoder(reader).Decode(&op); err != nil {
+		return tmpOp{}, err
+	}
+	return op, nil
+}
+
+// commitDisk - moves the files of the write into place on the disk,
+// files being replaced or removed are moved to the temporary area
+// first. Files are moved in order, the metadata file is expected last.
+func commitDisk(disk StorageAPI, tmpPath string, op tmpOp) error {
+	if err := saveTmpOp(disk, tmpPath, op); err != nil {
+		return err
+	}
+	names := append(append([]string{}, op.Remove...), op.Files...)
+	for _, name := range names {
+		filePath := slashpath.Join(op.Path, name)
+		if _, err := disk.StatFile(op.Volume, filePath); err != nil {
+			if err == errFileNotFound {
+				continue
+			}
+			return err
+		}
+		backupPath := slashpath.Join(tmpPath, tmpBackupDir, name)
+		if err := disk.RenameFile(op.Volume, filePath, minioMetaBucket, backupPath); err != nil {
+			return err
+		}
+	}
+	for index, name := range op.Files {
+		if err := disk.RenameFile(minioMetaBucket, op.source(tmpPath, index), op.Volume, slashpath.Join(op.Path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackDisk - restores the files replaced by a partially committed
+// write on the disk, including the files it removed. Files which did
+// not exist before the write are removed, once they were moved into
+// place. Only disks on which the commit started are to be rolled back.
+func rollbackDisk(disk StorageAPI, tmpPath string, op tmpOp) error {
+	// Metadata file is restored first, the file is then seen as
+	// being of the old version while its parts are being restored.
+	for index := len(op.Files) - 1; index >= 0; index-- {
+		name := op.Files[index]
+		filePath := slashpath.Join(op.Path, name)
+		source := op.source(tmpPath, index)
+		// New file is still at its source, the file in place is the
+		// old one if any.
+		moved := true
+		if _, err := disk.StatFile(minioMetaBucket, source); err == nil {
+			moved = false
+		}
+		// Files moved from outside the temporary area are moved back
+		// to their source, others are removed.
+		if moved && index < len(op.Sources) && op.Sources[index] != "" {
+			if _, err := disk.StatFile(op.Volume, filePath); err == nil {
+				if err = disk.RenameFile(op.Volume, filePath, minioMetaBucket, source); err != nil {
+					return err
+				}
+			}
+			moved = false
+		}
+		backupPath := slashpath.Join(tmpPath, tmpBackupDir, name)
+		if _, err := disk.StatFile(minioMetaBucket, backupPath); err == nil {
+			if err = disk.RenameFile(minioMetaBucket, backupPath, op.Volume, filePath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !moved {
+			continue
+		}
+		if err := disk.DeleteFile(op.Volume, filePath); err != nil && err != errFileNotFound {
+			return err
+		}
+	}
+	// Removed files are restored last, once the old metadata file is.
+	for _, name := range op.Remove {
+		backupPath := slashpath.Join(tmpPath, tmpBackupDir, name)
+		if _, err := disk.StatFile(minioMetaBucket, backupPath); err != nil {
+			continue
+		}
+		if err := disk.RenameFile(minioMetaBucket, backupPath, op.Volume, slashpath.Join(op.Path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeTmpPath - removes the temporary area of a write from the disk.
+// Commit marker is removed last, so that a write is known to be
+// committed as long as some of its temporary area is left.
+func purgeTmpPath(disk StorageAPI, tmpPath string) error {
+	commitPath := slashpath.Join(tmpPath, tmpCommitFile)
+	committed := false
+	marker := ""
+	for {
+		filesInfo, eof, err := disk.ListFiles(minioMetaBucket, tmpPath+"/", marker, true, 1000)
+		if err != nil {
+			return err
+		}
+		for _, fileInfo := range filesInfo {
+			if fileInfo.Name == commitPath {
+				committed = true
+				continue
+			}
+			if err = disk.DeleteFile(minioMetaBucket, fileInfo.Name); err != nil && err != errFileNotFound {
+				return err
+			}
+		}
+		if eof || len(filesInfo) == 0 {
+			break
+		}
+		marker = filesInfo[len(filesInfo)-1].Name
+	}
+	if !committed {
+		return nil
+	}
+	return disk.DeleteFile(minioMetaBucket, commitPath)
+}
+
+// markCommitted - saves the commit marker of the write on the disk.
+func markCommitted(disk StorageAPI, tmpPath string) error {
+	writer, err := disk.CreateFile(minioMetaBucket, slashpath.Join(tmpPath, tmpCommitFile))
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// purgeTmpOp - removes the temporary area of the write of the file
+// from all the disks, failures are logged and left for recovery on
+// restart.
+func (xl XL) purgeTmpOp(volume, path, tmpPath string) {
+	xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		err := purgeTmpPath(disk, tmpPath)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"tmpPath":   tmpPath,
+				"diskIndex": index,
+			}).Errorf("Purging temporary data failed with %s", err)
+		}
+		return err
+	})
+}
+
+// unlockAfterDiskOps - releases the write lock of the file once the
+// operations left in progress on it are done on all the disks.
+func (xl XL) unlockAfterDiskOps(disks []StorageAPI, volume, path string, dLock *distLock) {
+	ns := nsMutex
+	go func() {
+		xl.fanOutOnDisks(disks, volume, path, 0, func(index int, disk StorageAPI) error {
+			return nil
+		})
+		ns.Unlock(volume, path, dLock)
+	}()
+}
+
+// commitTmpOp - commits the write of the file on all the disks which
+// have it, ops are indexed by disk and nil for disks the write failed
+// on. Ops may be set by operations still in progress on their disk.
+// The write succeeds only if it is committed on write quorum disks.
+// Disks which fail to commit are rolled back to the old version and
+// healed later, all the disks are rolled back without write quorum,
+// or once the namespace lock is lost. Shard files of the old version
+// are removed.
+//
+// Returns once write quorum disks are done, the file is write locked
+// until the commit is done on all the disks.
+func (xl XL) commitTmpOp(volume, path, tmpPath string, ops []*tmpOp) error {
+	dLock := nsMutex.Lock(volume, path)
+	defer xl.unlockAfterDiskOps(xl.disks(), volume, path, dLock)
+
+	// Results of the commit on every disk, set by the commit of
+	// the disk even once it is left in progress.
+	commitErrs := make([]error, len(xl.storageDisks))
+	errs := xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) (err error) {
+		defer func() {
+			commitErrs[index] = err
+		}()
+		op := ops[index]
+		if op == nil {
+			return errDiskNotFound
+		}
+		if isLockLost(dLock) {
+			return errLockLost
+		}
+		// Disks without metadata have no shard files to remove.
+		oldMetadata, _ := readMetadata(disk, volume, path)
+		op.Remove = append(op.Remove, staleShardFiles(oldMetadata, index, op.Files)...)
+		err = commitDisk(disk, tmpPath, *op)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume":    op.Volume,
+				"path":      op.Path,
+				"diskIndex": index,
+			}).Errorf("Committing file failed with %s", err)
+		}
+		return err
+	})
+	commitCount := 0
+	for _, err := range errs {
+		if err == nil {
+			commitCount++
+		}
+	}
+	// Writes which lost their lock are rolled back, another node may
+	// be writing the same file.
+	lockLost := isLockLost(dLock)
+	committed := commitCount >= xl.writeQuorum && !lockLost
+	if committed {
+		xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+			if commitErrs[index] != nil {
+				return commitErrs[index]
+			}
+			return markCommitted(disk, tmpPath)
+		})
+	}
+
+	xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		op := ops[index]
+		if op == nil || (committed && commitErrs[index] == nil) {
+			return errDiskSkipped
+		}
+		err := rollbackDisk(disk, tmpPath, *op)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume":    op.Volume,
+				"path":      op.Path,
+				"diskIndex": index,
+			}).Errorf("Rolling back file failed with %s", err)
+		}
+		return err
+	})
+	xl.purgeTmpOp(volume, path, tmpPath)
+
+	if lockLost {
+		return errLockLost
+	}
+	if !committed {
+		return errWriteQuorum
+	}
+	return nil
+}
+
+// isLockLost - returns true if the lock on other nodes returned by the
+// namespace lock is lost, locks held locally only are never lost.
+func isLockLost(dLock *distLock) bool {
+	if dLock == nil {
+		return false
+	}
+	select {
+	case <-dLock.lostCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// recoverTmpOps - recovers the writes interrupted by a restart, writes
+// committed on quorum disks are kept and the others are rolled back.
+// Temporary areas modified after the server booted belong to writes of
+// other servers in progress and are left alone.
+func (xl XL) recoverTmpOps() {
+	recent := make(map[string]bool)
+	var tmpPaths []string
+	disks := xl.disks()
+	for _, disk := range disks {
+		if disk == nil {
+			continue
+		}
+		marker := ""
+		for {
+			filesInfo, eof, err := disk.ListFiles(minioMetaBucket, tmpMetaPrefix+"/", marker, true, 1000)
+			if err != nil {
+				break
+			}
+			for _, fileInfo := range filesInfo {
+				parts := strings.SplitN(fileInfo.Name, "/", 3)
+				if len(parts) < 3 {
+					continue
+				}
+				tmpPath := slashpath.Join(parts[0], parts[1])
+				if _, ok := recent[tmpPath]; !ok {
+					tmpPaths = append(tmpPaths, tmpPath)
+				}
+				recent[tmpPath] = recent[tmpPath] || fileInfo.ModTime.After(globalBootTime)
+			}
+			if eof || len(filesInfo) == 0 {
+				break
+			}
+			marker = filesInfo[len(filesInfo)-1].Name
+		}
+	}
+
+	for _, tmpPath := range tmpPaths {
+		if recent[tmpPath] {
+			continue
+		}
+		committed := false
+		var op *tmpOp
+		for _, disk := range disks {
+			if disk == nil {
+				continue
+			}
+			if _, err := disk.StatFile(minioMetaBucket, slashpath.Join(tmpPath, tmpCommitFile)); err == nil {
+				committed = true
+			}
+			if diskOp, err := loadTmpOp(disk, tmpPath); err == nil && op == nil {
+				op = &diskOp
+			}
+		}
+		log.WithFields(logrus.Fields{
+			"tmpPath":   tmpPath,
+			"committed": committed,
+		}).Warn("Recovering interrupted write")
+		if op == nil {
+			xl.purgeTmpOp(minioMetaBucket, tmpPath, tmpPath)
+			continue
+		}
+		dLock := nsMutex.Lock(op.Volume, op.Path)
+		if !committed {
+			xl.fanOutDisks(op.Volume, op.Path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+				// Commit did not start on disks without the target.
+				diskOp, err := loadTmpOp(disk, tmpPath)
+				if err != nil {
+					return err
+				}
+				return rollbackDisk(disk, tmpPath, diskOp)
+			})
+		}
+		xl.purgeTmpOp(op.Volume, op.Path, tmpPath)
+		xl.unlockAfterDiskOps(xl.disks(), op.Volume, op.Path, dLock)
+	}
+}
+
+// recoverXLTmpOps - recovers interrupted writes on all the sets.
+func recoverXLTmpOps(sets []*XL) {
+	for _, xl := range sets {
+		xl.recoverTmpOps()
+	}
+}
@@ -0,0 +1,405 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// commitFailDisk - fails moving new files of writes into volume.
+type commitFailDisk struct {
+	StorageAPI
+	volume string
+}
+
+func (d commitFailDisk) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
+	if dstVolume == d.volume && path.Base(path.Dir(srcPath)) != tmpBackupDir {
+		return errors.New("rename failed")
+	}
+	return d.StorageAPI.RenameFile(srcVolume, srcPath, dstVolume, dstPath)
+}
+
+// writeTestFile - writes data to path of volume on XL.
+func writeTestFile(xl *XL, volume, path string, data []byte) error {
+	writer, err := xl.CreateFile(volume, path)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(data); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// readTestFile - reads path of volume on XL.
+func readTestFile(xl *XL, volume, path string) ([]byte, error) {
+	reader, err := xl.ReadFile(volume, path, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// listTmpFiles - lists temporary files left on the disks of XL, once
+// the operations left in progress on the disks are done.
+func listTmpFiles(t *testing.T, xl *XL) []string {
+	waitDiskOps(xl)
+	var names []string
+	for _, disk := range xl.storageDisks {
+		filesInfo, _, err := disk.ListFiles(minioMetaBucket, tmpMetaPrefix+"/", "", true, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fileInfo := range filesInfo {
+			names = append(names, fileInfo.Name)
+		}
+	}
+	return names
+}
+
+// Tests writes are committed on quorum disks and rolled back otherwise,
+// leaving no temporary files behind.
+func TestXLCommitQuorum(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	oldData := bytes.Repeat([]byte("a"), 16*1024)
+	if err = writeTestFile(xl, "bucket", "object", oldData); err != nil {
+		t.Fatal(err)
+	}
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+
+	// Two failed disks out of four lose write quorum, the old version
+	// is kept on all the disks.
+	storageDisks := append([]StorageAPI{}, xl.storageDisks...)
+	for index := 0; index < 2; index++ {
+		xl.storageDisks[index] = commitFailDisk{storageDisks[index], "bucket"}
+	}
+	newData := bytes.Repeat([]byte("b"), 32*1024)
+	if err = writeTestFile(xl, "bucket", "object", newData); err != errWriteQuorum {
+		t.Fatalf("expected %s, got %v", errWriteQuorum, err)
+	}
+	copy(xl.storageDisks, storageDisks)
+	partsMetadata, errs := xl.getPartsMetadata("bucket", "object")
+	for index, metadata := range partsMetadata {
+		if errs[index] != nil || metadata.Stat.Size != int64(len(oldData)) {
+			t.Fatalf("Disk %d: expected old version, got %+v, err %v", index, metadata.Stat, errs[index])
+		}
+	}
+	if data, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, oldData) {
+		t.Fatalf("expected old data, got %d bytes, err %v", len(data), err)
+	}
+
+	// One failed disk keeps write quorum, the disk is left with the
+	// old version.
+	xl.storageDisks[0] = commitFailDisk{storageDisks[0], "bucket"}
+	if err = writeTestFile(xl, "bucket", "object", newData); err != nil {
+		t.Fatal(err)
+	}
+	copy(xl.storageDisks, storageDisks)
+	partsMetadata, errs = xl.getPartsMetadata("bucket", "object")
+	if errs[0] != nil || partsMetadata[0].Stat.Size != int64(len(oldData)) {
+		t.Fatalf("expected old version on failed disk, got %+v, err %v", partsMetadata[0].Stat, errs[0])
+	}
+	if data, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, newData) {
+		t.Fatalf("expected new data, got %d bytes, err %v", len(data), err)
+	}
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+}
+
+// listDiskFiles - lists files of volume on every disk of XL, once the
+// operations left in progress on the disks are done.
+func listDiskFiles(t *testing.T, xl *XL, volume string) [][]string {
+	waitDiskOps(xl)
+	names := make([][]string, len(xl.storageDisks))
+	for index, disk := range xl.storageDisks {
+		if disk == nil {
+			continue
+		}
+		filesInfo, _, err := disk.ListFiles(volume, "", "", true, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fileInfo := range filesInfo {
+			names[index] = append(names[index], fileInfo.Name)
+		}
+	}
+	return names
+}
+
+// Tests deletes are committed like writes, the deleted version is kept
+// on quorum disks without the shard files when disks are offline and
+// the old version is restored without write quorum.
+func TestXLDeleteFileCommit(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("a"), 16*1024)
+	if err = writeTestFile(xl, "bucket", "object", data); err != nil {
+		t.Fatal(err)
+	}
+
+	// File is removed from all the disks once they are all online.
+	if err = xl.DeleteFile("bucket", "object"); err != nil {
+		t.Fatal(err)
+	}
+	for index, names := range listDiskFiles(t, xl, "bucket") {
+		if len(names) != 0 {
+			t.Fatalf("Disk %d: expected no files, found %v", index, names)
+		}
+	}
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+
+	// An offline disk and two failed disks out of four lose write
+	// quorum, the old version is restored on the online disks.
+	if err = writeTestFile(xl, "bucket", "object", data); err != nil {
+		t.Fatal(err)
+	}
+	storageDisks := append([]StorageAPI{}, xl.storageDisks...)
+	xl.storageDisks[0] = nil
+	for index := 1; index < 3; index++ {
+		xl.storageDisks[index] = commitFailDisk{storageDisks[index], "bucket"}
+	}
+	if err = xl.DeleteFile("bucket", "object"); err != errWriteQuorum {
+		t.Fatalf("expected %s, got %v", errWriteQuorum, err)
+	}
+	copy(xl.storageDisks[1:], storageDisks[1:])
+	if got, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected old data, got %d bytes, err %v", len(got), err)
+	}
+
+	// Online disks keep the deleted version without the shard files,
+	// the offline disk is left with the old version.
+	if err = xl.DeleteFile("bucket", "object"); err != nil {
+		t.Fatal(err)
+	}
+	copy(xl.storageDisks, storageDisks)
+	partsMetadata, errs := xl.getPartsMetadata("bucket", "object")
+	for index, metadata := range partsMetadata {
+		if errs[index] != nil || metadata.Stat.Deleted != (index != 0) {
+			t.Fatalf("Disk %d: unexpected version %+v, err %v", index, metadata.Stat, errs[index])
+		}
+	}
+	for index, names := range listDiskFiles(t, xl, "bucket") {
+		if index != 0 && (len(names) != 1 || names[0] != path.Join("object", xlMetaV1File)) {
+			t.Fatalf("Disk %d: expected only metadata, found %v", index, names)
+		}
+	}
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+}
+
+// lockLossDisk - loses the namespace lock when new files of writes are
+// moved into volume.
+type lockLossDisk struct {
+	StorageAPI
+	volume string
+	lose   func()
+}
+
+func (d lockLossDisk) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
+	if dstVolume == d.volume && path.Base(path.Dir(srcPath)) != tmpBackupDir {
+		d.lose()
+	}
+	return d.StorageAPI.RenameFile(srcVolume, srcPath, dstVolume, dstPath)
+}
+
+// Tests writes whose namespace lock is lost while committing are rolled
+// back on all the disks.
+func TestXLCommitLockLost(t *testing.T) {
+	defer initTestRPCConfig()()
+	initNSLock()
+	servers := []*lockServer{newLockServer(), newLockServer(), newLockServer()}
+	for _, server := range servers {
+		nsMutex.lockers = append(nsMutex.lockers, localLocker{server})
+	}
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	oldData := bytes.Repeat([]byte("a"), 16*1024)
+	if err = writeTestFile(xl, "bucket", "object", oldData); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock expires on the lock servers once the first disk commits.
+	loseOnce := &sync.Once{}
+	lose := func() {
+		loseOnce.Do(func() {
+			nsMutex.mutex.Lock()
+			dLock := nsMutex.lockMap[nsParam{"bucket", "object"}].distLocks[0]
+			nsMutex.mutex.Unlock()
+			for _, server := range servers {
+				server.expireStaleLocks(-time.Hour)
+			}
+			dLock.refreshLease()
+		})
+	}
+	storageDisks := append([]StorageAPI{}, xl.storageDisks...)
+	for index := range xl.storageDisks {
+		xl.storageDisks[index] = lockLossDisk{storageDisks[index], "bucket", lose}
+	}
+	newData := bytes.Repeat([]byte("b"), 32*1024)
+	if err = writeTestFile(xl, "bucket", "object", newData); err != errLockLost {
+		t.Fatalf("expected %s, got %v", errLockLost, err)
+	}
+	copy(xl.storageDisks, storageDisks)
+	if data, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, oldData) {
+		t.Fatalf("expected old data, got %d bytes, err %v", len(data), err)
+	}
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+}
+
+// Tests writes interrupted while committing are rolled back, unless
+// committed on quorum disks.
+func TestXLRecoverTmpOps(t *testing.T) {
+	initNSLock()
+	savedBootTime := globalBootTime
+	defer func() {
+		globalBootTime = savedBootTime
+	}()
+
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	oldData := bytes.Repeat([]byte("a"), 16*1024)
+	if err = writeTestFile(xl, "bucket", "object", oldData); err != nil {
+		t.Fatal(err)
+	}
+
+	// interruptWrite - saves a new version of the object in the
+	// temporary area of all the disks and commits it on commitDisks.
+	interruptWrite := func(commitDisks int, committed bool) string {
+		tmpPath, err := newTmpPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		partsMetadata, _ := xl.getPartsMetadata("bucket", "object")
+		metadata := partsMetadata[0]
+		metadata.Stat.Version++
+		metadata.Stat.Size = 1
+		for index, disk := range xl.storageDisks {
+			names := []string{fmt.Sprintf("file.%d", index), xlMetaV1File}
+			for _, name := range names {
+				writer, err := disk.CreateFile(minioMetaBucket, tmpPath+"/"+name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if name == xlMetaV1File {
+					err = metadata.Write(writer)
+				} else {
+					_, err = io.WriteString(writer, "b")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				writer.Close()
+			}
+			if index >= commitDisks {
+				continue
+			}
+			if err = commitDisk(disk, tmpPath, tmpOp{Volume: "bucket", Path: "object", Files: names}); err != nil {
+				t.Fatal(err)
+			}
+			if committed {
+				if err = markCommitted(disk, tmpPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return tmpPath
+	}
+
+	// Writes in progress are left alone.
+	interruptWrite(2, false)
+	xl.recoverTmpOps()
+	if names := listTmpFiles(t, xl); len(names) == 0 {
+		t.Fatal("expected temporary files of write in progress")
+	}
+
+	// Interrupted write is rolled back to the old version.
+	globalBootTime = time.Now().UTC().Add(time.Hour)
+	xl.recoverTmpOps()
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+	partsMetadata, errs := xl.getPartsMetadata("bucket", "object")
+	for index, metadata := range partsMetadata {
+		if errs[index] != nil || metadata.Stat.Size != int64(len(oldData)) {
+			t.Fatalf("Disk %d: expected old version, got %+v, err %v", index, metadata.Stat, errs[index])
+		}
+	}
+	if data, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, oldData) {
+		t.Fatalf("expected old data, got %d bytes, err %v", len(data), err)
+	}
+
+	// Committed write is kept.
+	interruptWrite(3, true)
+	xl.recoverTmpOps()
+	if names := listTmpFiles(t, xl); len(names) != 0 {
+		t.Fatalf("expected no temporary files, found %v", names)
+	}
+	partsMetadata, errs = xl.getPartsMetadata("bucket", "object")
+	for index, metadata := range partsMetadata[:3] {
+		if errs[index] != nil || metadata.Stat.Size != 1 {
+			t.Fatalf("Disk %d: expected new version, got %+v, err %v", index, metadata.Stat, errs[index])
+		}
+	}
+}
@@ -20,10 +20,170 @@ import (
 	"errors"
 	slashpath "path"
 	"path/filepath"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 )
 
+// diskResult - result of an operation on a disk.
+type diskResult struct {
+	index int
+	err   error
+}
+
+// isErrIgnored - verifies if error is one of the ignored errors.
+func isErrIgnored(err error, ignoredErrs []error) bool {
+	for _, ignoredErr := range ignoredErrs {
+		if err == ignoredErr {
+			return true
+		}
+	}
+	return false
+}
+
+// diskOpKey - disk and the file an operation is issued on.
+type diskOpKey struct {
+	index  int
+	volume string
+	path   string
+}
+
+// pendingDiskOps - operations left running on disks by fan-outs which
+// returned early, indexed by disk and the file they operate on.
+type pendingDiskOps struct {
+	mutex *sync.Mutex
+	ops   map[diskOpKey]chan struct{}
+}
+
+// newPendingDiskOps - initializes pending operations of disks.
+func newPendingDiskOps() *pendingDiskOps {
+	return &pendingDiskOps{
+		mutex: &sync.Mutex{},
+		ops:   make(map[diskOpKey]chan struct{}),
+	}
+}
+
+// wait - returns channel closed once the pending operation of key is
+// done, nil if none.
+func (p *pendingDiskOps) wait(key diskOpKey) chan struct{} {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.ops[key]
+}
+
+// add - sets done as the pending operation of key, operations issued
+// later on the same disk and file wait for it.
+func (p *pendingDiskOps) add(key diskOpKey, done chan struct{}) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.ops[key] = done
+	go func() {
+		<-done
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.ops[key] == done {
+			delete(p.ops, key)
+		}
+	}()
+}
+
+// fanOutDisks - issues op on all storage disks concurrently, returns
+// errors indexed by disk. A quorum of zero waits for all the disks,
+// otherwise returns early once quorum disks succeeded or once quorum
+// can no longer be met. Disks still in progress are reported as
+// errDiskPending. Errors in ignoredErrs are counted as successes,
+// disks op returns errDiskSkipped for take no part in the quorum.
+//
+// Operations left in progress keep running, operations issued later
+// on the same disk for the same volume and path wait for them so that
+// callers never act on a file still being written. Operations left in
+// progress must only touch state of their own disk, callers leave it
+// alone until a later fan-out on the same file.
+func (xl XL) fanOutDisks(volume, path string, quorum int, op func(index int, disk StorageAPI) error, ignoredErrs ...error) []error {
+	return xl.fanOutOnDisks(xl.disks(), volume, path, quorum, op, ignoredErrs...)
+}
+
+// fanOutOnDisks - fanOutDisks on disks given by position, positions
+// without a disk fail with errDiskNotFound right away without waiting
+// for the operations pending on them.
+func (xl XL) fanOutOnDisks(disks []StorageAPI, volume, path string, quorum int, op func(index int, disk StorageAPI) error, ignoredErrs ...error) []error {
+	results := make(chan diskResult, len(disks))
+	done := make([]chan struct{}, len(disks))
+	for index, disk := range disks {
+		done[index] = make(chan struct{})
+		// Positions without an identified disk are offline.
+		if disk == nil {
+			close(done[index])
+			results <- diskResult{index, errDiskNotFound}
+			continue
+		}
+		key := diskOpKey{index, volume, path}
+		go func(index int, disk StorageAPI, pending chan struct{}) {
+			if pending != nil {
+				<-pending
+			}
+			err := op(index, disk)
+			close(done[index])
+			results <- diskResult{index, err}
+		}(index, disk, xl.pending.wait(key))
+	}
+
+	errs := make([]error, len(disks))
+	for index := range errs {
+		errs[index] = errDiskPending
+	}
+	successCount, failedCount, skippedCount := 0, 0, 0
+	for range disks {
+		result := <-results
+		errs[result.index] = result.err
+		if result.err == errDiskSkipped {
+			skippedCount++
+		} else if result.err == nil || isErrIgnored(result.err, ignoredErrs) {
+			successCount++
+		} else {
+			failedCount++
+		}
+		if quorum > 0 && (successCount >= quorum || failedCount > len(disks)-skippedCount-quorum) {
+			break
+		}
+	}
+	for index, err := range errs {
+		if err == errDiskPending {
+			xl.pending.add(diskOpKey{index, volume, path}, done[index])
+		}
+	}
+	return errs
+}
+
+// countDiskErrs - returns count of disks which failed, disks skipped
+// or still in progress are not counted.
+func countDiskErrs(errs []error) int {
+	count := 0
+	for _, err := range errs {
+		if err != nil && err != errDiskSkipped && err != errDiskPending {
+			count++
+		}
+	}
+	return count
+}
+
+// firstDiskErr - returns the first error of errs in disk order, if
+// any. Disks skipped or still in progress are not errors.
+func firstDiskErr(errs []error) error {
+	for _, err := range errs {
+		if err != nil && err != errDiskSkipped && err != errDiskPending {
+			return err
+		}
+	}
+	return nil
+}
+
 // Get the highest integer from a given integer slice.
 func highestInt(intSlice []int64) (highestInteger int64) {
 	highestInteger = int64(0)
@@ -48,45 +208,114 @@ func listFileVersions(partsMetadata []xlMetaV1, errs []error) (versions []int64)
 	return versions
 }
 
+// metadataKey - fields of the metadata which disks have to agree on
+// for a version of a file.
+type metadataKey struct {
+	version      int64
+	modTime      int64
+	size         int64
+	dataBlocks   int
+	parityBlocks int
+	blockSize    int64
+	algorithm    string
+	inline       bool
+	parts        int
+}
+
+// getMetadataKey - returns the fields of metadata disks agree on.
+func getMetadataKey(metadata xlMetaV1) metadataKey {
+	return metadataKey{
+		version:      metadata.Stat.Version,
+		modTime:      metadata.Stat.ModTime.UnixNano(),
+		size:         metadata.Stat.Size,
+		dataBlocks:   metadata.Erasure.DataBlocks,
+		parityBlocks: metadata.Erasure.ParityBlocks,
+		blockSize:    metadata.Erasure.BlockSize,
+		algorithm:    metadata.Erasure.Checksum.Algorithm,
+		inline:       metadata.Erasure.Inline,
+		parts:        len(metadata.Parts),
+	}
+}
+
+// reduceMetadata - returns the metadata agreed on by most disks, the
+// disks agreeing on it and their count. Ties go to the higher version,
+// then to the later modTime. Version numbers alone are not trusted,
+// partial writes may leave a higher version on a few disks.
+func reduceMetadata(partsMetadata []xlMetaV1, errs []error) (mdata xlMetaV1, agreed []bool, count int) {
+	keys := make([]metadataKey, len(partsMetadata))
+	counts := make(map[metadataKey]int)
+	for index, metadata := range partsMetadata {
+		if errs[index] != nil {
+			continue
+		}
+		keys[index] = getMetadataKey(metadata)
+		counts[keys[index]]++
+	}
+	// Disks are visited in order, ties left are won by the first disk.
+	var best metadataKey
+	for index, key := range keys {
+		if errs[index] != nil || counts[key] < count {
+			continue
+		}
+		if counts[key] == count && (key.version < best.version ||
+			key.version == best.version && key.modTime <= best.modTime) {
+			continue
+		}
+		best, count = key, counts[key]
+	}
+	agreed = make([]bool, len(partsMetadata))
+	found := false
+	for index, metadata := range partsMetadata {
+		if errs[index] != nil || keys[index] != best {
+			continue
+		}
+		if !found {
+			mdata = metadata
+			found = true
+		}
+		agreed[index] = true
+	}
+	if found {
+		mdata.gatherChecksums(partsMetadata, agreed)
+	}
+	return mdata, agreed, count
+}
+
 // Returns slice of online disks needed.
 // - slice returing readable disks.
 // - xlMetaV1
 // - bool value indicating if healing is needed.
 // - error if any.
 func (xl XL) listOnlineDisks(volume, path string) (onlineDisks []StorageAPI, mdata xlMetaV1, heal bool, err error) {
+	onlineDisks, _, mdata, heal, err = xl.listOnlineParts(volume, path)
+	return onlineDisks, mdata, heal, err
+}
+
+// listOnlineParts - same as listOnlineDisks, additionally returns the
+// metadata read from every disk, needed for files saved inline.
+func (xl XL) listOnlineParts(volume, path string) (onlineDisks []StorageAPI, partsMetadata []xlMetaV1, mdata xlMetaV1, heal bool, err error) {
 	partsMetadata, errs := xl.getPartsMetadata(volume, path)
 	notFoundCount := 0
-	// FIXME: take care of the situation when a disk has failed and been removed
-	// by looking at the error returned from the fs layer. fs-layer will have
-	// to return an error indicating that the disk is not available and should be
-	// different from ErrNotExist.
+	// Failed or removed disks return errDiskNotFound, only disks
+	// which are available and do not have the file are counted here.
 	for _, err := range errs {
 		if err == errFileNotFound {
 			notFoundCount++
 			// If we have errors with file not found greater than allowed read
 			// quorum we return err as errFileNotFound.
 			if notFoundCount > len(xl.storageDisks)-xl.readQuorum {
-				return nil, xlMetaV1{}, false, errFileNotFound
+				return nil, nil, xlMetaV1{}, false, errFileNotFound
 			}
 		}
 	}
-	highestVersion := int64(0)
-	onlineDisks = make([]StorageAPI, len(xl.storageDisks))
-	// List all the file versions from partsMetadata list.
-	versions := listFileVersions(partsMetadata, errs)
-
-	// Get highest file version.
-	highestVersion = highestInt(versions)
-
-	// Pick online disks with version set to highestVersion.
-	onlineDiskCount := 0
-	for index, version := range versions {
-		if version == highestVersion {
-			mdata = partsMetadata[index]
-			onlineDisks[index] = xl.storageDisks[index]
-			onlineDiskCount++
-		} else {
-			onlineDisks[index] = nil
+	// Pick online disks agreeing on the metadata with most disks,
+	// disks holding other metadata are stale.
+	mdata, agreed, onlineDiskCount := reduceMetadata(partsMetadata, errs)
+	disks := xl.disks()
+	onlineDisks = make([]StorageAPI, len(disks))
+	for index, diskAgreed := range agreed {
+		if diskAgreed {
+			onlineDisks[index] = disks[index]
 		}
 	}
 
@@ -99,46 +328,49 @@ func (xl XL) listOnlineDisks(volume, path string) (onlineDisks []StorageAPI, mda
 		heal = true
 		// Verify if online disks count are lesser than readQuorum
 		// threshold, return an error if yes.
-		if onlineDiskCount < xl.readQuorum {
+		if onlineDiskCount < xl.readQuorum || onlineDiskCount < mdata.Erasure.DataBlocks {
 			log.WithFields(logrus.Fields{
 				"volume":          volume,
 				"path":            path,
 				"onlineDiskCount": onlineDiskCount,
 				"readQuorumCount": xl.readQuorum,
 			}).Errorf("%s", errReadQuorum)
-			return nil, xlMetaV1{}, false, errReadQuorum
+			return nil, nil, xlMetaV1{}, false, errReadQuorum
 		}
 	}
-	return onlineDisks, mdata, heal, nil
+	return onlineDisks, partsMetadata, mdata, heal, nil
 }
 
 // Get file.json metadata as a map slice.
 // Returns error slice indicating the failed metadata reads.
 // Read lockNS() should be done by caller.
 func (xl XL) getPartsMetadata(volume, path string) ([]xlMetaV1, []error) {
-	errs := make([]error, len(xl.storageDisks))
 	metadataArray := make([]xlMetaV1, len(xl.storageDisks))
-	xlMetaV1FilePath := slashpath.Join(path, xlMetaV1File)
-	for index, disk := range xl.storageDisks {
-		offset := int64(0)
-		metadataReader, err := disk.ReadFile(volume, xlMetaV1FilePath, offset)
-		if err != nil {
-			errs[index] = err
-			continue
-		}
-		defer metadataReader.Close()
-
-		metadata, err := xlMetaV1Decode(metadataReader)
+	// Not found votes of all the disks are needed, wait for all.
+	errs := xl.fanOutDisks(volume, path, 0, func(index int, disk StorageAPI) error {
+		metadata, err := readMetadata(disk, volume, path)
 		if err != nil {
-			// Unable to parse file.json, set error.
-			errs[index] = err
-			continue
+			return err
 		}
 		metadataArray[index] = metadata
-	}
+		return nil
+	})
 	return metadataArray, errs
 }
 
+// readMetadata - reads file.json of the file on disk.
+func readMetadata(disk StorageAPI, volume, path string) (xlMetaV1, error) {
+	offset := int64(0)
+	metadataReader, err := disk.ReadFile(volume, slashpath.Join(path, xlMetaV1File), offset)
+	if err != nil {
+		return xlMetaV1{}, err
+	}
+	defer metadataReader.Close()
+
+	// Unable to parse file.json, set error.
+	return xlMetaV1Decode(metadataReader)
+}
+
 // Writes/Updates `file.json` for given file. updateParts carries
 // index of disks where `file.json` needs to be updated.
 //
@@ -147,28 +379,21 @@ func (xl XL) getPartsMetadata(volume, path string) ([]xlMetaV1, []error) {
 // Write lockNS() should be done by caller.
 func (xl XL) setPartsMetadata(volume, path string, metadata xlMetaV1, updateParts []bool) []error {
 	xlMetaV1FilePath := filepath.Join(path, xlMetaV1File)
-	errs := make([]error, len(xl.storageDisks))
-
-	for index := range updateParts {
-		errs[index] = errors.New("Metadata not updated")
-	}
-
-	for index, shouldUpdate := range updateParts {
-		if !shouldUpdate {
-			continue
+	errNotUpdated := errors.New("Metadata not updated")
+	// Metadata is healed in place under the lock of the caller,
+	// wait for all the disks.
+	return xl.fanOutDisks(volume, path, 0, func(index int, disk StorageAPI) error {
+		if !updateParts[index] {
+			return errNotUpdated
 		}
-		writer, err := xl.storageDisks[index].CreateFile(volume, xlMetaV1FilePath)
-		errs[index] = err
+		writer, err := disk.CreateFile(volume, xlMetaV1FilePath)
 		if err != nil {
-			continue
+			return err
 		}
-		err = metadata.Write(writer)
-		if err != nil {
-			errs[index] = err
+		if err = metadata.diskMetadata(index).Write(writer); err != nil {
 			safeCloseAndRemove(writer)
-			continue
+			return err
 		}
-		writer.Close()
-	}
-	return errs
+		return writer.Close()
+	})
 }
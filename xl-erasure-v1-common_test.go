@@ -0,0 +1,372 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// latencyDisk - delays every volume operation of the disk, simulates
+// a networked disk.
+type latencyDisk struct {
+	StorageAPI
+	latency time.Duration
+}
+
+func (d latencyDisk) MakeVol(volume string) error {
+	time.Sleep(d.latency)
+	return d.StorageAPI.MakeVol(volume)
+}
+
+func (d latencyDisk) StatVol(volume string) (VolInfo, error) {
+	time.Sleep(d.latency)
+	return d.StorageAPI.StatVol(volume)
+}
+
+func (d latencyDisk) DeleteVol(volume string) error {
+	time.Sleep(d.latency)
+	return d.StorageAPI.DeleteVol(volume)
+}
+
+// newLatencyXL - initializes XL on 16 posix disks with latency.
+func newLatencyXL(b *testing.B, latency time.Duration) (*XL, func()) {
+	var disks []string
+	for i := 0; i < maxErasureBlocks; i++ {
+		disk, err := ioutil.TempDir("", "minio-fanout-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		disks = append(disks, disk)
+	}
+	storage, err := newXL(disks...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	xl := storage.(*XL)
+	for index, disk := range xl.storageDisks {
+		xl.storageDisks[index] = latencyDisk{disk, latency}
+	}
+	return xl, func() {
+		for _, disk := range disks {
+			os.RemoveAll(disk)
+		}
+	}
+}
+
+// waitDiskOps - waits for the operations left in progress on the disks
+// of xl by fan-outs which returned early.
+func waitDiskOps(xl *XL) {
+	for {
+		var pending []chan struct{}
+		xl.pending.mutex.Lock()
+		for _, done := range xl.pending.ops {
+			pending = append(pending, done)
+		}
+		xl.pending.mutex.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for _, done := range pending {
+			<-done
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Tests fan-out returns errors by disk and returns early once quorum
+// is met or lost, operations issued later on disks still in progress
+// wait for them.
+func TestFanOutDisks(t *testing.T) {
+	errFaulty := errors.New("faulty disk")
+	xl := XL{storageDisks: make([]StorageAPI, 4), pending: newPendingDiskOps(), placement: &diskPlacement{}}
+	for index := range xl.storageDisks {
+		xl.storageDisks[index] = latencyDisk{}
+	}
+
+	// All disks are waited for with quorum of zero.
+	errs := xl.fanOutDisks("bucket", "object", 0, func(index int, disk StorageAPI) error {
+		if index%2 == 0 {
+			return errFaulty
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	for index, err := range errs {
+		if (index%2 == 0) != (err == errFaulty) || (index%2 == 1 && err != nil) {
+			t.Errorf("Disk %d: unexpected error %v", index, err)
+		}
+	}
+
+	// Slow disk is pending once quorum is lost.
+	release := make(chan struct{})
+	errs = xl.fanOutDisks("bucket", "object", 3, func(index int, disk StorageAPI) error {
+		if index == 3 {
+			<-release
+			return nil
+		}
+		if index < 2 {
+			return errFaulty
+		}
+		return nil
+	})
+	if errs[3] != errDiskPending {
+		t.Errorf("expected %s for slow disk, got %v", errDiskPending, errs[3])
+	}
+	close(release)
+
+	// Slow disk is pending once quorum is met, the next operation on
+	// it runs after the pending one.
+	slow := make(chan struct{})
+	var order []string
+	errs = xl.fanOutDisks("bucket", "object", 3, func(index int, disk StorageAPI) error {
+		if index == 0 {
+			<-slow
+			order = append(order, "first")
+		}
+		return nil
+	})
+	if errs[0] != errDiskPending {
+		t.Errorf("expected %s for slow disk, got %v", errDiskPending, errs[0])
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(slow)
+	}()
+	xl.fanOutDisks("bucket", "object", 0, func(index int, disk StorageAPI) error {
+		if index == 0 {
+			order = append(order, "second")
+		}
+		return nil
+	})
+	if !reflect.DeepEqual(order, []string{"first", "second"}) {
+		t.Errorf("expected operations on the slow disk in order, got %v", order)
+	}
+
+	// Operations on other files do not wait for the slow disk.
+	slow = make(chan struct{})
+	xl.fanOutDisks("bucket", "object", 3, func(index int, disk StorageAPI) error {
+		if index == 0 {
+			<-slow
+		}
+		return nil
+	})
+	errs = xl.fanOutDisks("bucket", "other", 0, func(index int, disk StorageAPI) error {
+		return nil
+	})
+	if firstDiskErr(errs) != nil {
+		t.Errorf("expected operations on another file to be done, got %v", errs)
+	}
+	close(slow)
+
+	// Skipped disks take no part in the quorum.
+	errs = xl.fanOutDisks("bucket", "object", 2, func(index int, disk StorageAPI) error {
+		if index < 2 {
+			return errDiskSkipped
+		}
+		if index == 2 {
+			return errFaulty
+		}
+		return nil
+	})
+	if countDiskErrs(errs) != 1 || errs[0] != errDiskSkipped || errs[1] != errDiskSkipped {
+		t.Errorf("expected two skipped disks and one failure, got %v", errs)
+	}
+
+	// Ignored errors do not count against quorum.
+	errs = xl.fanOutDisks("bucket", "object", 4, func(index int, disk StorageAPI) error {
+		return errVolumeExists
+	}, errVolumeExists)
+	for index, err := range errs {
+		if err != errVolumeExists {
+			t.Errorf("Disk %d: expected %s, got %v", index, errVolumeExists, err)
+		}
+	}
+}
+
+// Benchmarks a volume life cycle on 16 disks with 5ms latency, every
+// operation takes a single disk round trip rather than 16.
+func BenchmarkXLVolumeFanOut(b *testing.B) {
+	xl, removeDisks := newLatencyXL(b, 5*time.Millisecond)
+	defer removeDisks()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		volume := fmt.Sprintf("bucket%d", i)
+		if err := xl.MakeVol(volume); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := xl.StatVol(volume); err != nil {
+			b.Fatal(err)
+		}
+		if err := xl.DeleteVol(volume); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmarks the same volume life cycle issued one disk at a time, as
+// the baseline for BenchmarkXLVolumeFanOut.
+func BenchmarkXLVolumeSerial(b *testing.B) {
+	xl, removeDisks := newLatencyXL(b, 5*time.Millisecond)
+	defer removeDisks()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		volume := fmt.Sprintf("bucket%d", i)
+		for _, disk := range xl.storageDisks {
+			if _, err := disk.StatVol(volume); err != errVolumeNotFound {
+				b.Fatal(err)
+			}
+		}
+		for _, disk := range xl.storageDisks {
+			if err := disk.MakeVol(volume); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for _, disk := range xl.storageDisks {
+			if _, err := disk.StatVol(volume); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for _, disk := range xl.storageDisks {
+			if err := disk.DeleteVol(volume); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Tests metadata is reconciled by agreement of most disks, rather than
+// by the highest version.
+func TestReduceMetadata(t *testing.T) {
+	modTime := time.Now().UTC()
+	newMetadata := func(version, size int64) xlMetaV1 {
+		metadata := xlMetaV1{}
+		metadata.Stat.Version = version
+		metadata.Stat.Size = size
+		metadata.Stat.ModTime = modTime
+		metadata.Erasure.DataBlocks = 2
+		metadata.Erasure.ParityBlocks = 2
+		return metadata
+	}
+	testCases := []struct {
+		partsMetadata []xlMetaV1
+		errs          []error
+		version       int64
+		agreed        []bool
+	}{
+		// Bogus higher version on a single disk is outvoted.
+		{
+			[]xlMetaV1{newMetadata(5, 10), newMetadata(2, 10), newMetadata(2, 10), newMetadata(2, 10)},
+			make([]error, 4),
+			2, []bool{false, true, true, true},
+		},
+		// Same version with another size does not agree.
+		{
+			[]xlMetaV1{newMetadata(2, 10), newMetadata(2, 11), newMetadata(2, 10), {}},
+			[]error{nil, nil, nil, errFileNotFound},
+			2, []bool{true, false, true, false},
+		},
+		// Ties go to the higher version.
+		{
+			[]xlMetaV1{newMetadata(1, 10), newMetadata(1, 10), newMetadata(2, 20), newMetadata(2, 20)},
+			make([]error, 4),
+			2, []bool{false, false, true, true},
+		},
+	}
+	for i, testCase := range testCases {
+		mdata, agreed, count := reduceMetadata(testCase.partsMetadata, testCase.errs)
+		if mdata.Stat.Version != testCase.version {
+			t.Errorf("Test %d: expected version %d, got %d", i+1, testCase.version, mdata.Stat.Version)
+		}
+		agreedCount := 0
+		for index := range agreed {
+			if agreed[index] != testCase.agreed[index] {
+				t.Errorf("Test %d: expected agreed disks %v, got %v", i+1, testCase.agreed, agreed)
+				break
+			}
+			if agreed[index] {
+				agreedCount++
+			}
+		}
+		if count != agreedCount {
+			t.Errorf("Test %d: expected count %d, got %d", i+1, agreedCount, count)
+		}
+	}
+}
+
+// Tests disks holding metadata of a minority are healed, and metadata
+// without read quorum is never served.
+func TestListOnlineDisksStale(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("a"), 16*1024)
+	if err = writeTestFile(xl, "bucket", "object", data); err != nil {
+		t.Fatal(err)
+	}
+	partsMetadata, _ := xl.getPartsMetadata("bucket", "object")
+	version := partsMetadata[0].Stat.Version
+
+	// setVersion - saves metadata of disk index with another version.
+	setVersion := func(index int, version int64) {
+		metadata := partsMetadata[index]
+		metadata.Stat.Version = version
+		if err := writeMetadataFile(xl.storageDisks[index], "bucket", "object/"+xlMetaV1File, metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Left over of a partial write is stale and healed.
+	setVersion(0, version+10)
+	onlineDisks, metadata, heal, err := xl.listOnlineDisks("bucket", "object")
+	if err != nil || !heal || onlineDisks[0] != nil || metadata.Stat.Version != version {
+		t.Fatalf("expected disk 0 stale, got version %d, heal %t, err %v", metadata.Stat.Version, heal, err)
+	}
+	if err = xl.healFile("bucket", "object"); err != nil {
+		t.Fatal(err)
+	}
+	partsMetadata, _ = xl.getPartsMetadata("bucket", "object")
+	if partsMetadata[0].Stat.Version != version {
+		t.Fatalf("expected version %d healed, got %d", version, partsMetadata[0].Stat.Version)
+	}
+	if got, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected data, got %d bytes, err %v", len(got), err)
+	}
+
+	// No metadata reaches read quorum.
+	for index := 0; index < 3; index++ {
+		setVersion(index, version+int64(index)+1)
+	}
+	if _, _, _, err = xl.listOnlineDisks("bucket", "object"); err != errReadQuorum {
+		t.Fatalf("expected %s, got %v", errReadQuorum, err)
+	}
+}
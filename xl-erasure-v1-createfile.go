@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	slashpath "path"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -28,18 +29,20 @@ import (
 // Erasure block size.
 const erasureBlockSize = 4 * 1024 * 1024 // 4MiB.
 
+// Blocks a disk may fall behind the disks of write quorum before it is
+// dropped from the write and healed later.
+const erasureWriteLag = 4
+
 // cleanupCreateFileOps - cleans up all the temporary files and other
-// temporary data upon any failure.
-func (xl XL) cleanupCreateFileOps(volume, path string, writers ...io.WriteCloser) {
-	closeAndRemoveWriters(writers...)
-	for _, disk := range xl.storageDisks {
-		if err := disk.DeleteFile(volume, path); err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Errorf("DeleteFile failed with %s", err)
-		}
-	}
+// temporary data upon any failure, writers of every disk are closed
+// once the writes left in progress on it are done.
+func (xl XL) cleanupCreateFileOps(volume, path, tmpPath string, writers, metadataWriters []io.WriteCloser) {
+	xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		closeAndRemoveWriters(writers[index], metadataWriters[index])
+		writers[index], metadataWriters[index] = nil, nil
+		return nil
+	})
+	xl.purgeTmpOp(volume, path, tmpPath)
 }
 
 // Close and remove writers if they are safeFile.
@@ -53,14 +56,11 @@ func closeAndRemoveWriters(writers ...io.WriteCloser) {
 
 // WriteErasure reads predefined blocks, encodes them and writes to
 // configured storage disks.
-func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *waitCloser) {
-	// Release the block writer upon function return.
-	defer wcloser.release()
-
+func (xl XL) writeErasure(volume, path string, reader io.Reader) error {
 	// Lock right before reading from disk.
-	nsMutex.RLock(volume, path)
+	dLock := nsMutex.RLock(volume, path)
 	partsMetadata, errs := xl.getPartsMetadata(volume, path)
-	nsMutex.RUnlock(volume, path)
+	nsMutex.RUnlock(volume, path, dLock)
 
 	// Count errors other than fileNotFound, bigger than the allowed
 	// readQuorum, if yes throw an error.
@@ -73,13 +73,11 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 					"volume": volume,
 					"path":   path,
 				}).Errorf("%s", err)
-				reader.CloseWithError(err)
-				return
+				return err
 			}
 		}
 	}
 
-	var err error
 	// List all the file versions on existing files.
 	versions := listFileVersions(partsMetadata, errs)
 	// Get highest file version.
@@ -87,71 +85,98 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 	// Increment to have next higher version.
 	higherVersion++
 
-	writers := make([]io.WriteCloser, len(xl.storageDisks))
-
-	xlMetaV1FilePath := slashpath.Join(path, xlMetaV1File)
-	metadataWriters := make([]io.WriteCloser, len(xl.storageDisks))
+	// Files are written to a temporary area on every disk and moved
+	// into place once all of them are written.
+	tmpPath, err := newTmpPath()
+	if err != nil {
+		return err
+	}
 
 	// Save additional erasureMetadata.
 	modTime := time.Now().UTC()
 
-	createFileError := 0
-	for index, disk := range xl.storageDisks {
-		erasurePart := slashpath.Join(path, fmt.Sprintf("file.%d", index))
-		var writer io.WriteCloser
-		writer, err = disk.CreateFile(volume, erasurePart)
+	// Allocate 4MiB block size buffer for reading.
+	dataBuffer := make([]byte, erasureBlockSize)
+	// Read the first block, small files are read whole and saved
+	// inline in their metadata.
+	n, err := io.ReadFull(reader, dataBuffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("io.ReadFull failed with %s", err)
+		return err
+	}
+	// Files of minio meta volume are never saved inline, parts of
+	// multipart uploads are committed by moving their shard files.
+	if err != nil && int64(n) <= xl.inlineThreshold && volume != minioMetaBucket {
+		metadata := xl.newMetadata(int64(n), modTime, higherVersion)
+		return xl.writeInline(volume, path, tmpPath, dataBuffer[:n], metadata)
+	}
+	firstBlock := true
+
+	// Every stage returns once write quorum disks are done, the
+	// writers of a disk are only used by the operations on the disk,
+	// which run in order. Disks falling behind are dropped.
+	disks := xl.disks()
+	writeDisks := make([]StorageAPI, len(disks))
+	copy(writeDisks, disks)
+	inflight := make([]int32, len(disks))
+
+	writers := make([]io.WriteCloser, len(xl.storageDisks))
+
+	xlMetaV1FilePath := slashpath.Join(tmpPath, xlMetaV1File)
+	metadataWriters := make([]io.WriteCloser, len(xl.storageDisks))
+
+	// Create part and metadata files on all disks.
+	errs = xl.fanOutOnDisks(writeDisks, volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		erasurePart := slashpath.Join(tmpPath, fmt.Sprintf("file.%d", index))
+		writer, err := disk.CreateFile(minioMetaBucket, erasurePart)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"volume": volume,
 				"path":   path,
 			}).Errorf("CreateFile failed with %s", err)
-			createFileError++
-
-			// We can safely allow CreateFile errors up to len(xl.storageDisks) - xl.writeQuorum
-			// otherwise return failure.
-			if createFileError <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
-			}
-
-			// Remove previous temp writers for any failure.
-			xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-			reader.CloseWithError(errWriteQuorum)
-			return
+			globalMetrics.erasureWriteError(disk)
+			return err
 		}
 
 		// create meta data file
-		var metadataWriter io.WriteCloser
-		metadataWriter, err = disk.CreateFile(volume, xlMetaV1FilePath)
+		metadataWriter, err := disk.CreateFile(minioMetaBucket, xlMetaV1FilePath)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"volume": volume,
 				"path":   path,
 			}).Errorf("CreateFile failed with %s", err)
-			createFileError++
-
-			// We can safely allow CreateFile errors up to
-			// len(xl.storageDisks) - xl.writeQuorum otherwise return failure.
-			if createFileError <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
-			}
-
-			// Remove previous temp writers for any failure.
-			xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-			reader.CloseWithError(errWriteQuorum)
-			return
+			globalMetrics.erasureWriteError(disk)
+			safeCloseAndRemove(writer)
+			return err
 		}
 
 		writers[index] = writer
 		metadataWriters[index] = metadataWriter
+		return nil
+	})
+
+	// We can safely allow CreateFile errors up to len(xl.storageDisks) - xl.writeQuorum
+	// otherwise return failure.
+	if countDiskErrs(errs) > len(xl.storageDisks)-xl.writeQuorum {
+		// Remove previous temp writers for any failure.
+		xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+		return errWriteQuorum
 	}
 
-	// Allocate 4MiB block size buffer for reading.
-	dataBuffer := make([]byte, erasureBlockSize)
+	// Checksums of every block written to every shard.
+	checksums := make([][]string, len(xl.storageDisks))
+
 	var totalSize int64 // Saves total incoming stream size.
 	for {
-		// Read up to allocated block size.
-		var n int
-		n, err = io.ReadFull(reader, dataBuffer)
+		// Read up to allocated block size, unless the first block
+		// was just read.
+		if !firstBlock {
+			n, err = io.ReadFull(reader, dataBuffer)
+		}
+		firstBlock = false
 		if err != nil {
 			// Any unexpected errors, close the pipe reader with error.
 			if err != io.ErrUnexpectedEOF && err != io.EOF {
@@ -160,9 +185,8 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 					"path":   path,
 				}).Errorf("io.ReadFull failed with %s", err)
 				// Remove all temp writers.
-				xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-				reader.CloseWithError(err)
-				return
+				xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+				return err
 			}
 		}
 		// At EOF break out.
@@ -179,9 +203,8 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 					"path":   path,
 				}).Errorf("Splitting data buffer into erasure data blocks failed with %s", err)
 				// Remove all temp writers.
-				xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-				reader.CloseWithError(err)
-				return
+				xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+				return err
 			}
 
 			// Encode parity blocks using data blocks.
@@ -192,28 +215,65 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 					"path":   path,
 				}).Errorf("Encoding erasure data blocks failed with %s", err)
 				// Remove all temp writers upon error.
-				xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-				reader.CloseWithError(err)
-				return
+				xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+				return err
 			}
 
-			// Loop through and write encoded data to quorum disks.
-			for index, writer := range writers {
-				if writer == nil {
+			// Checksum all the shards, including the ones on failed
+			// disks which are recreated by healing.
+			for index, encodedData := range dataBlocks {
+				checksums[index] = append(checksums[index], bitrotSum(xl.bitrotAlgorithm, encodedData))
+			}
+
+			// Drop the disks too many blocks behind, their writers
+			// are cleaned up once their writes are done.
+			for index, disk := range writeDisks {
+				if disk == nil {
 					continue
 				}
-				encodedData := dataBlocks[index]
-				_, err = writers[index].Write(encodedData)
-				if err != nil {
+				if atomic.LoadInt32(&inflight[index]) >= erasureWriteLag {
 					log.WithFields(logrus.Fields{
 						"volume":    volume,
 						"path":      path,
 						"diskIndex": index,
-					}).Errorf("Writing encoded blocks failed with %s", err)
-					// Remove all temp writers upon error.
-					xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-					reader.CloseWithError(err)
-					return
+					}).Errorf("Dropping disk %d blocks behind", erasureWriteLag)
+					writeDisks[index] = nil
+					continue
+				}
+				atomic.AddInt32(&inflight[index], 1)
+			}
+
+			// Write encoded data to quorum disks concurrently.
+			errs = xl.fanOutOnDisks(writeDisks, volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+				defer atomic.AddInt32(&inflight[index], -1)
+				if writers[index] == nil {
+					return errDiskNotFound
+				}
+				_, wErr := writers[index].Write(dataBlocks[index])
+				if wErr != nil {
+					log.WithFields(logrus.Fields{
+						"volume":    volume,
+						"path":      path,
+						"diskIndex": index,
+					}).Errorf("Writing encoded blocks failed with %s", wErr)
+					globalMetrics.erasureWriteError(disk)
+					// Later blocks are not written on the disk.
+					closeAndRemoveWriters(writers[index], metadataWriters[index])
+					writers[index], metadataWriters[index] = nil, nil
+				}
+				return wErr
+			})
+			if countDiskErrs(errs) > len(xl.storageDisks)-xl.writeQuorum {
+				// Remove all temp writers upon error.
+				xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+				return errWriteQuorum
+			}
+			// Blocks still being written are not to be overwritten
+			// by the next block.
+			for _, err = range errs {
+				if err == errDiskPending {
+					dataBuffer = make([]byte, erasureBlockSize)
+					break
 				}
 			}
 
@@ -223,88 +283,100 @@ func (xl XL) writeErasure(volume, path string, reader *io.PipeReader, wcloser *w
 	}
 
 	// Initialize metadata map, save all erasure related metadata.
-	metadata := xlMetaV1{}
-	metadata.Version = "1"
-	metadata.Stat.Size = totalSize
-	metadata.Stat.ModTime = modTime
-	metadata.Minio.Release = minioReleaseTag
-	if len(xl.storageDisks) > len(writers) {
-		// Save file.version only if we wrote to less disks than all
-		// storage disks.
-		metadata.Stat.Version = higherVersion
-	}
-	metadata.Erasure.DataBlocks = xl.DataBlocks
-	metadata.Erasure.ParityBlocks = xl.ParityBlocks
-	metadata.Erasure.BlockSize = erasureBlockSize
+	metadata := xl.newMetadata(totalSize, modTime, higherVersion)
+	metadata.Erasure.Checksum.shards = checksums
 
 	// Write all the metadata.
-	// below case is not handled here
-	// Case: when storageDisks is 16 and write quorumDisks is 13,
-	//       meta data write failure up to 2 can be considered.
-	//       currently we fail for any meta data writes
-	for index, metadataWriter := range metadataWriters {
-		if metadataWriter == nil {
-			continue
+	errs = xl.fanOutOnDisks(writeDisks, volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		if metadataWriters[index] == nil {
+			return errDiskNotFound
 		}
 
 		// Write metadata.
-		err = metadata.Write(metadataWriter)
-		if err != nil {
+		wErr := metadata.diskMetadata(index).Write(metadataWriters[index])
+		if wErr != nil {
 			log.WithFields(logrus.Fields{
 				"volume":    volume,
 				"path":      path,
 				"diskIndex": index,
-			}).Errorf("Writing metadata failed with %s", err)
-			// Remove temporary files.
-			xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-			reader.CloseWithError(err)
-			return
+			}).Errorf("Writing metadata failed with %s", wErr)
+			closeAndRemoveWriters(writers[index], metadataWriters[index])
+			writers[index], metadataWriters[index] = nil, nil
 		}
+		return wErr
+	})
+	if countDiskErrs(errs) > len(xl.storageDisks)-xl.writeQuorum {
+		// Remove temporary files.
+		xl.cleanupCreateFileOps(volume, path, tmpPath, writers, metadataWriters)
+		return errWriteQuorum
 	}
 
-	// Lock right before commit to disk.
-	nsMutex.Lock(volume, path)
-	defer nsMutex.Unlock(volume, path)
-
-	// Close all writers and metadata writers in routines.
-	for index, writer := range writers {
-		if writer == nil {
-			continue
+	// Close all writers and metadata writers, files are saved in the
+	// temporary area. Files saved are committed on their disk, metadata
+	// is moved last. Shard files of the old version are removed.
+	ops := make([]*tmpOp, len(xl.storageDisks))
+	xl.fanOutOnDisks(disks, volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		if writers[index] == nil {
+			return errDiskNotFound
+		}
+		// Writers of dropped disks are discarded.
+		if writeDisks[index] == nil {
+			closeAndRemoveWriters(writers[index], metadataWriters[index])
+			writers[index], metadataWriters[index] = nil, nil
+			return errDiskNotFound
 		}
-		// Safely wrote, now rename to its actual location.
-		if err = writer.Close(); err != nil {
+		if cErr := writers[index].Close(); cErr != nil {
 			log.WithFields(logrus.Fields{
 				"volume":    volume,
 				"path":      path,
 				"diskIndex": index,
-			}).Errorf("Safely committing part failed with %s", err)
-			// Remove all temp writers upon error.
-			xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-			reader.CloseWithError(err)
-			return
+			}).Errorf("Safely saving part failed with %s", cErr)
+			closeAndRemoveWriters(metadataWriters[index])
+			return cErr
 		}
-
-		if metadataWriters[index] == nil {
-			continue
-		}
-		// Safely wrote, now rename to its actual location.
-		if err = metadataWriters[index].Close(); err != nil {
+		if cErr := metadataWriters[index].Close(); cErr != nil {
 			log.WithFields(logrus.Fields{
 				"volume":    volume,
 				"path":      path,
 				"diskIndex": index,
-			}).Errorf("Safely committing metadata failed with %s", err)
-			// Remove all temp writers upon error.
-			xl.cleanupCreateFileOps(volume, path, append(writers, metadataWriters...)...)
-			reader.CloseWithError(err)
-			return
+			}).Errorf("Safely saving metadata failed with %s", cErr)
+			return cErr
 		}
-
+		ops[index] = &tmpOp{
+			Volume: volume,
+			Path:   path,
+			Files:  []string{fmt.Sprintf("file.%d", index), xlMetaV1File},
+		}
+		return nil
+	})
+
+	err = xl.commitTmpOp(volume, path, tmpPath, ops)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("Committing file failed with %s", err)
+		return err
 	}
 
-	// Close the pipe reader and return.
-	reader.Close()
-	return
+	return nil
+}
+
+// newMetadata - initializes metadata of a file written with the
+// current erasure layout.
+func (xl XL) newMetadata(size int64, modTime time.Time, version int64) xlMetaV1 {
+	metadata := xlMetaV1{}
+	metadata.Version = "1"
+	metadata.Stat.Size = size
+	metadata.Stat.ModTime = modTime
+	metadata.Minio.Release = minioReleaseTag
+	// Disks which fail to commit keep the older version.
+	metadata.Stat.Version = version
+	metadata.Erasure.DataBlocks = xl.DataBlocks
+	metadata.Erasure.ParityBlocks = xl.ParityBlocks
+	metadata.Erasure.BlockSize = erasureBlockSize
+	metadata.Erasure.Checksum.Algorithm = xl.bitrotAlgorithm
+	return metadata
 }
 
 // CreateFile - create a file.
@@ -323,7 +395,13 @@ func (xl XL) CreateFile(volume, path string) (writeCloser io.WriteCloser, err er
 	wcloser := newWaitCloser(pipeWriter)
 
 	// Start erasure encoding in routine, reading data block by block from pipeReader.
-	go xl.writeErasure(volume, path, pipeReader, wcloser)
+	go func() {
+		err := xl.writeErasure(volume, path, pipeReader)
+		// Close the pipe reader, writer fails with the error if any.
+		pipeReader.CloseWithError(err)
+		// Release the block writer with the result of the write.
+		wcloser.release(err)
+	}()
 
 	// Return the writer, caller should start writing to this.
 	return wcloser, nil
@@ -24,11 +24,46 @@ var errFileSize = errors.New("Missing 'file.size' in metadata")
 // errMaxDisks - returned for reached maximum of disks.
 var errMaxDisks = errors.New("Total number of disks specified is higher than supported maximum of '16'")
 
-// errNumDisks - returned for odd numebr of disks.
-var errNumDisks = errors.New("Invalid number of disks provided, should be always multiples of '2'")
+// errParityBlocks - returned for invalid number of parity blocks.
+var errParityBlocks = errors.New("Invalid number of parity blocks, should be between '1' and half the number of disks")
+
+// errUnformattedDisk - returned for disks without format.
+var errUnformattedDisk = errors.New("Disk is not formatted")
+
+// errCorruptedFormat - returned for unreadable disk format.
+var errCorruptedFormat = errors.New("Disk format is corrupted")
+
+// errForeignDisk - returned for disks of another deployment.
+var errForeignDisk = errors.New("Disk belongs to another deployment")
+
+// errInconsistentFormat - returned for disks with differing formats.
+var errInconsistentFormat = errors.New("Disk formats are inconsistent, disks are mixed or duplicated")
+
+// errFormatLayout - returned for disks given in another layout than formatted.
+var errFormatLayout = errors.New("Number of disks does not match the disk format")
 
 // errModTime - returned for missing file modtime.
 var errModTime = errors.New("Missing 'file.modTime' in metadata")
 
+// errLockLost - returned for writes whose namespace lock lost quorum
+// of lock servers before the write was committed.
+var errLockLost = errors.New("Namespace lock was lost before the write was committed")
+
 // errUnexpected - returned for any unexpected error.
 var errUnexpected = errors.New("Unexpected error - please report at https://github.com/minio/minio/issues")
+
+// errDiskPending - returned for disks still in progress when a fan-out
+// returned early.
+var errDiskPending = errors.New("Disk operation did not finish before the fan-out returned")
+
+// errDiskSkipped - returned by fan-out operations for disks which take
+// no part in the fan-out.
+var errDiskSkipped = errors.New("Disk takes no part in the operation")
+
+// errFileVersion - returned for shards of a file replaced by another
+// version while being read.
+var errFileVersion = errors.New("File was replaced by another version while being read")
+
+// errPartLayout - returned for parts which cannot be committed as one
+// file, written with differing erasure layouts.
+var errPartLayout = errors.New("Parts were written with differing erasure layouts")
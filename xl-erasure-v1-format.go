@@ -0,0 +1,402 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skyrings/skyring-common/tools/uuid"
+)
+
+const (
+	// Format file of every XL disk, saved in minio meta volume.
+	formatConfigFile = "format.json"
+	formatVersion    = "1"
+	formatXL         = "xl"
+)
+
+// formatXLV1 - format of a XL disk, identifies the deployment the disk
+// belongs to, the disk itself and the position of every disk of the
+// deployment.
+type formatXLV1 struct {
+	Version string `json:"version"`
+	Format  string `json:"format"`
+	XL      struct {
+		DeploymentID string `json:"deploymentID"`
+		Disk         string `json:"disk"`
+		// Disk uuids of every erasure set, in disk order.
+		Sets [][]string `json:"sets"`
+	} `json:"xl"`
+}
+
+// newFormatXL - generates format of a new deployment, disks are
+// ordered as given.
+func newFormatXL(sets, setDisks int) (*formatXLV1, error) {
+	deploymentID, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+	format := &formatXLV1{
+		Version: formatVersion,
+		Format:  formatXL,
+	}
+	format.XL.DeploymentID = deploymentID.String()
+	format.XL.Sets = make([][]string, sets)
+	for set := range format.XL.Sets {
+		for disk := 0; disk < setDisks; disk++ {
+			diskID, err := uuid.New()
+			if err != nil {
+				return nil, err
+			}
+			format.XL.Sets[set] = append(format.XL.Sets[set], diskID.String())
+		}
+	}
+	return format, nil
+}
+
+// loadFormatXL - reads format of a disk, returns errUnformattedDisk
+// for disks which were never formatted.
+func loadFormatXL(disk StorageAPI) (*formatXLV1, error) {
+	reader, err := disk.ReadFile(minioMetaBucket, formatConfigFile, 0)
+	if err != nil {
+		if err == errFileNotFound || err == errVolumeNotFound {
+			return nil, errUnformattedDisk
+		}
+		return nil, err
+	}
+	defer reader.Close()
+	format := &formatXLV1{}
+	if err = json.NewDecoder(reader).Decode(format); err != nil {
+		return nil, errCorruptedFormat
+	}
+	if format.Version != formatVersion || format.Format != formatXL {
+		return nil, errCorruptedFormat
+	}
+	return format, nil
+}
+
+// saveFormatXL - writes format of a disk with its uuid.
+func saveFormatXL(disk StorageAPI, format formatXLV1, diskID string) error {
+	format.XL.Disk = diskID
+	formatBytes, err := json.Marshal(format)
+	if err != nil {
+		return err
+	}
+	if err = disk.MakeVol(minioMetaBucket); err != nil && err != errVolumeExists {
+		return err
+	}
+	writer, err := disk.CreateFile(minioMetaBucket, formatConfigFile)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(formatBytes); err != nil {
+		safeCloseAndRemove(writer)
+		return err
+	}
+	return writer.Close()
+}
+
+// getReferenceFormat - returns format shared by all the formatted
+// disks, nil if no disk is formatted yet. Disks of another deployment
+// or with differing disk order are refused.
+func getReferenceFormat(formats []*formatXLV1, errs []error) (*formatXLV1, error) {
+	var reference *formatXLV1
+	for index, format := range formats {
+		if errs[index] == errCorruptedFormat {
+			return nil, errCorruptedFormat
+		}
+		if format == nil {
+			continue
+		}
+		if reference == nil {
+			reference = format
+			continue
+		}
+		if format.XL.DeploymentID != reference.XL.DeploymentID {
+			return nil, errForeignDisk
+		}
+		if !reflect.DeepEqual(format.XL.Sets, reference.XL.Sets) {
+			return nil, errInconsistentFormat
+		}
+	}
+	return reference, nil
+}
+
+// diskPlacement - disks whose format could not be read when the disks
+// were ordered, their positions stay empty until they are placed by
+// their format. Guards positions of storageDisks filled meanwhile.
+type diskPlacement struct {
+	mutex    sync.RWMutex
+	unplaced []StorageAPI
+}
+
+// initFormatXL - validates format of the disks of all the sets and
+// orders the disks as recorded in the format, disks may have been
+// given in any order. Disks of a new deployment and new disks
+// replacing lost ones are formatted if formatDisks is set, only one
+// server of a distributed setup formats disks so that the format of a
+// new deployment is generated once. Returns errUnformattedDisk if no
+// disk is formatted yet and formatDisks is not set.
+//
+// Positions of disks not identified by their format are left empty if
+// some disk is offline, or if disks are formatted by another server,
+// since the position a disk takes can not be guessed. Such disks are
+// placed by placeDisks once their format can be read.
+func initFormatXL(sets []*XL, formatDisks bool) error {
+	var disks []StorageAPI
+	for _, xl := range sets {
+		disks = append(disks, xl.storageDisks...)
+	}
+	formats := make([]*formatXLV1, len(disks))
+	errs := make([]error, len(disks))
+	for index, disk := range disks {
+		if disk == nil {
+			errs[index] = errUnexpected
+			continue
+		}
+		formats[index], errs[index] = loadFormatXL(disk)
+	}
+
+	reference, err := getReferenceFormat(formats, errs)
+	if err != nil {
+		return err
+	}
+	newDeployment := reference == nil
+	if newDeployment && !formatDisks {
+		return errUnformattedDisk
+	}
+	if newDeployment {
+		if reference, err = newFormatXL(len(sets), len(sets[0].storageDisks)); err != nil {
+			return err
+		}
+	}
+	if len(reference.XL.Sets) != len(sets) {
+		return errFormatLayout
+	}
+	for set, xl := range sets {
+		if len(reference.XL.Sets[set]) != len(xl.storageDisks) {
+			return errFormatLayout
+		}
+	}
+
+	// Place every formatted disk at its recorded position.
+	type position struct{ set, disk int }
+	positions := make(map[string]position)
+	ordered := make([][]StorageAPI, len(sets))
+	for set, diskIDs := range reference.XL.Sets {
+		ordered[set] = make([]StorageAPI, len(diskIDs))
+		for disk, diskID := range diskIDs {
+			positions[diskID] = position{set, disk}
+		}
+	}
+	placed := make([]bool, len(disks))
+	for index, format := range formats {
+		if format == nil {
+			continue
+		}
+		pos, ok := positions[format.XL.Disk]
+		if !ok {
+			return errForeignDisk
+		}
+		if ordered[pos.set][pos.disk] != nil {
+			// Same disk given twice, or a copied disk.
+			return errInconsistentFormat
+		}
+		ordered[pos.set][pos.disk] = disks[index]
+		placed[index] = true
+	}
+
+	// Remaining positions are taken by new disks in the given order,
+	// only if no disk is offline and this server formats disks.
+	// Offline disks of a new deployment take positions as well, they
+	// are formatted once back by the disk healer.
+	var remaining []int
+	offlineDisks := false
+	for index := range disks {
+		if placed[index] {
+			continue
+		}
+		remaining = append(remaining, index)
+		if errs[index] != errUnformattedDisk {
+			offlineDisks = true
+		}
+	}
+	unplaced := make([][]StorageAPI, len(sets))
+	if !newDeployment && (offlineDisks || !formatDisks) {
+		for _, index := range remaining {
+			set := index / len(sets[0].storageDisks)
+			unplaced[set] = append(unplaced[set], disks[index])
+			if errs[index] != errUnformattedDisk {
+				continue
+			}
+			if !formatDisks {
+				log.WithFields(logrus.Fields{
+					"set": set,
+				}).Info("Leaving new disk to be formatted by the server of the first disk")
+				continue
+			}
+			log.WithFields(logrus.Fields{
+				"set": set,
+			}).Warn("Not formatting new disk while other disks are offline")
+		}
+		remaining = nil
+	}
+	for set := range ordered {
+		for disk := range ordered[set] {
+			if ordered[set][disk] != nil || len(remaining) == 0 {
+				continue
+			}
+			index := remaining[0]
+			remaining = remaining[1:]
+			ordered[set][disk] = disks[index]
+			if errs[index] != errUnformattedDisk {
+				continue
+			}
+			if err = saveFormatXL(disks[index], *reference, reference.XL.Sets[set][disk]); err != nil {
+				log.WithFields(logrus.Fields{
+					"set":  set,
+					"disk": disk,
+				}).Errorf("Formatting disk failed with %s", err)
+				continue
+			}
+			if newDeployment {
+				continue
+			}
+			// New disk replaces a lost one, all the files of the
+			// set are healed onto it by the disk healer.
+			progress := newDiskHealProgress(set, disk, disks[index])
+			if err = saveDiskHealProgress(disks[index], *progress); err != nil {
+				log.WithFields(logrus.Fields{
+					"set":  set,
+					"disk": disk,
+				}).Errorf("Saving disk heal progress failed with %s", err)
+				continue
+			}
+			log.WithFields(logrus.Fields{
+				"set":  set,
+				"disk": disk,
+			}).Info("Formatted new disk")
+		}
+	}
+
+	for set, xl := range sets {
+		xl.placement.mutex.Lock()
+		xl.storageDisks = ordered[set]
+		xl.placement.unplaced = unplaced[set]
+		xl.placement.mutex.Unlock()
+		xl.formatted = true
+	}
+	return nil
+}
+
+// placeDisks - places disks left unplaced by initFormatXL at the
+// position recorded in their format, once their format can be read.
+// Disks still offline or unformatted are left unplaced.
+func placeDisks(sets []*XL, reference *formatXLV1) {
+	positions := make(map[string]diskPosition)
+	for set, diskIDs := range reference.XL.Sets {
+		for disk, diskID := range diskIDs {
+			positions[diskID] = diskPosition{set, disk}
+		}
+	}
+	for _, xl := range sets {
+		xl.placement.mutex.RLock()
+		unplaced := append([]StorageAPI(nil), xl.placement.unplaced...)
+		xl.placement.mutex.RUnlock()
+		for _, disk := range unplaced {
+			format, err := loadFormatXL(disk)
+			if err != nil {
+				continue
+			}
+			pos, ok := positions[format.XL.Disk]
+			if !ok || format.XL.DeploymentID != reference.XL.DeploymentID {
+				log.WithFields(logrus.Fields{
+					"path": getStorageDiskPath(disk),
+				}).Errorf("Placing disk failed with %s", errForeignDisk)
+				continue
+			}
+			if err = sets[pos.set].placeDisk(pos.disk, disk); err != nil {
+				log.WithFields(logrus.Fields{
+					"set":  pos.set,
+					"disk": pos.disk,
+					"path": getStorageDiskPath(disk),
+				}).Errorf("Placing disk failed with %s", err)
+				continue
+			}
+			xl.removeUnplacedDisk(disk)
+			log.WithFields(logrus.Fields{
+				"set":  pos.set,
+				"disk": pos.disk,
+				"path": getStorageDiskPath(disk),
+			}).Info("Placed disk identified by its format")
+		}
+	}
+}
+
+// placeDisk - places a disk at an empty position.
+func (xl *XL) placeDisk(index int, disk StorageAPI) error {
+	xl.placement.mutex.Lock()
+	defer xl.placement.mutex.Unlock()
+	if xl.storageDisks[index] != nil {
+		// Same disk given twice, or a copied disk.
+		return errInconsistentFormat
+	}
+	xl.storageDisks[index] = disk
+	return nil
+}
+
+// unplaceDisk - empties a position taken by a disk of another
+// position, the disk is placed again by its format.
+func (xl *XL) unplaceDisk(index int) {
+	xl.placement.mutex.Lock()
+	defer xl.placement.mutex.Unlock()
+	if xl.storageDisks[index] == nil {
+		return
+	}
+	xl.placement.unplaced = append(xl.placement.unplaced, xl.storageDisks[index])
+	xl.storageDisks[index] = nil
+}
+
+// removeUnplacedDisk - removes a placed disk from the unplaced disks.
+func (xl *XL) removeUnplacedDisk(disk StorageAPI) {
+	xl.placement.mutex.Lock()
+	defer xl.placement.mutex.Unlock()
+	for index := range xl.placement.unplaced {
+		if xl.placement.unplaced[index] == disk {
+			xl.placement.unplaced = append(xl.placement.unplaced[:index], xl.placement.unplaced[index+1:]...)
+			return
+		}
+	}
+}
+
+// waitForFormatXL - validates format of the disks of all the sets,
+// waiting for disks of a new deployment to be formatted by the server
+// of the first disk unless formatDisks is set.
+func waitForFormatXL(sets []*XL, formatDisks bool) error {
+	for {
+		err := initFormatXL(sets, formatDisks)
+		if err != errUnformattedDisk {
+			return err
+		}
+		log.Info("Waiting for disks to be formatted by the server of the first disk")
+		time.Sleep(quorumRetryInterval)
+	}
+}
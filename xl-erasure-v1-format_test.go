@@ -0,0 +1,284 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// newTestFormatDisks - creates temporary disks, returns the disks and
+// a function removing them.
+func newTestFormatDisks(t *testing.T, totalDisks int) ([]string, func()) {
+	var disks []string
+	for i := 0; i < totalDisks; i++ {
+		disk, err := ioutil.TempDir("", "minio-format-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		disks = append(disks, disk)
+	}
+	return disks, func() {
+		for _, disk := range disks {
+			os.RemoveAll(disk)
+		}
+	}
+}
+
+// newTestFormattedXL - initializes XL on the disks and validates
+// their format.
+func newTestFormattedXL(t *testing.T, disks ...string) (*XL, error) {
+	storage, err := newXL(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl := storage.(*XL)
+	return xl, initFormatXL([]*XL{xl}, true)
+}
+
+// getDiskIDs - returns uuids of the disks of XL in disk order.
+func getDiskIDs(t *testing.T, xl *XL) []string {
+	var diskIDs []string
+	for _, disk := range xl.storageDisks {
+		format, err := loadFormatXL(disk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diskIDs = append(diskIDs, format.XL.Disk)
+	}
+	return diskIDs
+}
+
+// Tests disks are ordered by their format regardless of the order
+// they are given in.
+func TestInitFormatXL(t *testing.T) {
+	initNSLock()
+
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !xl.formatted {
+		t.Fatal("Expected XL to be formatted")
+	}
+	diskIDs := getDiskIDs(t, xl)
+
+	objAPI := xlObjects{xl}
+	data := bytes.Repeat([]byte("hello world"), 1024)
+	if err = objAPI.MakeBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = objAPI.PutObject("bucket", "object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disks are given in reverse order.
+	reversed := []string{disks[3], disks[2], disks[1], disks[0]}
+	xl, err = newTestFormattedXL(t, reversed...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, diskID := range getDiskIDs(t, xl) {
+		if diskID != diskIDs[index] {
+			t.Fatalf("Disk %d: expected %s, got %s", index, diskIDs[index], diskID)
+		}
+	}
+	reader, err := xlObjects{xl}.GetObject("bucket", "object", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Read data does not match written data")
+	}
+
+	// Brand new replacement disks are formatted at their position.
+	if err = os.RemoveAll(disks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(disks[1], 0700); err != nil {
+		t.Fatal(err)
+	}
+	xl, err = newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, diskID := range getDiskIDs(t, xl) {
+		if diskID != diskIDs[index] {
+			t.Fatalf("Disk %d: expected %s, got %s", index, diskIDs[index], diskID)
+		}
+	}
+}
+
+// offlineDisk - disk failing all reads while offline.
+type offlineDisk struct {
+	StorageAPI
+	offline *bool
+}
+
+func (d offlineDisk) ReadFile(volume, path string, offset int64) (io.ReadCloser, error) {
+	if *d.offline {
+		return nil, errDiskNotFound
+	}
+	return d.StorageAPI.ReadFile(volume, path, offset)
+}
+
+// Tests disks offline at startup are left unplaced, even when disks
+// are given in another order, and are placed by their format once
+// back.
+func TestInitFormatXLOfflineDisk(t *testing.T) {
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskIDs := getDiskIDs(t, xl)
+
+	// Disks are given in reverse order, the disk of the second
+	// position is offline.
+	storage, err := newXL(disks[3], disks[2], disks[1], disks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl = storage.(*XL)
+	offline := true
+	xl.storageDisks[2] = offlineDisk{xl.storageDisks[2], &offline}
+	if err = initFormatXL([]*XL{xl}, true); err != nil {
+		t.Fatal(err)
+	}
+	if xl.storageDisks[1] != nil || len(xl.placement.unplaced) != 1 {
+		t.Fatalf("Expected offline disk left unplaced, got %v", xl.storageDisks)
+	}
+
+	reference, err := loadFormatXL(xl.storageDisks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	placeDisks([]*XL{xl}, reference)
+	if xl.storageDisks[1] != nil {
+		t.Fatal("Expected offline disk left unplaced")
+	}
+	offline = false
+	placeDisks([]*XL{xl}, reference)
+	for index, diskID := range getDiskIDs(t, xl) {
+		if diskID != diskIDs[index] {
+			t.Fatalf("Disk %d: expected %s, got %s", index, diskIDs[index], diskID)
+		}
+	}
+}
+
+// Tests foreign, duplicated and differently laid out disks are refused.
+func TestInitFormatXLRefused(t *testing.T) {
+	disks, cleanup := newTestFormatDisks(t, 8)
+	defer cleanup()
+	if _, err := newTestFormattedXL(t, disks[:4]...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestFormattedXL(t, disks[4:]...); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		disks []string
+		err   error
+	}{
+		// Disk of another deployment.
+		{[]string{disks[0], disks[1], disks[2], disks[4]}, errForeignDisk},
+		// Same disk given twice.
+		{[]string{disks[0], disks[1], disks[2], disks[2]}, errInconsistentFormat},
+		// Less disks than formatted.
+		{[]string{disks[0], disks[1]}, errFormatLayout},
+	}
+	for i, testCase := range testCases {
+		if _, err := newTestFormattedXL(t, testCase.disks...); err != testCase.err {
+			t.Errorf("Test %d: expected error %v, got %v", i+1, testCase.err, err)
+		}
+	}
+}
+
+// Tests servers other than the server of the first disk wait for the
+// disks to be formatted and leave new disks unformatted and unplaced
+// until the server of the first disk formats them.
+func TestInitFormatXLNotFormatting(t *testing.T) {
+	disks, cleanup := newTestFormatDisks(t, 4)
+	defer cleanup()
+	storage, err := newXL(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl := storage.(*XL)
+	if err = initFormatXL([]*XL{xl}, false); err != errUnformattedDisk {
+		t.Fatalf("Expected %s, got %v", errUnformattedDisk, err)
+	}
+	if _, err = loadFormatXL(xl.storageDisks[0]); err != errUnformattedDisk {
+		t.Fatalf("Expected disk left unformatted, got %v", err)
+	}
+
+	if _, err = newTestFormattedXL(t, disks...); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.RemoveAll(disks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(disks[1], 0700); err != nil {
+		t.Fatal(err)
+	}
+	if storage, err = newXL(disks...); err != nil {
+		t.Fatal(err)
+	}
+	xl = storage.(*XL)
+	if err = initFormatXL([]*XL{xl}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !xl.formatted {
+		t.Fatal("Expected XL to be formatted")
+	}
+	if xl.storageDisks[1] != nil || len(xl.placement.unplaced) != 1 {
+		t.Fatalf("Expected new disk left unplaced, got %v", xl.storageDisks)
+	}
+	newDisk := xl.placement.unplaced[0]
+	if _, err = loadFormatXL(newDisk); err != errUnformattedDisk {
+		t.Fatalf("Expected new disk left unformatted, got %v", err)
+	}
+
+	// Disk is placed once formatted by the server of the first disk.
+	reference, err := loadFormatXL(xl.storageDisks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	placeDisks([]*XL{xl}, reference)
+	if xl.storageDisks[1] != nil {
+		t.Fatal("Expected unformatted disk left unplaced")
+	}
+	if _, err = newTestFormattedXL(t, disks...); err != nil {
+		t.Fatal(err)
+	}
+	placeDisks([]*XL{xl}, reference)
+	if xl.storageDisks[1] != newDisk || len(xl.placement.unplaced) != 0 {
+		t.Fatalf("Expected new disk placed at its position, got %v", xl.storageDisks)
+	}
+}
@@ -18,26 +18,21 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	slashpath "path"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/klauspost/reedsolomon"
 )
 
 // healHeal - heals the file at path.
-func (xl XL) healFile(volume string, path string) error {
-	totalBlocks := xl.DataBlocks + xl.ParityBlocks
-	needsHeal := make([]bool, totalBlocks)
-	var readers = make([]io.Reader, totalBlocks)
-	var writers = make([]io.WriteCloser, totalBlocks)
-
+func (xl XL) healFile(volume string, path string) (err error) {
 	// Acquire a read lock.
-	nsMutex.RLock(volume, path)
-	defer nsMutex.RUnlock(volume, path)
+	dLock := nsMutex.RLock(volume, path)
+	defer nsMutex.RUnlock(volume, path, dLock)
 
 	// List all online disks to verify if we need to heal.
-	onlineDisks, metadata, heal, err := xl.listOnlineDisks(volume, path)
+	onlineDisks, partsMetadata, metadata, heal, err := xl.listOnlineParts(volume, path)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
@@ -45,16 +40,104 @@ func (xl XL) healFile(volume string, path string) error {
 		}).Errorf("List online disks failed with %s", err)
 		return err
 	}
-	if !heal {
+
+	// Files are decoded with the layout they were written with.
+	rs, err := xl.getReedSolomon(metadata)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("Initializing erasure decoder failed with %s", err)
+		return err
+	}
+
+	// Shards of files saved inline are healed within their metadata.
+	if metadata.Erasure.Inline {
+		return xl.healInlineFile(volume, path, onlineDisks, partsMetadata, metadata, rs, heal)
+	}
+
+	// Record the result once healing is attempted.
+	healed := false
+	defer func() {
+		if healed {
+			globalMetrics.healResult(err)
+		}
+	}()
+
+	// Files committed from multipart uploads are healed part by part,
+	// the metadata is updated once all the parts are healed.
+	needsHeal := make([]bool, len(xl.storageDisks))
+	for partIndex, part := range metadata.partsMetadata() {
+		var partNeedsHeal []bool
+		var checksums [][]string
+		partNeedsHeal, checksums, err = xl.healShards(volume, path, onlineDisks, part, rs, heal)
+		if partNeedsHeal != nil {
+			healed = true
+			for index, healNeeded := range partNeedsHeal {
+				needsHeal[index] = needsHeal[index] || healNeeded
+			}
+		}
+		// Healed shards are saved with their own checksums.
+		for index := range checksums {
+			if checksums[index] == nil {
+				continue
+			}
+			if len(metadata.Parts) > 0 {
+				metadata.Parts[partIndex].shards[index] = checksums[index]
+			} else {
+				metadata.Erasure.Checksum.shards[index] = checksums[index]
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !healed {
 		return nil
 	}
 
+	// Update the quorum metadata after selfheal.
+	errs := xl.setPartsMetadata(volume, path, metadata, needsHeal)
+	for index, healNeeded := range needsHeal {
+		if healNeeded && errs[index] != nil {
+			return errs[index]
+		}
+	}
+	return nil
+}
+
+// healShards - heals the shards of a file or of a part of a file,
+// missing and corrupted shards are reconstructed. Returns the shards
+// healed, nil if none needed healing, and block checksums of the
+// healed shards.
+// Read lockNS() should be done by caller.
+func (xl XL) healShards(volume, path string, onlineDisks []StorageAPI, metadata xlMetaV1, rs reedsolomon.Encoder, heal bool) (needsHeal []bool, checksums [][]string, err error) {
+	totalBlocks := len(xl.storageDisks)
+	needsHeal = make([]bool, totalBlocks)
+	checksums = make([][]string, totalBlocks)
+	var readers = make([]io.Reader, totalBlocks)
+	var writers = make([]io.WriteCloser, totalBlocks)
+
+	// Verify block checksums of all the shards, corrupted shards
+	// are healed as if they were missing.
+	corrupted := xl.verifyShards(volume, path, onlineDisks, metadata)
+	bitrot := false
+	for _, shardCorrupted := range corrupted {
+		if shardCorrupted {
+			bitrot = true
+			break
+		}
+	}
+	if !heal && !bitrot {
+		return nil, nil, nil
+	}
+
 	for index, disk := range onlineDisks {
-		if disk == nil {
+		if disk == nil || corrupted[index] {
 			needsHeal[index] = true
 			continue
 		}
-		erasurePart := slashpath.Join(path, fmt.Sprintf("file.%d", index))
+		erasurePart := slashpath.Join(path, metadata.shardFile(index))
 		// If disk.ReadFile returns error and we don't have read quorum it will be taken care as
 		// ReedSolomon.Reconstruct() will fail later.
 		var reader io.ReadCloser
@@ -75,15 +158,15 @@ func (xl XL) healFile(volume string, path string) error {
 	}
 	if !atleastOneHeal {
 		// Return if healing not needed anywhere.
-		return nil
+		return nil, nil, nil
 	}
 
 	// create writers for parts where healing is needed.
 	for index, healNeeded := range needsHeal {
-		if !healNeeded {
+		if !healNeeded || xl.storageDisks[index] == nil {
 			continue
 		}
-		erasurePart := slashpath.Join(path, fmt.Sprintf("file.%d", index))
+		erasurePart := slashpath.Join(path, metadata.shardFile(index))
 		writers[index], err = xl.storageDisks[index].CreateFile(volume, erasurePart)
 		if err != nil {
 			log.WithFields(logrus.Fields{
@@ -128,18 +211,18 @@ func (xl XL) healFile(volume string, path string) error {
 				"volume": volume,
 				"path":   path,
 			}).Errorf("%s", errDataCorrupt)
-			return errDataCorrupt
+			return needsHeal, nil, errDataCorrupt
 		}
 
 		// Verify the blocks.
-		ok, err := xl.ReedSolomon.Verify(enBlocks)
+		ok, err := rs.Verify(enBlocks)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"volume": volume,
 				"path":   path,
 			}).Errorf("ReedSolomon verify failed with %s", err)
 			closeAndRemoveWriters(writers...)
-			return err
+			return needsHeal, nil, err
 		}
 
 		// Verification failed, blocks require reconstruction.
@@ -150,24 +233,24 @@ func (xl XL) healFile(volume string, path string) error {
 					enBlocks[index] = nil
 				}
 			}
-			err = xl.ReedSolomon.Reconstruct(enBlocks)
+			err = rs.Reconstruct(enBlocks)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
 				}).Errorf("ReedSolomon reconstruct failed with %s", err)
 				closeAndRemoveWriters(writers...)
-				return err
+				return needsHeal, nil, err
 			}
 			// Verify reconstructed blocks again.
-			ok, err = xl.ReedSolomon.Verify(enBlocks)
+			ok, err = rs.Verify(enBlocks)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
 				}).Errorf("ReedSolomon verify failed with %s", err)
 				closeAndRemoveWriters(writers...)
-				return err
+				return needsHeal, nil, err
 			}
 			if !ok {
 				// Blocks cannot be reconstructed, corrupted data.
@@ -177,13 +260,17 @@ func (xl XL) healFile(volume string, path string) error {
 					"path":   path,
 				}).Errorf("%s", err)
 				closeAndRemoveWriters(writers...)
-				return err
+				return needsHeal, nil, err
 			}
 		}
 		for index, healNeeded := range needsHeal {
-			if !healNeeded {
+			// Disks which could not be written are healed later.
+			if !healNeeded || writers[index] == nil {
 				continue
 			}
+			if algorithm := metadata.Erasure.Checksum.Algorithm; algorithm != "" {
+				checksums[index] = append(checksums[index], bitrotSum(algorithm, enBlocks[index]))
+			}
 			_, err := writers[index].Write(enBlocks[index])
 			if err != nil {
 				log.WithFields(logrus.Fields{
@@ -191,6 +278,7 @@ func (xl XL) healFile(volume string, path string) error {
 					"path":   path,
 				}).Errorf("Write failed with %s", err)
 				safeCloseAndRemove(writers[index])
+				writers[index] = nil
 				continue
 			}
 		}
@@ -205,13 +293,5 @@ func (xl XL) healFile(volume string, path string) error {
 		}
 		writer.Close()
 	}
-
-	// Update the quorum metadata after selfheal.
-	errs := xl.setPartsMetadata(volume, path, metadata, needsHeal)
-	for index, healNeeded := range needsHeal {
-		if healNeeded && errs[index] != nil {
-			return errs[index]
-		}
-	}
-	return nil
+	return needsHeal, checksums, nil
 }
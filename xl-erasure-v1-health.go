@@ -0,0 +1,279 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// Consecutive faults after which a disk is marked offline.
+	diskFaultThreshold = 3
+	// Interval for probing offline disks.
+	diskProbeInterval = 5 * time.Second
+	// Weight of the latest operation in the average latency.
+	diskLatencyWeight = 0.1
+)
+
+// Disk health states.
+const (
+	diskOnline  = "online"
+	diskOffline = "offline"
+)
+
+// DiskHealth - health of a disk as tracked by XL.
+type DiskHealth struct {
+	State             string  `json:"state"`
+	ConsecutiveErrors int     `json:"consecutiveErrors"`
+	TotalErrors       int64   `json:"totalErrors"`
+	AvgLatency        float64 `json:"avgLatency"` // In seconds.
+	LastError         string  `json:"lastError,omitempty"`
+}
+
+// isDiskFault - verifies if error indicates a faulty disk, rather than
+// a missing or conflicting volume or file.
+func isDiskFault(err error) bool {
+	switch err {
+	case nil, errFileNotFound, errVolumeNotFound, errVolumeExists, errVolumeNotEmpty,
+		errIsNotRegular, errFileAccessDenied, errVolumeAccessDenied, errDiskFull, errInvalidArgument:
+		return false
+	}
+	return true
+}
+
+// trackedDisk - storage disk of XL tracking its health. Disk is marked
+// offline after consecutive faults, offline disks fail right away so
+// that fan-outs skip them and are probed until they respond again.
+type trackedDisk struct {
+	disk           StorageAPI
+	faultThreshold int
+	probeInterval  time.Duration
+
+	mutex  *sync.Mutex
+	health *DiskHealth
+}
+
+// newTrackedDisk - initialize health tracking of a disk.
+func newTrackedDisk(disk StorageAPI) *trackedDisk {
+	return &trackedDisk{
+		disk:           disk,
+		faultThreshold: diskFaultThreshold,
+		probeInterval:  diskProbeInterval,
+		mutex:          &sync.Mutex{},
+		health:         &DiskHealth{State: diskOnline},
+	}
+}
+
+// withIOClass - returns a view of the disk scheduling its operations
+// in class, health is shared with the disk.
+func (d *trackedDisk) withIOClass(class ioClass) StorageAPI {
+	view := *d
+	view.disk = withIOClass(d.disk, class)
+	return &view
+}
+
+// Health - returns health of the disk.
+func (d *trackedDisk) Health() DiskHealth {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return *d.health
+}
+
+// isOffline - verifies if the disk is marked offline.
+func (d *trackedDisk) isOffline() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.health.State == diskOffline
+}
+
+// fault - records result of an operation, marks the disk offline after
+// consecutive faults. Returns the error as is.
+func (d *trackedDisk) fault(err error) error {
+	if !isDiskFault(err) {
+		d.mutex.Lock()
+		d.health.ConsecutiveErrors = 0
+		d.mutex.Unlock()
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.health.ConsecutiveErrors++
+	d.health.TotalErrors++
+	d.health.LastError = err.Error()
+	if d.health.State == diskOnline && d.health.ConsecutiveErrors >= d.faultThreshold {
+		d.health.State = diskOffline
+		log.WithFields(logrus.Fields{
+			"disk":              getStorageDiskPath(d.disk),
+			"consecutiveErrors": d.health.ConsecutiveErrors,
+		}).Errorf("Disk marked offline, last error %s", err)
+		go d.probe()
+	}
+	return err
+}
+
+// observe - records latency and result of an operation started at
+// start. Returns the error as is.
+func (d *trackedDisk) observe(start time.Time, err error) error {
+	latency := time.Since(start).Seconds()
+	d.mutex.Lock()
+	if d.health.AvgLatency == 0 {
+		d.health.AvgLatency = latency
+	} else {
+		d.health.AvgLatency += diskLatencyWeight * (latency - d.health.AvgLatency)
+	}
+	d.mutex.Unlock()
+	return d.fault(err)
+}
+
+// probe - probes an offline disk until it responds, then marks it
+// online.
+func (d *trackedDisk) probe() {
+	for {
+		time.Sleep(d.probeInterval)
+		if _, err := d.disk.ListVols(); isDiskFault(err) {
+			continue
+		}
+		d.mutex.Lock()
+		d.health.State = diskOnline
+		d.health.ConsecutiveErrors = 0
+		d.mutex.Unlock()
+		log.WithFields(logrus.Fields{
+			"disk": getStorageDiskPath(d.disk),
+		}).Info("Disk is back online")
+		return
+	}
+}
+
+// MakeVol - make a volume.
+func (d *trackedDisk) MakeVol(volume string) error {
+	if d.isOffline() {
+		return errDiskNotFound
+	}
+	start := time.Now()
+	return d.observe(start, d.disk.MakeVol(volume))
+}
+
+// ListVols - list volumes.
+func (d *trackedDisk) ListVols() ([]VolInfo, error) {
+	if d.isOffline() {
+		return nil, errDiskNotFound
+	}
+	start := time.Now()
+	vols, err := d.disk.ListVols()
+	return vols, d.observe(start, err)
+}
+
+// StatVol - stat a volume.
+func (d *trackedDisk) StatVol(volume string) (VolInfo, error) {
+	if d.isOffline() {
+		return VolInfo{}, errDiskNotFound
+	}
+	start := time.Now()
+	volInfo, err := d.disk.StatVol(volume)
+	return volInfo, d.observe(start, err)
+}
+
+// DeleteVol - delete a volume.
+func (d *trackedDisk) DeleteVol(volume string) error {
+	if d.isOffline() {
+		return errDiskNotFound
+	}
+	start := time.Now()
+	return d.observe(start, d.disk.DeleteVol(volume))
+}
+
+// ListFiles - list files of a volume.
+func (d *trackedDisk) ListFiles(volume, prefix, marker string, recursive bool, count int) ([]FileInfo, bool, error) {
+	if d.isOffline() {
+		return nil, true, errDiskNotFound
+	}
+	start := time.Now()
+	files, eof, err := d.disk.ListFiles(volume, prefix, marker, recursive, count)
+	return files, eof, d.observe(start, err)
+}
+
+// trackedReader - reader of a file on a tracked disk, read errors are
+// recorded as faults of the disk.
+type trackedReader struct {
+	io.ReadCloser
+	disk *trackedDisk
+}
+
+// Read - reads and records faults.
+func (r trackedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		r.disk.fault(err)
+	}
+	return n, err
+}
+
+// ReadFile - reads a file.
+func (d *trackedDisk) ReadFile(volume, path string, offset int64) (io.ReadCloser, error) {
+	if d.isOffline() {
+		return nil, errDiskNotFound
+	}
+	start := time.Now()
+	reader, err := d.disk.ReadFile(volume, path, offset)
+	if err = d.observe(start, err); err != nil {
+		return nil, err
+	}
+	return trackedReader{reader, d}, nil
+}
+
+// CreateFile - creates a file, writers are returned as is since
+// failed writes are cleaned up depending on the writer type.
+func (d *trackedDisk) CreateFile(volume, path string) (io.WriteCloser, error) {
+	if d.isOffline() {
+		return nil, errDiskNotFound
+	}
+	start := time.Now()
+	writer, err := d.disk.CreateFile(volume, path)
+	return writer, d.observe(start, err)
+}
+
+// StatFile - stat a file.
+func (d *trackedDisk) StatFile(volume, path string) (FileInfo, error) {
+	if d.isOffline() {
+		return FileInfo{}, errDiskNotFound
+	}
+	start := time.Now()
+	fileInfo, err := d.disk.StatFile(volume, path)
+	return fileInfo, d.observe(start, err)
+}
+
+// DeleteFile - delete a file.
+func (d *trackedDisk) DeleteFile(volume, path string) error {
+	if d.isOffline() {
+		return errDiskNotFound
+	}
+	start := time.Now()
+	return d.observe(start, d.disk.DeleteFile(volume, path))
+}
+
+// RenameFile - rename a file.
+func (d *trackedDisk) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
+	if d.isOffline() {
+		return errDiskNotFound
+	}
+	start := time.Now()
+	return d.observe(start, d.disk.RenameFile(srcVolume, srcPath, dstVolume, dstPath))
+}
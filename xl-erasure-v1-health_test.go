@@ -0,0 +1,203 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Tests posix returns errDiskNotFound once its disk is removed.
+func TestPosixDiskNotFound(t *testing.T) {
+	diskPath, err := ioutil.TempDir("", "minio-health-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diskPath)
+	disk, err := newPosix(diskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = disk.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = disk.StatFile("bucket", "object"); err != errFileNotFound {
+		t.Fatalf("expected %s, got %v", errFileNotFound, err)
+	}
+
+	os.RemoveAll(diskPath)
+	if _, err = disk.ListVols(); err != errDiskNotFound {
+		t.Errorf("ListVols: expected %s, got %v", errDiskNotFound, err)
+	}
+	if _, err = disk.StatVol("bucket"); err != errDiskNotFound {
+		t.Errorf("StatVol: expected %s, got %v", errDiskNotFound, err)
+	}
+	if _, err = disk.StatFile("bucket", "object"); err != errDiskNotFound {
+		t.Errorf("StatFile: expected %s, got %v", errDiskNotFound, err)
+	}
+	if err = disk.MakeVol("bucket"); err != errDiskNotFound {
+		t.Errorf("MakeVol: expected %s, got %v", errDiskNotFound, err)
+	}
+}
+
+// Tests posix returns errDiskNotFound once its mount point is left as an
+// empty directory by unmounting the disk.
+func TestPosixDiskUnmounted(t *testing.T) {
+	diskPath, err := ioutil.TempDir("", "minio-health-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diskPath)
+	storage, err := newPosix(diskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := storage.(fsStorage)
+	if disk.mountPoint {
+		t.Fatalf("expected %s not to be a mount point", diskPath)
+	}
+	if _, err = disk.StatVol("bucket"); err != errVolumeNotFound {
+		t.Fatalf("expected %s, got %v", errVolumeNotFound, err)
+	}
+
+	// Temporary directory is on the device of its parent, as a mount
+	// point once its disk is unmounted.
+	disk.mountPoint = true
+	if _, err = disk.ListVols(); err != errDiskNotFound {
+		t.Errorf("ListVols: expected %s, got %v", errDiskNotFound, err)
+	}
+	if _, err = disk.StatVol("bucket"); err != errDiskNotFound {
+		t.Errorf("StatVol: expected %s, got %v", errDiskNotFound, err)
+	}
+	if _, err = disk.StatFile("bucket", "object"); err != errDiskNotFound {
+		t.Errorf("StatFile: expected %s, got %v", errDiskNotFound, err)
+	}
+	if err = disk.MakeVol("bucket"); err != errDiskNotFound {
+		t.Errorf("MakeVol: expected %s, got %v", errDiskNotFound, err)
+	}
+	if empty, err := isDirEmpty(diskPath); err != nil || !empty {
+		t.Errorf("expected nothing written to the mount point, empty %t, err %v", empty, err)
+	}
+}
+
+// Tests a disk is marked offline after consecutive faults, skipped
+// while offline and brought back online by the probe.
+func TestTrackedDisk(t *testing.T) {
+	diskPath, err := ioutil.TempDir("", "minio-health-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diskPath)
+	storage, err := newPosix(diskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := newTrackedDisk(storage)
+	disk.probeInterval = 10 * time.Millisecond
+
+	// Missing files are not faults of the disk.
+	for i := 0; i < diskFaultThreshold; i++ {
+		if _, err = disk.StatVol("bucket"); err != errVolumeNotFound {
+			t.Fatalf("expected %s, got %v", errVolumeNotFound, err)
+		}
+	}
+	if health := disk.Health(); health.State != diskOnline || health.TotalErrors != 0 {
+		t.Fatalf("expected online disk without errors, got %+v", health)
+	}
+
+	os.RemoveAll(diskPath)
+	for i := 0; i < diskFaultThreshold; i++ {
+		if health := disk.Health(); health.State != diskOnline {
+			t.Fatalf("Fault %d: disk marked offline before threshold", i+1)
+		}
+		if _, err = disk.ListVols(); err != errDiskNotFound {
+			t.Fatalf("expected %s, got %v", errDiskNotFound, err)
+		}
+	}
+	health := disk.Health()
+	if health.State != diskOffline || health.ConsecutiveErrors != diskFaultThreshold {
+		t.Fatalf("expected offline disk after %d faults, got %+v", diskFaultThreshold, health)
+	}
+
+	// Offline disk is not queried.
+	if err = disk.MakeVol("bucket"); err != errDiskNotFound {
+		t.Fatalf("expected %s, got %v", errDiskNotFound, err)
+	}
+	if health = disk.Health(); health.TotalErrors != diskFaultThreshold {
+		t.Fatalf("expected %d errors, got %d", diskFaultThreshold, health.TotalErrors)
+	}
+
+	// Disk is back online once it is available.
+	if err = os.MkdirAll(diskPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; disk.Health().State != diskOnline; i++ {
+		if i == 100 {
+			t.Fatal("disk not marked online after it is back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = disk.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if health = disk.Health(); health.ConsecutiveErrors != 0 || health.AvgLatency <= 0 {
+		t.Fatalf("expected no consecutive errors and latency, got %+v", health)
+	}
+}
+
+// Tests offline disks are not counted as disks missing the file.
+func TestListOnlineDisksOffline(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := xl.CreateFile("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Write(bytes.Repeat([]byte("a"), 1024)); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Object is found with a disk offline, and needs healing.
+	offline := xl.storageDisks[0].(*trackedDisk)
+	offline.health.State = diskOffline
+	_, _, heal, err := xl.listOnlineDisks("bucket", "object")
+	if err != nil || !heal {
+		t.Fatalf("expected object needing heal, got heal %t, err %v", heal, err)
+	}
+
+	// Object is not reported missing when most disks are offline.
+	for _, disk := range xl.storageDisks[1:3] {
+		disk.(*trackedDisk).health.State = diskOffline
+	}
+	if _, _, _, err = xl.listOnlineDisks("bucket", "object"); err != errReadQuorum {
+		t.Fatalf("expected %s, got %v", errReadQuorum, err)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	slashpath "path"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/klauspost/reedsolomon"
+)
+
+// Files up to this size are saved inline by default.
+const defaultInlineThreshold = 8 * 1024 // 8KiB.
+
+// getInlineThreshold - returns configured inline threshold, negative
+// when files are not to be saved inline.
+func getInlineThreshold() int64 {
+	if serverConfig == nil {
+		return defaultInlineThreshold
+	}
+	if threshold := serverConfig.GetErasure().InlineThreshold; threshold != 0 {
+		return threshold
+	}
+	return defaultInlineThreshold
+}
+
+// writeMetadataFile - writes metadata file at path of volume.
+func writeMetadataFile(disk StorageAPI, volume, path string, metadata xlMetaV1) error {
+	writer, err := disk.CreateFile(volume, path)
+	if err != nil {
+		return err
+	}
+	if err = metadata.Write(writer); err != nil {
+		safeCloseAndRemove(writer)
+		return err
+	}
+	return writer.Close()
+}
+
+// writeInline - encodes a small file and saves every shard in the
+// metadata of its disk, shard files of the old version are removed
+// once the file is committed.
+func (xl XL) writeInline(volume, path, tmpPath string, data []byte, metadata xlMetaV1) error {
+	metadata.Erasure.Inline = true
+	shards := make([][]byte, len(xl.storageDisks))
+	if len(data) > 0 {
+		var err error
+		if shards, err = xl.ReedSolomon.Split(data); err != nil {
+			return err
+		}
+		if err = xl.ReedSolomon.Encode(shards); err != nil {
+			return err
+		}
+		metadata.Erasure.Checksum.shards = make([][]string, len(shards))
+		for index, shard := range shards {
+			metadata.Erasure.Checksum.shards[index] = []string{bitrotSum(xl.bitrotAlgorithm, shard)}
+		}
+	}
+
+	// Disks the metadata is written on are committed, including the
+	// ones still writing once write quorum disks are written.
+	ops := make([]*tmpOp, len(xl.storageDisks))
+	xlMetaV1FilePath := slashpath.Join(tmpPath, xlMetaV1File)
+	errs := xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		diskMetadata := metadata.diskMetadata(index)
+		diskMetadata.Data = shards[index]
+		err := writeMetadataFile(disk, minioMetaBucket, xlMetaV1FilePath, diskMetadata)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume":    volume,
+				"path":      path,
+				"diskIndex": index,
+			}).Errorf("Writing metadata failed with %s", err)
+			globalMetrics.erasureWriteError(disk)
+			return err
+		}
+		ops[index] = &tmpOp{
+			Volume: volume,
+			Path:   path,
+			Files:  []string{xlMetaV1File},
+		}
+		return nil
+	})
+	if countDiskErrs(errs) > len(xl.storageDisks)-xl.writeQuorum {
+		xl.purgeTmpOp(volume, path, tmpPath)
+		return errWriteQuorum
+	}
+
+	return xl.commitTmpOp(volume, path, tmpPath, ops)
+}
+
+// healInlineFile - heals shards of a file saved inline, missing and
+// corrupted shards are reconstructed and saved in the metadata of
+// their disks.
+// Read lockNS() should be done by caller.
+func (xl XL) healInlineFile(volume, path string, onlineDisks []StorageAPI, partsMetadata []xlMetaV1, metadata xlMetaV1, rs reedsolomon.Encoder, heal bool) (err error) {
+	shardSize := int64(0)
+	// Deleted files have no shards left to heal.
+	if metadata.Stat.Size > 0 && !metadata.Stat.Deleted {
+		shardSize = getEncodedBlockLen(metadata.Stat.Size, metadata.Erasure.DataBlocks)
+	}
+	shards := make([][]byte, len(xl.storageDisks))
+	needsHeal := make([]bool, len(xl.storageDisks))
+	for index, disk := range onlineDisks {
+		if disk == nil {
+			needsHeal[index] = true
+			continue
+		}
+		if shardSize == 0 {
+			continue
+		}
+		data := partsMetadata[index].Data
+		if int64(len(data)) != shardSize || !metadata.verifyBlock(index, 0, data) {
+			reportBitrot(disk, volume, path, index, 0)
+			needsHeal[index] = true
+			heal = true
+			continue
+		}
+		shards[index] = data
+	}
+	if !heal {
+		return nil
+	}
+
+	// Record the result once healing is attempted.
+	defer func() {
+		globalMetrics.healResult(err)
+	}()
+
+	if shardSize > 0 {
+		if err = rs.Reconstruct(shards); err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+				"path":   path,
+			}).Errorf("ReedSolomon reconstruct failed with %s", err)
+			return err
+		}
+	}
+
+	xlMetaV1FilePath := slashpath.Join(path, xlMetaV1File)
+	// Shards are healed in place under the lock of the caller, wait
+	// for all the disks.
+	errs := xl.fanOutDisks(volume, path, 0, func(index int, disk StorageAPI) error {
+		if !needsHeal[index] {
+			return errDiskSkipped
+		}
+		diskMetadata := metadata.diskMetadata(index)
+		diskMetadata.Data = shards[index]
+		if algorithm := metadata.Erasure.Checksum.Algorithm; algorithm != "" && shardSize > 0 {
+			diskMetadata.Erasure.Checksum.Blocks = []string{bitrotSum(algorithm, shards[index])}
+		}
+		return writeMetadataFile(disk, volume, xlMetaV1FilePath, diskMetadata)
+	})
+	return firstDiskErr(errs)
+}
@@ -0,0 +1,142 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countPartFiles - counts part files of path in volume on all the disks.
+func countPartFiles(t *testing.T, disks []string, volume, path string) int {
+	count := 0
+	for _, disk := range disks {
+		entries, err := ioutil.ReadDir(filepath.Join(disk, volume, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.Name() != xlMetaV1File {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Tests small files are saved inline in their metadata, read back,
+// healed, and replaced by files of any size.
+func TestXLInlineFile(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	smallData := []byte("hello inline world")
+	largeData := bytes.Repeat([]byte("a"), defaultInlineThreshold+1)
+	testCases := []struct {
+		data      []byte
+		partFiles int
+	}{
+		{smallData, 0},
+		{[]byte{}, 0},
+		{largeData, 4},
+		// Part files of the large file are removed.
+		{smallData, 0},
+	}
+	for i, testCase := range testCases {
+		if err = writeTestFile(xl, "bucket", "object", testCase.data); err != nil {
+			t.Fatalf("Test %d: %s", i+1, err)
+		}
+		if count := countPartFiles(t, disks, "bucket", "object"); count != testCase.partFiles {
+			t.Errorf("Test %d: expected %d part files, found %d", i+1, testCase.partFiles, count)
+		}
+		data, err := readTestFile(xl, "bucket", "object")
+		if err != nil {
+			t.Fatalf("Test %d: %s", i+1, err)
+		}
+		if !bytes.Equal(data, testCase.data) {
+			t.Errorf("Test %d: read %d bytes not matching the written data", i+1, len(data))
+		}
+	}
+
+	// Reads at an offset.
+	reader, err := xl.ReadFile("bucket", "object", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, smallData[6:]) {
+		t.Fatalf("expected %q, got %q, err %v", smallData[6:], data, err)
+	}
+
+	// Lost metadata of a disk is healed with its shard.
+	partsMetadata, _ := xl.getPartsMetadata("bucket", "object")
+	shard := partsMetadata[0].Data
+	if err = os.Remove(filepath.Join(disks[0], "bucket", "object", xlMetaV1File)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, smallData) {
+		t.Fatalf("expected %q, got %q, err %v", smallData, data, err)
+	}
+	if err = xl.healFile("bucket", "object"); err != nil {
+		t.Fatal(err)
+	}
+	partsMetadata, errs := xl.getPartsMetadata("bucket", "object")
+	if errs[0] != nil || !partsMetadata[0].Erasure.Inline || !bytes.Equal(partsMetadata[0].Data, shard) {
+		t.Fatalf("expected healed inline shard %q, got %q, err %v", shard, partsMetadata[0].Data, errs[0])
+	}
+
+	// Part files are the ones of the version found at commit, not of
+	// the version found when the write started.
+	tmpPath, err := newTmpPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := xl.newMetadata(int64(len(smallData)), partsMetadata[0].Stat.ModTime, partsMetadata[0].Stat.Version+1)
+	if err = writeTestFile(xl, "bucket", "object", largeData); err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.writeInline("bucket", "object", tmpPath, smallData, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if count := countPartFiles(t, disks, "bucket", "object"); count != 0 {
+		t.Errorf("expected part files of the committed version removed, found %d", count)
+	}
+
+	// Files are never saved inline with a negative threshold.
+	xl.inlineThreshold = -1
+	if err = writeTestFile(xl, "bucket", "object", smallData); err != nil {
+		t.Fatal(err)
+	}
+	if count := countPartFiles(t, disks, "bucket", "object"); count != 4 {
+		t.Errorf("expected 4 part files, found %d", count)
+	}
+	if data, err = readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(data, smallData) {
+		t.Fatalf("expected %q, got %q, err %v", smallData, data, err)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Saved listings not continued within this duration are dropped.
+const xlListTimeout = 60 * time.Second
+
+// xlListStream - sorted stream of entries listed on a disk, entries
+// are buffered a page at a time.
+type xlListStream struct {
+	// Stream is being filled by a listing left in progress, other
+	// fields are not to be used meanwhile.
+	mutex   sync.Mutex
+	filling bool
+
+	marker     string
+	markerPath string
+	started    bool
+	entries    []FileInfo
+	eof        bool
+	err        error
+}
+
+// fill - lists the next page of entries on disk when the buffered
+// entries are consumed. Whole pages are consumed so that the disk can
+// continue its tree walk on the next page.
+func (s *xlListStream) fill(disk StorageAPI, volume, prefix string, recursive bool, count int) error {
+	if !s.started {
+		s.markerPath = listMarkerPath(disk, volume, s.marker)
+		s.started = true
+	}
+	for len(s.entries) == 0 && !s.eof {
+		fsFilesInfo, eof, err := disk.ListFiles(volume, prefix, s.markerPath, recursive, count)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume":    volume,
+				"prefix":    prefix,
+				"marker":    s.markerPath,
+				"recursive": recursive,
+				"count":     count,
+			}).Errorf("ListFiles failed with %s", err)
+			return err
+		}
+		for _, fsFileInfo := range fsFilesInfo {
+			fileInfo, ok, err := extractListEntry(disk, volume, fsFileInfo)
+			if err != nil {
+				return err
+			}
+			if ok {
+				s.entries = append(s.entries, fileInfo)
+			}
+		}
+		if len(fsFilesInfo) > 0 {
+			s.markerPath = fsFilesInfo[len(fsFilesInfo)-1].Name
+		}
+		s.eof = eof
+	}
+	// Sort to make sure we sort entries back properly.
+	sort.Sort(byFileInfoName(s.entries))
+	return nil
+}
+
+// xlListWalker - list streams of all the disks saved between pages
+// of a listing.
+type xlListWalker struct {
+	streams []*xlListStream
+	// Name of the last entry consumed, entries up to it listed by
+	// disks which were still listing are dropped.
+	consumed string
+	saved    time.Time
+}
+
+// xlListPool - listings saved for their next page.
+type xlListPool struct {
+	mutex   *sync.Mutex
+	walkers map[listParams]*xlListWalker
+}
+
+// newXLListPool - initializes a new pool of saved listings.
+func newXLListPool() *xlListPool {
+	return &xlListPool{
+		mutex:   &sync.Mutex{},
+		walkers: make(map[listParams]*xlListWalker),
+	}
+}
+
+// save - saves walker to continue listing of params, timed out
+// listings are dropped.
+func (p *xlListPool) save(params listParams, walker *xlListWalker) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	for savedParams, savedWalker := range p.walkers {
+		if now.Sub(savedWalker.saved) > xlListTimeout {
+			delete(p.walkers, savedParams)
+		}
+	}
+	walker.saved = now
+	p.walkers[params] = walker
+}
+
+// lookup - removes and returns the walker saved to continue listing
+// of params, nil if none.
+func (p *xlListPool) lookup(params listParams) *xlListWalker {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	walker, ok := p.walkers[params]
+	if !ok {
+		return nil
+	}
+	delete(p.walkers, params)
+	if time.Since(walker.saved) > xlListTimeout {
+		return nil
+	}
+	return walker
+}
+
+// reduceFileInfo - returns the entry most disks agree on, ties are
+// won by the first disk.
+func reduceFileInfo(filesInfo []FileInfo) FileInfo {
+	sameFileInfo := func(a, b FileInfo) bool {
+		return a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.Mode.IsDir() == b.Mode.IsDir()
+	}
+	best, bestCount := 0, 0
+	for i := range filesInfo {
+		count := 0
+		for j := range filesInfo {
+			if sameFileInfo(filesInfo[i], filesInfo[j]) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	return filesInfo[best]
+}
+
+// fillListStreams - fills the consumed list streams of all disks,
+// returns once read quorum disks are listed. Returns the streams ready
+// to be merged indexed by disk, failed disks and disks still listing
+// are left out. Returns error if fewer than read quorum disks can be
+// listed.
+func (xl XL) fillListStreams(streams []*xlListStream, volume, prefix string, recursive bool, count int) ([]*xlListStream, error) {
+	needsFill := make([]bool, len(streams))
+	fillCount := 0
+	for index, stream := range streams {
+		stream.mutex.Lock()
+		if !stream.filling && stream.err == nil && len(stream.entries) == 0 && !stream.eof {
+			stream.filling = true
+			needsFill[index] = true
+			fillCount++
+		}
+		stream.mutex.Unlock()
+	}
+	if fillCount > 0 {
+		xl.fanOutDisks(volume, prefix, xl.readQuorum, func(index int, disk StorageAPI) error {
+			if !needsFill[index] {
+				return errDiskSkipped
+			}
+			stream := streams[index]
+			err := stream.fill(disk, volume, prefix, recursive, count)
+			stream.mutex.Lock()
+			defer stream.mutex.Unlock()
+			stream.err = err
+			stream.filling = false
+			return err
+		})
+	}
+	ready := make([]*xlListStream, len(streams))
+	errs := make([]error, len(streams))
+	errCount := 0
+	for index, stream := range streams {
+		stream.mutex.Lock()
+		if stream.filling {
+			errs[index] = errDiskPending
+		} else if errs[index] = stream.err; stream.err == nil {
+			ready[index] = stream
+		}
+		stream.mutex.Unlock()
+		if errs[index] != nil {
+			errCount++
+		}
+	}
+	if errCount > len(xl.storageDisks)-xl.readQuorum {
+		if err := firstDiskErr(errs); err != nil {
+			return nil, err
+		}
+		return nil, errReadQuorum
+	}
+	return ready, nil
+}
+
+// nextListEntry - returns name of the least entry listed by any disk
+// and the list streams ready to be merged, found is false if no disk
+// has entries left. Disks still listing are waited for only once the
+// other disks have no entries left, or do not agree on the entry.
+func (xl XL) nextListEntry(walker *xlListWalker, volume, prefix string, recursive bool, count int) (streams []*xlListStream, name string, found bool, err error) {
+	for {
+		if streams, err = xl.fillListStreams(walker.streams, volume, prefix, recursive, count); err != nil {
+			return nil, "", false, err
+		}
+		refill, listing := false, false
+		for index, stream := range streams {
+			if stream == nil {
+				walker.streams[index].mutex.Lock()
+				listing = listing || walker.streams[index].filling
+				walker.streams[index].mutex.Unlock()
+				continue
+			}
+			// Entries consumed while the disk was listing.
+			for len(stream.entries) > 0 && walker.consumed != "" && stream.entries[0].Name <= walker.consumed {
+				stream.entries = stream.entries[1:]
+			}
+			if len(stream.entries) == 0 {
+				refill = refill || !stream.eof
+				continue
+			}
+			if !found || stream.entries[0].Name < name {
+				name, found = stream.entries[0].Name, true
+			}
+		}
+		if refill {
+			name, found = "", false
+			continue
+		}
+		// Entries without read quorum of the disks listed may have
+		// it with the disks still listing.
+		if found && listing {
+			agreed := 0
+			for _, stream := range streams {
+				if stream != nil && len(stream.entries) > 0 && stream.entries[0].Name == name {
+					agreed++
+				}
+			}
+			if agreed < xl.readQuorum {
+				found = false
+			}
+		}
+		if found || !listing {
+			return streams, name, found, nil
+		}
+		name = ""
+		xl.fanOutDisks(volume, prefix, 0, func(index int, disk StorageAPI) error {
+			return nil
+		})
+	}
+}
+
+// ListFiles - lists files at prefix. Sorted listings of all the disks
+// are merged, entries are listed only when read quorum disks agree on
+// them so that partially written files are never listed.
+func (xl XL) ListFiles(volume, prefix, marker string, recursive bool, count int) (filesInfo []FileInfo, eof bool, err error) {
+	if !isValidVolname(volume) {
+		return nil, true, errInvalidArgument
+	}
+
+	// Continue a listing saved by the previous page, list streams
+	// of all the disks are started otherwise.
+	var walker *xlListWalker
+	if xl.listPool != nil {
+		walker = xl.listPool.lookup(listParams{volume, recursive, marker, prefix})
+	}
+	if walker == nil {
+		walker = &xlListWalker{streams: make([]*xlListStream, len(xl.storageDisks))}
+		for index := range walker.streams {
+			walker.streams[index] = &xlListStream{marker: marker}
+		}
+	}
+	for len(filesInfo) < count {
+		streams, name, found, nErr := xl.nextListEntry(walker, volume, prefix, recursive, count)
+		if nErr != nil {
+			return nil, true, nErr
+		}
+		if !found {
+			return filesInfo, true, nil
+		}
+		// Consume the entry from all the disks listing it.
+		var candidates []FileInfo
+		for _, stream := range streams {
+			if stream == nil || len(stream.entries) == 0 || stream.entries[0].Name != name {
+				continue
+			}
+			candidates = append(candidates, stream.entries[0])
+			stream.entries = stream.entries[1:]
+		}
+		walker.consumed = name
+		if len(candidates) < xl.readQuorum {
+			continue
+		}
+		filesInfo = append(filesInfo, reduceFileInfo(candidates))
+	}
+
+	// Listing ends if no disk has entries left.
+	_, _, found, err := xl.nextListEntry(walker, volume, prefix, recursive, count)
+	if err != nil {
+		return nil, true, err
+	}
+	eof = !found
+	if !eof && xl.listPool != nil && len(filesInfo) > 0 {
+		nextMarker := filesInfo[len(filesInfo)-1].Name
+		xl.listPool.save(listParams{volume, recursive, nextMarker, prefix}, walker)
+	}
+	return filesInfo, eof, nil
+}
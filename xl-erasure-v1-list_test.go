@@ -0,0 +1,103 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests listings are merged from all the disks, entries without read
+// quorum are left out, and pages continue the saved listing.
+func TestXLListFiles(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range []string{"a", "b", "c", "d", "e", "f", "dir/g"} {
+		if err = writeTestFile(xl, "bucket", object, []byte(object)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "a" is missing on the first disk, still on quorum.
+	if err = os.RemoveAll(filepath.Join(disks[0], "bucket", "a")); err != nil {
+		t.Fatal(err)
+	}
+	// "d" is left over by a partial write on the first disk only.
+	for _, disk := range disks[1:] {
+		if err = os.RemoveAll(filepath.Join(disk, "bucket", "d")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		recursive bool
+		names     []string
+	}{
+		{true, []string{"a", "b", "c", "dir/g", "e", "f"}},
+		{false, []string{"a", "b", "c", "dir/", "e", "f"}},
+	}
+	for i, testCase := range testCases {
+		var names []string
+		marker := ""
+		pages := 0
+		for {
+			filesInfo, eof, err := xl.ListFiles("bucket", "", marker, testCase.recursive, 2)
+			if err != nil {
+				t.Fatalf("Test %d: %s", i+1, err)
+			}
+			pages++
+			for _, fileInfo := range filesInfo {
+				names = append(names, fileInfo.Name)
+			}
+			if eof {
+				break
+			}
+			if len(xl.listPool.walkers) != 1 {
+				t.Fatalf("Test %d: expected listing saved for the next page", i+1)
+			}
+			marker = filesInfo[len(filesInfo)-1].Name
+		}
+		if !reflect.DeepEqual(names, testCase.names) {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.names, names)
+		}
+		if pages != 3 {
+			t.Errorf("Test %d: expected 3 pages, got %d", i+1, pages)
+		}
+		if len(xl.listPool.walkers) != 0 {
+			t.Errorf("Test %d: expected no listing saved after the last page", i+1)
+		}
+	}
+
+	// Listing fails without read quorum.
+	for _, disk := range disks[1:] {
+		if err = os.RemoveAll(filepath.Join(disk, "bucket")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err = xl.ListFiles("bucket", "", "", true, 10); err != errVolumeNotFound {
+		t.Fatalf("expected %s, got %v", errVolumeNotFound, err)
+	}
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"time"
 )
@@ -35,10 +36,151 @@ type xlMetaV1 struct {
 		DataBlocks   int   `json:"data"`
 		ParityBlocks int   `json:"parity"`
 		BlockSize    int64 `json:"blockSize"`
+		// Shards of small files are saved in the metadata of
+		// every disk rather than in part files.
+		Inline bool `json:"inline,omitempty"`
+		// Checksums of every block of the shard of the disk,
+		// checksums of all the shards are gathered from the
+		// metadata of every disk.
+		Checksum struct {
+			Algorithm string   `json:"algorithm,omitempty"`
+			Blocks    []string `json:"blocks,omitempty"`
+
+			// Checksums of every shard indexed by disk.
+			shards [][]string
+		} `json:"checksum"`
 	} `json:"erasure"`
 	Minio struct {
 		Release string `json:"release"`
 	} `json:"minio"`
+	// Parts of files committed from multipart uploads, in order,
+	// every part is erasure coded on its own.
+	Parts []xlMetaV1Part `json:"parts,omitempty"`
+	// Shard of the disk, for files saved inline.
+	Data []byte `json:"data,omitempty"`
+
+	// Number of the part described, for metadata of a single part.
+	part int
+}
+
+// xlMetaV1Part - part of a file committed from a multipart upload.
+type xlMetaV1Part struct {
+	Number int   `json:"number"`
+	Size   int64 `json:"size"`
+	// Checksums of every block of the shard of the disk.
+	Checksum []string `json:"checksum,omitempty"`
+
+	// Checksums of every shard indexed by disk.
+	shards [][]string
+}
+
+// partMetadata - returns metadata describing the part at index alone,
+// the part is read and healed as a file of its own.
+func (m xlMetaV1) partMetadata(index int) xlMetaV1 {
+	part := m.Parts[index]
+	m.Stat.Size = part.Size
+	m.Erasure.Checksum.Blocks = part.Checksum
+	m.Erasure.Checksum.shards = part.shards
+	m.Parts = nil
+	m.part = part.Number
+	return m
+}
+
+// gatherChecksums - gathers checksums of the shards of all the disks
+// from their metadata, disks which do not agree have none.
+func (m *xlMetaV1) gatherChecksums(partsMetadata []xlMetaV1, agreed []bool) {
+	m.Erasure.Checksum.shards = make([][]string, len(partsMetadata))
+	parts := make([]xlMetaV1Part, len(m.Parts))
+	for partIndex, part := range m.Parts {
+		part.shards = make([][]string, len(partsMetadata))
+		parts[partIndex] = part
+	}
+	m.Parts = parts
+	for index, metadata := range partsMetadata {
+		if !agreed[index] {
+			continue
+		}
+		m.Erasure.Checksum.shards[index] = metadata.Erasure.Checksum.Blocks
+		for partIndex := range m.Parts {
+			if partIndex < len(metadata.Parts) {
+				m.Parts[partIndex].shards[index] = metadata.Parts[partIndex].Checksum
+			}
+		}
+	}
+}
+
+// diskMetadata - returns metadata saved on disk index, carrying
+// checksums of the shard of the disk only.
+func (m xlMetaV1) diskMetadata(index int) xlMetaV1 {
+	m.Erasure.Checksum.Blocks = nil
+	if index < len(m.Erasure.Checksum.shards) {
+		m.Erasure.Checksum.Blocks = m.Erasure.Checksum.shards[index]
+	}
+	parts := make([]xlMetaV1Part, len(m.Parts))
+	for partIndex, part := range m.Parts {
+		part.Checksum = nil
+		if index < len(part.shards) {
+			part.Checksum = part.shards[index]
+		}
+		parts[partIndex] = part
+	}
+	if len(parts) > 0 {
+		m.Parts = parts
+	}
+	return m
+}
+
+// partsMetadata - returns metadata of every part of the file, a file
+// not committed from a multipart upload is its only part.
+func (m xlMetaV1) partsMetadata() []xlMetaV1 {
+	if len(m.Parts) == 0 {
+		return []xlMetaV1{m}
+	}
+	parts := make([]xlMetaV1, len(m.Parts))
+	for index := range m.Parts {
+		parts[index] = m.partMetadata(index)
+	}
+	return parts
+}
+
+// shardFile - returns name of the shard file of disk index.
+func (m xlMetaV1) shardFile(index int) string {
+	if m.part > 0 {
+		return fmt.Sprintf("part.%d.%d", m.part, index)
+	}
+	return fmt.Sprintf("file.%d", index)
+}
+
+// shardFiles - returns names of all the shard files of disk index,
+// files saved inline have none.
+func (m xlMetaV1) shardFiles(index int) []string {
+	if m.Erasure.Inline {
+		return nil
+	}
+	var files []string
+	for _, part := range m.partsMetadata() {
+		files = append(files, part.shardFile(index))
+	}
+	return files
+}
+
+// staleShardFiles - returns shard files of the old version of a file
+// on disk index which are not replaced by files of the new version.
+func staleShardFiles(old xlMetaV1, index int, files []string) []string {
+	var stale []string
+	for _, oldFile := range old.shardFiles(index) {
+		replaced := false
+		for _, file := range files {
+			if file == oldFile {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			stale = append(stale, oldFile)
+		}
+	}
+	return stale
 }
 
 // Write writes a metadata in wire format.
@@ -0,0 +1,167 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	slashpath "path"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// sameErasureLayout - verifies if files were erasure coded alike, their
+// shards can then be read and healed as parts of a single file.
+func sameErasureLayout(m1, m2 xlMetaV1) bool {
+	return m1.Erasure.DataBlocks == m2.Erasure.DataBlocks &&
+		m1.Erasure.ParityBlocks == m2.Erasure.ParityBlocks &&
+		m1.Erasure.BlockSize == m2.Erasure.BlockSize &&
+		m1.Erasure.Checksum.Algorithm == m2.Erasure.Checksum.Algorithm
+}
+
+// CommitParts - commits files at partPaths of minio meta volume, the
+// parts of a multipart upload, as the file at path of volume. Shard
+// files of the parts are moved into place as they were written, only
+// the metadata of the file recording the parts is written.
+func (xl XL) CommitParts(volume, path string, partPaths []string) error {
+	if !isValidVolname(volume) {
+		return errInvalidArgument
+	}
+	if !isValidPath(path) {
+		return errInvalidArgument
+	}
+	if len(partPaths) == 0 {
+		return errInvalidArgument
+	}
+
+	// Read metadata of all the parts, disks missing any of the parts
+	// are left with the old version of the file and healed later.
+	onlineDisks := make([]StorageAPI, len(xl.storageDisks))
+	copy(onlineDisks, xl.disks())
+	parts := make([]xlMetaV1Part, len(partPaths))
+	var layout xlMetaV1
+	var totalSize int64
+	for partIndex, partPath := range partPaths {
+		if !isValidPath(partPath) {
+			return errInvalidArgument
+		}
+		dLock := nsMutex.RLock(minioMetaBucket, partPath)
+		partDisks, metadata, _, err := xl.listOnlineDisks(minioMetaBucket, partPath)
+		nsMutex.RUnlock(minioMetaBucket, partPath, dLock)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": minioMetaBucket,
+				"path":   partPath,
+			}).Errorf("listOnlineDisks failed with %s", err)
+			return err
+		}
+		if partIndex == 0 {
+			layout = metadata
+		}
+		if !sameErasureLayout(layout, metadata) || metadata.Erasure.Inline || len(metadata.Parts) > 0 {
+			return errPartLayout
+		}
+		for index, disk := range partDisks {
+			if disk == nil {
+				onlineDisks[index] = nil
+			}
+		}
+		parts[partIndex] = xlMetaV1Part{
+			Number: partIndex + 1,
+			Size:   metadata.Stat.Size,
+			shards: metadata.Erasure.Checksum.shards,
+		}
+		totalSize += metadata.Stat.Size
+	}
+
+	// Lock right before reading from disk.
+	dLock := nsMutex.RLock(volume, path)
+	partsMetadata, errs := xl.getPartsMetadata(volume, path)
+	nsMutex.RUnlock(volume, path, dLock)
+
+	// Increment to have next higher version.
+	higherVersion := highestInt(listFileVersions(partsMetadata, errs)) + 1
+
+	metadata := xl.newMetadata(totalSize, time.Now().UTC(), higherVersion)
+	metadata.Erasure = layout.Erasure
+	metadata.Erasure.Checksum.Blocks = nil
+	metadata.Erasure.Checksum.shards = nil
+	metadata.Parts = parts
+
+	tmpPath, err := newTmpPath()
+	if err != nil {
+		return err
+	}
+	// Shard files of the parts are moved into place from where they
+	// were written, metadata is moved last. Disks the metadata is
+	// written on are committed, including the ones still writing
+	// once write quorum disks are written.
+	ops := make([]*tmpOp, len(xl.storageDisks))
+	xlMetaV1FilePath := slashpath.Join(tmpPath, xlMetaV1File)
+	errs = xl.fanOutOnDisks(onlineDisks, volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		err := writeMetadataFile(disk, minioMetaBucket, xlMetaV1FilePath, metadata.diskMetadata(index))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume":    volume,
+				"path":      path,
+				"diskIndex": index,
+			}).Errorf("Writing metadata failed with %s", err)
+			return err
+		}
+		op := &tmpOp{Volume: volume, Path: path}
+		for partIndex, part := range metadata.partsMetadata() {
+			op.Files = append(op.Files, part.shardFile(index))
+			op.Sources = append(op.Sources, slashpath.Join(partPaths[partIndex], layout.shardFile(index)))
+		}
+		op.Files = append(op.Files, xlMetaV1File)
+		op.Sources = append(op.Sources, "")
+		ops[index] = op
+		return nil
+	})
+	if countDiskErrs(errs) > len(xl.storageDisks)-xl.writeQuorum {
+		xl.purgeTmpOp(volume, path, tmpPath)
+		return errWriteQuorum
+	}
+
+	err = xl.commitTmpOp(volume, path, tmpPath, ops)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("Committing parts failed with %s", err)
+		return err
+	}
+
+	// Parts are left with their metadata and the shards of disks the
+	// commit failed on, remove them once the commit is done on their
+	// disk.
+	xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
+		for _, partPath := range partPaths {
+			for _, name := range []string{layout.shardFile(index), xlMetaV1File} {
+				err := disk.DeleteFile(minioMetaBucket, slashpath.Join(partPath, name))
+				if err != nil && err != errFileNotFound {
+					log.WithFields(logrus.Fields{
+						"volume":    minioMetaBucket,
+						"path":      partPath,
+						"diskIndex": index,
+					}).Errorf("DeleteFile failed with %s", err)
+				}
+			}
+		}
+		return nil
+	})
+	return nil
+}
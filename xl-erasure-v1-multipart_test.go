@@ -0,0 +1,143 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests parts are committed as a file by moving their shards into
+// place, and the file is read and healed part by part.
+func TestXLCommitParts(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parts span several stripes, the last part is small.
+	partSizes := []int{erasureBlockSize + 1024, erasureBlockSize, 100}
+	var data []byte
+	var partPaths []string
+	for index, size := range partSizes {
+		part := bytes.Repeat([]byte{byte('a' + index)}, size)
+		partPath := fmt.Sprintf("bucket/object/upload.%d", index+1)
+		if err = writeTestFile(xl, minioMetaBucket, partPath, part); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, part...)
+		partPaths = append(partPaths, partPath)
+	}
+	if err = writeTestFile(xl, "bucket", "object", []byte("old version")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shard files of the parts, to verify they are moved into place
+	// and not copied.
+	partShards := make([][]os.FileInfo, len(disks))
+	for index, disk := range disks {
+		for _, partPath := range partPaths {
+			shardInfo, err := os.Stat(filepath.Join(disk, minioMetaBucket, partPath, fmt.Sprintf("file.%d", index)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			partShards[index] = append(partShards[index], shardInfo)
+		}
+	}
+
+	if err = xl.CommitParts("bucket", "object", partPaths); err != nil {
+		t.Fatal(err)
+	}
+	waitDiskOps(xl)
+	for index, disk := range disks {
+		for partIndex, partShard := range partShards[index] {
+			shardInfo, err := os.Stat(filepath.Join(disk, "bucket", "object", fmt.Sprintf("part.%d.%d", partIndex+1, index)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(shardInfo, partShard) {
+				t.Errorf("Disk %d: expected shard of part %d to be moved, found a copy", index, partIndex+1)
+			}
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(disk, "bucket", "object"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(partSizes)+1 {
+			t.Errorf("expected shards of %d parts and metadata, found %d files", len(partSizes), len(entries))
+		}
+		if _, err = os.Stat(filepath.Join(disk, minioMetaBucket, "bucket", "object", "upload.1")); !os.IsNotExist(err) {
+			t.Errorf("expected parts to be removed, got %v", err)
+		}
+	}
+	fileInfo, err := xl.StatFile("bucket", "object")
+	if err != nil || fileInfo.Size != int64(len(data)) {
+		t.Fatalf("expected size %d, got %d, err %v", len(data), fileInfo.Size, err)
+	}
+
+	// Reads at offsets of every part and across part boundaries.
+	for _, offset := range []int64{0, 10, erasureBlockSize + 1024, erasureBlockSize + 1000, int64(len(data)) - 50} {
+		reader, err := xl.ReadFile("bucket", "object", offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("Offset %d: %s", offset, err)
+		}
+		if !bytes.Equal(got, data[offset:]) {
+			t.Errorf("Offset %d: read %d bytes not matching the parts", offset, len(got))
+		}
+	}
+
+	// Lost shard of a part is healed.
+	shardPath := filepath.Join(disks[1], "bucket", "object", "part.2.1")
+	if err = os.Remove(shardPath); err != nil {
+		t.Fatal(err)
+	}
+	xl.healFile("bucket", "object")
+	if _, err = os.Stat(shardPath); err != nil {
+		t.Fatalf("expected %s to be healed, got %s", shardPath, err)
+	}
+	if got, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected parts, got %d bytes, err %v", len(got), err)
+	}
+
+	// Shards of the parts are removed once the file is replaced.
+	if err = writeTestFile(xl, "bucket", "object", []byte("new version")); err != nil {
+		t.Fatal(err)
+	}
+	if count := countPartFiles(t, disks, "bucket", "object"); count != 0 {
+		t.Errorf("expected no shard files, found %d", count)
+	}
+
+	// Missing parts are not committed.
+	if err = xl.CommitParts("bucket", "object", partPaths); err != errFileNotFound {
+		t.Fatalf("expected %s, got %v", errFileNotFound, err)
+	}
+}
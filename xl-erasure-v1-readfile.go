@@ -17,12 +17,15 @@
 package main
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
 	"io"
+	"io/ioutil"
 	slashpath "path"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/klauspost/reedsolomon"
 )
 
 // ReadFile - read file
@@ -36,9 +39,9 @@ func (xl XL) ReadFile(volume, path string, offset int64) (io.ReadCloser, error)
 	}
 
 	// Acquire a read lock.
-	nsMutex.RLock(volume, path)
-	onlineDisks, metadata, heal, err := xl.listOnlineDisks(volume, path)
-	nsMutex.RUnlock(volume, path)
+	dLock := nsMutex.RLock(volume, path)
+	onlineDisks, partsMetadata, metadata, heal, err := xl.listOnlineParts(volume, path)
+	nsMutex.RUnlock(volume, path, dLock)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
@@ -47,11 +50,21 @@ func (xl XL) ReadFile(volume, path string, offset int64) (io.ReadCloser, error)
 		return nil, err
 	}
 
+	// Files are decoded with the layout they were written with.
+	rs, err := xl.getReedSolomon(metadata)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("Initializing erasure decoder failed with %s", err)
+		return nil, err
+	}
+
 	if heal {
 		// Heal in background safely, since we already have read
 		// quorum disks. Let the reads continue.
 		go func() {
-			if err = xl.healFile(volume, path); err != nil {
+			if err := xl.background().healFile(volume, path); err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
@@ -61,140 +74,381 @@ func (xl XL) ReadFile(volume, path string, offset int64) (io.ReadCloser, error)
 		}()
 	}
 
-	// Acquire read lock again.
-	nsMutex.RLock(volume, path)
-	readers := make([]io.ReadCloser, len(xl.storageDisks))
-	for index, disk := range onlineDisks {
-		if disk == nil {
-			continue
-		}
-		erasurePart := slashpath.Join(path, fmt.Sprintf("file.%d", index))
-		// If disk.ReadFile returns error and we don't have read quorum it will be taken care as
-		// ReedSolomon.Reconstruct() will fail later.
-		var reader io.ReadCloser
-		if reader, err = disk.ReadFile(volume, erasurePart, offset); err == nil {
-			readers[index] = reader
-		}
+	// Files committed from multipart uploads are read part by part,
+	// starting at the part holding offset.
+	parts := metadata.partsMetadata()
+	for len(parts) > 1 && offset >= parts[0].Stat.Size {
+		offset -= parts[0].Stat.Size
+		parts = parts[1:]
 	}
-	nsMutex.RUnlock(volume, path)
 
 	// Initialize pipe.
 	pipeReader, pipeWriter := io.Pipe()
 	go func() {
-		var totalLeft = metadata.Stat.Size
-		// Read until the totalLeft.
-		for totalLeft > 0 {
-			// Figure out the right blockSize as it was encoded before.
-			var curBlockSize int64
-			if metadata.Erasure.BlockSize < totalLeft {
-				curBlockSize = metadata.Erasure.BlockSize
-			} else {
-				curBlockSize = totalLeft
-			}
-			// Calculate the current encoded block size.
-			curEncBlockSize := getEncodedBlockLen(curBlockSize, metadata.Erasure.DataBlocks)
-			enBlocks := make([][]byte, len(xl.storageDisks))
-			// Loop through all readers and read.
-			for index, reader := range readers {
-				// Initialize shard slice and fill the data from each parts.
-				enBlocks[index] = make([]byte, curEncBlockSize)
-				if reader == nil {
-					continue
-				}
-				_, err = io.ReadFull(reader, enBlocks[index])
-				if err != nil && err != io.ErrUnexpectedEOF {
-					readers[index] = nil
-				}
+		bitrotDetected := false
+		for _, part := range parts {
+			shards := newShardReaders(xl, volume, path, onlineDisks, partsMetadata, part)
+			err := xl.decodeShards(pipeWriter, shards, rs, offset)
+			shards.Close()
+			bitrotDetected = bitrotDetected || shards.bitrotDetected
+			if err != nil {
+				pipeWriter.CloseWithError(err)
+				return
 			}
+			offset = 0
+		}
+
+		// Cleanly end the pipe after a successful decoding.
+		pipeWriter.Close()
 
-			// Check blocks if they are all zero in length.
-			if checkBlockSize(enBlocks) == 0 {
+		// Queue corrupted shards for healing, unless healing was
+		// already started above.
+		if bitrotDetected && !heal {
+			if err := xl.background().healFile(volume, path); err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
-				}).Errorf("%s", errDataCorrupt)
-				pipeWriter.CloseWithError(errDataCorrupt)
-				return
+				}).Errorf("healFile failed with %s", err)
 			}
+		}
+	}()
 
-			// Verify the blocks.
+	// Return the pipe for the top level caller to start reading.
+	return pipeReader, nil
+}
+
+// decodeShards - decodes the file read by shards starting at offset
+// and writes it to writer.
+func (xl XL) decodeShards(writer io.Writer, shards *shardReaders, rs reedsolomon.Encoder, offset int64) (err error) {
+	metadata := shards.metadata
+	volume, path := shards.volume, shards.path
+
+	// Reads start at the stripe holding offset, the bytes of the
+	// stripe before offset are skipped once decoded.
+	blockSize := metadata.Erasure.BlockSize
+	startBlock := offset / blockSize
+	skipSize := offset % blockSize
+	var totalLeft = metadata.Stat.Size - startBlock*blockSize
+	// Read until the totalLeft.
+	for block := int(startBlock); totalLeft > 0; block++ {
+		// Figure out the right blockSize as it was encoded before.
+		var curBlockSize int64
+		if blockSize < totalLeft {
+			curBlockSize = blockSize
+		} else {
+			curBlockSize = totalLeft
+		}
+		// Calculate the current encoded block size, all the
+		// previous blocks are full blocks.
+		curEncBlockSize := getEncodedBlockLen(curBlockSize, metadata.Erasure.DataBlocks)
+		shardOffset := int64(block) * getEncodedBlockLen(blockSize, metadata.Erasure.DataBlocks)
+
+		var enBlocks [][]byte
+		enBlocks, err = shards.readStripe(block, shardOffset, curEncBlockSize)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+				"path":   path,
+			}).Errorf("Reading erasure blocks failed with %s", err)
+			return err
+		}
+
+		// Data blocks are missing, reconstruct the stripe from
+		// the parity blocks.
+		if !hasDataBlocks(enBlocks, metadata.Erasure.DataBlocks) {
+			err = rs.Reconstruct(enBlocks)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"volume": volume,
+					"path":   path,
+				}).Errorf("ReedSolomon reconstruct failed with %s", err)
+				return err
+			}
+			// Verify reconstructed blocks.
 			var ok bool
-			ok, err = xl.ReedSolomon.Verify(enBlocks)
+			ok, err = rs.Verify(enBlocks)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
 				}).Errorf("ReedSolomon verify failed with %s", err)
-				pipeWriter.CloseWithError(err)
-				return
+				return err
 			}
-
-			// Verification failed, blocks require reconstruction.
 			if !ok {
-				for index, reader := range readers {
-					if reader == nil {
-						// Reconstruct expects missing blocks to be nil.
-						enBlocks[index] = nil
-					}
-				}
-				err = xl.ReedSolomon.Reconstruct(enBlocks)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"volume": volume,
-						"path":   path,
-					}).Errorf("ReedSolomon reconstruct failed with %s", err)
-					pipeWriter.CloseWithError(err)
-					return
-				}
-				// Verify reconstructed blocks again.
-				ok, err = xl.ReedSolomon.Verify(enBlocks)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"volume": volume,
-						"path":   path,
-					}).Errorf("ReedSolomon verify failed with %s", err)
-					pipeWriter.CloseWithError(err)
-					return
-				}
-				if !ok {
-					// Blocks cannot be reconstructed, corrupted data.
-					err = errors.New("Verification failed after reconstruction, data likely corrupted.")
-					log.WithFields(logrus.Fields{
-						"volume": volume,
-						"path":   path,
-					}).Errorf("%s", err)
-					pipeWriter.CloseWithError(err)
-					return
-				}
-			}
-
-			// Join the decoded blocks.
-			err = xl.ReedSolomon.Join(pipeWriter, enBlocks, int(curBlockSize))
-			if err != nil {
+				// Blocks cannot be reconstructed, corrupted data.
+				err = errors.New("Verification failed after reconstruction, data likely corrupted.")
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
-				}).Errorf("ReedSolomon joining decoded blocks failed with %s", err)
-				pipeWriter.CloseWithError(err)
-				return
+				}).Errorf("%s", err)
+				return err
 			}
+		}
 
-			// Save what's left after reading erasureBlockSize.
-			totalLeft = totalLeft - metadata.Erasure.BlockSize
+		// Join the decoded blocks, skipping the bytes before
+		// offset in the first stripe.
+		if skipSize > 0 {
+			var buf bytes.Buffer
+			if err = rs.Join(&buf, enBlocks, int(curBlockSize)); err == nil {
+				_, err = writer.Write(buf.Bytes()[skipSize:])
+			}
+			skipSize = 0
+		} else {
+			err = rs.Join(writer, enBlocks, int(curBlockSize))
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"volume": volume,
+				"path":   path,
+			}).Errorf("ReedSolomon joining decoded blocks failed with %s", err)
+			return err
 		}
 
-		// Cleanly end the pipe after a successful decoding.
-		pipeWriter.Close()
+		// Save what's left after reading erasureBlockSize.
+		totalLeft = totalLeft - blockSize
+	}
 
-		// Cleanly close all the underlying data readers.
-		for _, reader := range readers {
-			if reader == nil {
-				continue
-			}
-			reader.Close()
+	return nil
+}
+
+// shardReaders - readers of the shards of a file. Only as many shards
+// as there are data blocks are read, preferring data shards, further
+// shards are opened once a shard fails.
+type shardReaders struct {
+	xl       XL
+	volume   string
+	path     string
+	metadata xlMetaV1
+	// Shards saved inline in the metadata of every disk, indexed by
+	// disk.
+	inline [][]byte
+
+	// Opens and reads left in progress by fan-outs which returned
+	// early update the fields below.
+	mutex *sync.Mutex
+	// Readers of the opened shards, indexed by disk.
+	readers []io.ReadCloser
+	// Shards being opened, indexed by disk.
+	opening []bool
+	// Shards which are not online, failed to read or are corrupted.
+	failed         []bool
+	bitrotDetected bool
+}
+
+// newShardReaders - initializes shard readers on online disks, no
+// shard is opened until the first stripe is read.
+func newShardReaders(xl XL, volume, path string, onlineDisks []StorageAPI, partsMetadata []xlMetaV1, metadata xlMetaV1) *shardReaders {
+	failed := make([]bool, len(onlineDisks))
+	var inline [][]byte
+	if metadata.Erasure.Inline {
+		inline = make([][]byte, len(onlineDisks))
+	}
+	for index, disk := range onlineDisks {
+		failed[index] = disk == nil
+		if inline != nil && disk != nil {
+			inline[index] = partsMetadata[index].Data
+		}
+	}
+	return &shardReaders{
+		xl:       xl,
+		volume:   volume,
+		path:     path,
+		metadata: metadata,
+		inline:   inline,
+		mutex:    &sync.Mutex{},
+		readers:  make([]io.ReadCloser, len(onlineDisks)),
+		opening:  make([]bool, len(onlineDisks)),
+		failed:   failed,
+	}
+}
+
+// open - opens count shards which are neither open, being opened nor
+// failed at shardOffset, in disk order. Shards which fail to open are
+// failed. Returns once the shards are open or one of them failed.
+func (s *shardReaders) open(count int, shardOffset int64) {
+	want := make([]bool, len(s.readers))
+	s.mutex.Lock()
+	for index := range s.readers {
+		if count == 0 {
+			break
+		}
+		if s.readers[index] == nil && !s.opening[index] && !s.failed[index] {
+			want[index] = true
+			s.opening[index] = true
+			count--
+		}
+	}
+	s.mutex.Unlock()
+	wantCount := len(want) - count
+
+	// Shards of a newer version are not to be mixed in.
+	dLock := nsMutex.RLock(s.volume, s.path)
+	defer nsMutex.RUnlock(s.volume, s.path, dLock)
+	s.xl.fanOutDisks(s.volume, s.path, wantCount, func(index int, disk StorageAPI) error {
+		if !want[index] {
+			return errDiskSkipped
+		}
+		reader, err := s.openShard(index, disk, shardOffset)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.opening[index] = false
+		if err != nil {
+			s.failed[index] = true
+			return err
+		}
+		s.readers[index] = reader
+		return nil
+	})
+}
+
+// openShard - opens the shard of disk index at shardOffset. The file
+// may have been replaced since its metadata was read, shards are
+// verified to be of the version being read.
+func (s *shardReaders) openShard(index int, disk StorageAPI, shardOffset int64) (io.ReadCloser, error) {
+	// Shards saved inline were read along with the metadata.
+	if s.inline != nil {
+		shard := s.inline[index]
+		if shardOffset > int64(len(shard)) {
+			return nil, errFileNotFound
+		}
+		return ioutil.NopCloser(bytes.NewReader(shard[shardOffset:])), nil
+	}
+	metadata, err := extractMetadata(disk, s.volume, s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !s.isShardVersion(index, metadata) {
+		return nil, errFileVersion
+	}
+	erasurePart := slashpath.Join(s.path, s.metadata.shardFile(index))
+	reader, err := disk.ReadFile(s.volume, erasurePart, shardOffset)
+	if err != nil {
+		globalMetrics.erasureReadError(disk)
+		return nil, err
+	}
+	return reader, nil
+}
+
+// isShardVersion - verifies metadata of disk index describes the
+// shard of the version being read, with the same block checksums.
+func (s *shardReaders) isShardVersion(index int, metadata xlMetaV1) bool {
+	if metadata.Stat.Version != s.metadata.Stat.Version || !metadata.Stat.ModTime.Equal(s.metadata.Stat.ModTime) {
+		return false
+	}
+	checksums := metadata.Erasure.Checksum.Blocks
+	if s.metadata.part > 0 {
+		if s.metadata.part > len(metadata.Parts) {
+			return false
 		}
+		checksums = metadata.Parts[s.metadata.part-1].Checksum
+	}
+	var quorumChecksums []string
+	if index < len(s.metadata.Erasure.Checksum.shards) {
+		quorumChecksums = s.metadata.Erasure.Checksum.shards[index]
+	}
+	if len(checksums) != len(quorumChecksums) {
+		return false
+	}
+	for block := range checksums {
+		if checksums[block] != quorumChecksums[block] {
+			return false
+		}
+	}
+	return true
+}
+
+// readStripe - reads the blocks of a stripe from data blocks count of
+// shards, missing blocks are nil. Failed and corrupted shards are
+// replaced by opening further shards at shardOffset, the offset of
+// the stripe in the shards. Blocks read once the stripe is returned
+// are dropped.
+func (s *shardReaders) readStripe(block int, shardOffset, encBlockSize int64) ([][]byte, error) {
+	metadata := s.metadata
+	enBlocks := make([][]byte, len(s.readers))
+	returned := false
+	defer func() {
+		s.mutex.Lock()
+		returned = true
+		s.mutex.Unlock()
 	}()
+	readCount := 0
+	for readCount < metadata.Erasure.DataBlocks {
+		// Open shards to make up for the missing blocks.
+		if missing := metadata.Erasure.DataBlocks - readCount - s.pending(enBlocks); missing > 0 {
+			s.open(missing, shardOffset)
+		}
+		if s.pending(enBlocks) == 0 {
+			return nil, errReadQuorum
+		}
+		s.xl.fanOutDisks(s.volume, s.path, metadata.Erasure.DataBlocks-readCount, func(index int, disk StorageAPI) error {
+			s.mutex.Lock()
+			reader := s.readers[index]
+			skip := reader == nil || enBlocks[index] != nil
+			s.mutex.Unlock()
+			if skip {
+				return errDiskSkipped
+			}
+			data := make([]byte, encBlockSize)
+			_, err := io.ReadFull(reader, data)
+			if err != nil {
+				globalMetrics.erasureReadError(disk)
+			} else if !metadata.verifyBlock(index, block, data) {
+				// Corrupted shards are treated as missing and
+				// reconstructed from the rest.
+				reportBitrot(disk, s.volume, s.path, index, block)
+				err = errBitrot
+			}
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if err != nil {
+				s.bitrotDetected = s.bitrotDetected || err == errBitrot
+				reader.Close()
+				s.readers[index] = nil
+				s.failed[index] = true
+				return err
+			}
+			if !returned {
+				enBlocks[index] = data
+			}
+			return nil
+		})
+		s.mutex.Lock()
+		readCount = 0
+		for _, data := range enBlocks {
+			if data != nil {
+				readCount++
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return enBlocks, nil
+}
 
-	// Return the pipe for the top level caller to start reading.
-	return pipeReader, nil
+// pending - returns count of open shards and shards being opened
+// whose block is not read.
+func (s *shardReaders) pending(enBlocks [][]byte) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := 0
+	for index, reader := range s.readers {
+		if (reader != nil || s.opening[index]) && enBlocks[index] == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Close - closes all the open shards, once the opens and reads left
+// in progress are done.
+func (s *shardReaders) Close() error {
+	s.xl.fanOutDisks(s.volume, s.path, 0, func(index int, disk StorageAPI) error {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.readers[index] != nil {
+			s.readers[index].Close()
+			s.readers[index] = nil
+		}
+		return nil
+	})
+	return nil
 }
@@ -0,0 +1,170 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shardReadDisk - records offsets of the shards read from the disk.
+type shardReadDisk struct {
+	StorageAPI
+	mutex   *sync.Mutex
+	offsets map[string]int64
+}
+
+func (d shardReadDisk) ReadFile(volume, path string, offset int64) (io.ReadCloser, error) {
+	if !strings.HasSuffix(path, xlMetaV1File) {
+		d.mutex.Lock()
+		d.offsets[path] = offset
+		d.mutex.Unlock()
+	}
+	return d.StorageAPI.ReadFile(volume, path, offset)
+}
+
+// Tests only data shards are read on the happy path, from the stripe
+// holding the offset, and parity shards replace failed data shards.
+func TestXLReadFileDataShards(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three stripes, the last one partial.
+	data := make([]byte, 2*erasureBlockSize+1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	writer, err := xl.CreateFile("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	offsets := make(map[string]int64)
+	for index, disk := range xl.storageDisks {
+		xl.storageDisks[index] = shardReadDisk{disk, &mutex, offsets}
+	}
+	encBlockSize := getEncodedBlockLen(erasureBlockSize, xl.DataBlocks)
+
+	testCases := []struct {
+		offset      int64
+		shardOffset int64
+		removeShard string
+		readShards  []string
+	}{
+		{0, 0, "", []string{"object/file.0", "object/file.1"}},
+		{erasureBlockSize + 10, encBlockSize, "", []string{"object/file.0", "object/file.1"}},
+		{2*erasureBlockSize + 100, 2 * encBlockSize, "", []string{"object/file.0", "object/file.1"}},
+		// Parity shard is read once a data shard is missing.
+		{erasureBlockSize - 1, 0, "object/file.0", []string{"object/file.0", "object/file.1", "object/file.2"}},
+	}
+	for i, testCase := range testCases {
+		if testCase.removeShard != "" {
+			if err = xl.storageDisks[0].DeleteFile("bucket", testCase.removeShard); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for path := range offsets {
+			delete(offsets, path)
+		}
+		reader, err := xl.ReadFile("bucket", "object", testCase.offset)
+		if err != nil {
+			t.Fatalf("Test %d: %s", i+1, err)
+		}
+		got, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Test %d: %s", i+1, err)
+		}
+		if !bytes.Equal(got, data[testCase.offset:]) {
+			t.Errorf("Test %d: read %d bytes not matching the written data", i+1, len(got))
+		}
+		mutex.Lock()
+		if len(offsets) != len(testCase.readShards) {
+			t.Errorf("Test %d: expected shards %v, read %v", i+1, testCase.readShards, offsets)
+		}
+		for _, shard := range testCase.readShards {
+			if offset, ok := offsets[shard]; !ok || offset != testCase.shardOffset {
+				t.Errorf("Test %d: expected %s read at %d, read %v", i+1, shard, testCase.shardOffset, offsets)
+			}
+		}
+		mutex.Unlock()
+	}
+}
+
+// Tests shards of a file replaced before its first stripe is read are
+// not mixed in with the version being read.
+func TestXLReadFileReplaced(t *testing.T) {
+	initNSLock()
+	disks, removeDisks := newTestFormatDisks(t, 4)
+	defer removeDisks()
+	xl, err := newTestFormattedXL(t, disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xl.MakeVol("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	oldData := bytes.Repeat([]byte("a"), erasureBlockSize+1024)
+	if err = writeTestFile(xl, "bucket", "object", oldData); err != nil {
+		t.Fatal(err)
+	}
+	onlineDisks, partsMetadata, metadata, _, err := xl.listOnlineParts("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := xl.getReedSolomon(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := newShardReaders(*xl, "bucket", "object", onlineDisks, partsMetadata, metadata)
+	defer shards.Close()
+
+	// New version of the same size replaces the file before any
+	// shard is opened.
+	newData := bytes.Repeat([]byte("b"), len(oldData))
+	if err = writeTestFile(xl, "bucket", "object", newData); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = xl.decodeShards(&buf, shards, rs, 0); err == nil {
+		t.Fatal("expected read of the replaced version to fail")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no data of the new version, read %d bytes", buf.Len())
+	}
+	if got, err := readTestFile(xl, "bucket", "object"); err != nil || !bytes.Equal(got, newData) {
+		t.Fatalf("expected new data, got %d bytes, err %v", len(got), err)
+	}
+}
@@ -34,3 +34,14 @@ func getEncodedBlockLen(inputLen int64, dataBlocks int) (curBlockSize int64) {
 	curBlockSize = (inputLen + int64(dataBlocks) - 1) / int64(dataBlocks)
 	return curBlockSize
 }
+
+// hasDataBlocks - verifies if all the data blocks of a stripe are
+// present.
+func hasDataBlocks(enBlocks [][]byte, dataBlocks int) bool {
+	for _, block := range enBlocks[:dataBlocks] {
+		if block == nil {
+			return false
+		}
+	}
+	return true
+}
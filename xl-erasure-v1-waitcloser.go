@@ -28,6 +28,7 @@ import (
 type waitCloser struct {
 	wg     *sync.WaitGroup // Waitgroup for atomicity.
 	writer io.WriteCloser  // Embedded writer.
+	err    error           // Error the writer was released with.
 }
 
 // Write to the underlying writer.
@@ -40,12 +41,17 @@ func (b *waitCloser) Write(data []byte) (int, error) {
 func (b *waitCloser) Close() error {
 	err := b.writer.Close()
 	b.wg.Wait()
+	if err == nil {
+		err = b.err
+	}
 	return err
 }
 
-// release the Close, causing it to unblock. Only call this
-// once. Calling it multiple times results in a panic.
-func (b *waitCloser) release() {
+// release the Close with the error of the read consumer, causing it
+// to unblock. Only call this once. Calling it multiple times results
+// in a panic.
+func (b *waitCloser) release(err error) {
+	b.err = err
 	b.wg.Done()
 	return
 }
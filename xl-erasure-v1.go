@@ -17,12 +17,9 @@
 package main
 
 import (
-	"fmt"
-	"io"
 	"os"
 	slashpath "path"
 	"sort"
-	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/klauspost/reedsolomon"
@@ -40,15 +37,27 @@ type XL struct {
 	ReedSolomon  reedsolomon.Encoder // Erasure encoder/decoder.
 	DataBlocks   int
 	ParityBlocks int
-	storageDisks []StorageAPI
-	readQuorum   int
-	writeQuorum  int
+	// Hash algorithm of block checksums of newly written files.
+	bitrotAlgorithm string
+	// Files up to this size are saved inline in their metadata.
+	inlineThreshold int64
+	storageDisks    []StorageAPI
+	readQuorum      int
+	writeQuorum     int
+	// Disks are validated and ordered by their format.
+	formatted bool
+	// Listings saved to continue on their next page.
+	listPool *xlListPool
+	// Operations left running on disks by fan-outs.
+	pending *pendingDiskOps
+	// Disks waiting to be placed by their format.
+	placement *diskPlacement
 }
 
 // newXL instantiate a new XL.
 func newXL(disks ...string) (StorageAPI, error) {
 	// Initialize XL.
-	xl := &XL{}
+	xl := &XL{listPool: newXLListPool(), pending: newPendingDiskOps(), placement: &diskPlacement{}}
 
 	// Verify disks.
 	totalDisks := len(disks)
@@ -56,18 +65,18 @@ func newXL(disks ...string) (StorageAPI, error) {
 		return nil, errMaxDisks
 	}
 
-	// isEven function to verify if a given number if even.
-	isEven := func(number int) bool {
-		return number%2 == 0
+	// Calculate data and parity blocks, parity defaults to half of
+	// the disks.
+	parityBlocks := getParityBlocks()
+	if parityBlocks == 0 {
+		parityBlocks = totalDisks / 2
 	}
-
-	// TODO: verify if this makes sense in future.
-	if !isEven(totalDisks) {
-		return nil, errNumDisks
+	// Parity blocks can not outnumber data blocks, since read and
+	// write quorums would no longer overlap.
+	if parityBlocks < 1 || parityBlocks > totalDisks/2 {
+		return nil, errParityBlocks
 	}
-
-	// Calculate data and parity blocks.
-	dataBlocks, parityBlocks := totalDisks/2, totalDisks/2
+	dataBlocks := totalDisks - parityBlocks
 
 	// Initialize reed solomon encoding.
 	rs, err := reedsolomon.New(dataBlocks, parityBlocks)
@@ -75,40 +84,88 @@ func newXL(disks ...string) (StorageAPI, error) {
 		return nil, err
 	}
 
+	// Verify bitrot algorithm.
+	bitrotAlgorithm := getBitrotAlgorithm()
+	if !isValidBitrotAlgorithm(bitrotAlgorithm) {
+		return nil, errBitrotAlgorithm
+	}
+	xl.bitrotAlgorithm = bitrotAlgorithm
+	xl.inlineThreshold = getInlineThreshold()
+
 	// Save the reedsolomon.
 	xl.DataBlocks = dataBlocks
 	xl.ParityBlocks = parityBlocks
 	xl.ReedSolomon = rs
 
-	// Initialize all storage disks.
+	// Initialize all storage disks, health of each disk is tracked
+	// so that failed disks are skipped until they are back.
 	storageDisks := make([]StorageAPI, len(disks))
 	for index, disk := range disks {
-		var err error
-		storageDisks[index], err = newPosix(disk)
+		storage, err := newStorageAPI(disk)
 		if err != nil {
 			return nil, err
 		}
+		storageDisks[index] = newTrackedDisk(storage)
 	}
 
 	// Save all the initialized storage disks.
 	xl.storageDisks = storageDisks
 
-	// Figure out read and write quorum based on number of storage disks.
-	// Read quorum should be always N/2 + 1 (due to Vandermonde matrix
-	// erasure requirements)
-	xl.readQuorum = len(xl.storageDisks)/2 + 1
-
-	// Write quorum is assumed if we have total disks + 3
-	// parity. (Need to discuss this again)
-	xl.writeQuorum = len(xl.storageDisks)/2 + 3
-	if xl.writeQuorum > len(xl.storageDisks) {
-		xl.writeQuorum = len(xl.storageDisks)
+	// Figure out read and write quorum based on data and parity
+	// blocks. Reads need at least data blocks to reconstruct, writes
+	// need one more when data and parity are equal so that every
+	// read quorum overlaps with the last write quorum.
+	xl.readQuorum = dataBlocks
+	xl.writeQuorum = dataBlocks
+	if dataBlocks == parityBlocks {
+		xl.writeQuorum++
 	}
 
 	// Return successfully initialized.
 	return xl, nil
 }
 
+// background - returns a view of XL scheduling its disk operations
+// behind foreground reads and writes, for healing and scanning.
+func (xl XL) background() *XL {
+	storageDisks := xl.disks()
+	for index, disk := range storageDisks {
+		storageDisks[index] = withIOClass(disk, ioBackground)
+	}
+	xl.storageDisks = storageDisks
+	return &xl
+}
+
+// disks - returns the disks at every position, disks placed after
+// boot included. Positions without an identified disk are nil.
+func (xl XL) disks() []StorageAPI {
+	xl.placement.mutex.RLock()
+	defer xl.placement.mutex.RUnlock()
+	return append([]StorageAPI(nil), xl.storageDisks...)
+}
+
+// getParityBlocks - returns configured parity blocks, zero when the
+// default should be used.
+func getParityBlocks() int {
+	if serverConfig == nil {
+		return 0
+	}
+	return serverConfig.GetErasure().ParityBlocks
+}
+
+// getReedSolomon - returns erasure encoder for the layout a file was
+// written with, files keep their layout even if parity is changed.
+func (xl XL) getReedSolomon(metadata xlMetaV1) (reedsolomon.Encoder, error) {
+	dataBlocks, parityBlocks := metadata.Erasure.DataBlocks, metadata.Erasure.ParityBlocks
+	if dataBlocks == xl.DataBlocks && parityBlocks == xl.ParityBlocks {
+		return xl.ReedSolomon, nil
+	}
+	if dataBlocks+parityBlocks != len(xl.storageDisks) {
+		return nil, errDataCorrupt
+	}
+	return reedsolomon.New(dataBlocks, parityBlocks)
+}
+
 // MakeVol - make a volume.
 func (xl XL) MakeVol(volume string) error {
 	if !isValidVolname(volume) {
@@ -133,30 +190,40 @@ func (xl XL) MakeVol(volume string) error {
 		}
 	}
 
+	// Make a volume entry on all underlying storage disks, existing
+	// volumes do not count against write quorum.
+	errs = xl.fanOutDisks(volume, "", xl.writeQuorum, func(index int, disk StorageAPI) error {
+		return disk.MakeVol(volume)
+	}, errVolumeExists)
+
 	createVolErr := 0
 	volumeExistsErrCnt := 0
-	// Make a volume entry on all underlying storage disks.
-	for _, disk := range xl.storageDisks {
-		if err := disk.MakeVol(volume); err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-			}).Errorf("MakeVol failed with %s", err)
-			// if volume already exists, count them.
-			if err == errVolumeExists {
-				volumeExistsErrCnt++
-				// Return err if all disks report volume exists.
-				if volumeExistsErrCnt == len(xl.storageDisks) {
-					return errVolumeExists
-				}
-				continue
-			}
-			// Update error counter separately.
-			createVolErr++
-			if createVolErr <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
-			}
-			return errWriteQuorum
+	finishedCount := 0
+	for _, err := range errs {
+		if err == errDiskPending {
+			continue
+		}
+		finishedCount++
+		if err == nil {
+			continue
+		}
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+		}).Errorf("MakeVol failed with %s", err)
+		// if volume already exists, count them.
+		if err == errVolumeExists {
+			volumeExistsErrCnt++
+			continue
 		}
+		// Update error counter separately.
+		createVolErr++
+	}
+	if createVolErr > len(xl.storageDisks)-xl.writeQuorum {
+		return errWriteQuorum
+	}
+	// Return err if all finished disks report volume exists.
+	if volumeExistsErrCnt == finishedCount {
+		return errVolumeExists
 	}
 	return nil
 }
@@ -167,22 +234,27 @@ func (xl XL) DeleteVol(volume string) error {
 		return errInvalidArgument
 	}
 
+	// Remove a volume entry on all underlying storage disks, any
+	// failure other than errVolumeNotFound is returned.
+	errs := xl.fanOutDisks(volume, "", len(xl.storageDisks), func(index int, disk StorageAPI) error {
+		return disk.DeleteVol(volume)
+	}, errVolumeNotFound)
+
 	// Collect if all disks report volume not found.
 	var volumeNotFoundErrCnt int
-
-	// Remove a volume entry on all underlying storage disks.
-	for _, disk := range xl.storageDisks {
-		if err := disk.DeleteVol(volume); err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-			}).Errorf("DeleteVol failed with %s", err)
-			// We ignore error if errVolumeNotFound.
-			if err == errVolumeNotFound {
-				volumeNotFoundErrCnt++
-				continue
-			}
-			return err
+	for _, err := range errs {
+		if err == nil || err == errDiskPending {
+			continue
 		}
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+		}).Errorf("DeleteVol failed with %s", err)
+		// We ignore error if errVolumeNotFound.
+		if err == errVolumeNotFound {
+			volumeNotFoundErrCnt++
+			continue
+		}
+		return err
 	}
 	// Return err if all disks report volume not found.
 	if volumeNotFoundErrCnt == len(xl.storageDisks) {
@@ -197,10 +269,15 @@ func (xl XL) ListVols() (volsInfo []VolInfo, err error) {
 	// Success vols map carries successful results of ListVols from
 	// each disks.
 	var successVolsMap = make(map[int][]VolInfo)
-	for index, disk := range xl.storageDisks {
-		var vlsInfo []VolInfo
-		vlsInfo, err = disk.ListVols()
-		if err == nil {
+	vlsInfos := make([][]VolInfo, len(xl.storageDisks))
+	// Volumes missing on some of the disks are listed too, wait
+	// for all the disks.
+	errs := xl.fanOutDisks("", "", 0, func(index int, disk StorageAPI) (err error) {
+		vlsInfos[index], err = disk.ListVols()
+		return err
+	})
+	for index, vlsInfo := range vlsInfos {
+		if errs[index] == nil {
 			if len(vlsInfo) == 0 {
 				emptyCount++
 			} else {
@@ -245,16 +322,16 @@ func (xl XL) ListVols() (volsInfo []VolInfo, err error) {
 // getAllVolumeInfo - get bucket volume info from all disks.
 // Returns error slice indicating the failed volume stat operations.
 func (xl XL) getAllVolumeInfo(volume string) (volsInfo []VolInfo, errs []error) {
-	errs = make([]error, len(xl.storageDisks))
 	volsInfo = make([]VolInfo, len(xl.storageDisks))
-	for index, disk := range xl.storageDisks {
+	// Not found votes of all the disks are needed, wait for all.
+	errs = xl.fanOutDisks(volume, "", 0, func(index int, disk StorageAPI) error {
 		volInfo, err := disk.StatVol(volume)
 		if err != nil {
-			errs[index] = err
-			continue
+			return err
 		}
 		volsInfo[index] = volInfo
-	}
+		return nil
+	})
 	return volsInfo, errs
 }
 
@@ -328,6 +405,9 @@ func (xl XL) healVolume(volume string) error {
 			continue
 		}
 		// Volinfo name would be an empty string, create it.
+		if xl.storageDisks[index] == nil {
+			continue
+		}
 		if err = xl.storageDisks[index].MakeVol(volume); err != nil {
 			if err != nil {
 				log.WithFields(logrus.Fields{
@@ -355,7 +435,7 @@ func (xl XL) StatVol(volume string) (volInfo VolInfo, err error) {
 
 	if heal {
 		go func() {
-			if err = xl.healVolume(volume); err != nil {
+			if err = xl.background().healVolume(volume); err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 				}).Errorf("healVolume failed with %s", err)
@@ -469,69 +549,9 @@ func (d byFileInfoName) Len() int           { return len(d) }
 func (d byFileInfoName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
 func (d byFileInfoName) Less(i, j int) bool { return d[i].Name < d[j].Name }
 
-// ListFiles files at prefix.
-func (xl XL) ListFiles(volume, prefix, marker string, recursive bool, count int) (filesInfo []FileInfo, eof bool, err error) {
-	if !isValidVolname(volume) {
-		return nil, true, errInvalidArgument
-	}
-
-	// TODO: Fix: If readQuorum is met, its assumed that disks are in consistent file list.
-	// exclude disks those are not in consistent file list and check count of remaining disks
-	// are met readQuorum.
-
-	// Treat empty file list specially
-	emptyCount := 0
-	errCount := 0
-	successCount := 0
-
-	var firstFilesInfo []FileInfo
-	var firstEOF bool
-	var firstErr error
-
-	for _, disk := range xl.storageDisks {
-		if filesInfo, eof, err = listFiles(disk, volume, prefix, marker, recursive, count); err == nil {
-			// we need to return first successful result
-			if firstFilesInfo == nil {
-				firstFilesInfo = filesInfo
-				firstEOF = eof
-			}
-
-			if len(filesInfo) == 0 {
-				emptyCount++
-			} else {
-				successCount++
-			}
-		} else {
-			if firstErr == nil {
-				firstErr = err
-			}
-
-			errCount++
-		}
-	}
-
-	if errCount >= xl.readQuorum {
-		return nil, false, firstErr
-	} else if successCount >= xl.readQuorum {
-		return firstFilesInfo, firstEOF, nil
-	} else if emptyCount >= xl.readQuorum {
-		return []FileInfo{}, true, nil
-	}
-
-	return nil, false, errReadQuorum
-}
-
 func listFiles(disk StorageAPI, volume, prefix, marker string, recursive bool, count int) (filesInfo []FileInfo, eof bool, err error) {
 	var fsFilesInfo []FileInfo
-	var markerPath = marker
-	if marker != "" {
-		isLeaf := isLeafDirectory(disk, volume, retainSlash(marker))
-		if isLeaf {
-			// For leaf for now we just point to the first block, make it
-			// dynamic in future based on the availability of storage disks.
-			markerPath = slashpath.Join(marker, xlMetaV1File)
-		}
-	}
+	var markerPath = listMarkerPath(disk, volume, marker)
 
 	// Loop and capture the proper fileInfos, requires extraction and
 	// separation of XL related metadata information.
@@ -548,36 +568,12 @@ func listFiles(disk StorageAPI, volume, prefix, marker string, recursive bool, c
 			return nil, true, err
 		}
 		for _, fsFileInfo := range fsFilesInfo {
-			// Skip metadata files.
-			if strings.HasSuffix(fsFileInfo.Name, xlMetaV1File) {
-				continue
-			}
-			var fileInfo FileInfo
-			var isLeaf bool
-			if fsFileInfo.Mode.IsDir() {
-				isLeaf = isLeafDirectory(disk, volume, fsFileInfo.Name)
+			fileInfo, ok, err := extractListEntry(disk, volume, fsFileInfo)
+			if err != nil {
+				return nil, true, err
 			}
-			if isLeaf || !fsFileInfo.Mode.IsDir() {
-				// Extract the parent of leaf directory or file to get the
-				// actual name.
-				path := slashpath.Dir(fsFileInfo.Name)
-				fileInfo, err = extractFileInfo(disk, volume, path)
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"volume": volume,
-						"path":   path,
-					}).Errorf("extractFileInfo failed with %s", err)
-					// For a leaf directory, if err is FileNotFound then
-					// perhaps has a missing metadata. Ignore it and let
-					// healing finish its job it will become available soon.
-					if err == errFileNotFound {
-						continue
-					}
-					// For any other errors return to the caller.
-					return nil, true, err
-				}
-			} else {
-				fileInfo = fsFileInfo
+			if !ok {
+				continue
 			}
 			filesInfo = append(filesInfo, fileInfo)
 			count--
@@ -589,35 +585,6 @@ func listFiles(disk StorageAPI, volume, prefix, marker string, recursive bool, c
 			// markerPath for the next disk.ListFiles() iteration.
 			markerPath = fsFilesInfo[len(fsFilesInfo)-1].Name
 		}
-		if count == 0 && recursive && !strings.HasSuffix(markerPath, xlMetaV1File) {
-			// If last entry is not file.json then loop once more to check if we have reached eof.
-			fsFilesInfo, eof, err = disk.ListFiles(volume, prefix, markerPath, recursive, 1)
-			if err != nil {
-				log.WithFields(logrus.Fields{
-					"volume":    volume,
-					"prefix":    prefix,
-					"marker":    markerPath,
-					"recursive": recursive,
-					"count":     1,
-				}).Errorf("ListFiles failed with %s", err)
-				return nil, true, err
-			}
-			if !eof {
-				// file.N and file.json are always in pairs and hence this
-				// entry has to be file.json. If not better to manually investigate
-				// and fix it.
-				// For the next ListFiles() call we can safely assume that the
-				// marker is "object/file.json"
-				if !strings.HasSuffix(fsFilesInfo[0].Name, xlMetaV1File) {
-					log.WithFields(logrus.Fields{
-						"volume":          volume,
-						"prefix":          prefix,
-						"fsFileInfo.Name": fsFilesInfo[0].Name,
-					}).Errorf("ListFiles failed with %s, expected %s to be a file.json file.", err, fsFilesInfo[0].Name)
-					return nil, true, errUnexpected
-				}
-			}
-		}
 		if count == 0 || eof {
 			break
 		}
@@ -627,6 +594,53 @@ func listFiles(disk StorageAPI, volume, prefix, marker string, recursive bool, c
 	return filesInfo, eof, nil
 }
 
+// listMarkerPath - returns the path on disk to list from for marker,
+// objects are listed from their metadata file.
+func listMarkerPath(disk StorageAPI, volume, marker string) string {
+	if marker != "" && isLeafDirectory(disk, volume, retainSlash(marker)) {
+		// For leaf for now we just point to the first block, make it
+		// dynamic in future based on the availability of storage disks.
+		return slashpath.Join(marker, xlMetaV1File)
+	}
+	return marker
+}
+
+// extractListEntry - converts an entry listed on disk to the entry
+// listed by XL, ok is false for entries which are not listed.
+func extractListEntry(disk StorageAPI, volume string, fsFileInfo FileInfo) (fileInfo FileInfo, ok bool, err error) {
+	// Files are listed by their metadata file, skip part
+	// files. Files saved inline have no part files.
+	if !fsFileInfo.Mode.IsDir() && slashpath.Base(fsFileInfo.Name) != xlMetaV1File {
+		return FileInfo{}, false, nil
+	}
+	var isLeaf bool
+	if fsFileInfo.Mode.IsDir() {
+		isLeaf = isLeafDirectory(disk, volume, fsFileInfo.Name)
+	}
+	if !isLeaf && fsFileInfo.Mode.IsDir() {
+		return fsFileInfo, true, nil
+	}
+	// Extract the parent of leaf directory or file to get the
+	// actual name.
+	path := slashpath.Dir(fsFileInfo.Name)
+	fileInfo, err = extractFileInfo(disk, volume, path)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("extractFileInfo failed with %s", err)
+		// For a leaf directory, if err is FileNotFound then
+		// perhaps has a missing metadata. Ignore it and let
+		// healing finish its job it will become available soon.
+		if err == errFileNotFound {
+			return FileInfo{}, false, nil
+		}
+		// For any other errors return to the caller.
+		return FileInfo{}, false, err
+	}
+	return fileInfo, true, nil
+}
+
 // Object API.
 
 // StatFile - stat a file
@@ -639,9 +653,9 @@ func (xl XL) StatFile(volume, path string) (FileInfo, error) {
 	}
 
 	// Acquire read lock.
-	nsMutex.RLock(volume, path)
+	dLock := nsMutex.RLock(volume, path)
 	_, metadata, heal, err := xl.listOnlineDisks(volume, path)
-	nsMutex.RUnlock(volume, path)
+	nsMutex.RUnlock(volume, path, dLock)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"volume": volume,
@@ -653,7 +667,7 @@ func (xl XL) StatFile(volume, path string) (FileInfo, error) {
 	if heal {
 		// Heal in background safely, since we already have read quorum disks.
 		go func() {
-			if err = xl.healFile(volume, path); err != nil {
+			if err = xl.background().healFile(volume, path); err != nil {
 				log.WithFields(logrus.Fields{
 					"volume": volume,
 					"path":   path,
@@ -683,134 +697,98 @@ func (xl XL) DeleteFile(volume, path string) error {
 	}
 
 	// Lock right before reading from disk.
-	nsMutex.RLock(volume, path)
+	dLock := nsMutex.RLock(volume, path)
 	partsMetadata, errs := xl.getPartsMetadata(volume, path)
-	nsMutex.RUnlock(volume, path)
-
-	var err error
+	nsMutex.RUnlock(volume, path, dLock)
 
 	// List all the file versions on existing files.
 	versions := listFileVersions(partsMetadata, errs)
 	// Get highest file version.
 	higherVersion := highestInt(versions)
 
-	// find online disks and meta data of higherVersion
-	var mdata *xlMetaV1
+	// find online disks and the meta data agreed on by most disks.
 	onlineDiskCount := 0
-	for index, metadata := range partsMetadata {
-		if errs[index] == nil {
+	for _, err := range errs {
+		if err == nil {
 			onlineDiskCount++
-			if metadata.Stat.Version == higherVersion && mdata == nil {
-				mdata = &metadata
-			}
 		}
 	}
+	metadata, _, agreedCount := reduceMetadata(partsMetadata, errs)
+	mdata := &metadata
 
-	// return error if mdata is empty or onlineDiskCount doesn't meet write quorum
-	if mdata == nil || onlineDiskCount < xl.writeQuorum {
+	// return error if no meta data reaches read quorum or onlineDiskCount doesn't meet write quorum
+	if agreedCount < xl.readQuorum || onlineDiskCount < xl.writeQuorum {
 		return errWriteQuorum
 	}
 
 	// Increment to have next higher version.
 	higherVersion++
 
-	xlMetaV1FilePath := slashpath.Join(path, xlMetaV1File)
 	deleteMetaData := (onlineDiskCount == len(xl.storageDisks))
 
 	// Set higher version to indicate file operation
 	mdata.Stat.Version = higherVersion
 	mdata.Stat.Deleted = true
+	// Shards saved inline are deleted along with the file.
+	mdata.Data = nil
 
-	nsMutex.Lock(volume, path)
-	defer nsMutex.Unlock(volume, path)
-
-	errCount := 0
-	// Update meta data file and remove part file
-	for index, disk := range xl.storageDisks {
+	tmpPath, err := newTmpPath()
+	if err != nil {
+		return err
+	}
+	// Shard files are removed by the commit, the meta data file is
+	// removed too only if deleteMetaData is true, otherwise it is
+	// replaced by the deleted version for the failed disks to be
+	// healed. Failed disks are not operated on.
+	ops := make([]*tmpOp, len(xl.storageDisks))
+	xlMetaV1FilePath := slashpath.Join(tmpPath, xlMetaV1File)
+	updateErrs := xl.fanOutDisks(volume, path, xl.writeQuorum, func(index int, disk StorageAPI) error {
 		// no need to operate on failed disks
 		if errs[index] != nil {
-			errCount++
-			continue
+			return errs[index]
 		}
-
-		// update meta data about delete operation
-		var metadataWriter io.WriteCloser
-		metadataWriter, err = disk.CreateFile(volume, xlMetaV1FilePath)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Errorf("CreateFile failed with %s", err)
-
-			errCount++
-
-			// We can safely allow CreateFile errors up to len(xl.storageDisks) - xl.writeQuorum
-			// otherwise return failure.
-			if errCount <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
+		if deleteMetaData {
+			ops[index] = &tmpOp{
+				Volume: volume,
+				Path:   path,
+				Remove: []string{xlMetaV1File},
 			}
-
-			return err
+			return nil
 		}
 
-		err = mdata.Write(metadataWriter)
+		// update meta data about delete operation
+		err := writeMetadataFile(disk, minioMetaBucket, xlMetaV1FilePath, mdata.diskMetadata(index))
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"volume":    volume,
 				"path":      path,
 				"diskIndex": index,
 			}).Errorf("Writing metadata failed with %s", err)
-
-			errCount++
-
-			// We can safely allow CreateFile errors up to len(xl.storageDisks) - xl.writeQuorum
-			// otherwise return failure.
-			if errCount <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
-			}
-
 			return err
 		}
-
-		erasureFilePart := slashpath.Join(path, fmt.Sprintf("file.%d", index))
-		err = disk.DeleteFile(volume, erasureFilePart)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"volume": volume,
-				"path":   path,
-			}).Errorf("DeleteFile failed with %s", err)
-
-			errCount++
-
-			// We can safely allow CreateFile errors up to len(xl.storageDisks) - xl.writeQuorum
-			// otherwise return failure.
-			if errCount <= len(xl.storageDisks)-xl.writeQuorum {
-				continue
-			}
-
-			return err
+		ops[index] = &tmpOp{
+			Volume: volume,
+			Path:   path,
+			Files:  []string{xlMetaV1File},
 		}
-	}
-
-	// Remove meta data file only if deleteMetaData is true.
-	if deleteMetaData {
-		for index, disk := range xl.storageDisks {
-			// no need to operate on failed disks
-			if errs[index] != nil {
-				continue
-			}
+		return nil
+	})
 
-			err = disk.DeleteFile(volume, xlMetaV1FilePath)
-			if err != nil {
-				// No need to return the error as we updated the meta data file previously
-				log.WithFields(logrus.Fields{
-					"volume": volume,
-					"path":   path,
-				}).Errorf("DeleteFile failed with %s", err)
-			}
-		}
+	// We can safely allow errors up to len(xl.storageDisks) - xl.writeQuorum
+	// otherwise return failure.
+	if countDiskErrs(updateErrs) > len(xl.storageDisks)-xl.writeQuorum {
+		xl.purgeTmpOp(volume, path, tmpPath)
+		return errWriteQuorum
 	}
 
+	err = xl.commitTmpOp(volume, path, tmpPath, ops)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"volume": volume,
+			"path":   path,
+		}).Errorf("Committing delete failed with %s", err)
+		return err
+	}
 	return nil
 }
 
@@ -829,8 +807,12 @@ func (xl XL) RenameFile(srcVolume, srcPath, dstVolume, dstPath string) error {
 	if !isValidPath(dstPath) {
 		return errInvalidArgument
 	}
-	for _, disk := range xl.storageDisks {
-		if err := disk.RenameFile(srcVolume, srcPath, dstVolume, dstPath); err != nil {
+	// Rename on all disks, any failure is returned.
+	errs := xl.fanOutDisks(srcVolume, srcPath, len(xl.storageDisks), func(index int, disk StorageAPI) error {
+		return disk.RenameFile(srcVolume, srcPath, dstVolume, dstPath)
+	})
+	for _, err := range errs {
+		if err != nil && err != errDiskPending {
 			log.WithFields(logrus.Fields{
 				"srcVolume": srcVolume,
 				"srcPath":   srcPath,
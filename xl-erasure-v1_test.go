@@ -0,0 +1,141 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Tests data and parity blocks and quorums of XL.
+func TestNewXLParity(t *testing.T) {
+	savedConfig := serverConfig
+	defer func() {
+		serverConfig = savedConfig
+	}()
+	serverConfig = &serverConfigV6{rwMutex: &sync.RWMutex{}}
+
+	testCases := []struct {
+		totalDisks   int
+		parityBlocks int
+		dataBlocks   int
+		readQuorum   int
+		writeQuorum  int
+		err          error
+	}{
+		// Default parity is half the disks.
+		{4, 0, 2, 2, 3, nil},
+		{5, 0, 3, 3, 3, nil},
+		{8, 0, 4, 4, 5, nil},
+		{12, 4, 8, 8, 8, nil},
+		{12, 2, 10, 10, 10, nil},
+		{6, 1, 5, 5, 5, nil},
+		{6, 4, 0, 0, 0, errParityBlocks},
+		{6, -1, 0, 0, 0, errParityBlocks},
+		{17, 0, 0, 0, 0, errMaxDisks},
+	}
+	for i, testCase := range testCases {
+		var disks []string
+		for j := 0; j < testCase.totalDisks; j++ {
+			disk, err := ioutil.TempDir("", "minio-xl-parity-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(disk)
+			disks = append(disks, disk)
+		}
+		serverConfig.SetErasure(erasureConfig{ParityBlocks: testCase.parityBlocks})
+		storage, err := newXL(disks...)
+		if err != testCase.err {
+			t.Errorf("Test %d: expected error %v, got %v", i+1, testCase.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		xl := storage.(*XL)
+		if xl.DataBlocks != testCase.dataBlocks || xl.ParityBlocks != testCase.totalDisks-testCase.dataBlocks {
+			t.Errorf("Test %d: expected %d data blocks, got %d+%d", i+1, testCase.dataBlocks, xl.DataBlocks, xl.ParityBlocks)
+		}
+		if xl.readQuorum != testCase.readQuorum || xl.writeQuorum != testCase.writeQuorum {
+			t.Errorf("Test %d: expected quorums %d/%d, got %d/%d", i+1, testCase.readQuorum, testCase.writeQuorum, xl.readQuorum, xl.writeQuorum)
+		}
+	}
+}
+
+// Tests files keep their layout after parity is changed.
+func TestXLParityChange(t *testing.T) {
+	initNSLock()
+	savedConfig := serverConfig
+	defer func() {
+		serverConfig = savedConfig
+	}()
+	serverConfig = &serverConfigV6{rwMutex: &sync.RWMutex{}}
+
+	var disks []string
+	for i := 0; i < 6; i++ {
+		disk, err := ioutil.TempDir("", "minio-xl-parity-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(disk)
+		disks = append(disks, disk)
+	}
+	objAPI, err := newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("hello world"), 1024)
+	if err = objAPI.MakeBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = objAPI.PutObject("bucket", "object", int64(len(data)), bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig.SetErasure(erasureConfig{ParityBlocks: 2})
+	objAPI, err = newXLObjects(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xl, _ := getXLStorage(objAPI)
+	if xl.DataBlocks != 4 || xl.ParityBlocks != 2 {
+		t.Fatalf("Expected 4 data and 2 parity blocks, got %d+%d", xl.DataBlocks, xl.ParityBlocks)
+	}
+	reader, err := objAPI.GetObject("bucket", "object", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("Expected object written with previous layout to be readable")
+	}
+	_, metadata, _, err := xl.listOnlineDisks("bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Erasure.DataBlocks != 3 || metadata.Erasure.ParityBlocks != 3 {
+		t.Fatalf("Expected stored layout of 3 data and 3 parity blocks, got %d+%d", metadata.Erasure.DataBlocks, metadata.Erasure.ParityBlocks)
+	}
+}
@@ -17,7 +17,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"path"
@@ -387,54 +386,43 @@ func (xl xlObjects) CompleteMultipartUpload(bucket string, object string, upload
 	} else if !status {
 		return "", (InvalidUploadID{UploadID: uploadID})
 	}
-	sort.Sort(completedParts(parts))
-	var metadata MultipartObjectInfo
-	for _, part := range parts {
-		partSuffix := fmt.Sprintf("%s.%.5d.%s", uploadID, part.PartNumber, part.ETag)
-		fi, err := xl.storage.StatFile(minioMetaBucket, path.Join(bucket, object, partSuffix))
-		if err != nil {
-			return "", err
-		}
-		metadata = append(metadata, MultipartPartInfo{part.PartNumber, part.ETag, fi.Size})
+	storage, ok := xl.storage.(partsStorage)
+	if !ok {
+		return "", toObjectErr(errUnexpected, bucket, object)
 	}
+	sort.Sort(completedParts(parts))
+	var partPaths []string
 	var md5Sums []string
 	for _, part := range parts {
 		// Construct part suffix.
 		partSuffix := fmt.Sprintf("%s.%.5d.%s", uploadID, part.PartNumber, part.ETag)
-		err := xl.storage.RenameFile(minioMetaBucket, path.Join(bucket, object, partSuffix), bucket, path.Join(object, partNumToPartFileName(part.PartNumber)))
-		// We need a way to roll back if of the renames failed.
-		if err != nil {
-			return "", err
-		}
+		partPaths = append(partPaths, path.Join(bucket, object, partSuffix))
 		md5Sums = append(md5Sums, part.ETag)
 	}
-
-	if w, err := xl.storage.CreateFile(bucket, pathJoin(object, multipartMetaFile)); err == nil {
-		var b []byte
-		b, err = json.Marshal(metadata)
-		if err != nil {
-			return "", err
-		}
-		_, err = w.Write(b)
-		if err != nil {
-			return "", err
-		}
-		// Close the writer.
-		if err = w.Close(); err != nil {
-			return "", err
-		}
-	} else {
-		return "", toObjectErr(err, bucket, object)
-	}
-	if err := xl.storage.DeleteFile(minioMetaBucket, path.Join(bucket, object, uploadID)); err != nil {
-		return "", toObjectErr(err, bucket, object)
-	}
 	// Save the s3 md5.
 	s3MD5, err := makeS3MD5(md5Sums...)
 	if err != nil {
 		return "", err
 	}
 
+	// Parts are moved into place as they were written, the object is
+	// committed by writing its metadata only.
+	if err = storage.CommitParts(bucket, object, partPaths); err != nil {
+		if err == errFileNotFound {
+			return "", InvalidPart{}
+		}
+		return "", toObjectErr(err, bucket, object)
+	}
+
+	// Cleanup the upload and the parts left out of the object.
+	if err = abortMultipartUploadCommon(xl.storage, bucket, object, uploadID); err != nil {
+		log.WithFields(logrus.Fields{
+			"bucket":   bucket,
+			"object":   object,
+			"uploadID": uploadID,
+		}).Errorf("Cleaning up multipart upload failed with %s", err)
+	}
+
 	// Return md5sum.
 	return s3MD5, nil
 }
@@ -0,0 +1,348 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+const (
+	// Minimum number of disks in an erasure set.
+	minSetDisks = 4
+)
+
+// errSetDisks - returned when disks can not be split into erasure sets.
+var errSetDisks = errors.New("Total number of disks should be divisible by a set size between '4' and '16'")
+
+// xlSets - implements object layer on top of erasure sets, each set
+// is an independent XL of a fixed number of disks. Objects are placed
+// on a set by the hash of their name, bucket operations apply to all
+// the sets.
+type xlSets struct {
+	sets []xlObjects
+}
+
+// getSetDisks - returns the largest set size which divides the disks
+// evenly.
+func getSetDisks(totalDisks int) (int, error) {
+	for setDisks := maxErasureBlocks; setDisks >= minSetDisks; setDisks-- {
+		if totalDisks%setDisks == 0 {
+			return setDisks, nil
+		}
+	}
+	return 0, errSetDisks
+}
+
+// newXLSets - initialize new xl object layer on erasure sets.
+func newXLSets(exportPaths ...string) (ObjectLayer, error) {
+	setDisks, err := getSetDisks(len(exportPaths))
+	if err != nil {
+		return nil, err
+	}
+	var sets []xlObjects
+	for index := 0; index < len(exportPaths); index += setDisks {
+		storage, err := newXL(exportPaths[index : index+setDisks]...)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, xlObjects{storage})
+	}
+	return xlSets{sets}, nil
+}
+
+// getHashedSet - returns the set an object is placed on.
+func (s xlSets) getHashedSet(object string) xlObjects {
+	return s.sets[crc32.ChecksumIEEE([]byte(object))%uint32(len(s.sets))]
+}
+
+// quorum - number of sets a bucket operation should succeed on.
+func (s xlSets) quorum() int {
+	return len(s.sets)/2 + 1
+}
+
+// reduceSetErrs - returns nil if at least quorum sets succeeded,
+// otherwise the most common error.
+func reduceSetErrs(errs []error, quorum int) error {
+	successCount := 0
+	errCounts := make(map[string]int)
+	var maxErr error
+	for _, err := range errs {
+		if err == nil {
+			successCount++
+			continue
+		}
+		errCounts[err.Error()]++
+		if maxErr == nil || errCounts[err.Error()] > errCounts[maxErr.Error()] {
+			maxErr = err
+		}
+	}
+	if successCount >= quorum {
+		return nil
+	}
+	return maxErr
+}
+
+/// Bucket operations
+
+// MakeBucket - make a bucket on all the sets, the bucket is removed
+// again if it could not be created on quorum sets.
+func (s xlSets) MakeBucket(bucket string) error {
+	errs := make([]error, len(s.sets))
+	for index, set := range s.sets {
+		errs[index] = set.MakeBucket(bucket)
+	}
+	err := reduceSetErrs(errs, s.quorum())
+	if err == nil {
+		return nil
+	}
+	for index, set := range s.sets {
+		if errs[index] == nil {
+			set.DeleteBucket(bucket)
+		}
+	}
+	return err
+}
+
+// GetBucketInfo - get bucket info, bucket should exist on quorum sets.
+func (s xlSets) GetBucketInfo(bucket string) (BucketInfo, error) {
+	var bucketInfo BucketInfo
+	errs := make([]error, len(s.sets))
+	for index, set := range s.sets {
+		var info BucketInfo
+		info, errs[index] = set.GetBucketInfo(bucket)
+		if errs[index] == nil && bucketInfo.Name == "" {
+			bucketInfo = info
+		}
+	}
+	if err := reduceSetErrs(errs, s.quorum()); err != nil {
+		return BucketInfo{}, err
+	}
+	return bucketInfo, nil
+}
+
+// ListBuckets - list buckets of all the sets.
+func (s xlSets) ListBuckets() ([]BucketInfo, error) {
+	bucketsMap := make(map[string]BucketInfo)
+	errs := make([]error, len(s.sets))
+	for index, set := range s.sets {
+		var buckets []BucketInfo
+		buckets, errs[index] = set.ListBuckets()
+		for _, bucket := range buckets {
+			if _, ok := bucketsMap[bucket.Name]; !ok {
+				bucketsMap[bucket.Name] = bucket
+			}
+		}
+	}
+	if err := reduceSetErrs(errs, s.quorum()); err != nil {
+		return nil, err
+	}
+	var bucketInfos []BucketInfo
+	for _, bucket := range bucketsMap {
+		bucketInfos = append(bucketInfos, bucket)
+	}
+	sort.Sort(byBucketName(bucketInfos))
+	return bucketInfos, nil
+}
+
+// DeleteBucket - delete a bucket from all the sets, the bucket should
+// be empty on every set.
+func (s xlSets) DeleteBucket(bucket string) error {
+	for _, set := range s.sets {
+		result, err := set.ListObjects(bucket, "", "", "", 1)
+		if err != nil {
+			if _, ok := err.(BucketNotFound); ok {
+				continue
+			}
+			return err
+		}
+		if len(result.Objects) > 0 {
+			return BucketNotEmpty{Bucket: bucket}
+		}
+	}
+	errs := make([]error, len(s.sets))
+	notFoundCount := 0
+	for index, set := range s.sets {
+		errs[index] = set.DeleteBucket(bucket)
+		if _, ok := errs[index].(BucketNotFound); ok {
+			// Bucket missing on a set is already deleted there.
+			notFoundCount++
+			errs[index] = nil
+		}
+	}
+	if notFoundCount == len(s.sets) {
+		return BucketNotFound{Bucket: bucket}
+	}
+	return reduceSetErrs(errs, s.quorum())
+}
+
+// ListObjects - list objects of all the sets, merges the sorted
+// listing of every set.
+func (s xlSets) ListObjects(bucket, prefix, marker, delimiter string, maxKeys int) (ListObjectsInfo, error) {
+	var objects []ObjectInfo
+	prefixes := make(map[string]struct{})
+	isTruncated := false
+	notFoundCount := 0
+	for _, set := range s.sets {
+		result, err := set.ListObjects(bucket, prefix, marker, delimiter, maxKeys)
+		if err != nil {
+			if _, ok := err.(BucketNotFound); ok {
+				notFoundCount++
+				continue
+			}
+			return ListObjectsInfo{}, err
+		}
+		objects = append(objects, result.Objects...)
+		for _, prefix := range result.Prefixes {
+			prefixes[prefix] = struct{}{}
+		}
+		if result.IsTruncated {
+			isTruncated = true
+		}
+	}
+	if notFoundCount == len(s.sets) {
+		return ListObjectsInfo{}, BucketNotFound{Bucket: bucket}
+	}
+
+	// Objects and prefixes are merged in a single sorted listing,
+	// prefixes are marked as directories.
+	for prefix := range prefixes {
+		objects = append(objects, ObjectInfo{Name: prefix, IsDir: true})
+	}
+	sort.Sort(byObjectName(objects))
+	if len(objects) > maxKeys {
+		objects = objects[:maxKeys]
+		isTruncated = true
+	}
+
+	result := ListObjectsInfo{IsTruncated: isTruncated}
+	for _, object := range objects {
+		// With delimiter set we fill in NextMarker and Prefixes.
+		if delimiter == slashSeparator {
+			result.NextMarker = object.Name
+		}
+		if object.IsDir {
+			result.Prefixes = append(result.Prefixes, object.Name)
+			continue
+		}
+		result.Objects = append(result.Objects, object)
+	}
+	return result, nil
+}
+
+/// Object operations
+
+// GetObject - get an object from its set.
+func (s xlSets) GetObject(bucket, object string, startOffset int64) (io.ReadCloser, error) {
+	return s.getHashedSet(object).GetObject(bucket, object, startOffset)
+}
+
+// GetObjectInfo - get object info from its set.
+func (s xlSets) GetObjectInfo(bucket, object string) (ObjectInfo, error) {
+	return s.getHashedSet(object).GetObjectInfo(bucket, object)
+}
+
+// PutObject - create an object on its set.
+func (s xlSets) PutObject(bucket, object string, size int64, data io.Reader, metadata map[string]string) (string, error) {
+	return s.getHashedSet(object).PutObject(bucket, object, size, data, metadata)
+}
+
+// DeleteObject - delete an object from its set.
+func (s xlSets) DeleteObject(bucket, object string) error {
+	return s.getHashedSet(object).DeleteObject(bucket, object)
+}
+
+/// Multipart operations
+
+// ListMultipartUploads - list multipart uploads of all the sets,
+// merges the sorted listing of every set.
+func (s xlSets) ListMultipartUploads(bucket, prefix, keyMarker, uploadIDMarker, delimiter string, maxUploads int) (ListMultipartsInfo, error) {
+	var uploads []uploadMetadata
+	prefixes := make(map[string]struct{})
+	isTruncated := false
+	for _, set := range s.sets {
+		result, err := set.ListMultipartUploads(bucket, prefix, keyMarker, uploadIDMarker, delimiter, maxUploads)
+		if err != nil {
+			return ListMultipartsInfo{}, err
+		}
+		uploads = append(uploads, result.Uploads...)
+		for _, prefix := range result.CommonPrefixes {
+			prefixes[prefix] = struct{}{}
+		}
+		if result.IsTruncated {
+			isTruncated = true
+		}
+	}
+
+	// Common prefixes are merged with uploads as entries with empty
+	// upload id.
+	for prefix := range prefixes {
+		uploads = append(uploads, uploadMetadata{Object: prefix})
+	}
+	sort.Sort(byObjectUpload(uploads))
+	if len(uploads) > maxUploads {
+		uploads = uploads[:maxUploads]
+		isTruncated = true
+	}
+
+	result := ListMultipartsInfo{
+		MaxUploads:  maxUploads,
+		IsTruncated: isTruncated,
+	}
+	for _, upload := range uploads {
+		if upload.UploadID == "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, upload.Object)
+		} else {
+			result.Uploads = append(result.Uploads, upload)
+		}
+		result.NextKeyMarker = upload.Object
+		result.NextUploadIDMarker = upload.UploadID
+	}
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextUploadIDMarker = ""
+	}
+	return result, nil
+}
+
+// NewMultipartUpload - initialize a new multipart upload on the set
+// of the object.
+func (s xlSets) NewMultipartUpload(bucket, object string) (string, error) {
+	return s.getHashedSet(object).NewMultipartUpload(bucket, object)
+}
+
+// PutObjectPart - writes a part of a multipart upload.
+func (s xlSets) PutObjectPart(bucket, object, uploadID string, partID int, size int64, data io.Reader, md5Hex string) (string, error) {
+	return s.getHashedSet(object).PutObjectPart(bucket, object, uploadID, partID, size, data, md5Hex)
+}
+
+// ListObjectParts - list parts of a multipart upload.
+func (s xlSets) ListObjectParts(bucket, object, uploadID string, partNumberMarker, maxParts int) (ListPartsInfo, error) {
+	return s.getHashedSet(object).ListObjectParts(bucket, object, uploadID, partNumberMarker, maxParts)
+}
+
+// AbortMultipartUpload - aborts a multipart upload.
+func (s xlSets) AbortMultipartUpload(bucket, object, uploadID string) error {
+	return s.getHashedSet(object).AbortMultipartUpload(bucket, object, uploadID)
+}
+
+// CompleteMultipartUpload - completes a multipart upload.
+func (s xlSets) CompleteMultipartUpload(bucket, object, uploadID string, parts []completePart) (string, error) {
+	return s.getHashedSet(object).CompleteMultipartUpload(bucket, object, uploadID, parts)
+}
@@ -0,0 +1,230 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests splitting disks into erasure sets.
+func TestGetSetDisks(t *testing.T) {
+	testCases := []struct {
+		totalDisks int
+		setDisks   int
+		err        error
+	}{
+		{16, 16, nil},
+		{20, 10, nil},
+		{32, 16, nil},
+		{36, 12, nil},
+		{60, 15, nil},
+		{37, 0, errSetDisks},
+		{2, 0, errSetDisks},
+	}
+	for i, testCase := range testCases {
+		setDisks, err := getSetDisks(testCase.totalDisks)
+		if err != testCase.err {
+			t.Errorf("Test %d: expected error %v, got %v", i+1, testCase.err, err)
+			continue
+		}
+		if err == nil && setDisks != testCase.setDisks {
+			t.Errorf("Test %d: expected %d disks per set, got %d", i+1, testCase.setDisks, setDisks)
+		}
+	}
+}
+
+// newTestXLSets - initializes erasure sets on temporary disks, returns
+// the object layer and the disks to be removed.
+func newTestXLSets(t *testing.T, totalDisks int) (xlSets, []string) {
+	var disks []string
+	for i := 0; i < totalDisks; i++ {
+		disk, err := ioutil.TempDir("", "minio-xl-sets-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		disks = append(disks, disk)
+	}
+	objAPI, err := newObjectLayer(disks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, ok := objAPI.(xlSets)
+	if !ok {
+		t.Fatalf("Expected erasure sets for %d disks", totalDisks)
+	}
+	return sets, disks
+}
+
+// removeTestDisks - removes temporary disks.
+func removeTestDisks(disks []string) {
+	for _, disk := range disks {
+		os.RemoveAll(disk)
+	}
+}
+
+// Tests objects are spread over the sets and listings are merged.
+func TestXLSets(t *testing.T) {
+	initNSLock()
+	objAPI, disks := newTestXLSets(t, 20)
+	defer removeTestDisks(disks)
+	if len(objAPI.sets) != 2 {
+		t.Fatalf("Expected 2 sets, got %d", len(objAPI.sets))
+	}
+
+	for _, bucket := range []string{"bucket2", "bucket1"} {
+		if err := objAPI.MakeBucket(bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := objAPI.MakeBucket("bucket1"); err == nil {
+		t.Fatal("Expected error creating an existing bucket")
+	}
+	buckets, err := objAPI.ListBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 || buckets[0].Name != "bucket1" || buckets[1].Name != "bucket2" {
+		t.Fatalf("Expected merged sorted buckets, got %v", buckets)
+	}
+	if _, err = objAPI.GetBucketInfo("bucket1"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello world")
+	var names []string
+	setObjects := make(map[int]int)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("dir%d/object%02d", i%2, i)
+		names = append(names, name)
+		if _, err = objAPI.PutObject("bucket1", name, int64(len(data)), bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		for index, set := range objAPI.sets {
+			if _, err = set.GetObjectInfo("bucket1", name); err == nil {
+				setObjects[index]++
+			}
+		}
+	}
+	if len(setObjects) != 2 || setObjects[0]+setObjects[1] != 20 {
+		t.Fatalf("Expected objects to be placed on exactly one of both sets, got %v", setObjects)
+	}
+	for _, name := range names {
+		reader, err := objAPI.GetObject("bucket1", name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readData, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(readData, data) {
+			t.Fatalf("Unexpected data of %s", name)
+		}
+	}
+
+	// Paginated listing returns all objects in sorted order.
+	var listed []string
+	marker := ""
+	for {
+		result, err := objAPI.ListObjects("bucket1", "dir0/", marker, "", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, object := range result.Objects {
+			listed = append(listed, object.Name)
+			marker = object.Name
+		}
+		if !result.IsTruncated {
+			break
+		}
+	}
+	if len(listed) != 10 {
+		t.Fatalf("Expected 10 objects, got %v", listed)
+	}
+	for i, name := range listed {
+		if expected := fmt.Sprintf("dir0/object%02d", i*2); name != expected {
+			t.Fatalf("Expected %s, got %s", expected, name)
+		}
+	}
+
+	// Common prefixes present on both sets are listed once.
+	result, err := objAPI.ListObjects("bucket1", "", "", slashSeparator, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Prefixes) != 2 || result.Prefixes[0] != "dir0/" || result.Prefixes[1] != "dir1/" {
+		t.Fatalf("Expected merged prefixes, got %v", result.Prefixes)
+	}
+
+	// Multipart uploads of all the sets are listed.
+	for _, name := range names[:4] {
+		if _, err = objAPI.NewMultipartUpload("bucket1", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uploads, err := objAPI.ListMultipartUploads("bucket1", "", "", "", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads.Uploads) != 4 {
+		t.Fatalf("Expected 4 uploads, got %v", uploads.Uploads)
+	}
+	for i, upload := range uploads.Uploads[1:] {
+		if upload.Object < uploads.Uploads[i].Object {
+			t.Fatalf("Expected sorted uploads, got %v", uploads.Uploads)
+		}
+	}
+
+	// Non empty bucket can not be deleted from any set.
+	if err = objAPI.DeleteBucket("bucket1"); err == nil {
+		t.Fatal("Expected error deleting a non empty bucket")
+	}
+	if err = objAPI.DeleteBucket("bucket2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = objAPI.GetBucketInfo("bucket2"); err == nil {
+		t.Fatal("Expected deleted bucket to be not found")
+	}
+	if err = objAPI.DeleteBucket("bucket2"); err == nil {
+		t.Fatal("Expected error deleting a missing bucket")
+	}
+}
+
+// Tests bucket operations reduce errors of the sets with quorum.
+func TestReduceSetErrs(t *testing.T) {
+	errNotFound := BucketNotFound{Bucket: "bucket"}
+	testCases := []struct {
+		errs   []error
+		quorum int
+		err    error
+	}{
+		{[]error{nil, nil, nil}, 2, nil},
+		{[]error{nil, errNotFound, nil}, 2, nil},
+		{[]error{errNotFound, errNotFound, nil}, 2, errNotFound},
+		{[]error{errDiskFull, errNotFound, errNotFound}, 2, errNotFound},
+	}
+	for i, testCase := range testCases {
+		if err := reduceSetErrs(testCase.errs, testCase.quorum); err != testCase.err {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.err, err)
+		}
+	}
+}